@@ -18,6 +18,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"text/template"
@@ -68,10 +69,36 @@ type buildctx struct {
 	// the resolved package name like expat-amd64-2.2.6-1.
 	substituteCache map[string]string
 
+	// squashfsOpts configures the SquashFS writer for the resulting package
+	// images, e.g. to enable compression.
+	squashfsOpts []squashfs.WriterOption
+
+	// Reproducible is set if builds should be bit-for-bit reproducible, in
+	// which case SourceDateEpoch (in seconds since the Unix epoch) is exported
+	// to the build steps and used for the resulting package images.
+	Reproducible    bool
+	SourceDateEpoch int64
+
 	artifactWriter io.Writer
 }
 
-func buildpkg(hermetic, debug, fuse bool, cross, remote string, artifactFd int) error {
+// sourceDateEpoch returns the time specified in the SOURCE_DATE_EPOCH
+// environment variable (see
+// https://reproducible-builds.org/specs/source-date-epoch/), or the Unix epoch
+// if SOURCE_DATE_EPOCH is not set.
+func sourceDateEpoch() (time.Time, error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Unix(0, 0), nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, xerrors.Errorf("invalid SOURCE_DATE_EPOCH: %v", err)
+	}
+	return time.Unix(sec, 0), nil
+}
+
+func buildpkg(hermetic, debug, fuse bool, cross, remote, compression string, reproducible bool, artifactFd int) error {
 	c, err := ioutil.ReadFile("build.textproto")
 	if err != nil {
 		return err
@@ -90,6 +117,19 @@ func buildpkg(hermetic, debug, fuse bool, cross, remote string, artifactFd int)
 		cross = "amd64" // TODO: configurable / auto-detect
 	}
 
+	squashfsOpts, err := squashfsWriterOptions(compression)
+	if err != nil {
+		return err
+	}
+	var epoch time.Time
+	if reproducible {
+		epoch, err = sourceDateEpoch()
+		if err != nil {
+			return err
+		}
+		squashfsOpts = append(squashfsOpts, squashfs.WithSourceDateEpoch(epoch))
+	}
+
 	b := &buildctx{
 		Proto:          &buildProto,
 		PkgDir:         pwd,
@@ -99,8 +139,13 @@ func buildpkg(hermetic, debug, fuse bool, cross, remote string, artifactFd int)
 		Hermetic:       hermetic,
 		FUSE:           fuse,
 		Debug:          debug,
+		squashfsOpts:   squashfsOpts,
 		artifactWriter: ioutil.Discard,
 	}
+	if reproducible {
+		b.Reproducible = true
+		b.SourceDateEpoch = epoch.Unix()
+	}
 
 	if artifactFd > -1 {
 		b.artifactWriter = os.NewFile(uintptr(artifactFd), "")
@@ -342,6 +387,7 @@ func buildpkg(hermetic, debug, fuse bool, cross, remote string, artifactFd int)
 				SourcePkg:    proto.String(b.Pkg),
 				Version:      proto.String(b.Version),
 				RuntimeUnion: unions,
+				ExchangeDir:  b.Proto.GetExchangeDir(),
 			})
 			fn := filepath.Join("../distri/pkg/" + fullName + ".meta.textproto")
 			b.artifactWriter.Write([]byte("build/" + strings.TrimPrefix(fn, "../") + "\n"))
@@ -485,7 +531,7 @@ func (b *buildctx) pkg() error {
 			return err
 		}
 		defer f.Cleanup()
-		w, err := squashfs.NewWriter(f, time.Now())
+		w, err := squashfs.NewWriter(f, time.Now(), b.squashfsOpts...)
 		if err != nil {
 			return err
 		}
@@ -652,6 +698,9 @@ func (b *buildctx) env(deps []string, hermetic bool) []string {
 		"PERL5LIB=" + strings.Join(perl5Dirs, ":") + ifNotHermetic(":$PERL5LIB"),                   // for perl
 		"PYTHONPATH=" + strings.Join(pythonDirs, ":") + ifNotHermetic(":$PYTHONPATH"),
 	}
+	if b.Reproducible {
+		env = append(env, fmt.Sprintf("SOURCE_DATE_EPOCH=%d", b.SourceDateEpoch)) // for compilers, documentation generators, etc.
+	}
 	// Exclude LDFLAGS for glibc as per
 	// https://github.com/Linuxbrew/legacy-linuxbrew/issues/126
 	if b.Pkg != "glibc" && b.Pkg != "glibc-i686" {
@@ -914,6 +963,38 @@ func (b *buildctx) builddeps(p *pb.Build) ([]string, error) {
 	return resolve(env.DefaultRepo, deps, "")
 }
 
+// defaultBuildOverlays are the exchange directories which are provided to
+// builds in addition to the exchange directories declared by build
+// dependencies. Not all of cmdfuse.ExchangeDirs are useful for builds, e.g.
+// /debug is not.
+var defaultBuildOverlays = []string{
+	"/bin",
+	"/out/lib/pkgconfig",
+	"/out/include",
+	"/out/share/aclocal",
+	"/out/share/gir-1.0",
+	"/out/share/mime",
+	"/out/gopath",
+	"/out/lib/gio",
+	"/out/lib/girepository-1.0",
+	"/out/share/gettext",
+	"/out/lib",
+}
+
+// buildOverlays returns the exchange directories to provide to a build with
+// the specified (resolved) build dependencies.
+func buildOverlays(deps []string) ([]string, error) {
+	metas := make([]*pb.Meta, 0, len(deps))
+	for _, dep := range deps {
+		meta, err := pb.ReadMetaFile(filepath.Join(env.DefaultRepo, dep+".meta.textproto"))
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, meta)
+	}
+	return cmdfuse.DeclaredExchangeDirs(defaultBuildOverlays, metas...), nil
+}
+
 func fuseMkdirAll(ctl string, dir string) error {
 	ctl, err := os.Readlink(ctl)
 	if err != nil {
@@ -1000,7 +1081,11 @@ func (b *buildctx) build() (*pb.Meta, error) {
 		}
 
 		if b.FUSE {
-			if _, err = cmdfuse.Mount([]string{"-overlays=/bin,/out/lib/pkgconfig,/out/include,/out/share/aclocal,/out/share/gir-1.0,/out/share/mime,/out/gopath,/out/lib/gio,/out/lib/girepository-1.0,/out/share/gettext,/out/lib", "-pkgs=" + strings.Join(deps, ","), depsdir}); err != nil {
+			overlays, err := buildOverlays(deps)
+			if err != nil {
+				return nil, err
+			}
+			if _, err = cmdfuse.Mount([]string{"-overlays=" + strings.Join(overlays, ","), "-pkgs=" + strings.Join(deps, ","), depsdir}); err != nil {
 				return nil, xerrors.Errorf("cmdfuse.Mount: %v", err)
 			}
 			defer fuse.Unmount(depsdir)
@@ -2383,6 +2468,14 @@ func build(args []string) error {
 		pkg = fset.String("pkg",
 			"",
 			"If non-empty, a package to build. Otherwise inferred from $PWD")
+
+		compression = fset.String("compression",
+			"",
+			"If non-empty, compress data blocks of the resulting SquashFS images using the specified compressor (zlib or lz4)")
+
+		reproducible = fset.Bool("reproducible",
+			os.Getenv("SOURCE_DATE_EPOCH") != "",
+			"Produce bit-for-bit reproducible SquashFS images: clamp modification times to $SOURCE_DATE_EPOCH (0 if unset) and normalize permissions. Enabled by default if $SOURCE_DATE_EPOCH is set")
 	)
 	fset.Usage = usage(fset, buildHelp)
 	fset.Parse(args)
@@ -2414,7 +2507,7 @@ func build(args []string) error {
 		return err
 	}
 
-	if err := buildpkg(*hermetic, *debug, *fuse, *cross, *remote, *artifactFd); err != nil {
+	if err := buildpkg(*hermetic, *debug, *fuse, *cross, *remote, *compression, *reproducible, *artifactFd); err != nil {
 		return err
 	}
 
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/distr1/distri/internal/squashfs"
+	"github.com/distr1/distri/pb"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/unix"
+)
+
+// writeFixturePackage populates a destination directory for the package
+// hello-amd64-1 (as left behind by a build) and returns its DestDir. The
+// variant determines file modification times, permissions (as if built with
+// a different umask), whether owners were set explicitly and the order in which
+// xattrs were set.
+func writeFixturePackage(t *testing.T, tmp string, variant int) string {
+	t.Helper()
+	destDir := filepath.Join(tmp, "dest", "tmp")
+	out := filepath.Join(tmp, "dest", "hello-amd64-1", "out")
+	for _, dir := range []string{"bin", "lib", "share/doc/hello"} {
+		if err := os.MkdirAll(filepath.Join(out, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	umask := []os.FileMode{0022, 0002}[variant%2]
+	files := []struct {
+		path     string
+		contents string
+		perm     os.FileMode
+	}{
+		{"bin/hello", "#!/bin/sh\necho hello\n", 0777},
+		{"lib/libhello.so.1", "ELF", 0777},
+		{"share/doc/hello/README", "hello, world\n", 0666},
+	}
+	mtime := time.Now().Add(time.Duration(variant) * time.Hour)
+	for _, f := range files {
+		fn := filepath.Join(out, f.path)
+		if err := ioutil.WriteFile(fn, []byte(f.contents), f.perm&^umask); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(fn, f.perm&^umask); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(fn, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("libhello.so.1", filepath.Join(out, "lib", "libhello.so")); err != nil {
+		t.Fatal(err)
+	}
+	if variant%2 == 1 {
+		// Files owned by the build user are owned by root within the image:
+		for _, f := range []string{"lib/libhello.so", "share/doc/hello", "share/doc/hello/README"} {
+			if err := os.Lchown(filepath.Join(out, f), os.Getuid(), os.Getgid()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if os.Getuid() == 0 {
+		// Dedicated owners are kept (only root can change owners):
+		if err := os.Lchown(filepath.Join(out, "bin", "hello"), 0, fixtureGid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	attrs := fixtureXattrs()
+	if variant%2 == 1 {
+		for i, j := 0, len(attrs)-1; i < j; i, j = i+1, j-1 {
+			attrs[i], attrs[j] = attrs[j], attrs[i]
+		}
+	}
+	for _, attr := range attrs {
+		err := unix.Setxattr(filepath.Join(out, "bin", "hello"), attr.FullName, attr.Value, 0)
+		if err == unix.ENOTSUP {
+			break // xattrs are best-effort: the file system might not support them
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return destDir
+}
+
+// fixtureGid is the group owning bin/hello when running as root, like the utmp
+// group owns utempter.
+const fixtureGid = 22
+
+// fixtureXattrs returns the xattrs which writeFixturePackage sets on bin/hello,
+// in the order in which they are stored in the image.
+func fixtureXattrs() []squashfs.Xattr {
+	attrs := []squashfs.Xattr{
+		{Type: squashfs.XattrTypeUser, FullName: "user.a", Value: []byte("user.a")},
+		{Type: squashfs.XattrTypeUser, FullName: "user.b", Value: []byte("user.b")},
+	}
+	if os.Getuid() == 0 {
+		// Only root can set file capabilities:
+		attrs = append(attrs, squashfs.Xattr{
+			Type:     squashfs.XattrTypeSecurity,
+			FullName: "security.capability",
+			Value:    []byte{1, 0, 0, 2, 0, 32, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		})
+	}
+	return attrs
+}
+
+// supportsXattrs reports whether the file system of dir supports user xattrs.
+func supportsXattrs(t *testing.T, dir string) bool {
+	t.Helper()
+	fn := filepath.Join(dir, "xattr")
+	if err := ioutil.WriteFile(fn, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fn)
+	return unix.Setxattr(fn, "user.test", []byte("test"), 0) != unix.ENOTSUP
+}
+
+func TestReproducibleImages(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	epoch := time.Unix(1500000000, 0)
+	var hashes [][sha256.Size]byte
+	for variant := 0; variant < 2; variant++ {
+		tmp, err := ioutil.TempDir("", "distri-reproducible")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tmp)
+		// buildctx.pkg writes images relative to the package build directory.
+		pkgbuilddir := filepath.Join(tmp, "build", "hello")
+		for _, dir := range []string{pkgbuilddir, filepath.Join(tmp, "build", "distri", "pkg")} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Chdir(pkgbuilddir); err != nil {
+			t.Fatal(err)
+		}
+
+		b := &buildctx{
+			Proto:          &pb.Build{},
+			Pkg:            "hello",
+			Arch:           "amd64",
+			Version:        "1",
+			DestDir:        writeFixturePackage(t, tmp, variant),
+			squashfsOpts:   []squashfs.WriterOption{squashfs.WithSourceDateEpoch(epoch)},
+			artifactWriter: ioutil.Discard,
+		}
+		if err := b.pkg(); err != nil {
+			t.Fatal(err)
+		}
+		image, err := ioutil.ReadFile(filepath.Join(tmp, "build", "distri", "pkg", "hello-amd64-1.squashfs"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, sha256.Sum256(image))
+
+		rd, err := squashfs.NewReader(bytes.NewReader(image))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if os.Getuid() == 0 {
+			fi, err := rd.FS().Lstat("out/bin/hello")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sfi := fi.Sys().(*squashfs.FileInfo); sfi.Uid != 0 || sfi.Gid != fixtureGid {
+				t.Errorf("variant %d: unexpected owner of bin/hello: got %d:%d, want 0:%d", variant, sfi.Uid, sfi.Gid, fixtureGid)
+			}
+		}
+		if !supportsXattrs(t, tmp) {
+			continue
+		}
+		inode, err := rd.LookupPath("out/bin/hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		xattrs, err := rd.ReadXattrs(inode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(fixtureXattrs(), xattrs); diff != "" {
+			t.Errorf("variant %d: unexpected xattrs of bin/hello: diff (-want +got):\n%s", variant, diff)
+		}
+	}
+	if hashes[0] != hashes[1] {
+		t.Errorf("building the same package twice resulted in different images: %x vs. %x", hashes[0], hashes[1])
+	}
+}
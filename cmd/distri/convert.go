@@ -60,12 +60,57 @@ func readXattrs(fd int) ([]squashfs.Xattr, error) {
 		if err != nil {
 			return nil, err
 		}
-		attrs = append(attrs, squashfs.XattrFromAttr(attr, buf))
+		xattr, ok := squashfs.XattrFromAttr(attr, buf)
+		if !ok {
+			log.Printf("skipping xattr %q: namespace not supported by SquashFS", attr)
+			continue
+		}
+		attrs = append(attrs, xattr)
 	}
 	return attrs, nil
 }
 
+// squashfsWriterOptions returns the options for creating SquashFS images
+// according to the specified -compression flag value.
+func squashfsWriterOptions(compression string) ([]squashfs.WriterOption, error) {
+	var opts []squashfs.WriterOption
+	if compression != "" {
+		c, err := squashfs.ParseCompression(compression)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, squashfs.WithCompression(c))
+	}
+	return opts, nil
+}
+
+// fileID identifies a file on the local file system for detecting hard links.
+type fileID struct {
+	dev, ino uint64
+}
+
+// imageOwner returns the owner which the file described by st should have
+// within the image: files owned by the user running the build (who is root
+// within the build namespace) are owned by root, all other owners are kept.
+func imageOwner(st *syscall.Stat_t) (uid, gid uint32) {
+	uid, gid = st.Uid, st.Gid
+	if uid == uint32(os.Getuid()) {
+		uid = 0
+	}
+	if gid == uint32(os.Getgid()) {
+		gid = 0
+	}
+	return uid, gid
+}
+
+// cp copies the contents of dir into w, preserving hard links and owners.
 func cp(w *squashfs.Directory, dir string) error {
+	return cpLinks(w, dir, "", make(map[fileID]string))
+}
+
+// cpLinks is cp for the subdirectory rel of the image. links maps files with
+// more than one hard link to the path (within the image) of their first copy.
+func cpLinks(w *squashfs.Directory, dir, rel string, links map[fileID]string) error {
 	//log.Printf("cp(%s)", dir)
 	fis, err := ioutil.ReadDir(dir)
 	if err != nil {
@@ -73,9 +118,21 @@ func cp(w *squashfs.Directory, dir string) error {
 	}
 	for _, fi := range fis {
 		//log.Printf("file %s, mode %#o (raw %#o)", fi.Name(), fi.Mode(), fi.Sys().(*syscall.Stat_t).Mode)
+		st := fi.Sys().(*syscall.Stat_t)
+		uid, gid := imageOwner(st)
+		if st.Nlink > 1 && (fi.Mode().IsRegular() || fi.Mode()&os.ModeSymlink != 0) {
+			id := fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+			if oldname, ok := links[id]; ok {
+				if err := w.Link(oldname, fi.Name()); err != nil {
+					return err
+				}
+				continue
+			}
+			links[id] = filepath.Join(rel, fi.Name())
+		}
 		if fi.IsDir() {
-			subdir := w.Directory(fi.Name(), fi.ModTime())
-			if err := cp(subdir, filepath.Join(dir, fi.Name())); err != nil {
+			subdir := w.Directory(fi.Name(), fi.ModTime(), fi.Mode(), uid, gid)
+			if err := cpLinks(subdir, filepath.Join(dir, fi.Name()), filepath.Join(rel, fi.Name()), links); err != nil {
 				return err
 			}
 		} else if fi.Mode().IsRegular() {
@@ -88,7 +145,7 @@ func cp(w *squashfs.Directory, dir string) error {
 			if err != nil {
 				return err
 			}
-			f, err := w.File(fi.Name(), fi.ModTime(), uint16(fi.Sys().(*syscall.Stat_t).Mode), attrs)
+			f, err := w.File(fi.Name(), fi.ModTime(), uint16(st.Mode), uid, gid, attrs)
 			if err != nil {
 				return err
 			}
@@ -104,7 +161,7 @@ func cp(w *squashfs.Directory, dir string) error {
 			if err != nil {
 				return err
 			}
-			if err := w.Symlink(dest, fi.Name(), fi.ModTime(), fi.Mode().Perm()); err != nil {
+			if err := w.Symlink(dest, fi.Name(), fi.ModTime(), fi.Mode().Perm(), uid, gid); err != nil {
 				return err
 			}
 		} else {
@@ -116,12 +173,19 @@ func cp(w *squashfs.Directory, dir string) error {
 
 func convert(args []string) error {
 	fset := flag.NewFlagSet("convert", flag.ExitOnError)
-	var pkg = fset.String("pkg", "", "path to tar.gz package to convert to squashfs")
+	var (
+		pkg         = fset.String("pkg", "", "path to tar.gz package to convert to squashfs")
+		compression = fset.String("compression", "", "if non-empty, compress data blocks using the specified compressor (zlib or lz4)")
+	)
 	fset.Usage = usage(fset, convertHelp)
 	fset.Parse(args)
 	if *pkg == "" {
 		return xerrors.Errorf("required: -pkg")
 	}
+	opts, err := squashfsWriterOptions(*compression)
+	if err != nil {
+		return err
+	}
 	log.Printf("converting %s to SquashFS", *pkg)
 	tmp, err := ioutil.TempDir("", "convert")
 	if err != nil {
@@ -143,7 +207,7 @@ func convert(args []string) error {
 		return err
 	}
 
-	w, err := squashfs.NewWriter(out, time.Now())
+	w, err := squashfs.NewWriter(out, time.Now(), opts...)
 	if err != nil {
 		return err
 	}
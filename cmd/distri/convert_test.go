@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/distr1/distri/internal/squashfs"
+	"github.com/orcaman/writerseeker"
+)
+
+func TestCpHardLinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "distri-cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.MkdirAll(filepath.Join(tmp, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, "bin", "git"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(tmp, "bin", "git"), filepath.Join(tmp, "git-upload-pack")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &writerseeker.WriterSeeker{}
+	w, err := squashfs.NewWriter(buf, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cp(w.Root, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rd, err := squashfs.NewReader(buf.BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inodes []squashfs.Inode
+	for _, path := range []string{"bin/git", "git-upload-pack"} {
+		inode, err := rd.LlookupPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := rd.Stat(path, inode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fi.Sys().(*squashfs.FileInfo).Nlink, uint32(2); got != want {
+			t.Errorf("%s: unexpected number of hard links: got %d, want %d", path, got, want)
+		}
+		inodes = append(inodes, inode)
+	}
+	if inodes[0] != inodes[1] {
+		t.Errorf("hard link refers to a different inode: got %v, want %v", inodes[1], inodes[0])
+	}
+}
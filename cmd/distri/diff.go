@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/distr1/distri"
+	"github.com/distr1/distri/internal/squashfs"
+	"github.com/distr1/distri/pb"
+	"golang.org/x/xerrors"
+)
+
+const diffHelp = `distri diff [-flags] <pkg-a> <pkg-b>
+
+Show the differences between two package images.
+
+Packages can be specified by name (looked up in the package store) or by the
+path of their .squashfs image. Files which were added (A), deleted (D),
+modified (M) or changed type (T) are listed, including changes in size, mode,
+symbolic link target and extended attributes.
+
+Example:
+  % distri diff i3status-amd64-2.13-4 i3status-amd64-2.13-5
+  % distri diff -text build/distri/pkg/i3status-amd64-2.13-{4,5}.squashfs
+`
+
+// pkgEntry is a file within a package image.
+type pkgEntry struct {
+	rd     *squashfs.Reader
+	fi     fs.FileInfo
+	target string // symbolic link target
+	xattrs map[string][]byte
+}
+
+func readPkgEntries(rd *squashfs.Reader) (map[string]*pkgEntry, error) {
+	entries := make(map[string]*pkgEntry)
+	err := fs.WalkDir(rd.FS(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == "." {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := &pkgEntry{rd: rd, fi: fi}
+		inode := fi.Sys().(*squashfs.FileInfo).Inode
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if e.target, err = rd.ReadLink(inode); err != nil {
+				return xerrors.Errorf("%s: %v", path, err)
+			}
+		}
+		xattrs, err := rd.ReadXattrs(inode)
+		if err != nil {
+			return xerrors.Errorf("%s: %v", path, err)
+		}
+		if len(xattrs) > 0 {
+			e.xattrs = make(map[string][]byte)
+			for _, attr := range xattrs {
+				e.xattrs[attr.FullName] = attr.Value
+			}
+		}
+		entries[path] = e
+		return nil
+	})
+	return entries, err
+}
+
+func (e *pkgEntry) contents() ([]byte, error) {
+	fr, err := e.rd.FileReader(e.fi.Sys().(*squashfs.FileInfo).Inode)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(fr)
+}
+
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode&os.ModeDevice != 0:
+		return "block device"
+	case mode&os.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	}
+	return "unknown"
+}
+
+// A pkgChange describes how a file differs between two package images.
+type pkgChange struct {
+	Path    string
+	Status  byte     // A (added), D (deleted), M (modified) or T (type changed)
+	Details []string // e.g. size 12 → 13
+
+	// Old and New contain the file contents of text files which were
+	// modified, for displaying a content diff. Both are nil otherwise.
+	Old, New []byte
+}
+
+func (c pkgChange) String() string {
+	if len(c.Details) == 0 {
+		return fmt.Sprintf("%c %s", c.Status, c.Path)
+	}
+	return fmt.Sprintf("%c %s (%s)", c.Status, c.Path, strings.Join(c.Details, ", "))
+}
+
+// isText reports whether b looks like the contents of a text file, using the
+// same heuristic as git: text files contain no NUL bytes.
+func isText(b []byte) bool {
+	const peek = 8000
+	if len(b) > peek {
+		b = b[:peek]
+	}
+	return bytes.IndexByte(b, 0) == -1
+}
+
+// diffPkgEntries compares the files of two package images. If text is true,
+// the contents of modified text files are retained for a content diff.
+func diffPkgEntries(a, b map[string]*pkgEntry, text bool) ([]pkgChange, error) {
+	paths := make([]string, 0, len(a)+len(b))
+	for path := range a {
+		paths = append(paths, path)
+	}
+	for path := range b {
+		if _, ok := a[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var changes []pkgChange
+	for _, path := range paths {
+		ea, eb := a[path], b[path]
+		if ea == nil {
+			changes = append(changes, pkgChange{Path: path, Status: 'A'})
+			continue
+		}
+		if eb == nil {
+			changes = append(changes, pkgChange{Path: path, Status: 'D'})
+			continue
+		}
+		ma, mb := ea.fi.Mode(), eb.fi.Mode()
+		if ta, tb := fileType(ma), fileType(mb); ta != tb {
+			changes = append(changes, pkgChange{
+				Path:    path,
+				Status:  'T',
+				Details: []string{ta + " → " + tb},
+			})
+			continue
+		}
+		c := pkgChange{Path: path, Status: 'M'}
+		if ma != mb {
+			c.Details = append(c.Details, fmt.Sprintf("mode %v → %v", ma, mb))
+		}
+		if ea.target != eb.target {
+			c.Details = append(c.Details, fmt.Sprintf("target %q → %q", ea.target, eb.target))
+		}
+		for _, name := range xattrNames(ea.xattrs, eb.xattrs) {
+			va, oka := ea.xattrs[name]
+			vb, okb := eb.xattrs[name]
+			switch {
+			case !oka:
+				c.Details = append(c.Details, "xattr "+name+" added")
+			case !okb:
+				c.Details = append(c.Details, "xattr "+name+" removed")
+			case !bytes.Equal(va, vb):
+				c.Details = append(c.Details, "xattr "+name+" changed")
+			}
+		}
+		if ma.IsRegular() {
+			sa, sb := ea.fi.Size(), eb.fi.Size()
+			if sa != sb {
+				c.Details = append(c.Details, fmt.Sprintf("size %d → %d", sa, sb))
+			}
+			ca, err := ea.contents()
+			if err != nil {
+				return nil, xerrors.Errorf("%s: %v", path, err)
+			}
+			cb, err := eb.contents()
+			if err != nil {
+				return nil, xerrors.Errorf("%s: %v", path, err)
+			}
+			if !bytes.Equal(ca, cb) {
+				if sa == sb {
+					c.Details = append(c.Details, "contents changed")
+				}
+				if text && isText(ca) && isText(cb) {
+					c.Old, c.New = ca, cb
+				}
+			}
+		}
+		if len(c.Details) > 0 {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+func xattrNames(a, b map[string][]byte) []string {
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// diffRuntimeDeps compares two runtime_dep closures and returns one line per
+// package which was added, removed or changed its version.
+func diffRuntimeDeps(a, b []string) []string {
+	versions := func(deps []string) map[string]string {
+		m := make(map[string]string)
+		for _, dep := range deps {
+			pv := distri.ParseVersion(dep)
+			m[pv.Pkg+"-"+pv.Arch] = dep
+		}
+		return m
+	}
+	va, vb := versions(a), versions(b)
+	pkgs := make([]string, 0, len(va)+len(vb))
+	for pkg := range va {
+		pkgs = append(pkgs, pkg)
+	}
+	for pkg := range vb {
+		if _, ok := va[pkg]; !ok {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Strings(pkgs)
+	var lines []string
+	for _, pkg := range pkgs {
+		da, db := va[pkg], vb[pkg]
+		switch {
+		case da == "":
+			lines = append(lines, "+ "+db)
+		case db == "":
+			lines = append(lines, "- "+da)
+		case da != db:
+			lines = append(lines, "~ "+da+" → "+db)
+		}
+	}
+	return lines
+}
+
+// textDiff writes a unified diff of a and b (labeled with path) to w.
+func textDiff(w io.Writer, path string, a, b []byte) error {
+	tmpdir, err := ioutil.TempDir("", "distri-diff")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpdir)
+	for fn, contents := range map[string][]byte{"a": a, "b": b} {
+		if err := ioutil.WriteFile(filepath.Join(tmpdir, fn), contents, 0644); err != nil {
+			return err
+		}
+	}
+	diff := exec.Command("diff", "-u", "--label", "a/"+path, "--label", "b/"+path, "a", "b")
+	diff.Dir = tmpdir
+	diff.Stdout = w
+	diff.Stderr = os.Stderr
+	if err := diff.Run(); err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 1 {
+			// files are different, which is what we expect
+		} else {
+			return xerrors.Errorf("%v: %v", diff.Args, err)
+		}
+	}
+	return nil
+}
+
+// pkgImage returns the path of the image of pkg, which is either a path to a
+// .squashfs file or the name of a package in store.
+func pkgImage(store, pkg string) string {
+	if strings.HasSuffix(pkg, ".squashfs") {
+		return pkg
+	}
+	return filepath.Join(store, pkg+".squashfs")
+}
+
+func openPkgEntries(image string) (map[string]*pkgEntry, error) {
+	f, err := os.Open(image)
+	if err != nil {
+		return nil, err
+	}
+	// The file is intentionally not closed: the entries refer to the Reader.
+	rd, err := squashfs.NewReader(f)
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %v", image, err)
+	}
+	entries, err := readPkgEntries(rd)
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %v", image, err)
+	}
+	return entries, nil
+}
+
+func diffPkgs(args []string) error {
+	fset := flag.NewFlagSet("diff", flag.ExitOnError)
+	var (
+		root = fset.String("root",
+			"/",
+			"root directory for optionally operating on a chroot")
+
+		storeFlag = fset.String("store",
+			"",
+			"if non-empty, look up packages in the specified package store (the package store in -root/roimg otherwise)")
+
+		text = fset.Bool("text",
+			false,
+			"show content diffs of modified text files")
+
+		runtimeDeps = fset.Bool("runtime_deps",
+			true,
+			"show changes to the runtime_dep closure (from the .meta.textproto files)")
+	)
+	fset.Usage = usage(fset, diffHelp)
+	fset.Parse(args)
+
+	if fset.NArg() != 2 {
+		return xerrors.Errorf("syntax: diff [-flags] <pkg-a> <pkg-b>")
+	}
+	store := *storeFlag
+	if store == "" {
+		store = filepath.Join(*root, "roimg")
+	}
+	imageA := pkgImage(store, fset.Arg(0))
+	imageB := pkgImage(store, fset.Arg(1))
+
+	entriesA, err := openPkgEntries(imageA)
+	if err != nil {
+		return err
+	}
+	entriesB, err := openPkgEntries(imageB)
+	if err != nil {
+		return err
+	}
+	changes, err := diffPkgEntries(entriesA, entriesB, *text)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+
+	if *runtimeDeps {
+		metaA, errA := pb.ReadMetaFile(strings.TrimSuffix(imageA, ".squashfs") + ".meta.textproto")
+		metaB, errB := pb.ReadMetaFile(strings.TrimSuffix(imageB, ".squashfs") + ".meta.textproto")
+		switch {
+		case errA != nil:
+			log.Printf("not comparing runtime_dep: %v", errA)
+		case errB != nil:
+			log.Printf("not comparing runtime_dep: %v", errB)
+		default:
+			if lines := diffRuntimeDeps(metaA.GetRuntimeDep(), metaB.GetRuntimeDep()); len(lines) > 0 {
+				fmt.Println()
+				fmt.Println("runtime_dep:")
+				for _, line := range lines {
+					fmt.Println("  " + line)
+				}
+			}
+		}
+	}
+
+	for _, c := range changes {
+		if c.Old == nil {
+			continue // not a modified text file
+		}
+		fmt.Println()
+		if err := textDiff(os.Stdout, c.Path, c.Old, c.New); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/distr1/distri/internal/squashfs"
+	"github.com/google/go-cmp/cmp"
+)
+
+type diffTestFile struct {
+	name     string
+	contents string
+	mode     uint16
+	xattrs   []squashfs.Xattr
+}
+
+func writeDiffTestImage(t *testing.T, fn string, files []diffTestFile, symlinkTarget string) {
+	t.Helper()
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := squashfs.NewWriter(f, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := w.Root.Directory("bin", time.Now(), 0555, 0, 0)
+	for _, file := range files {
+		ff, err := bin.File(file.name, time.Now(), file.mode, 0, 0, file.xattrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ff.Write([]byte(file.contents)); err != nil {
+			t.Fatal(err)
+		}
+		if err := ff.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bin.Symlink(symlinkTarget, "sh", time.Now(), 0777, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := bin.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffPkgs(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "distri-diff-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	capability, _ := squashfs.XattrFromAttr("security.capability", []byte{1, 0, 0, 2})
+	imageA := filepath.Join(tmp, "hello-amd64-1-1.squashfs")
+	writeDiffTestImage(t, imageA, []diffTestFile{
+		{name: "bash", contents: "#!/bin/bash\necho a\n", mode: 0755},
+		{name: "deleted", contents: "gone", mode: 0755},
+		{name: "hello", contents: "hello\n", mode: 0755},
+		{name: "ping", contents: "\x7fELF\x00a", mode: 0755, xattrs: []squashfs.Xattr{capability}},
+	}, "bash")
+	imageB := filepath.Join(tmp, "hello-amd64-1-2.squashfs")
+	writeDiffTestImage(t, imageB, []diffTestFile{
+		{name: "added", contents: "new", mode: 0755},
+		{name: "bash", contents: "#!/bin/bash\necho b\n", mode: 0755},
+		{name: "hello", contents: "hello, world\n", mode: 0644},
+		{name: "ping", contents: "\x7fELF\x00b", mode: 0755},
+	}, "dash")
+
+	entriesA, err := openPkgEntries(imageA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entriesB, err := openPkgEntries(imageB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := diffPkgEntries(entriesA, entriesB, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"A bin/added",
+		"M bin/bash (contents changed)",
+		"D bin/deleted",
+		"M bin/hello (mode -rwxr-xr-x → -rw-r--r--, size 6 → 13)",
+		"M bin/ping (xattr security.capability removed, contents changed)",
+		`M bin/sh (target "bash" → "dash")`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("diffPkgEntries: unexpected changes: diff (-want +got):\n%s", diff)
+	}
+
+	// Content diffs are only retained for text files.
+	for _, c := range changes {
+		if got, want := c.Old != nil, c.Path == "bin/bash" || c.Path == "bin/hello"; got != want {
+			t.Errorf("%s: content diff retained = %v, want %v", c.Path, got, want)
+		}
+	}
+}
+
+func TestDiffRuntimeDeps(t *testing.T) {
+	got := diffRuntimeDeps(
+		[]string{"hello-amd64-1-1", "glibc-amd64-2.27-3", "ncurses-amd64-6.1-8"},
+		[]string{"hello-amd64-1-2", "glibc-amd64-2.27-3", "readline-amd64-8.0-4"})
+	want := []string{
+		"~ hello-amd64-1-1 → hello-amd64-1-2",
+		"- ncurses-amd64-6.1-8",
+		"+ readline-amd64-8.0-4",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("diffRuntimeDeps: diff (-want +got):\n%s", diff)
+	}
+}
@@ -114,6 +114,8 @@ func main() {
 		"unpack":  {unpack},
 		"update":  {update},
 		"gc":      {gc},
+		"fsck":    {fsck},
+		"diff":    {diffPkgs},
 		"patch":   {patch},
 		"bump":    {bump},
 		"builder": {builder},
@@ -147,11 +149,13 @@ func main() {
 			fmt.Fprintf(os.Stderr, "\tpatch    - interactively create a patch for a package\n")
 			fmt.Fprintf(os.Stderr, "\tlog      - show package build log (local)\n")
 			fmt.Fprintf(os.Stderr, "\tbump     - increase revision of package and rdeps\n")
+			fmt.Fprintf(os.Stderr, "\tdiff     - show differences between two package images\n")
 			fmt.Fprintf(os.Stderr, "\tbatch    - build all distri packages\n")
 			fmt.Fprintln(os.Stderr)
 			fmt.Fprintf(os.Stderr, "Package store commands:\n")
 			fmt.Fprintf(os.Stderr, "\texport   - serve local package store to others\n")
 			fmt.Fprintf(os.Stderr, "\tmirror   - make a package store usable as a repository\n")
+			fmt.Fprintf(os.Stderr, "\tfsck     - verify package images and their metadata\n")
 			os.Exit(2)
 		}
 		verb = args[0]
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/distr1/distri/cmd/distri/internal/fuse"
 	"github.com/distr1/distri/internal/addrfd"
 	"github.com/distr1/distri/internal/env"
 	"github.com/lpar/gzipped"
@@ -15,6 +22,9 @@ const exportHelp = `distri export [-flags]
 
 Serve local package store to others.
 
+Chunk hashes (required by distri fuse -lazy) are computed on the fly for
+package images which distri mirror did not yet process.
+
 Example:
   ws % distri export
   laptop % distri install -repo http://ws:7080 i3status
@@ -52,12 +62,45 @@ func export(args []string) error {
 	server := &http.Server{Addr: addr}
 	log.Printf("exporting %s on %s", *repo, addr)
 
-	if *gzip {
-		http.Handle("/", gzipped.FileServer(http.Dir(*repo)))
-	} else {
-		http.Handle("/", http.FileServer(http.Dir(*repo)))
-	}
+	server.Handler = exportHandler(*repo, *gzip)
 
 	addrfd.MustWrite(addr)
 	return server.Serve(tcpKeepAliveListener{ln.(*net.TCPListener)})
 }
+
+// exportHandler serves the repository in directory repo.
+func exportHandler(repo string, gzip bool) http.Handler {
+	var fileServer http.Handler
+	if gzip {
+		fileServer = gzipped.FileServer(http.Dir(repo))
+	} else {
+		fileServer = http.FileServer(http.Dir(repo))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ".squashfs"+fuse.ChunkHashesSuffix) {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		fn := filepath.Join(repo, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+		if _, err := os.Stat(fn); err == nil {
+			fileServer.ServeHTTP(w, r) // written by distri mirror
+			return
+		}
+		f, err := os.Open(strings.TrimSuffix(fn, fuse.ChunkHashesSuffix))
+		if err != nil {
+			if os.IsNotExist(err) {
+				http.NotFound(w, r)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		var buf bytes.Buffer
+		if err := fuse.WriteChunkHashes(&buf, f); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, path.Base(r.URL.Path), time.Time{}, bytes.NewReader(buf.Bytes()))
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/distr1/distri/cmd/distri/internal/fuse"
+)
+
+func TestExportChunkHashes(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distri-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	if err := os.MkdirAll(filepath.Join(repo, "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	image := make([]byte, 1<<20+42)
+	rand.New(rand.NewSource(1)).Read(image)
+	if err := ioutil.WriteFile(filepath.Join(repo, "pkg", "hello-amd64-1.squashfs"), image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(exportHandler(repo, true))
+	defer srv.Close()
+
+	get := func(path, rng string) (int, []byte) {
+		t.Helper()
+		req, err := http.NewRequest("GET", srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, b
+	}
+
+	t.Run("ComputedOnTheFly", func(t *testing.T) {
+		var want bytes.Buffer
+		if err := fuse.WriteChunkHashes(&want, bytes.NewReader(image)); err != nil {
+			t.Fatal(err)
+		}
+		status, got := get("/pkg/hello-amd64-1.squashfs"+fuse.ChunkHashesSuffix, "")
+		if status != http.StatusOK {
+			t.Fatalf("HTTP status %d", status)
+		}
+		if !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("unexpected chunk hashes: got %q, want %q", got, want.Bytes())
+		}
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		status, got := get("/pkg/hello-amd64-1.squashfs", "bytes=1000-1999")
+		if status != http.StatusPartialContent {
+			t.Fatalf("HTTP status %d", status)
+		}
+		if !bytes.Equal(got, image[1000:2000]) {
+			t.Errorf("unexpected range contents")
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		if status, _ := get("/pkg/missing-amd64-1.squashfs"+fuse.ChunkHashesSuffix, ""); status != http.StatusNotFound {
+			t.Errorf("HTTP status %d, want %d", status, http.StatusNotFound)
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/distr1/distri"
+	"github.com/distr1/distri/internal/env"
+	"github.com/distr1/distri/internal/squashfs"
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/xerrors"
+)
+
+const fsckHelp = `distri fsck [-flags] [image...]
+
+Verify the integrity of package images and their metadata.
+
+Every SquashFS image is read in its entirety (superblock, tables, inodes,
+directories and data blocks). Truncated downloads and bit rot are reported with
+their location within the image.
+
+The .meta.textproto of every image is checked to describe the same package:
+its version and source package must match the image name. When the image is a
+split package (e.g. gcc-libs, built from gcc), the source package’s
+build.textproto is consulted (if found in -pkgs) to verify the split.
+
+Example:
+  % distri fsck
+  % distri fsck -store=/srv/repo/pkg
+  % distri fsck /roimg/glibc-amd64-2.27-3.squashfs
+`
+
+// fsckImage verifies the package image fn and returns all problems found.
+// pkgsDir is the pkgs directory of a distri checkout, used to verify split
+// packages.
+func fsckImage(fn, pkgsDir string) []string {
+	var problems []string
+	f, err := os.Open(fn)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	defer f.Close()
+	rd, err := squashfs.NewReader(f)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	for _, problem := range rd.Verify() {
+		problems = append(problems, problem.Error())
+	}
+	return append(problems, fsckMeta(fn, pkgsDir)...)
+}
+
+// fsckMeta cross-checks the package image fn against its .meta.textproto.
+func fsckMeta(fn, pkgsDir string) []string {
+	pkg := strings.TrimSuffix(filepath.Base(fn), ".squashfs")
+	metaFn := strings.TrimSuffix(fn, ".squashfs") + ".meta.textproto"
+	meta, err := pb.ReadMetaFile(metaFn)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	pv := distri.ParseVersion(pkg)
+	if pv.Pkg == "" || pv.Arch == "" {
+		return []string{fmt.Sprintf("cannot parse package name and architecture from %q", pkg)}
+	}
+	var problems []string
+	version := strings.TrimPrefix(pkg, pv.Pkg+"-"+pv.Arch+"-")
+	if got := meta.GetVersion(); got != version {
+		problems = append(problems, fmt.Sprintf("%s: version %q does not match image name %q (version %q)", filepath.Base(metaFn), got, pkg, version))
+	}
+	// pv.Pkg includes the target architecture of cross packages (e.g.
+	// gcc-i686), just like the source package name does.
+	if src := meta.GetSourcePkg(); src != "" && src != pv.Pkg {
+		split, err := splitPackageOf(pkgsDir, src, pv.Pkg)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", filepath.Base(metaFn), err))
+		} else if !split {
+			problems = append(problems, fmt.Sprintf("%s: source_pkg %q does not match image name %q (%s is not a split package of %s)", filepath.Base(metaFn), src, pkg, pv.Pkg, src))
+		}
+	}
+	for _, dep := range meta.GetRuntimeDep() {
+		dv := distri.ParseVersion(dep)
+		if dv.Pkg == pv.Pkg && dv.Arch == pv.Arch && dep != pkg {
+			problems = append(problems, fmt.Sprintf("%s: runtime_dep %q refers to a different version of the package itself", filepath.Base(metaFn), dep))
+		}
+	}
+	return problems
+}
+
+// splitPackageOf reports whether pkg is a split package of the source package
+// src, according to src’s build.textproto in pkgsDir. Without a build.textproto
+// (e.g. when no distri checkout is present), pkg is assumed to be a split
+// package.
+func splitPackageOf(pkgsDir, src, pkg string) (bool, error) {
+	c, err := ioutil.ReadFile(filepath.Join(pkgsDir, src, "build.textproto"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	var buildProto pb.Build
+	if err := proto.UnmarshalText(string(c), &buildProto); err != nil {
+		return false, xerrors.Errorf("%s: %v", filepath.Join(pkgsDir, src, "build.textproto"), err)
+	}
+	for _, sp := range buildProto.GetSplitPackage() {
+		if sp.GetName() == pkg {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func fsck(args []string) error {
+	fset := flag.NewFlagSet("fsck", flag.ExitOnError)
+	var (
+		root = fset.String("root",
+			"/",
+			"root directory for optionally operating on a chroot")
+
+		storeFlag = fset.String("store",
+			"",
+			"if non-empty, verify the specified package store (the package store in -root/roimg otherwise)")
+
+		pkgsDir = fset.String("pkgs",
+			filepath.Join(env.DistriRoot, "pkgs"),
+			"pkgs directory of a distri checkout, used to verify that split packages belong to their source package")
+	)
+	fset.Usage = usage(fset, fsckHelp)
+	fset.Parse(args)
+
+	images := fset.Args()
+	if len(images) == 0 {
+		store := *storeFlag
+		if store == "" {
+			store = filepath.Join(*root, "roimg")
+		}
+		var err error
+		images, err = filepath.Glob(filepath.Join(store, "*.squashfs"))
+		if err != nil {
+			return err
+		}
+	}
+
+	var corrupt, problems int
+	for _, fn := range images {
+		p := fsckImage(fn, *pkgsDir)
+		if len(p) == 0 {
+			continue
+		}
+		corrupt++
+		problems += len(p)
+		for _, problem := range p {
+			fmt.Printf("%s: %s\n", fn, problem)
+		}
+	}
+	if problems > 0 {
+		return xerrors.Errorf("found %d problems in %d of %d images", problems, corrupt, len(images))
+	}
+	return nil
+}
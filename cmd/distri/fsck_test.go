@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/distr1/distri/internal/squashfs"
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestFsck(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tmp, err := ioutil.TempDir("", "distri-fsck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	pkgbuilddir := filepath.Join(tmp, "build", "hello")
+	pkgdir := filepath.Join(tmp, "build", "distri", "pkg")
+	for _, dir := range []string{pkgbuilddir, pkgdir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chdir(pkgbuilddir); err != nil {
+		t.Fatal(err)
+	}
+	b := &buildctx{
+		Proto:          &pb.Build{},
+		Pkg:            "hello",
+		Arch:           "amd64",
+		Version:        "1",
+		DestDir:        writeFixturePackage(t, tmp, 0),
+		squashfsOpts:   []squashfs.WriterOption{squashfs.WithCompression(squashfs.ZlibCompression)},
+		artifactWriter: ioutil.Discard,
+	}
+	if err := b.pkg(); err != nil {
+		t.Fatal(err)
+	}
+	image := filepath.Join(pkgdir, "hello-amd64-1.squashfs")
+	metaFn := filepath.Join(pkgdir, "hello-amd64-1.meta.textproto")
+	writeMeta := func(meta *pb.Meta) {
+		t.Helper()
+		if err := ioutil.WriteFile(metaFn, []byte(proto.MarshalTextString(meta)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeMeta(&pb.Meta{
+		SourcePkg:  proto.String("hello"),
+		Version:    proto.String("1"),
+		RuntimeDep: []string{"hello-amd64-1", "glibc-amd64-2.27-3"},
+	})
+	pkgsDir := filepath.Join(tmp, "pkgs")
+	if err := os.MkdirAll(filepath.Join(pkgsDir, "hello"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	buildProto := &pb.Build{
+		SplitPackage: []*pb.SplitPackage{{Name: proto.String("hello-doc")}},
+	}
+	if err := ioutil.WriteFile(filepath.Join(pkgsDir, "hello", "build.textproto"), []byte(proto.MarshalTextString(buildProto)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Intact", func(t *testing.T) {
+		if problems := fsckImage(image, pkgsDir); len(problems) > 0 {
+			t.Errorf("fsckImage(%s) = %q, want no problems", image, problems)
+		}
+	})
+
+	t.Run("MetaMismatch", func(t *testing.T) {
+		writeMeta(&pb.Meta{
+			Version:    proto.String("2"),
+			RuntimeDep: []string{"hello-amd64-2"},
+		})
+		problems := fsckImage(image, pkgsDir)
+		if got, want := len(problems), 2; got != want {
+			t.Fatalf("fsckImage(%s) = %q, want %d problems", image, problems, want)
+		}
+		if got, want := problems[0], `version "2" does not match`; !strings.Contains(got, want) {
+			t.Errorf("fsckImage: got %q, want a problem containing %q", got, want)
+		}
+	})
+
+	t.Run("SplitPackage", func(t *testing.T) {
+		split := filepath.Join(pkgdir, "hello-doc-amd64-1.squashfs")
+		if err := os.Link(image, split); err != nil {
+			t.Fatal(err)
+		}
+		meta := &pb.Meta{
+			SourcePkg: proto.String("hello"),
+			Version:   proto.String("1"),
+		}
+		if err := ioutil.WriteFile(filepath.Join(pkgdir, "hello-doc-amd64-1.meta.textproto"), []byte(proto.MarshalTextString(meta)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if problems := fsckImage(split, pkgsDir); len(problems) > 0 {
+			t.Errorf("fsckImage(%s) = %q, want no problems", split, problems)
+		}
+	})
+
+	t.Run("SwappedMeta", func(t *testing.T) {
+		// The meta of a different package with the same version:
+		if err := os.MkdirAll(filepath.Join(pkgsDir, "world"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(pkgsDir, "world", "build.textproto"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		writeMeta(&pb.Meta{
+			SourcePkg: proto.String("world"),
+			Version:   proto.String("1"),
+		})
+		problems := fsckImage(image, pkgsDir)
+		if got, want := len(problems), 1; got != want {
+			t.Fatalf("fsckImage(%s) = %q, want %d problems", image, problems, want)
+		}
+		if got, want := problems[0], `source_pkg "world" does not match`; !strings.Contains(got, want) {
+			t.Errorf("fsckImage: got %q, want a problem containing %q", got, want)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		st, err := os.Stat(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		truncated := filepath.Join(pkgdir, "hello-amd64-3.squashfs")
+		b, err := ioutil.ReadFile(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(truncated, b[:st.Size()/2], 0644); err != nil {
+			t.Fatal(err)
+		}
+		problems := fsckImage(truncated, pkgsDir)
+		if len(problems) == 0 {
+			t.Fatalf("fsckImage(%s) unexpectedly found no problems", truncated)
+		}
+		// The missing .meta.textproto is reported, too.
+		if got, want := problems[len(problems)-1], "no such file or directory"; !strings.Contains(got, want) {
+			t.Errorf("fsckImage: got %q, want a problem containing %q", got, want)
+		}
+	})
+}
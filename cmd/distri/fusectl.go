@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/distr1/distri/pb"
 	"google.golang.org/grpc"
@@ -16,8 +19,13 @@ Send a control instruction to the FUSE file system.
 
 Typically only used under the covers, or for debugging.
 
-Example:
+Examples:
   % distri fusectl -scan_packages
+  % distri fusectl -list_packages
+  % distri fusectl -resolve_path=/ro/bin/bash
+  % distri fusectl -forget_package=bash-amd64-5.0-4
+  % distri fusectl -stats
+  % distri fusectl -conflicts
 `
 
 func fusectl(args []string) error {
@@ -25,6 +33,11 @@ func fusectl(args []string) error {
 	var (
 		mkdirAll     = fset.String("mkdirall", "", "if non-empty, sends a MkdirAll request")
 		scanPackages = fset.Bool("scan_packages", false, "sends a ScanPackages request")
+		listPackages = fset.Bool("list_packages", false, "sends a ListPackages request and prints the packages")
+		resolvePath  = fset.String("resolve_path", "", "if non-empty, sends a ResolvePath request and prints the package and file providing the path")
+		forget       = fset.String("forget_package", "", "if non-empty, sends a ForgetPackage request for the specified package (e.g. bash-amd64-5.0-4)")
+		stats        = fset.Bool("stats", false, "sends a GetStats request and prints the statistics")
+		conflicts    = fset.Bool("conflicts", false, "sends a ListConflicts request and prints exchange directory entries which are provided by more than one package")
 	)
 	fset.Usage = usage(fset, fusectlHelp)
 	fset.Parse(args)
@@ -49,6 +62,55 @@ func fusectl(args []string) error {
 		if _, err := cl.ScanPackages(ctx, &pb.ScanPackagesRequest{}); err != nil {
 			return err
 		}
+	} else if *listPackages {
+		resp, err := cl.ListPackages(ctx, &pb.ListPackagesRequest{})
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(tw, "PACKAGE\tMOUNTED\tSIZE\tORIGIN\n")
+		for _, pkg := range resp.GetPackage() {
+			fmt.Fprintf(tw, "%s\t%v\t%d\t%s\n", pkg.GetName(), pkg.GetMounted(), pkg.GetSize(), pkg.GetOrigin())
+		}
+		return tw.Flush()
+	} else if *resolvePath != "" {
+		resp, err := cl.ResolvePath(ctx, &pb.ResolvePathRequest{Path: resolvePath})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\t%s\n", resp.GetPkg(), resp.GetPath())
+	} else if *forget != "" {
+		if _, err := cl.ForgetPackage(ctx, &pb.ForgetPackageRequest{Pkg: forget}); err != nil {
+			return err
+		}
+	} else if *stats {
+		resp, err := cl.GetStats(ctx, &pb.GetStatsRequest{})
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(tw, "packages:\t%d\n", resp.GetPackages())
+		fmt.Fprintf(tw, "mounted images:\t%d\n", resp.GetMountedImages())
+		fmt.Fprintf(tw, "open readers:\t%d\n", resp.GetOpenReaders())
+		fmt.Fprintf(tw, "read bytes:\t%d\n", resp.GetReadBytes())
+		fmt.Fprintf(tw, "autodownloads:\t%d\n", resp.GetAutodownloads())
+		fmt.Fprintln(tw)
+		fmt.Fprintf(tw, "OP\tCOUNT\tTOTAL SECONDS\n")
+		for _, op := range resp.GetOp() {
+			fmt.Fprintf(tw, "%s\t%d\t%.3f\n", op.GetName(), op.GetCount(), op.GetTotalSeconds())
+		}
+		return tw.Flush()
+	} else if *conflicts {
+		resp, err := cl.ListConflicts(ctx, &pb.ListConflictsRequest{})
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(tw, "PATH\tPACKAGES\tREASON\n")
+		for _, c := range resp.GetConflict() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", c.GetPath(), strings.Join(c.GetPkg(), ", "), c.GetReason())
+		}
+		return tw.Flush()
 	} else {
 		resp, err := cl.Ping(ctx, &pb.PingRequest{})
 		if err != nil {
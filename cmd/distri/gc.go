@@ -12,6 +12,7 @@ import (
 
 	"github.com/distr1/distri"
 	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
 	"google.golang.org/grpc"
 )
 
@@ -106,8 +107,10 @@ func gc(args []string) error {
 	}
 
 	// delete all eligible packages (first .meta.textproto, then .squashfs)
+	var deleted []string
 	for _, pkgs := range eligible {
 		for pkg := range pkgs {
+			deleted = append(deleted, pkg)
 			for _, suffix := range []string{".meta.textproto", ".squashfs"} {
 				fn := filepath.Join(store, pkg+suffix)
 				if *dryRun {
@@ -122,14 +125,18 @@ func gc(args []string) error {
 	}
 
 	if *storeFlag != "" {
-		// Not operating on a running system; skip the ScanPackages call.
+		// Not operating on a running system; skip the ForgetPackage calls.
 		return nil
 	}
 
 	// TODO(correctness): delete all .squashfs without corresponding
 	// .meta.textproto (to recover from interruptions)
 
-	// Make the FUSE daemon update its packages.
+	if *dryRun || len(deleted) == 0 {
+		return nil
+	}
+
+	// Make the FUSE daemon release the deleted packages.
 	ctl, err := os.Readlink(filepath.Join(*root, "ro", "ctl"))
 	if err != nil {
 		log.Printf("not updating FUSE daemon: %v", err)
@@ -143,8 +150,11 @@ func gc(args []string) error {
 		return err
 	}
 	cl := pb.NewFUSEClient(conn)
-	if _, err := cl.ScanPackages(ctx, &pb.ScanPackagesRequest{}); err != nil {
-		return err
+	for _, pkg := range deleted {
+		if _, err := cl.ForgetPackage(ctx, &pb.ForgetPackageRequest{Pkg: proto.String(pkg)}); err != nil {
+			// e.g. the FUSE daemon was started with -pkgs
+			log.Printf("ForgetPackage(%s): %v", pkg, err)
+		}
 	}
 
 	return nil
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -124,63 +126,115 @@ func repoReader(ctx context.Context, repo distri.Repo, fn string) (io.ReadCloser
 	return os.Open(filepath.Join(repo.Path, fn))
 }
 
-func unpackDir(dest string, rd *squashfs.Reader, inode squashfs.Inode) error {
-	if err := os.MkdirAll(dest, 0755); err != nil {
-		return err
+// unpackDir copies the directory dir from fsys (recursively) to dest,
+// preserving modes (including setuid, setgid and sticky bits) and, when running
+// as root, owners.
+func unpackDir(dest string, fsys *squashfs.FS, dir string) error {
+	type dirMode struct {
+		name string
+		mode os.FileMode
 	}
-	fis, err := rd.Readdir(inode)
-	if err != nil {
-		return err
-	}
-	for _, fi := range fis {
-		destName := filepath.Join(dest, fi.Name())
-		fileInode := fi.Sys().(*squashfs.FileInfo).Inode
-		if fi.IsDir() {
-			if err := unpackDir(destName, rd, fileInode); err != nil {
+	var (
+		dirs   []dirMode // applied once all contents are unpacked
+		warned bool
+	)
+	err := fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		destName := filepath.Join(dest, strings.TrimPrefix(path, dir))
+		if err := unpackEntry(destName, fsys, path, d); err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if sfi, ok := fi.Sys().(*squashfs.FileInfo); ok && (sfi.Uid != 0 || sfi.Gid != 0) {
+			if os.Geteuid() != 0 {
+				// Only root can change owners, e.g. distri install -root as a
+				// regular user results in files owned by that user.
+				if !warned {
+					log.Printf("not running as root, not preserving owners (e.g. %d:%d of %s)", sfi.Uid, sfi.Gid, destName)
+					warned = true
+				}
+			} else if err := os.Lchown(destName, int(sfi.Uid), int(sfi.Gid)); err != nil {
 				return err
 			}
-		} else if fi.Mode()&os.ModeSymlink > 0 {
-			target, err := rd.ReadLink(fileInode)
-			if err != nil {
+		}
+		if fi.IsDir() {
+			dirs = append(dirs, dirMode{destName, fi.Mode()})
+		} else if fi.Mode().IsRegular() {
+			// Set the mode only now: setuid and setgid bits are not passed to
+			// open(2) and are cleared by chown(2).
+			if err := os.Chmod(destName, fi.Mode()); err != nil {
 				return err
 			}
-			if err := os.Symlink(target, destName); err != nil {
-				if os.IsExist(err) {
-					got, err := os.Readlink(destName)
-					if err != nil {
-						return err
-					}
-					if target != got {
-						if err := os.Remove(destName); err != nil {
-							log.Printf("remove(%s): %v", destName, err)
-						}
-						return os.Symlink(target, destName)
-					}
-					// fallthrough: target identical
-				} else {
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Regular users could not have populated read-only directories otherwise:
+	for _, d := range dirs {
+		if err := os.Chmod(d.name, d.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unpackEntry creates destName with the contents of the entry d at path.
+func unpackEntry(destName string, fsys *squashfs.FS, path string, d fs.DirEntry) error {
+	if d.IsDir() {
+		return os.MkdirAll(destName, 0755)
+	} else if d.Type()&fs.ModeSymlink > 0 {
+		target, err := fsys.ReadLink(path)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, destName); err != nil {
+			if os.IsExist(err) {
+				got, err := os.Readlink(destName)
+				if err != nil {
 					return err
 				}
-			}
-		} else if fi.Mode().IsRegular() {
-			fr, err := rd.FileReader(fileInode)
-			if err != nil {
-				return err
-			}
-			f, err := os.OpenFile(destName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
-			if err != nil {
-				return err
-			}
-			n, err := io.Copy(f, fr)
-			if err != nil {
-				return err
-			}
-			atomic.AddInt64(&totalBytes, n)
-			if err := f.Close(); err != nil {
+				if target != got {
+					if err := os.Remove(destName); err != nil {
+						log.Printf("remove(%s): %v", destName, err)
+					}
+					return os.Symlink(target, destName)
+				}
+				// fallthrough: target identical
+			} else {
 				return err
 			}
-		} else {
-			log.Printf("ERROR: unsupported SquashFS file type: %+v", fi.Mode())
 		}
+	} else if d.Type().IsRegular() {
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fr, err := fsys.Open(path)
+		if err != nil {
+			return err
+		}
+		defer fr.Close()
+		f, err := os.OpenFile(destName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(f, fr)
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&totalBytes, n)
+		if err := f.Close(); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("ERROR: unsupported SquashFS file type: %+v", d.Type())
 	}
 	return nil
 }
@@ -237,19 +291,16 @@ func install1(ctx context.Context, root string, repo distri.Repo, pkg string, fi
 			return err
 		}
 
-		fis, err := rd.Readdir(rd.RootInode())
-		if err != nil {
+		fsys := rd.FS()
+		fi, err := fsys.Lstat("etc")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
 			return err
 		}
-		for _, fi := range fis {
-			if fi.Name() != "etc" {
-				continue
-			}
+		if err == nil && fi.IsDir() {
 			log.Printf("copying %s/etc", pkg)
-			if err := unpackDir(filepath.Join(root, "etc"), rd, fi.Sys().(*squashfs.FileInfo).Inode); err != nil {
+			if err := unpackDir(filepath.Join(root, "etc"), fsys, "etc"); err != nil {
 				return xerrors.Errorf("copying /etc: %v", err)
 			}
-			break
 		}
 	}
 
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/distr1/distri/internal/squashfs"
+	"github.com/orcaman/writerseeker"
+	"golang.org/x/sys/unix"
+)
+
+func TestUnpackDir(t *testing.T) {
+	buf := &writerseeker.WriterSeeker{}
+	w, err := squashfs.NewWriter(buf, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	etc := w.Root.Directory("etc", time.Now(), 0755, 0, 0)
+	spool := etc.Directory("spool", time.Now(), os.ModeSetgid|0775, 8, 12) // mail:mail
+	if err := spool.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	ssh := etc.Directory("ssh", time.Now(), 0700, 0, 0)
+	f, err := ssh.File("sshd_config", time.Now(), 0644, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("PermitRootLogin no\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ssh.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := etc.Symlink("ssh/sshd_config", "sshd_config", time.Now(), 0777, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	f, err = etc.File("utempter", time.Now(), unix.S_ISGID|0711, 0, 22, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := etc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	rd, err := squashfs.NewReader(buf.BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmp, err := ioutil.TempDir("", "distri-unpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := unpackDir(tmp, rd.FS(), "etc"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(tmp, "sshd_config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "PermitRootLogin no\n"; got != want {
+		t.Errorf("unexpected contents: got %q, want %q", got, want)
+	}
+	target, err := os.Readlink(filepath.Join(tmp, "sshd_config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := target, "ssh/sshd_config"; got != want {
+		t.Errorf("unexpected symlink target: got %q, want %q", got, want)
+	}
+
+	if os.Getuid() != 0 {
+		t.Skip("not running as root, cannot verify that owners are preserved")
+	}
+	for _, tt := range []struct {
+		path     string
+		uid, gid uint32
+		mode     os.FileMode
+	}{
+		{"spool", 8, 12, os.ModeDir | os.ModeSetgid | 0775},
+		{"ssh", 0, 0, os.ModeDir | 0700},
+		{"utempter", 0, 22, os.ModeSetgid | 0711},
+	} {
+		fi, err := os.Stat(filepath.Join(tmp, tt.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		st := fi.Sys().(*syscall.Stat_t)
+		if st.Uid != tt.uid || st.Gid != tt.gid {
+			t.Errorf("%s: unexpected owner: got %d:%d, want %d:%d", tt.path, st.Uid, st.Gid, tt.uid, tt.gid)
+		}
+		if got, want := fi.Mode(), tt.mode; got != want {
+			t.Errorf("%s: unexpected mode: got %v, want %v", tt.path, got, want)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package fuse
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/renameio"
+	"golang.org/x/xerrors"
+)
+
+// ChunkHashesSuffix is appended to the file name of a package image to form
+// the file name of its chunk hashes, e.g. bash-amd64-5.0-4.squashfs.chunks.
+const ChunkHashesSuffix = ".chunks"
+
+// chunkSize is the granularity in which -lazy fetches, verifies and caches
+// package images. SquashFS data blocks are 128 KB, so that a chunk covers at
+// least one compressed block.
+const chunkSize = 256 * 1024
+
+// chunkHashes describes the chunks of a package image.
+type chunkHashes struct {
+	size      int64 // of the image in bytes
+	chunkSize int64
+	sums      [][sha256.Size]byte
+}
+
+// WriteChunkHashes reads a package image from r and writes the SHA-256 sums of
+// its chunks to w, in the following format:
+//
+//	size 8388608
+//	chunk_size 262144
+//	<hex-encoded SHA-256 sum of the first chunk>
+//	…
+func WriteChunkHashes(w io.Writer, r io.Reader) error {
+	var (
+		sums []string
+		size int64
+		buf  = make([]byte, chunkSize)
+	)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			sums = append(sums, hex.EncodeToString(sum[:]))
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "size %d\n", size)
+	fmt.Fprintf(bw, "chunk_size %d\n", chunkSize)
+	for _, sum := range sums {
+		fmt.Fprintln(bw, sum)
+	}
+	return bw.Flush()
+}
+
+func readChunkHashes(r io.Reader) (*chunkHashes, error) {
+	var (
+		h       chunkHashes
+		scanner = bufio.NewScanner(r)
+	)
+	header := func(key string) (int64, error) {
+		if !scanner.Scan() {
+			return 0, xerrors.Errorf("missing %s", key)
+		}
+		line := scanner.Text()
+		if !strings.HasPrefix(line, key+" ") {
+			return 0, xerrors.Errorf("malformed line %q, expected %s", line, key)
+		}
+		return strconv.ParseInt(strings.TrimPrefix(line, key+" "), 0, 64)
+	}
+	var err error
+	if h.size, err = header("size"); err != nil {
+		return nil, err
+	}
+	if h.chunkSize, err = header("chunk_size"); err != nil {
+		return nil, err
+	}
+	if h.chunkSize <= 0 {
+		return nil, xerrors.Errorf("invalid chunk_size %d", h.chunkSize)
+	}
+	for scanner.Scan() {
+		var sum [sha256.Size]byte
+		b, err := hex.DecodeString(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != len(sum) {
+			return nil, xerrors.Errorf("malformed hash %q", scanner.Text())
+		}
+		copy(sum[:], b)
+		h.sums = append(h.sums, sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if got, want := int64(len(h.sums)), (h.size+h.chunkSize-1)/h.chunkSize; got != want {
+		return nil, xerrors.Errorf("got %d hashes, want %d for %d bytes", got, want, h.size)
+	}
+	return &h, nil
+}
+
+// chunkCache is a persistent cache of package image chunks on local disk.
+// Chunks are stored under their SHA-256 sum, so chunks which are shared
+// between images (e.g. unchanged files of a new package revision) are stored
+// only once. When the cache exceeds its maximum size, the least recently used
+// chunks are evicted.
+type chunkCache struct {
+	dir string
+	max int64 // bytes
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type cacheEntry struct {
+	sum  [sha256.Size]byte
+	size int64
+}
+
+func openChunkCache(dir string, max int64) (*chunkCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &chunkCache{
+		dir:     dir,
+		max:     max,
+		lru:     list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+	}
+	type chunkFile struct {
+		entry   cacheEntry
+		modTime time.Time
+	}
+	var chunks []chunkFile
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		b, err := hex.DecodeString(info.Name())
+		if err != nil || len(b) != sha256.Size {
+			return nil // not a chunk, e.g. temporary file
+		}
+		cf := chunkFile{
+			entry:   cacheEntry{size: info.Size()},
+			modTime: info.ModTime(),
+		}
+		copy(cf.entry.sum[:], b)
+		chunks = append(chunks, cf)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The modification time of a chunk file is updated when the chunk is
+	// used, so that the LRU order survives restarts.
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].modTime.After(chunks[j].modTime)
+	})
+	for _, cf := range chunks {
+		entry := cf.entry // copy
+		c.entries[entry.sum] = c.lru.PushBack(&entry)
+		c.size += entry.size
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictLocked()
+	return c, nil
+}
+
+func (c *chunkCache) path(sum [sha256.Size]byte) string {
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+// get returns the contents of the chunk with the specified SHA-256 sum, or nil
+// if the chunk is not cached.
+func (c *chunkCache) get(sum [sha256.Size]byte) []byte {
+	c.mu.Lock()
+	el, ok := c.entries[sum]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	path := c.path(sum)
+	b, err := ioutil.ReadFile(path)
+	if err != nil || sha256.Sum256(b) != sum {
+		// The chunk vanished or was corrupted on disk, fetch it again:
+		c.remove(sum)
+		return nil
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now) // for openChunkCache, best effort
+	return b
+}
+
+// contains reports whether the chunk with the specified SHA-256 sum is cached.
+func (c *chunkCache) contains(sum [sha256.Size]byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[sum]
+	return ok
+}
+
+// put stores the chunk b, whose SHA-256 sum was already verified.
+func (c *chunkCache) put(sum [sha256.Size]byte, b []byte) error {
+	if int64(len(b)) > c.max {
+		return nil // would be evicted right away
+	}
+	c.mu.Lock()
+	_, ok := c.entries[sum]
+	c.mu.Unlock()
+	if ok {
+		return nil // already cached
+	}
+	path := c.path(sum)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := renameio.WriteFile(path, b, 0644); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[sum]; ok {
+		return nil // concurrently stored
+	}
+	c.entries[sum] = c.lru.PushFront(&cacheEntry{sum: sum, size: int64(len(b))})
+	c.size += int64(len(b))
+	c.evictLocked()
+	return nil
+}
+
+func (c *chunkCache) remove(sum [sha256.Size]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[sum]
+	if !ok {
+		return
+	}
+	c.removeLocked(el)
+}
+
+func (c *chunkCache) removeLocked(el *list.Element) {
+	entry := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.sum)
+	c.size -= entry.size
+	os.Remove(c.path(entry.sum))
+}
+
+func (c *chunkCache) evictLocked() {
+	for c.size > c.max {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+// cachedChunks returns the number of chunks and their total size in bytes.
+func (c *chunkCache) cachedChunks() (chunks int, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len(), c.size
+}
@@ -0,0 +1,315 @@
+package fuse
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/distr1/distri"
+	"golang.org/x/xerrors"
+)
+
+// PinsFile is the name of the file within the distri config directory
+// (typically /etc/distri) which configures how conflicts between packages
+// providing the same exchange directory entry are resolved. Example:
+//
+//	# /ro/bin/sh is provided by both bash and busybox:
+//	pin /bin/sh bash
+//	# packages of the base pkgset take precedence over all other packages:
+//	pkgset base
+//
+// pin lines name either a package (e.g. bash), a package of a specific
+// architecture (e.g. bash-amd64) or a specific package version (e.g.
+// bash-amd64-5.0-4). pkgset lines refer to pkgset.d/<name>.pkgset, in order of
+// decreasing priority.
+const PinsFile = "pins"
+
+// nativeArch is the architecture whose packages are preferred over packages
+// of other architectures (e.g. i686) providing the same path.
+const nativeArch = "amd64" // TODO: configurable / auto-detect
+
+// arbitraryReason is the reason for conflicts which none of the configured
+// pins and pkgsets resolve.
+const arbitraryReason = "package name"
+
+// ConflictPolicy decides which package provides an exchange directory entry
+// (e.g. /bin/sh) when multiple packages ship the same path. Packages are
+// identified by name and architecture (e.g. bash-amd64). In order:
+//
+//  1. a package which is pinned for the path (see PinsFile) wins
+//  2. a package which is part of a pkgset with higher priority wins
+//  3. a package of the native architecture wins
+//  4. different packages are ordered by name (for determinism only, the
+//     conflict should be resolved using a pin)
+//  5. the newest revision of a package wins
+//
+// The zero value resolves conflicts using only rules 3 to 5.
+type ConflictPolicy struct {
+	pins     map[string]string // exchange path → package (version)
+	priority map[string]int    // package → index into pkgsets
+	pkgsets  []string
+}
+
+// LoadConflictPolicy reads the PinsFile within dir. A missing PinsFile results
+// in the default policy.
+func LoadConflictPolicy(dir string) (*ConflictPolicy, error) {
+	var p ConflictPolicy
+	fn := filepath.Join(dir, PinsFile)
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &p, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch {
+		case fields[0] == "pin" && len(fields) == 3:
+			if p.pins == nil {
+				p.pins = make(map[string]string)
+			}
+			p.pins[filepath.Clean("/"+fields[1])] = fields[2]
+
+		case fields[0] == "pkgset" && len(fields) == 2:
+			b, err := ioutil.ReadFile(filepath.Join(dir, "pkgset.d", fields[1]+".pkgset"))
+			if err != nil {
+				return nil, xerrors.Errorf("%s:%d: %v", fn, lineno, err)
+			}
+			if p.priority == nil {
+				p.priority = make(map[string]int)
+			}
+			for _, pkg := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+				if _, ok := p.priority[pkg]; ok {
+					continue // already part of a pkgset with higher priority
+				}
+				p.priority[pkg] = len(p.pkgsets)
+			}
+			p.pkgsets = append(p.pkgsets, fields[1])
+
+		default:
+			return nil, xerrors.Errorf("%s:%d: malformed line %q", fn, lineno, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// packageKey returns the name and architecture of pkg, e.g. bash-amd64 for
+// bash-amd64-5.0-4, which identifies a package across revisions.
+func packageKey(pkg string) string {
+	pv := distri.ParseVersion(pkg)
+	return pv.Pkg + "-" + pv.Arch
+}
+
+// pinned reports whether pin refers to pkg.
+func pinned(pin, pkg string, pv distri.PackageVersion) bool {
+	return pin == pkg || pin == pv.Pkg || pin == pv.Pkg+"-"+pv.Arch
+}
+
+// pkgsetPriority returns the priority of the pkgset containing pkg, if any.
+func (p *ConflictPolicy) pkgsetPriority(pv distri.PackageVersion) (int, bool) {
+	if prio, ok := p.priority[pv.Pkg+"-"+pv.Arch]; ok {
+		return prio, true
+	}
+	prio, ok := p.priority[pv.Pkg]
+	return prio, ok
+}
+
+// precedes reports whether package a (e.g. bash-amd64-5.0-4) takes precedence
+// over package b for the exchange directory entry path, and why.
+func (p *ConflictPolicy) precedes(path, a, b string) (bool, string) {
+	va, vb := distri.ParseVersion(a), distri.ParseVersion(b)
+	if pin, ok := p.pins[path]; ok {
+		pinnedA := pinned(pin, a, va)
+		pinnedB := pinned(pin, b, vb)
+		if pinnedA != pinnedB {
+			return pinnedA, "pinned"
+		}
+	}
+	prioA, okA := p.pkgsetPriority(va)
+	prioB, okB := p.pkgsetPriority(vb)
+	if okA != okB || prioA != prioB {
+		winner := prioA
+		if !okA || (okB && prioB < prioA) {
+			winner = prioB
+		}
+		return okA && (!okB || prioA < prioB), "pkgset " + p.pkgsets[winner]
+	}
+	if nativeA, nativeB := va.Arch == nativeArch, vb.Arch == nativeArch; nativeA != nativeB {
+		return nativeA, "native architecture"
+	}
+	if keyA, keyB := va.Pkg+"-"+va.Arch, vb.Pkg+"-"+vb.Arch; keyA != keyB {
+		return keyA < keyB, arbitraryReason
+	}
+	if va.DistriRevision != vb.DistriRevision {
+		return va.DistriRevision > vb.DistriRevision, "newest revision"
+	}
+	return a < b, arbitraryReason
+}
+
+// Conflict describes an exchange directory entry which is provided by more
+// than one package.
+type Conflict struct {
+	Path   string   // e.g. /bin/sh
+	Pkgs   []string // in order of precedence, i.e. Pkgs[0] provides Path
+	Reason string   // why Pkgs[0] takes precedence over Pkgs[1]
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s: provided by %s, using %s (%s)", c.Path, strings.Join(c.Pkgs, ", "), c.Pkgs[0], c.Reason)
+}
+
+// conflict returns the Conflict for path between pkgs, which are sorted in
+// place.
+func (p *ConflictPolicy) conflict(path string, pkgs []string) Conflict {
+	sort.Slice(pkgs, func(i, j int) bool {
+		precedes, _ := p.precedes(path, pkgs[i], pkgs[j])
+		return precedes
+	})
+	c := Conflict{
+		Path: path,
+		Pkgs: pkgs,
+	}
+	if len(pkgs) > 1 {
+		_, c.Reason = p.precedes(path, pkgs[0], pkgs[1])
+	}
+	return c
+}
+
+// FindConflicts returns the conflicts between the specified packages, whose
+// well-known paths (see pb.MirrorMeta) are given by paths, sorted by path.
+// Different revisions of the same package are only part of a conflict if
+// another package provides the same path.
+func (p *ConflictPolicy) FindConflicts(paths map[string][]string) []Conflict {
+	byPath := make(map[string][]string)
+	for pkg, wellKnown := range paths {
+		for _, wk := range wellKnown {
+			path := "/" + strings.TrimPrefix(wk, "out/")
+			byPath[path] = append(byPath[path], pkg)
+		}
+	}
+	var conflicts []Conflict
+	for path, pkgs := range byPath {
+		if !multiplePackages(pkgs) {
+			continue
+		}
+		conflicts = append(conflicts, p.conflict(path, pkgs))
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Path < conflicts[j].Path
+	})
+	return conflicts
+}
+
+// multiplePackages reports whether pkgs contains more than just different
+// revisions of the same package (of the same architecture).
+func multiplePackages(pkgs []string) bool {
+	for _, pkg := range pkgs[1:] {
+		if packageKey(pkg) != packageKey(pkgs[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkTargetPkg returns the package into which the exchange directory entry
+// path (e.g. /bin/sh) with the specified link target points.
+func linkTargetPkg(path, linkTarget string) string {
+	// e.g. /bin/sh → ../bash-amd64-5.0-4/bin/sh
+	target := filepath.Join(filepath.Dir(path), linkTarget)
+	// target is now /bash-amd64-5.0-4/bin/sh
+	return strings.SplitN(strings.TrimPrefix(target, "/"), "/", 2)[0]
+}
+
+// resolveConflict reports whether linkTarget should replace existing as the
+// link target of the exchange directory entry path. fs.mu must be held.
+func (fs *fuseFS) resolveConflict(path, existing, linkTarget string) bool {
+	pkg := linkTargetPkg(path, linkTarget)
+	other := linkTargetPkg(path, existing)
+	if pkg == other {
+		return false
+	}
+	replace, _ := fs.policy.precedes(path, pkg, other)
+	candidates, ok := fs.conflicts[path]
+	if !ok {
+		if !multiplePackages([]string{pkg, other}) {
+			return replace // e.g. a new revision of the same package
+		}
+		if fs.conflicts == nil {
+			fs.conflicts = make(map[string]map[string]string)
+		}
+		candidates = map[string]string{other: existing}
+		fs.conflicts[path] = candidates
+	}
+	candidates[pkg] = linkTarget
+	c := fs.conflictLocked(path)
+	log.Print(c)
+	if c.Reason == arbitraryReason {
+		log.Printf("%s: no pin or pkgset applies, pin the package to use (e.g. “pin %s %s” in the %s file)", path, path, packageKey(c.Pkgs[0]), PinsFile)
+	}
+	return replace
+}
+
+// conflictLocked returns the Conflict for path. fs.mu must be held.
+func (fs *fuseFS) conflictLocked(path string) Conflict {
+	candidates := fs.conflicts[path]
+	pkgs := make([]string, 0, len(candidates))
+	for pkg := range candidates {
+		pkgs = append(pkgs, pkg)
+	}
+	return fs.policy.conflict(path, pkgs)
+}
+
+// forgetConflicts removes the leftover packages from all conflicts. Exchange
+// directory entries which were provided by a leftover package are pointed to
+// the package with the next highest precedence. fs.mu must be held.
+func (fs *fuseFS) forgetConflicts(leftover map[string]bool) {
+	for path, candidates := range fs.conflicts {
+		for pkg := range candidates {
+			if leftover[pkg] {
+				delete(candidates, pkg)
+			}
+		}
+		if len(candidates) == 0 {
+			delete(fs.conflicts, path)
+			continue
+		}
+		c := fs.conflictLocked(path)
+		if dir, ok := fs.dirs[filepath.Dir(path)]; ok {
+			if _, ok := dir.byName[filepath.Base(path)]; !ok {
+				fs.symlink(filepath.Dir(path), dir, candidates[c.Pkgs[0]])
+			}
+		}
+		if !multiplePackages(c.Pkgs) {
+			delete(fs.conflicts, path)
+		}
+	}
+}
+
+// listConflicts returns all current exchange directory conflicts, sorted by path.
+func (fs *fuseFS) listConflicts() []Conflict {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	conflicts := make([]Conflict, 0, len(fs.conflicts))
+	for path := range fs.conflicts {
+		conflicts = append(conflicts, fs.conflictLocked(path))
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Path < conflicts[j].Path
+	})
+	return conflicts
+}
@@ -0,0 +1,170 @@
+package fuse
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConflictPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "distri-pins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "pkgset.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	const pins = `# comment
+pin /bin/sh busybox
+pin lib/pkgconfig/foo.pc foo-amd64-1
+pin /bin/bar bar-i686
+pkgset base
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, PinsFile), []byte(pins), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pkgset.d", "base.pkgset"), []byte("zsh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadConflictPolicy(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		path       string
+		a, b       string
+		want       bool
+		wantReason string
+	}{
+		{"/bin/sh", "bash-amd64-5.0-4", "busybox-amd64-1.31-2", false, "pinned"},
+		{"/bin/sh", "busybox-amd64-1.31-2", "zsh-amd64-5.6-1", true, "pinned"},
+		{"/bin/bash", "bash-amd64-5.0-4", "zsh-amd64-5.6-1", false, "pkgset base"},
+		{"/bin/bash", "bash-amd64-5.0-4", "busybox-amd64-1.31-2", true, "package name"},
+		{"/bin/bash", "bash-amd64-5.0-4", "bash-amd64-5.0-5", false, "newest revision"},
+		{"/lib/pkgconfig/foo.pc", "foo-amd64-1", "foo-amd64-2", true, "pinned"},
+		{"/bin/foo", "foo-amd64-1", "foo-i686-2", true, "native architecture"},
+		{"/bin/foo", "foo-i686-2", "foo-amd64-1", false, "native architecture"},
+		{"/bin/bar", "bar-amd64-1", "bar-i686-1", false, "pinned"},
+	} {
+		got, reason := policy.precedes(tt.path, tt.a, tt.b)
+		if got != tt.want || reason != tt.wantReason {
+			t.Errorf("precedes(%s, %s, %s) = %v, %q, want %v, %q", tt.path, tt.a, tt.b, got, reason, tt.want, tt.wantReason)
+		}
+	}
+
+	conflicts := policy.FindConflicts(map[string][]string{
+		"bash-amd64-5.0-4":     {"bin/bash", "bin/sh"},
+		"bash-amd64-5.0-5":     {"bin/bash", "bin/sh"},
+		"busybox-amd64-1.31-2": {"bin/sh", "out/lib/pkgconfig/busybox.pc"},
+		"foo-amd64-1":          {"bin/foo"},
+		"foo-i686-2":           {"bin/foo"},
+	})
+	want := []Conflict{
+		{
+			Path:   "/bin/foo",
+			Pkgs:   []string{"foo-amd64-1", "foo-i686-2"},
+			Reason: "native architecture",
+		},
+		{
+			Path:   "/bin/sh",
+			Pkgs:   []string{"busybox-amd64-1.31-2", "bash-amd64-5.0-5", "bash-amd64-5.0-4"},
+			Reason: "pinned",
+		},
+	}
+	if diff := cmp.Diff(want, conflicts); diff != "" {
+		t.Errorf("FindConflicts: unexpected conflicts: diff (-want +got):\n%s", diff)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, PinsFile), []byte("pin /bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConflictPolicy(dir); err == nil {
+		t.Errorf("LoadConflictPolicy unexpectedly succeeded for malformed %s", PinsFile)
+	}
+}
+
+func TestExchangeConflicts(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distri-conflicts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	pkgs := []string{"bash-amd64-5.0-4", "busybox-amd64-1.31-2", "dash-amd64-0.5-1"}
+	for _, pkg := range pkgs {
+		writeTestPackage(t, repo, pkg, nil, "bin/sh")
+	}
+
+	linkTarget := func(fs *fuseFS) string {
+		t.Helper()
+		dirent, ok := fs.dirs["/bin"].byName["sh"]
+		if !ok {
+			t.Fatalf("/bin/sh not found")
+		}
+		return dirent.linkTarget
+	}
+
+	// The result does not depend on the scan order:
+	for _, order := range [][]string{pkgs, {pkgs[2], pkgs[1], pkgs[0]}} {
+		fs := newTestFS(repo)
+		if err := fs.scanPackages(&nopLocker{}, order); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := linkTarget(fs), "../bash-amd64-5.0-4/bin/sh"; got != want {
+			t.Errorf("scan order %q: /bin/sh = %q, want %q", order, got, want)
+		}
+	}
+
+	fs := newTestFS(repo)
+	fs.policy.pins = map[string]string{"/bin/sh": "dash"}
+	if err := fs.scanPackages(&nopLocker{}, pkgs); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := linkTarget(fs), "../dash-amd64-0.5-1/bin/sh"; got != want {
+		t.Errorf("/bin/sh = %q, want %q", got, want)
+	}
+	ctx := context.Background()
+	resp, err := fs.ListConflicts(ctx, &pb.ListConflictsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantReply := &pb.ListConflictsReply{
+		Conflict: []*pb.ListConflictsReply_Conflict{
+			{
+				Path:   proto.String("/bin/sh"),
+				Pkg:    []string{"dash-amd64-0.5-1", "bash-amd64-5.0-4", "busybox-amd64-1.31-2"},
+				Reason: proto.String("pinned"),
+			},
+		},
+	}
+	if diff := cmp.Diff(wantReply, resp, cmp.Comparer(proto.Equal)); diff != "" {
+		t.Errorf("ListConflicts: unexpected reply: diff (-want +got):\n%s", diff)
+	}
+
+	// Forgetting the package providing /bin/sh points /bin/sh to the package
+	// with the next highest precedence:
+	for _, tt := range []struct {
+		forget string
+		want   string
+	}{
+		{"dash-amd64-0.5-1", "../bash-amd64-5.0-4/bin/sh"},
+		{"bash-amd64-5.0-4", "../busybox-amd64-1.31-2/bin/sh"},
+	} {
+		if _, err := fs.ForgetPackage(ctx, &pb.ForgetPackageRequest{Pkg: proto.String(tt.forget)}); err != nil {
+			t.Fatal(err)
+		}
+		if got := linkTarget(fs); got != tt.want {
+			t.Errorf("after ForgetPackage(%s): /bin/sh = %q, want %q", tt.forget, got, tt.want)
+		}
+	}
+	if got := fs.listConflicts(); len(got) > 0 {
+		t.Errorf("listConflicts() = %v, want no conflicts", got)
+	}
+}
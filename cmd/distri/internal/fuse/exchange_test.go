@@ -0,0 +1,77 @@
+package fuse
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDeclaredExchangeDirs(t *testing.T) {
+	got := DeclaredExchangeDirs([]string{"/bin", "/out/lib"},
+		&pb.Meta{ExchangeDir: []string{"out/share/fonts", "/out/lib"}},
+		nil, // package without metadata
+		&pb.Meta{ExchangeDir: []string{"out/libexec/plugins/", "out", "out/share/fonts"}})
+	want := []string{"/bin", "/out/lib", "/out/libexec/plugins", "/out/share/fonts"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DeclaredExchangeDirs: diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestScanDeclaredExchangeDirs(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distri-exchange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	writeTestPackage(t, repo, "plugin-amd64-1", nil,
+		"out/libexec/plugins/plugin.so")
+	writeTestPackage(t, repo, "host-amd64-1", &pb.Meta{
+		Version:     proto.String("1"),
+		ExchangeDir: []string{"out/libexec/plugins"},
+	}, "out/libexec/plugins/builtin.so")
+
+	fs := newTestFS(repo)
+	if err := fs.scanPackages(&nopLocker{}, []string{"plugin-amd64-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fs.dirs["/libexec/plugins"]; ok {
+		t.Errorf("/libexec/plugins unexpectedly present before any package declared it")
+	}
+
+	// Scanning a package which declares an exchange directory makes the
+	// exchange directory available, including the files of packages which
+	// were scanned before:
+	if err := fs.scanPackages(&nopLocker{}, []string{"plugin-amd64-1", "host-amd64-1"}); err != nil {
+		t.Fatal(err)
+	}
+	dir, ok := fs.dirs["/libexec/plugins"]
+	if !ok {
+		t.Fatalf("/libexec/plugins not found")
+	}
+	want := map[string]string{
+		"builtin.so": "../../host-amd64-1/out/libexec/plugins/builtin.so",
+		"plugin.so":  "../../plugin-amd64-1/out/libexec/plugins/plugin.so",
+	}
+	got := make(map[string]string)
+	for name, dirent := range dir.byName {
+		got[name] = dirent.linkTarget
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("/libexec/plugins: diff (-want +got):\n%s", diff)
+	}
+
+	// -overlays disables exchange directory declarations:
+	fs = newTestFS(repo)
+	fs.exchangeDirs = []string{"/bin"}
+	fs.declaredDirs = false
+	if err := fs.scanPackages(&nopLocker{}, []string{"plugin-amd64-1", "host-amd64-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fs.dirs["/libexec/plugins"]; ok {
+		t.Errorf("/libexec/plugins unexpectedly present with -overlays")
+	}
+}
@@ -41,10 +41,14 @@ Example:
   % distri fuse /ro
 `
 
-// wellKnown lists paths which should be created as a union overlay underneath
+// ExchangeDirs lists paths which should be created as a union overlay underneath
 // /ro. E.g., /ro/bin will contain symlinks to all package’s bin directories, or
 // /ro/system will contain symlinks to all package’s
 // out/lib/systemd/system directories.
+//
+// These exchange directories are always provided. Packages can declare
+// additional exchange directories in their metadata (exchange_dir), see
+// DeclaredExchangeDirs.
 var ExchangeDirs = []string{
 	"/bin",
 	"/out/lib",
@@ -64,6 +68,33 @@ var ExchangeDirs = []string{
 
 // TODO: pprof label for each of the exchange dirs so that we can profile them
 
+// DeclaredExchangeDirs returns a copy of dirs (e.g. ExchangeDirs) plus the
+// exchange directories which are declared in the specified package metadata
+// (e.g. /out/share/fonts), unless already present.
+func DeclaredExchangeDirs(dirs []string, metas ...*pb.Meta) []string {
+	dirs = append([]string(nil), dirs...)
+	known := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		known[dir] = true
+	}
+	var declared []string
+	for _, meta := range metas {
+		for _, dir := range meta.GetExchangeDir() {
+			dir = filepath.Clean("/" + dir) // e.g. out/share/fonts → /out/share/fonts
+			if dir == "/" || dir == "/out" {
+				continue // would expose the entire package
+			}
+			if known[dir] {
+				continue
+			}
+			known[dir] = true
+			declared = append(declared, dir)
+		}
+	}
+	sort.Strings(declared)
+	return append(dirs, declared...)
+}
+
 const (
 	rootInode = 1
 	ctlInode  = 2
@@ -78,46 +109,27 @@ func (e *FileNotFoundError) Error() string {
 }
 
 func lookupComponent(rd *squashfs.Reader, parent squashfs.Inode, component string) (squashfs.Inode, error) {
-	rfis, err := rd.Readdir(parent)
+	inode, err := rd.Lookup(parent, component)
 	if err != nil {
-		return 0, err
-	}
-	for _, rfi := range rfis {
-		if rfi.Name() == component {
-			return rfi.Sys().(*squashfs.FileInfo).Inode, nil
+		if _, ok := err.(*squashfs.FileNotFoundError); ok {
+			return 0, &FileNotFoundError{path: component}
 		}
+		return 0, err
 	}
-	return 0, &FileNotFoundError{path: component}
+	return inode, nil
 }
 
+// LookupPath returns the inode of path within the image read by rd, following
+// symbolic links which point within the image.
 func LookupPath(rd *squashfs.Reader, path string) (squashfs.Inode, error) {
-	inode := rd.RootInode()
-	parts := strings.Split(path, "/")
-	for idx, part := range parts {
-		var err error
-		inode, err = lookupComponent(rd, inode, part)
-		if err != nil {
-			if _, ok := err.(*FileNotFoundError); ok {
-				return 0, &FileNotFoundError{path: path}
-			}
-			return 0, err
-		}
-		fi, err := rd.Stat("", inode)
-		if err != nil {
-			return 0, xerrors.Errorf("Stat(%d): %v", inode, err)
-		}
-		if fi.Mode()&os.ModeSymlink > 0 {
-			target, err := rd.ReadLink(inode)
-			if err != nil {
-				return 0, err
-			}
-			//log.Printf("component %q (full: %q) resolved to %q", part, parts[:idx+1], target)
-			target = filepath.Clean(filepath.Join(append(parts[:idx] /* parent */, target)...))
-			//log.Printf("-> %s", target)
-			return LookupPath(rd, target)
+	fi, err := rd.FS().Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, &FileNotFoundError{path: path}
 		}
+		return 0, err
 	}
-	return inode, nil
+	return fi.Sys().(*squashfs.FileInfo).Inode, nil
 }
 
 func Mount(args []string) (join func(context.Context) error, _ error) {
@@ -126,10 +138,15 @@ func Mount(args []string) (join func(context.Context) error, _ error) {
 	var (
 		repo         = fset.String("repo", env.DefaultRepo, "TODO")
 		readiness    = fset.Int("readiness", -1, "file descriptor on which to send readiness notification")
-		overlays     = fset.String("overlays", "", "comma-separated list of overlays to provide. if empty, all overlays will be provided")
+		overlays     = fset.String("overlays", "", "comma-separated list of overlays to provide. if empty, the default overlays plus all overlays declared in package metadata will be provided")
 		pkgsList     = fset.String("pkgs", "", "comma-separated list of packages to provide. if empty, all packages within -repo will be provided")
 		autoDownload = fset.Bool("autodownload", false, "simulate availability of all packages, automatically downloading them as required. works well for e.g. /ro-dbg")
+		lazy         = fset.Bool("lazy", false, "like -autodownload, but instead of downloading entire packages, fetch only the parts which are read (cached in -cache_dir)")
+		cacheDir     = fset.String("cache_dir", "/var/cache/distri/chunks", "directory in which -lazy caches package image chunks")
+		cacheSize    = fset.Int64("cache_size", 4<<30, "maximum size of -cache_dir in bytes. least recently used chunks are evicted")
+		listen       = fset.String("listen", "", "if non-empty, [host]:port on which to serve Prometheus metrics (/metrics) and a debug page (/debug/fuse)")
 		section      = fset.String("section", "pkg", "repository section to serve (one of pkg, debug)")
+		maxPages     = fset.Uint("max_pages", 256, "maximum number of pages (4 KiB each) per FUSE request, e.g. when reading files. 0 uses the kernel default of 32 pages")
 	)
 	fset.Usage = func() {
 		fmt.Fprintln(os.Stderr, help)
@@ -145,41 +162,68 @@ func Mount(args []string) (join func(context.Context) error, _ error) {
 
 	// TODO: do what fusermount -u does, i.e. umount2("/ro-dbg", UMOUNT_NOFOLLOW)
 
+	exchangeDirs := append([]string(nil), ExchangeDirs...)
 	if *overlays != "" {
-		var filtered []string
-		permitted := make(map[string]bool)
+		exchangeDirs = nil
 		for _, overlay := range strings.Split(strings.TrimSpace(*overlays), ",") {
 			if overlay == "" {
 				continue
 			}
-			permitted[overlay] = true
-		}
-		for _, dir := range ExchangeDirs {
-			if !permitted[dir] {
-				continue
-			}
-			filtered = append(filtered, dir)
+			exchangeDirs = append(exchangeDirs, overlay)
 		}
-		ExchangeDirs = filtered
 	}
 
-	// TODO: use inotify to efficiently get updates to the store
-
 	fs := &fuseFS{
 		repo:         *repo,
+		exchangeDirs: exchangeDirs,
+		declaredDirs: *overlays == "",
+		mountpoint:   mountpoint,
 		autoDownload: *autoDownload,
+		lazy:         *lazy,
 		repoSection:  *section,
 		fileReaders:  make(map[fuseops.InodeID]*io.SectionReader),
 		inodeCnt:     2, // root + ctl inode
 		dirs:         make(map[string]*dir),
 		inodes:       make(map[fuseops.InodeID]interface{}),
 		unions:       make(map[fuseops.InodeID][]fuseops.InodeID),
+		origins:      make(map[string]string),
 	}
+	policy, err := LoadConflictPolicy(env.DistriConfig)
+	if err != nil {
+		return nil, err
+	}
+	fs.policy = *policy
 	dir := &dir{
 		byName: make(map[string]*dirent),
+		inode:  fuseops.RootInodeID,
 	}
 	fs.dirs["/"] = dir
 	fs.inodes[fs.inodeCnt] = dir
+	if fs.lazy {
+		var err error
+		fs.cache, err = openChunkCache(*cacheDir, *cacheSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Watch the repo before scanning it, so that packages which are added to
+	// or removed from the repo (e.g. by distri install, distri gc or rsync)
+	// while starting up are picked up, too.
+	stopWatch := func() error { return nil }
+	if *pkgsList == "" {
+		stop, err := fs.watchRepo()
+		if err != nil {
+			log.Printf("not watching %s for changes: %v", fs.repo, err)
+		} else {
+			stopWatch = stop
+		}
+	}
+	defer func() {
+		if join == nil {
+			stopWatch() // Mount failed
+		}
+	}()
 
 	var pkgs []string
 	if *pkgsList != "" {
@@ -191,20 +235,23 @@ func Mount(args []string) (join func(context.Context) error, _ error) {
 			return nil, err
 		}
 	}
+	// The repo watch might rescan concurrently:
+	fs.mu.Lock()
 	fs.growReaders(len(pkgs))
-
-	if err := fs.scanPackages(&nopLocker{}, pkgs); err != nil {
+	err = fs.scanPackages(&nopLocker{}, pkgs)
+	fs.mu.Unlock()
+	if err != nil {
 		return nil, err
 	}
 
-	if fs.autoDownload {
+	if fs.autoDownload || fs.lazy {
 		if err := fs.updatePackages(); err != nil {
 			log.Printf("updatePackages: %v", err)
 		}
 	}
 
 	var libRequested bool
-	for _, dir := range ExchangeDirs {
+	for _, dir := range fs.exchangeDirs {
 		if dir == "/lib" {
 			libRequested = true
 			break
@@ -214,11 +261,29 @@ func Mount(args []string) (join func(context.Context) error, _ error) {
 		// Even if the /lib exchange dir was not requested, we still need to
 		// provide a symlink to ld-linux.so, which is used as the .interp of our
 		// ELF binaries.
+		fs.mu.Lock()
 		fs.mkExchangeDirAll(&nopLocker{}, "/lib")
-		fs.symlink(fs.dirs["/lib"], "../glibc-amd64-2.27-1/out/lib/ld-linux-x86-64.so.2")
+		fs.symlink("/lib", fs.dirs["/lib"], "../glibc-amd64-2.27-1/out/lib/ld-linux-x86-64.so.2")
+		fs.mu.Unlock()
 	}
 
-	server := fuseutil.NewFileSystemServer(fs)
+	if *listen != "" {
+		ln, err := net.Listen("tcp", *listen)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("serving metrics on http://%s/metrics", ln.Addr())
+		go func() {
+			if err := http.Serve(ln, fs.httpHandler()); err != nil {
+				log.Printf("serving metrics: %v", err)
+			}
+		}()
+	}
+
+	server := &notifyingServer{
+		Server: fuseutil.NewFileSystemServer(fs),
+		fs:     fs,
+	}
 
 	go func() {
 		c := make(chan os.Signal, 1)
@@ -266,21 +331,33 @@ func Mount(args []string) (join func(context.Context) error, _ error) {
 			"allow_other": "", // allow all users to read files
 			"suid":        "",
 		},
+		// Return attributes along with directory entries: listing e.g. /ro/bin
+		// would otherwise result in one LookUpInode per entry.
+		EnableReaddirplus:     true,
+		EnableReaddirplusAuto: true,
+		// The file system is read-only, so directory operations can safely run
+		// concurrently.
+		EnableParallelDirOps: true,
+		MaxPages:             uint16(*maxPages),
 		//DebugLogger: log.New(os.Stderr, "[debug] ", log.LstdFlags),
 	})
 	if err != nil {
 		return nil, xerrors.Errorf("fuse.Mount: %v", err)
 	}
-	join = mfs.Join
+	join = func(ctx context.Context) error {
+		defer stopWatch()
+		return mfs.Join(ctx)
+	}
 
 	{
 		tempdir, err := ioutil.TempDir("", "distri-fuse")
 		if err != nil {
 			return nil, err
 		}
+		mfsJoin := join
 		join = func(ctx context.Context) error {
 			defer os.RemoveAll(tempdir)
-			return mfs.Join(ctx)
+			return mfsJoin(ctx)
 		}
 		fs.ctl = filepath.Join(tempdir, "distri-fuse-ctl")
 		ln, err := net.Listen("unix", fs.ctl)
@@ -311,62 +388,117 @@ func Mount(args []string) (join func(context.Context) error, _ error) {
 // * LookUpInode returns inode and mode()
 // * GetInodeAttributes returns mode()
 // * ReadSymlink returns linkTarget
+// * ReadFile returns the synthesized contents (see synth.go)
 type dirent struct {
 	name       string // e.g. "xterm"
 	linkTarget string // e.g. "../../xterm-amd64-23/bin/xterm". Empty for directories
 	inode      fuseops.InodeID
+	synth      *synthState // non-nil for synthesized files, e.g. ld.so.cache
 }
 
 func (d *dirent) typ() fuseutil.DirentType {
-	if d.linkTarget != "" {
+	if d.linkTarget != "" || d.synth != nil {
 		return fuseutil.DT_File
 	}
 	return fuseutil.DT_Directory
 }
 
 func (d *dirent) mode() os.FileMode {
+	if d.synth != nil {
+		return 0444
+	}
 	if d.linkTarget != "" {
 		return os.ModeSymlink | 0444
 	}
 	return os.ModeDir | 0555
 }
 
+// direntAttributes returns the attributes of d. fs.mu must not be held: the
+// size of synthesized files is only known once they are generated.
+func (fs *fuseFS) direntAttributes(ctx context.Context, d *dirent) (fuseops.InodeAttributes, error) {
+	attr := fuseops.InodeAttributes{
+		Nlink: 1, // TODO: number of incoming hard links to this inode
+		Mode:  d.mode(),
+		Atime: time.Now(), // TODO
+		Mtime: time.Now(), // TODO
+		Ctime: time.Now(), // TODO
+	}
+	if d.synth != nil {
+		b, err := fs.synthesize(ctx, d)
+		if err != nil {
+			return attr, fuse.EIO
+		}
+		attr.Size = uint64(len(b))
+	}
+	return attr, nil
+}
+
 type dir struct {
 	entries []*dirent          // ReadDir requires deterministic iteration order
 	byName  map[string]*dirent // LookUpInode profits from fast access by name
+	inode   fuseops.InodeID    // for cache invalidations (see notify.go)
 }
 
 type squashfsReader struct {
 	*squashfs.Reader
 
-	file *os.File // for closing it in Destroy
+	file io.Closer // for closing it in Destroy
+}
 
-	dircacheMu sync.Mutex
-	dircache   map[squashfs.Inode]map[string]fuseops.ChildInodeEntry
+// close releases the memory mapping of the image (if any) and closes its file.
+func (rd *squashfsReader) close() error {
+	if err := rd.Reader.Close(); err != nil {
+		rd.file.Close()
+		return err
+	}
+	return rd.file.Close()
 }
 
 type fuseFS struct {
 	fuseutil.NotImplementedFileSystem
 
 	repo         string
+	mountpoint   string
 	ctl          string
 	autoDownload bool
-	repoSection  string // e.g. “debug” (default “pkg”)
+	lazy         bool
+	cache        *chunkCache // only if lazy
+	repoSection  string      // e.g. “debug” (default “pkg”)
+	// exchangeDirs are the exchange directories to provide, see ExchangeDirs.
+	exchangeDirs []string
+	// declaredDirs is true if exchange directories declared in package
+	// metadata are added to exchangeDirs (i.e. -overlays was not specified).
+	declaredDirs bool
 
 	mu       sync.Mutex
 	inodeCnt fuseops.InodeID
 	dirs     map[string]*dir
 	inodes   map[fuseops.InodeID]interface{} // *dirent (file) or *dir (dir)
 	unions   map[fuseops.InodeID][]fuseops.InodeID
+	// origins maps the name of each package which was added by updatePackages
+	// to the URL of the repository section which advertised it.
+	origins map[string]string
 	// pkgs is only ever appended to (empty strings are tombstones), because the
 	// inode for /<pkg> is an index into pkgs.
 	pkgs []string
 	// readers contains one SquashFS reader for every package, or nil if the
-	// package has not yet been accessed.
+	// package has not yet been accessed (or was removed by ForgetPackage).
 	readers []*squashfsReader
+	// policy resolves conflicts between packages providing the same exchange
+	// directory entry.
+	policy ConflictPolicy
+	// conflicts maps exchange directory entries which are provided by more than
+	// one package (e.g. /bin/sh) to the link target into each package.
+	conflicts map[string]map[string]string
+	// synth contains the state of each of the synthesizers, see synth.go.
+	synth []*synthState
 
 	fileReadersMu sync.Mutex
 	fileReaders   map[fuseops.InodeID]*io.SectionReader
+
+	notifier notifier
+
+	metrics fuseMetrics
 }
 
 func (fs *fuseFS) growReaders(n int) {
@@ -376,12 +508,6 @@ func (fs *fuseFS) growReaders(n int) {
 	fs.readers = readers
 }
 
-func (fs *fuseFS) reader(image int) *squashfsReader {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
-	return fs.readers[image]
-}
-
 func (fs *fuseFS) union(inode fuseops.InodeID) []fuseops.InodeID {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
@@ -415,13 +541,18 @@ func (fs *fuseFS) mkExchangeDirAll(mu sync.Locker, path string) {
 			name:  component,
 			inode: fs.allocateInodeLocked(),
 		}
+		dir.inode = dirent.inode
 		parent.entries = append(parent.entries, dirent)
 		parent.byName[dirent.name] = dirent // might shadow an old symlink dirent
 		fs.inodes[dirent.inode] = dir
+		fs.invalidateEntryLocked(parent, dirent.name)
 	}
 }
 
-func (fs *fuseFS) symlink(dir *dir, target string) {
+// symlink adds a symlink to target to dir, the exchange directory at path. If
+// dir already contains an entry of the same name, fs.policy decides which
+// package provides the entry.
+func (fs *fuseFS) symlink(path string, dir *dir, target string) {
 	base := filepath.Base(target)
 	for idx, entry := range dir.entries {
 		if entry == nil || entry.name != base {
@@ -430,9 +561,8 @@ func (fs *fuseFS) symlink(dir *dir, target string) {
 		if entry.linkTarget == "" {
 			return // do not shadow exchange directories
 		}
-		if distri.ParseVersion(target).Pkg == distri.ParseVersion(entry.linkTarget).Pkg &&
-			distri.PackageRevisionLess(target, entry.linkTarget) {
-			return // more recent link target already in place
+		if !fs.resolveConflict(filepath.Join(path, base), entry.linkTarget, target) {
+			return // link target with higher precedence already in place
 		}
 		dir.entries[idx] = nil // tombstone
 		break
@@ -445,6 +575,7 @@ func (fs *fuseFS) symlink(dir *dir, target string) {
 	dir.entries = append(dir.entries, dirent)
 	dir.byName[base] = dirent
 	fs.inodes[dirent.inode] = dirent
+	fs.invalidateEntryLocked(dir, base)
 }
 
 func (fs *fuseFS) findPackages() ([]string, error) {
@@ -513,14 +644,16 @@ func (fs *fuseFS) scanPackagesSymlink(mu sync.Locker, rd *squashfs.Reader, pkg s
 				return err
 			}
 			mu.Lock()
-			fs.symlink(dir, rel)
+			fs.symlink(exchangePath, dir, rel)
 			mu.Unlock()
 		}
 	}
 	return nil
 }
 
-func (fs *fuseFS) scanPackage(mu sync.Locker, idx int, pkg string) error {
+// scanPackageSymlinks scans the exchange directories dirs of pkg, which must
+// be present in the repo.
+func (fs *fuseFS) scanPackageSymlinks(mu sync.Locker, pkg string, dirs []string) error {
 	f, err := os.Open(filepath.Join(fs.repo, pkg+".squashfs"))
 	if err != nil {
 		return err
@@ -530,16 +663,21 @@ func (fs *fuseFS) scanPackage(mu sync.Locker, idx int, pkg string) error {
 	if err != nil {
 		return err
 	}
+	return fs.scanPackagesSymlink(mu, rd, pkg, dirs)
+}
 
-	// set up runtime_unions:
-	meta, err := pb.ReadMetaFile(filepath.Join(fs.repo, pkg+".meta.textproto"))
+func (fs *fuseFS) scanPackage(mu sync.Locker, idx int, pkg string, meta *pb.Meta, exchangeDirs []string) error {
+	f, err := os.Open(filepath.Join(fs.repo, pkg+".squashfs"))
 	if err != nil {
-		if os.IsNotExist(err) {
-			log.Print(err)
-			return nil // recover by skipping this package
-		}
 		return err
 	}
+	defer f.Close()
+	rd, err := squashfs.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	// set up runtime_unions:
 	for _, o := range meta.GetRuntimeUnion() {
 		// log.Printf("%s: runtime union: %v", pkg, o)
 		image := -1
@@ -565,10 +703,7 @@ func (fs *fuseFS) scanPackage(mu sync.Locker, idx int, pkg string) error {
 			return err
 		}
 
-		err = fs.mountImage(image)
-		mu.Lock()
-		rd := fs.readers[image]
-		mu.Unlock()
+		rd, err := fs.mountImage(image)
 		if err != nil {
 			return err
 		}
@@ -587,10 +722,9 @@ func (fs *fuseFS) scanPackage(mu sync.Locker, idx int, pkg string) error {
 		dstfuse := fs.fuseInode(idx, dstinode)
 		fs.unions[srcfuse] = append(fs.unions[srcfuse], dstfuse)
 		mu.Unlock()
-		delete(rd.dircache, srcinode) // invalidate dircache
 	}
 
-	if err := fs.scanPackagesSymlink(mu, rd, pkg, ExchangeDirs); err != nil {
+	if err := fs.scanPackagesSymlink(mu, rd, pkg, exchangeDirs); err != nil {
 		return err
 	}
 
@@ -602,16 +736,58 @@ func (fs *fuseFS) scanPackages(mu sync.Locker, pkgs []string) error {
 	defer func() {
 		log.Printf("scanPackages in %v", time.Since(start))
 	}()
-	// TODO: iterate over packages once, calling mkdir for all exchange dirs
-	for _, dir := range ExchangeDirs {
-		fs.mkExchangeDirAll(mu, strings.TrimPrefix(dir, "/out"))
-	}
-
 	existing := make(map[string]bool)
 	for _, pkg := range fs.pkgs {
+		if pkg == "" {
+			continue // tombstone
+		}
 		existing[pkg] = true
 	}
 
+	// Read the metadata of all new packages first: packages can declare
+	// additional exchange directories, for which all packages need to be
+	// scanned.
+	metas := make([]*pb.Meta, len(pkgs))
+	{
+		var eg errgroup.Group
+		for idx, pkg := range pkgs {
+			if existing[pkg] {
+				continue
+			}
+			idx, pkg := idx, pkg // copy
+			eg.Go(func() error {
+				meta, err := pb.ReadMetaFile(filepath.Join(fs.repo, pkg+".meta.textproto"))
+				if err != nil {
+					if os.IsNotExist(err) {
+						log.Print(err)
+						return nil // recover by skipping this package
+					}
+					return err
+				}
+				metas[idx] = meta
+				return nil
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			return err
+		}
+	}
+	var added []string // exchange directories declared by new packages
+	if fs.declaredDirs {
+		known := len(fs.exchangeDirs)
+		fs.exchangeDirs = DeclaredExchangeDirs(fs.exchangeDirs, metas...)
+		added = fs.exchangeDirs[known:]
+		if len(added) > 0 && len(fs.pkgs) > 0 {
+			log.Printf("new exchange directories declared: %q", added)
+		}
+	}
+	exchangeDirs := fs.exchangeDirs
+
+	// TODO: iterate over packages once, calling mkdir for all exchange dirs
+	for _, dir := range exchangeDirs {
+		fs.mkExchangeDirAll(mu, strings.TrimPrefix(dir, "/out"))
+	}
+
 	{
 		mu := mu // shadow, possibly overwrite:
 		if _, ok := mu.(*nopLocker); ok {
@@ -622,14 +798,23 @@ func (fs *fuseFS) scanPackages(mu sync.Locker, pkgs []string) error {
 		for idx, pkg := range pkgs {
 			if existing[pkg] {
 				delete(existing, pkg) // left-overs are deleted packages
+				if len(added) > 0 {
+					pkg := pkg // copy
+					eg.Go(func() error {
+						return fs.scanPackageSymlinks(mu, pkg, added)
+					})
+				}
 				continue
 			}
 			mu.Lock()
 			fs.pkgs = append(fs.pkgs, pkg)
 			mu.Unlock()
+			if metas[idx] == nil {
+				continue // metadata missing, see above
+			}
 			idx, pkg := idx, pkg // copy
 			eg.Go(func() error {
-				return fs.scanPackage(mu, idx, pkg)
+				return fs.scanPackage(mu, idx, pkg, metas[idx], exchangeDirs)
 			})
 		}
 		if err := eg.Wait(); err != nil {
@@ -637,81 +822,105 @@ func (fs *fuseFS) scanPackages(mu sync.Locker, pkgs []string) error {
 		}
 	}
 
-	if leftover := existing; len(leftover) > 0 {
-		// iterate through all symlinks, checking if they begin with /ro/<pkg>,
-		// and <pkg> matching any of the still-present ones
-		scan := make(map[string]bool)
-		for path, dir := range fs.dirs {
-			for idx, dirent := range dir.entries {
-				if dirent == nil {
-					continue // tombstone
-				}
-				if dirent.linkTarget == "" {
-					continue // subdirectory
-				}
-				// e.g. /lib/pkgconfig/bash.pc → ../../bash-amd64-1/out/lib/pkgconfig/bash.pc
-				target := filepath.Clean(filepath.Join(filepath.Dir(path), dirent.linkTarget))
-				// target is now /bash-amd64-1/out/lib/pkgconfig/bash.pc
-				pkg := target[1 : 1+strings.IndexByte(target[1:], '/')]
-				if leftover[pkg] {
-					scan[path] = true
-
-					// delete, in case there is no stand-in (or the stand-in
-					// does not contain the file)
-					delete(dir.byName, dirent.name)
-					dir.entries[idx] = nil // tombstone
-				}
+	if len(existing) > 0 {
+		// Tombstone deleted packages, so that they are scanned again if they
+		// re-appear. Packages of remote repositories (see updatePackages) are
+		// not expected in the repo and remain available.
+		mu.Lock()
+		for image, pkg := range fs.pkgs {
+			if existing[pkg] && fs.origins[pkg] == "" {
+				fs.forgetImageLocked(image)
 			}
 		}
-		affectedExchangeDirs := make([]string, 0, len(scan))
-		for path := range scan {
-			affectedExchangeDirs = append(affectedExchangeDirs, path)
+		mu.Unlock()
+		if err := fs.removeSymlinks(mu, existing); err != nil {
+			return err
 		}
-		for deleted := range existing {
-			var standin string
-			for _, arch := range []string{"amd64", "i686"} {
-				archmiddle := "-" + arch + "-"
-				if !strings.Contains(deleted, archmiddle) {
-					continue
-				}
-				source := deleted[:strings.Index(deleted, archmiddle)+len(archmiddle)]
-				matches, err := filepath.Glob(filepath.Join(fs.repo, source+"*.squashfs"))
-				if err != nil {
-					return err
-				}
-				if len(matches) == 0 {
-					continue
-				}
-				for idx, m := range matches {
-					matches[idx] = strings.TrimSuffix(filepath.Base(m), ".squashfs")
-				}
-				sort.Slice(matches, func(i, j int) bool {
-					return distri.PackageRevisionLess(matches[j], matches[i]) // reverse
-				})
-				standin = matches[0]
-				break
+	}
+
+	fs.growReaders(len(fs.pkgs))
+
+	mu.Lock()
+	fs.updateSynthesized()
+	mu.Unlock()
+
+	return nil
+}
+
+// removeSymlinks removes the exchange directory symlinks pointing into any of
+// the removed packages. Where another version of a removed package is available
+// in the repository, the symlinks are pointed to that version instead.
+func (fs *fuseFS) removeSymlinks(mu sync.Locker, leftover map[string]bool) error {
+	// iterate through all symlinks, checking if they begin with /ro/<pkg>,
+	// and <pkg> matching any of the still-present ones
+	scan := make(map[string]bool)
+	for path, dir := range fs.dirs {
+		for idx, dirent := range dir.entries {
+			if dirent == nil {
+				continue // tombstone
+			}
+			if dirent.linkTarget == "" {
+				continue // subdirectory
+			}
+			// e.g. /lib/pkgconfig/bash.pc → ../../bash-amd64-1/out/lib/pkgconfig/bash.pc
+			target := filepath.Clean(filepath.Join(filepath.Dir(path), dirent.linkTarget))
+			// target is now /bash-amd64-1/out/lib/pkgconfig/bash.pc
+			pkg := target[1 : 1+strings.IndexByte(target[1:], '/')]
+			if leftover[pkg] {
+				scan[path] = true
+
+				// delete, in case there is no stand-in (or the stand-in
+				// does not contain the file)
+				delete(dir.byName, dirent.name)
+				dir.entries[idx] = nil // tombstone
+				fs.invalidateEntryLocked(dir, dirent.name)
 			}
-			if standin == "" {
+		}
+	}
+	// Point entries which other packages provide as well to the package with
+	// the next highest precedence:
+	fs.forgetConflicts(leftover)
+	affectedExchangeDirs := make([]string, 0, len(scan))
+	for path := range scan {
+		affectedExchangeDirs = append(affectedExchangeDirs, path)
+	}
+	for deleted := range leftover {
+		var standin string
+		for _, arch := range []string{"amd64", "i686"} {
+			archmiddle := "-" + arch + "-"
+			if !strings.Contains(deleted, archmiddle) {
 				continue
 			}
-			f, err := os.Open(filepath.Join(fs.repo, standin+".squashfs"))
+			source := deleted[:strings.Index(deleted, archmiddle)+len(archmiddle)]
+			matches, err := filepath.Glob(filepath.Join(fs.repo, source+"*.squashfs"))
 			if err != nil {
 				return err
 			}
-			defer f.Close()
-			rd, err := squashfs.NewReader(f)
-			if err != nil {
-				return err
+			pkgs := matches[:0]
+			for _, m := range matches {
+				pkg := strings.TrimSuffix(filepath.Base(m), ".squashfs")
+				if leftover[pkg] {
+					continue // e.g. forgotten, but not yet deleted
+				}
+				pkgs = append(pkgs, pkg)
 			}
-
-			if err := fs.scanPackagesSymlink(mu, rd, standin, affectedExchangeDirs); err != nil {
-				return err
+			matches = pkgs
+			if len(matches) == 0 {
+				continue
 			}
+			sort.Slice(matches, func(i, j int) bool {
+				return distri.PackageRevisionLess(matches[j], matches[i]) // reverse
+			})
+			standin = matches[0]
+			break
+		}
+		if standin == "" {
+			continue
+		}
+		if err := fs.scanPackageSymlinks(mu, standin, affectedExchangeDirs); err != nil {
+			return err
 		}
 	}
-
-	fs.growReaders(len(fs.pkgs))
-
 	return nil
 }
 
@@ -720,36 +929,86 @@ type nopLocker struct{}
 func (*nopLocker) Lock()   {}
 func (*nopLocker) Unlock() {}
 
-// TODO: read this from a config file, remove trailing slash if any (always added by caller)
-const remote = "https://repo.distr1.org/distri/master/debug"
-
-func (fs *fuseFS) updatePackages() error {
-	repos, err := env.Repos()
-	if err != nil {
-		return xerrors.Errorf("env.Repos: %v", err)
+// remote returns the URL of the repository section from which pkg is fetched,
+// e.g. https://repo.distr1.org/distri/jackherer/debug.
+func (fs *fuseFS) remote(pkg string) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	section, ok := fs.origins[pkg]
+	if !ok {
+		return "", xerrors.Errorf("%s: not advertised by any repository", pkg)
 	}
+	return section, nil
+}
 
-	if len(repos) == 0 {
-		return xerrors.Errorf("no repositories configured")
-	}
-	// TODO: make this code work with multiple repos
-	resp, err := http.Get(repos[0].Path + "/" + fs.repoSection + "/meta.binaryproto")
+func fetchMirrorMeta(section string) (*pb.MirrorMeta, error) {
+	resp, err := http.Get(section + "/meta.binaryproto")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 	if got, want := resp.StatusCode, http.StatusOK; got != want {
-		return xerrors.Errorf("HTTP status %v", resp.Status)
+		return nil, xerrors.Errorf("HTTP status %v", resp.Status)
 	}
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return xerrors.Errorf("reading meta.binaryproto: %v", err)
+		return nil, xerrors.Errorf("reading meta.binaryproto: %v", err)
 	}
 	var mm pb.MirrorMeta
 	if err := proto.Unmarshal(b, &mm); err != nil {
-		return err
+		return nil, err
+	}
+	return &mm, nil
+}
+
+// updatePackages makes available all packages which are advertised by any of
+// the configured repositories. When multiple repositories advertise the same
+// package, the repository which comes first in env.Repos takes precedence.
+func (fs *fuseFS) updatePackages() error {
+	repos, err := env.Repos()
+	if err != nil {
+		return xerrors.Errorf("env.Repos: %v", err)
+	}
+
+	if len(repos) == 0 {
+		return xerrors.Errorf("no repositories configured")
+	}
+
+	var (
+		eg       errgroup.Group
+		sections = make([]string, len(repos))
+		metas    = make([]*pb.MirrorMeta, len(repos))
+	)
+	for idx, repo := range repos {
+		idx := idx // copy
+		sections[idx] = strings.TrimSuffix(repo.Path, "/") + "/" + fs.repoSection
+		if !strings.HasPrefix(repo.Path, "http://") &&
+			!strings.HasPrefix(repo.Path, "https://") {
+			log.Printf("skipping repository %s: not an HTTP repository", repo.Path)
+			continue
+		}
+		eg.Go(func() error {
+			mm, err := fetchMirrorMeta(sections[idx])
+			if err != nil {
+				// Serve the packages of the remaining repositories.
+				log.Printf("%s: %v", sections[idx], err)
+				return nil
+			}
+			log.Printf("%s: %d remote packages", sections[idx], len(mm.GetPackage()))
+			metas[idx] = mm
+			return nil
+		})
+	}
+	eg.Wait()
+	var listed int
+	for _, mm := range metas {
+		if mm != nil {
+			listed++
+		}
+	}
+	if listed == 0 {
+		return xerrors.Errorf("could not list packages of any of the %d configured repositories", len(repos))
 	}
-	log.Printf("%d remote packages", len(mm.GetPackage()))
 
 	existing := make(map[string]bool)
 	fs.mu.Lock()
@@ -757,69 +1016,101 @@ func (fs *fuseFS) updatePackages() error {
 	for _, pkg := range fs.pkgs {
 		existing[pkg] = true
 	}
-	for _, pkg := range mm.GetPackage() {
-		if existing[pkg.GetName()] {
-			continue
-		}
-		fs.pkgs = append(fs.pkgs, pkg.GetName())
-		for _, p := range pkg.GetWellKnownPath() {
-			exchangePath := "/" + strings.TrimPrefix(filepath.Dir(p), "out/")
-			fs.mkExchangeDirAll(&nopLocker{}, exchangePath)
-			dir, ok := fs.dirs[exchangePath]
-			if !ok {
-				panic(fmt.Sprintf("BUG: fs.dirs[%q] not found", exchangePath))
+	for idx, mm := range metas {
+		for _, pkg := range mm.GetPackage() {
+			if existing[pkg.GetName()] {
+				continue
 			}
-			rel, err := filepath.Rel(exchangePath, filepath.Join("/", pkg.GetName(), p))
-			if err != nil {
-				return err
+			existing[pkg.GetName()] = true
+			fs.origins[pkg.GetName()] = sections[idx]
+			fs.pkgs = append(fs.pkgs, pkg.GetName())
+			for _, p := range pkg.GetWellKnownPath() {
+				exchangePath := "/" + strings.TrimPrefix(filepath.Dir(p), "out/")
+				fs.mkExchangeDirAll(&nopLocker{}, exchangePath)
+				dir, ok := fs.dirs[exchangePath]
+				if !ok {
+					panic(fmt.Sprintf("BUG: fs.dirs[%q] not found", exchangePath))
+				}
+				rel, err := filepath.Rel(exchangePath, filepath.Join("/", pkg.GetName(), p))
+				if err != nil {
+					return err
+				}
+				fs.symlink(exchangePath, dir, rel)
 			}
-			fs.symlink(dir, rel)
 		}
 	}
 
 	fs.growReaders(len(fs.pkgs))
+	fs.updateSynthesized()
 
 	return nil
 }
 
-func (fs *fuseFS) mountImage(image int) error {
+// mountImage returns the reader for image, opening the image when it is first
+// accessed. Images of packages which were removed by ForgetPackage result in
+// fuse.ENOENT.
+func (fs *fuseFS) mountImage(image int) (*squashfsReader, error) {
 	//log.Printf("mountImage(%d)", image)
-	if fs.reader(image) != nil {
-		return nil // already mounted
-	}
-
 	fs.mu.Lock()
-	pkg := fs.pkgs[image]
+	rd, pkg := fs.readers[image], fs.pkgs[image]
 	fs.mu.Unlock()
+	if rd != nil {
+		return rd, nil // already mounted
+	}
+	if pkg == "" {
+		return nil, fuse.ENOENT // tombstone, see ForgetPackage
+	}
 	log.Printf("mounting %s", pkg)
 
-	// var err error
-	// f := &httpReaderAt{fileurl: "http://localhost:7080/" + pkg + ".squashfs"}
+	var f interface {
+		io.ReaderAt
+		io.Closer
+	}
 	f, err := os.Open(filepath.Join(fs.repo, pkg+".squashfs"))
 	if err != nil {
 		if !os.IsNotExist(err) {
-			return err
+			return nil, err
 		}
-		if !fs.autoDownload {
-			return err
+		if !fs.lazy && !fs.autoDownload {
+			return nil, err
 		}
-		f, err = autodownload(fs.repo, remote+"/"+pkg+".squashfs")
+		section, err := fs.remote(pkg)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		defer fs.metrics.observeAutodownload(time.Now())
+		if fs.lazy {
+			f, err = openLazyImage(section+"/"+pkg+".squashfs", fs.cache)
+		} else {
+			f, err = autodownload(fs.repo, section+"/"+pkg+".squashfs")
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
-	rd, err := squashfs.NewReader(f)
+	sqrd, err := squashfs.NewReader(f)
 	if err != nil {
-		return err
+		f.Close()
+		return nil, err
+	}
+	rd = &squashfsReader{
+		file:   f,
+		Reader: sqrd,
 	}
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
-	fs.readers[image] = &squashfsReader{
-		file:     f,
-		Reader:   rd,
-		dircache: make(map[squashfs.Inode]map[string]fuseops.ChildInodeEntry),
-	}
-	return nil
+	if fs.pkgs[image] == "" {
+		// ForgetPackage was called while the image was being opened.
+		rd.close()
+		return nil, fuse.ENOENT
+	}
+	if cur := fs.readers[image]; cur != nil {
+		// A concurrent mountImage call was faster.
+		rd.close()
+		return cur, nil
+	}
+	fs.readers[image] = rd
+	return rd, nil
 }
 
 func (fs *fuseFS) squashfsInode(i fuseops.InodeID) (int, squashfs.Inode, error) {
@@ -832,10 +1123,11 @@ func (fs *fuseFS) squashfsInode(i fuseops.InodeID) (int, squashfs.Inode, error)
 		if image == -1 {
 			return image, 1, nil
 		}
-		if err := fs.mountImage(image); err != nil {
+		rd, err := fs.mountImage(image)
+		if err != nil {
 			return 0, 0, err
 		}
-		return image, fs.reader(image).RootInode(), nil
+		return image, rd.RootInode(), nil
 	}
 
 	return image, squashfs.Inode(i), nil
@@ -847,13 +1139,25 @@ func (fs *fuseFS) fuseInode(image int, i squashfs.Inode) fuseops.InodeID {
 }
 
 func (fs *fuseFS) fuseAttributes(fi os.FileInfo) fuseops.InodeAttributes {
+	nlink := uint32(1)
+	var uid, gid uint32
+	if sfi, ok := fi.Sys().(*squashfs.FileInfo); ok {
+		// Directories keep reporting 1, which tells programs such as find(1)
+		// that the number of subdirectories is unknown.
+		if !fi.IsDir() && sfi.Nlink > 0 {
+			nlink = sfi.Nlink
+		}
+		uid, gid = sfi.Uid, sfi.Gid
+	}
 	return fuseops.InodeAttributes{
 		Size:  uint64(fi.Size()),
-		Nlink: 1, // TODO: number of incoming hard links to this inode
+		Nlink: nlink,
 		Mode:  fi.Mode(),
 		Atime: fi.ModTime(),
 		Mtime: fi.ModTime(),
 		Ctime: fi.ModTime(),
+		Uid:   uid,
+		Gid:   gid,
 	}
 }
 
@@ -876,11 +1180,13 @@ func (fs *fuseFS) StatFS(ctx context.Context, op *fuseops.StatFSOp) error {
 var never = time.Now().Add(365 * 24 * time.Hour)
 
 // VirtualFileExpiration determines how long virtual files (e.g. exchange
-// directory contents) are cached. 1s matches the default entry_timeout FUSE
-// option. Larger values (e.g. never) have no effect.
+// directory contents) are cached when the kernel does not support cache
+// invalidations (see notify.go). 1s matches the default entry_timeout FUSE
+// option.
 const VirtualFileExpiration = 1 * time.Second
 
 func (fs *fuseFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) error {
+	defer fs.metrics.observeOp("LookUpInode", time.Now())
 	//log.Printf("LookUpInode(op=%+v)", op)
 	// find dirent op.Name in inode op.Parent
 	image, squashfsInode, err := fs.squashfsInode(op.Parent)
@@ -891,11 +1197,13 @@ func (fs *fuseFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) er
 
 	if image == -1 { // (virtual) root directory
 
-		// Cache virtual files for 1s, which is the default entry_timeout FUSE
-		// option value. Enabling caching speeds up building the i3 package from
-		// 46s to 18s. Larger values (e.g. never) have no effect.
-		op.Entry.AttributesExpiration = time.Now().Add(VirtualFileExpiration)
-		op.Entry.EntryExpiration = time.Now().Add(VirtualFileExpiration)
+		// Cache virtual files until they are invalidated, or for 1s (the
+		// default entry_timeout FUSE option value) if the kernel does not
+		// support invalidations. Enabling caching speeds up building the i3
+		// package from 46s to 18s.
+		expiration := fs.notifier.expiration()
+		op.Entry.AttributesExpiration = expiration
+		op.Entry.EntryExpiration = expiration
 
 		if squashfsInode == 1 { // root directory (e.g. /ro)
 			fs.mu.Lock()
@@ -942,24 +1250,19 @@ func (fs *fuseFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) er
 			return fuse.ENOENT
 		} else { // overlay directory
 			fs.mu.Lock()
-			defer fs.mu.Unlock()
 			dir, ok := fs.inodes[op.Parent].(*dir)
 			if !ok {
+				fs.mu.Unlock()
 				return fuse.EIO // not a directory
 			}
 			dirent, ok := dir.byName[op.Name]
+			fs.mu.Unlock()
 			if !ok {
 				return fuse.ENOENT
 			}
 			op.Entry.Child = dirent.inode
-			op.Entry.Attributes = fuseops.InodeAttributes{
-				Nlink: 1, // TODO: number of incoming hard links to this inode
-				Mode:  dirent.mode(),
-				Atime: time.Now(), // TODO
-				Mtime: time.Now(), // TODO
-				Ctime: time.Now(), // TODO
-			}
-			return nil
+			op.Entry.Attributes, err = fs.direntAttributes(ctx, dirent)
+			return err
 		}
 		//log.Printf("return EIO")
 		return fuse.EIO
@@ -968,39 +1271,44 @@ func (fs *fuseFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) er
 	op.Entry.AttributesExpiration = never
 	op.Entry.EntryExpiration = never
 
-	rd := fs.reader(image)
-	rd.dircacheMu.Lock()
-	fis, ok := rd.dircache[squashfsInode]
-	rd.dircacheMu.Unlock()
-	if !ok {
-		fis = make(map[string]fuseops.ChildInodeEntry)
-		ur := fs.newUnionReader(op.Parent)
-		for ur.Next() {
-			image := ur.Image()
-			for _, fi := range ur.Dir() {
-				fis[fi.Name()] = fuseops.ChildInodeEntry{
-					Child:      fs.fuseInode(image, fi.Sys().(*squashfs.FileInfo).Inode),
-					Attributes: fs.fuseAttributes(fi),
-				}
+	// Look up op.Name in op.Parent and all directories unioned into it, with
+	// entries of later directories taking precedence. The squashfs.Reader
+	// caches metadata, so repeated lookups are cheap.
+	var found bool
+	for _, inode := range append([]fuseops.InodeID{op.Parent}, fs.union(op.Parent)...) {
+		image, squashfsInode, err := fs.squashfsInode(inode)
+		if err != nil {
+			log.Printf("LookUpInode: %v", err)
+			return fuse.EIO
+		}
+		rd, err := fs.mountImage(image)
+		if err == fuse.ENOENT {
+			return err
+		}
+		if err != nil {
+			log.Printf("LookUpInode: %v", err)
+			return fuse.EIO
+		}
+		child, err := rd.Lookup(squashfsInode, op.Name)
+		if err != nil {
+			if _, ok := err.(*squashfs.FileNotFoundError); ok {
+				continue
 			}
+			log.Printf("LookUpInode: %v", err)
+			return fuse.EIO
 		}
-		if err := ur.Err(); err != nil {
-			log.Printf("Readdir: %v", err)
+		fi, err := rd.Stat(op.Name, child)
+		if err != nil {
+			log.Printf("LookUpInode: %v", err)
 			return fuse.EIO
 		}
-		// It is okay if another goroutine races us to getting this lock: the
-		// contents will be the same, and an extra write doesn’t hurt.
-		rd.dircacheMu.Lock()
-		rd.dircache[squashfsInode] = fis
-		rd.dircacheMu.Unlock()
+		op.Entry.Child = fs.fuseInode(image, child)
+		op.Entry.Attributes = fs.fuseAttributes(fi)
+		found = true
 	}
-
-	cie, ok := fis[op.Name]
-	if !ok {
+	if !found {
 		return fuse.ENOENT
 	}
-	op.Entry.Child = cie.Child
-	op.Entry.Attributes = cie.Attributes
 	return nil
 }
 
@@ -1037,8 +1345,8 @@ func (fs *fuseFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAt
 		}
 
 		fs.mu.Lock()
-		defer fs.mu.Unlock()
 		x, ok := fs.inodes[op.Inode]
+		fs.mu.Unlock()
 		if !ok {
 			return fuse.ENOENT
 		}
@@ -1052,18 +1360,24 @@ func (fs *fuseFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAt
 				Ctime: time.Now(), // TODO
 			}
 		case *dirent:
-			op.Attributes = fuseops.InodeAttributes{
-				Nlink: 1, // TODO: number of incoming hard links to this inode
-				Mode:  x.mode(),
-				Atime: time.Now(), // TODO
-				Mtime: time.Now(), // TODO
-				Ctime: time.Now(), // TODO
+			if x.synth != nil {
+				// Synthesized files change when packages are added or removed.
+				op.AttributesExpiration = fs.notifier.expiration()
+			}
+			var err error
+			op.Attributes, err = fs.direntAttributes(ctx, x)
+			if err != nil {
+				return err
 			}
 		}
 		return nil
 	}
 
-	fi, err := fs.reader(image).Stat("", squashfsInode)
+	rd, err := fs.mountImage(image)
+	if err != nil {
+		return err
+	}
+	fi, err := rd.Stat("", squashfsInode)
 	if err != nil {
 		//log.Printf("Stat: %v", err)
 		return fuse.ENOENT // TODO
@@ -1092,85 +1406,85 @@ func (fs *fuseFS) OpenDir(ctx context.Context, op *fuseops.OpenDirOp) error {
   /ro/glibc-2.27            inode img=1 1
 */
 
-func (fs *fuseFS) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) error {
-	// TODO: if this inode is not referring to a directory, return fuse.EIO
+// direntPlus is a directory entry plus where its attributes come from (see
+// childEntry).
+type direntPlus struct {
+	fuseutil.Dirent
 
-	image, squashfsInode, err := fs.squashfsInode(op.Inode)
+	dirent *dirent     // exchange directory entry, if any
+	fi     os.FileInfo // package contents, if any
+}
+
+// readDir returns the entries of the directory inode.
+func (fs *fuseFS) readDir(inode fuseops.InodeID) ([]direntPlus, error) {
+	image, squashfsInode, err := fs.squashfsInode(inode)
 	if err != nil {
 		log.Println(err)
-		return fuse.EIO
+		return nil, fuse.EIO
 	}
 
-	//log.Printf("ReadDir(inode %d (image %d, i %d), handle %d, offset %d)", op.Inode, image, squashfsInode, op.Handle, op.Offset) // skip op.Dst, which is large
+	//log.Printf("readDir(inode %d (image %d, i %d))", inode, image, squashfsInode)
+
+	var entries []direntPlus
+	add := func(e direntPlus) {
+		e.Offset = fuseops.DirOffset(len(entries) + 1) // (opaque) offset of the next entry
+		entries = append(entries, e)
+	}
 
 	if image == -1 { // (virtual) root directory
-		var entries []fuseutil.Dirent
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
 		if squashfsInode == 1 {
-			fs.mu.Lock()
 			for idx, pkg := range fs.pkgs {
 				if pkg == "" {
 					continue // tombstone
 				}
-				entries = append(entries, fuseutil.Dirent{
-					Offset: fuseops.DirOffset(len(entries) + 1), // (opaque) offset of the next entry
-					Inode:  fs.fuseInode(idx, rootInode),
-					Name:   pkg,
-					Type:   fuseutil.DT_Directory,
-				})
+				add(direntPlus{Dirent: fuseutil.Dirent{
+					Inode: fs.fuseInode(idx, rootInode),
+					Name:  pkg,
+					Type:  fuseutil.DT_Directory,
+				}})
 			}
 
-			entries = append(entries, fuseutil.Dirent{
-				Offset: fuseops.DirOffset(len(entries) + 1), // (opaque) offset of the next entry
-				Inode:  fs.fuseInode(-1, ctlInode),
-				Name:   "ctl",
-				Type:   fuseutil.DT_File,
-			})
+			add(direntPlus{Dirent: fuseutil.Dirent{
+				Inode: fs.fuseInode(-1, ctlInode),
+				Name:  "ctl",
+				Type:  fuseutil.DT_File,
+			}})
 
 			for _, dirent := range fs.dirs["/"].entries {
-				entries = append(entries, fuseutil.Dirent{
-					Offset: fuseops.DirOffset(len(entries) + 1), // (opaque) offset of the next entry
-					Inode:  dirent.inode,
-					Name:   dirent.name,
-					Type:   fuseutil.DT_Directory,
+				add(direntPlus{
+					Dirent: fuseutil.Dirent{
+						Inode: dirent.inode,
+						Name:  dirent.name,
+						Type:  fuseutil.DT_Directory,
+					},
+					dirent: dirent,
 				})
 			}
-			fs.mu.Unlock()
 		} else { // exchange directory
-			fs.mu.Lock()
-			dir, ok := fs.inodes[op.Inode].(*dir)
+			dir, ok := fs.inodes[inode].(*dir)
 			if !ok {
-				return fuse.EIO
+				return nil, fuse.EIO
 			}
 			for _, dirent := range dir.entries {
 				if dirent == nil {
 					continue // tombstone
 				}
-				entries = append(entries, fuseutil.Dirent{
-					Offset: fuseops.DirOffset(len(entries) + 1), // (opaque) offset of the next entry
-					Inode:  dirent.inode,
-					Name:   dirent.name,
-					Type:   dirent.typ(),
+				add(direntPlus{
+					Dirent: fuseutil.Dirent{
+						Inode: dirent.inode,
+						Name:  dirent.name,
+						Type:  dirent.typ(),
+					},
+					dirent: dirent,
 				})
 			}
-			fs.mu.Unlock()
-		}
-		if op.Offset > fuseops.DirOffset(len(entries)) {
-			return fuse.EIO
-		}
-
-		for _, e := range entries[op.Offset:] {
-			n := fuseutil.WriteDirent(op.Dst[op.BytesRead:], e)
-			if n == 0 {
-				break
-			}
-			op.BytesRead += n
 		}
-
-		return nil
+		return entries, nil
 	}
 
-	var fis []fuseutil.Dirent
-	ur := fs.newUnionReader(op.Inode)
+	ur := fs.newUnionReader(inode)
 	for ur.Next() {
 		image := ur.Image()
 		for _, e := range ur.Dir() {
@@ -1178,26 +1492,104 @@ func (fs *fuseFS) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) error {
 			if e.IsDir() {
 				direntType = fuseutil.DT_Directory
 			}
-			fis = append(fis, fuseutil.Dirent{
-				Offset: fuseops.DirOffset(len(fis)) + 1, // (opaque) offset of the next entry
-				Inode:  fs.fuseInode(image, e.Sys().(*squashfs.FileInfo).Inode),
-				Name:   e.Name(),
-				Type:   direntType,
+			add(direntPlus{
+				Dirent: fuseutil.Dirent{
+					Inode: fs.fuseInode(image, e.Sys().(*squashfs.FileInfo).Inode),
+					Name:  e.Name(),
+					Type:  direntType,
+				},
+				fi: e,
 			})
 		}
 	}
 	if err := ur.Err(); err != nil {
 		log.Printf("Readdir: %v", err)
+		return nil, fuse.EIO
+	}
+	return entries, nil
+}
+
+// childEntry returns what LookUpInode would return for e. If that would fail, it
+// returns an entry without child, which makes the kernel skip e.
+func (fs *fuseFS) childEntry(ctx context.Context, e direntPlus) fuseops.ChildInodeEntry {
+	entry := fuseops.ChildInodeEntry{Child: e.Inode}
+	if e.fi != nil {
+		entry.Attributes = fs.fuseAttributes(e.fi)
+		entry.AttributesExpiration = never
+		entry.EntryExpiration = never
+		return entry
+	}
+	// See LookUpInode for how long virtual files are cached.
+	expiration := fs.notifier.expiration()
+	entry.AttributesExpiration = expiration
+	entry.EntryExpiration = expiration
+	switch {
+	case e.dirent != nil:
+		attr, err := fs.direntAttributes(ctx, e.dirent)
+		if err != nil {
+			return fuseops.ChildInodeEntry{}
+		}
+		entry.Attributes = attr
+	case e.Inode == ctlInode:
+		entry.Attributes = fuseops.InodeAttributes{
+			Nlink: 1, // TODO: number of incoming hard links to this inode
+			Mode:  os.ModeSymlink | 0444,
+			Atime: time.Now(), // TODO
+			Mtime: time.Now(), // TODO
+			Ctime: time.Now(), // TODO
+		}
+	default: // package directory, e.g. /ro/bash-amd64-5.0-4
+		entry.Attributes = fuseops.InodeAttributes{
+			Nlink: 1, // TODO: number of incoming hard links to this inode
+			Mode:  os.ModeDir | 0555,
+			Atime: time.Now(), // TODO
+			Mtime: time.Now(), // TODO
+			Ctime: time.Now(), // TODO
+		}
+	}
+	return entry
+}
+
+func (fs *fuseFS) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) error {
+	defer fs.metrics.observeOp("ReadDir", time.Now())
+	// TODO: if this inode is not referring to a directory, return fuse.EIO
+
+	entries, err := fs.readDir(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	if op.Offset > fuseops.DirOffset(len(entries)) {
 		return fuse.EIO
 	}
 
-	if op.Offset > fuseops.DirOffset(len(fis)) {
+	for _, e := range entries[op.Offset:] {
+		n := fuseutil.WriteDirent(op.Dst[op.BytesRead:], e.Dirent)
+		if n == 0 {
+			break
+		}
+		op.BytesRead += n
+	}
+
+	return nil
+}
+
+// ReadDirPlus is like ReadDir, but additionally returns the attributes of all
+// entries, saving a LookUpInode round-trip per entry for e.g. ls -l /ro/bin.
+func (fs *fuseFS) ReadDirPlus(ctx context.Context, op *fuseops.ReadDirPlusOp) error {
+	defer fs.metrics.observeOp("ReadDirPlus", time.Now())
+
+	entries, err := fs.readDir(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	if op.Offset > fuseops.DirOffset(len(entries)) {
 		return fuse.EIO
 	}
 
-	for _, dirent := range fis[op.Offset:] {
-		//log.Printf("  dirent: %+v", dirent)
-		n := fuseutil.WriteDirent(op.Dst[op.BytesRead:], dirent)
+	for _, e := range entries[op.Offset:] {
+		n := fuseutil.WriteDirentPlus(op.Dst[op.BytesRead:], fs.childEntry(ctx, e), e.Dirent)
 		if n == 0 {
 			break
 		}
@@ -1210,13 +1602,32 @@ func (fs *fuseFS) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) error {
 func (fs *fuseFS) OpenFile(ctx context.Context, op *fuseops.OpenFileOp) error {
 	//log.Printf("OpenFile(op=%+v)", op)
 
-	op.KeepPageCache = true // no modifications are happening in immutable images
+	// No modifications are happening in immutable images, but synthesized
+	// files are re-generated when packages are added or removed.
+	op.KeepPageCache = op.Inode>>48 != 0
 
 	return nil // allow opening any file
 }
 
 func (fs *fuseFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
+	defer fs.metrics.observeOp("ReadFile", time.Now())
 	//log.Printf("ReadFile(inode %d, handle %d, offset %d)", op.Inode, op.Handle, op.Offset) // skip op.Dst, which is large
+	if op.Inode>>48 == 0 { // synthesized file, see squashfsInode
+		fs.mu.Lock()
+		dirent, ok := fs.inodes[op.Inode].(*dirent)
+		fs.mu.Unlock()
+		if !ok || dirent.synth == nil {
+			return fuse.EIO // not a file
+		}
+		b, err := fs.synthesize(ctx, dirent)
+		if err != nil {
+			return fuse.EIO
+		}
+		if op.Offset < int64(len(b)) {
+			op.BytesRead = copy(op.Dst, b[op.Offset:])
+		}
+		return nil
+	}
 	fs.fileReadersMu.Lock()
 	r, ok := fs.fileReaders[op.Inode]
 	fs.fileReadersMu.Unlock()
@@ -1227,7 +1638,11 @@ func (fs *fuseFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
 			return fuse.EIO
 		}
 
-		r, err = fs.reader(image).FileReader(squashfsInode)
+		rd, err := fs.mountImage(image)
+		if err != nil {
+			return err
+		}
+		r, err = rd.FileReader(squashfsInode)
 		if err != nil {
 			return err
 		}
@@ -1237,6 +1652,8 @@ func (fs *fuseFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
 	}
 	var err error
 	op.BytesRead, err = r.ReadAt(op.Dst, op.Offset)
+	image := int((op.Inode>>48)&0xFFFF) - 1 // see squashfsInode
+	fs.metrics.addReadBytes(image, op.BytesRead)
 	if err == io.EOF {
 		err = nil // FUSE does not want io.EOF
 	}
@@ -1260,14 +1677,18 @@ func (fs *fuseFS) ReadSymlink(ctx context.Context, op *fuseops.ReadSymlinkOp) er
 			return nil
 		}
 		dirent, ok := fs.inodes[op.Inode].(*dirent)
-		if !ok {
+		if !ok || dirent.linkTarget == "" {
 			return fuse.EIO // not a symlink
 		}
 		op.Target = dirent.linkTarget
 		return nil
 	}
 
-	target, err := fs.reader(image).ReadLink(squashfsInode)
+	rd, err := fs.mountImage(image)
+	if err != nil {
+		return err
+	}
+	target, err := rd.ReadLink(squashfsInode)
 	if err != nil {
 		return err
 	}
@@ -1285,7 +1706,11 @@ func (fs *fuseFS) ListXattr(ctx context.Context, op *fuseops.ListXattrOp) error
 		return nil // no extended attributes
 	}
 
-	attrs, err := fs.reader(image).ReadXattrs(squashfsInode)
+	rd, err := fs.mountImage(image)
+	if err != nil {
+		return err
+	}
+	attrs, err := rd.ReadXattrs(squashfsInode)
 	if err != nil {
 		return err
 	}
@@ -1318,7 +1743,11 @@ func (fs *fuseFS) GetXattr(ctx context.Context, op *fuseops.GetXattrOp) error {
 		return nil // no extended attributes
 	}
 
-	attrs, err := fs.reader(image).ReadXattrs(squashfsInode)
+	rd, err := fs.mountImage(image)
+	if err != nil {
+		return err
+	}
+	attrs, err := rd.ReadXattrs(squashfsInode)
 	if err != nil {
 		return err
 	}
@@ -1342,11 +1771,14 @@ func (fs *fuseFS) GetXattr(ctx context.Context, op *fuseops.GetXattrOp) error {
 }
 
 func (fs *fuseFS) Destroy() {
-	for _, rd := range fs.readers {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for idx, rd := range fs.readers {
 		if rd == nil {
-			continue
+			continue // not mounted, or already closed by ForgetPackage
 		}
-		rd.file.Close()
+		rd.close()
+		fs.readers[idx] = nil
 	}
 }
 
@@ -1381,3 +1813,152 @@ func (fs *fuseFS) ScanPackages(ctx context.Context, req *pb.ScanPackagesRequest)
 	defer fs.mu.Unlock()
 	return &pb.ScanPackagesReply{}, fs.scanPackages(&nopLocker{}, pkgs)
 }
+
+func (fs *fuseFS) ListPackages(ctx context.Context, req *pb.ListPackagesRequest) (*pb.ListPackagesReply, error) {
+	reply := &pb.ListPackagesReply{}
+	fs.mu.Lock()
+	for idx, pkg := range fs.pkgs {
+		if pkg == "" {
+			continue // tombstone
+		}
+		p := &pb.ListPackagesReply_Package{
+			Name:    proto.String(pkg),
+			Mounted: proto.Bool(idx < len(fs.readers) && fs.readers[idx] != nil),
+		}
+		if origin, ok := fs.origins[pkg]; ok {
+			p.Origin = proto.String(origin)
+		}
+		reply.Package = append(reply.Package, p)
+	}
+	fs.mu.Unlock()
+	for _, p := range reply.Package {
+		if st, err := os.Stat(filepath.Join(fs.repo, p.GetName()+".squashfs")); err == nil {
+			p.Size = proto.Int64(st.Size())
+		}
+	}
+	return reply, nil
+}
+
+func (fs *fuseFS) ResolvePath(ctx context.Context, req *pb.ResolvePathRequest) (*pb.ResolvePathReply, error) {
+	path := req.GetPath()
+	if filepath.IsAbs(path) && fs.mountpoint != "" {
+		rel, err := filepath.Rel(fs.mountpoint, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			return nil, xerrors.Errorf("ResolvePath: %s is not underneath mountpoint %s", path, fs.mountpoint)
+		}
+		path = rel
+	}
+	path = filepath.Clean("/" + path)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// Follow exchange directory symlinks, e.g. /bin/bash → ../bash-amd64-5.0-4/bin/bash
+	if dir, ok := fs.dirs[filepath.Dir(path)]; ok {
+		if dirent, ok := dir.byName[filepath.Base(path)]; ok && dirent.linkTarget != "" {
+			path = filepath.Clean(filepath.Join(filepath.Dir(path), dirent.linkTarget))
+		}
+	}
+	components := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	for _, pkg := range fs.pkgs {
+		if pkg == "" || pkg != components[0] {
+			continue
+		}
+		reply := &pb.ResolvePathReply{Pkg: proto.String(pkg)}
+		if len(components) > 1 {
+			reply.Path = proto.String(components[1])
+		}
+		return reply, nil
+	}
+	return nil, xerrors.Errorf("ResolvePath: %s is not provided by any package", req.GetPath())
+}
+
+func (fs *fuseFS) ForgetPackage(ctx context.Context, req *pb.ForgetPackageRequest) (*pb.ForgetPackageReply, error) {
+	if req.GetPkg() == "" {
+		return nil, xerrors.Errorf("ForgetPackage: pkg must not be empty")
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	image := -1
+	for idx, pkg := range fs.pkgs {
+		if pkg == req.GetPkg() {
+			image = idx
+			break
+		}
+	}
+	if image == -1 {
+		return nil, xerrors.Errorf("ForgetPackage: package %q not found", req.GetPkg())
+	}
+	fs.forgetImageLocked(image)
+	if err := fs.removeSymlinks(&nopLocker{}, map[string]bool{req.GetPkg(): true}); err != nil {
+		return nil, err
+	}
+	fs.updateSynthesized()
+	return &pb.ForgetPackageReply{}, nil
+}
+
+// forgetImageLocked tombstones the package of image and releases its reader.
+// Requests for inodes of this image which are still cached by the kernel fail
+// with ENOENT instead of mounting the image again, see mountImage. The caller
+// must hold fs.mu and remove the package’s symlinks.
+func (fs *fuseFS) forgetImageLocked(image int) {
+	pkg := fs.pkgs[image]
+	fs.pkgs[image] = "" // tombstone
+	delete(fs.origins, pkg)
+	fs.invalidateEntryLocked(fs.dirs["/"], pkg)
+	if image < len(fs.readers) && fs.readers[image] != nil {
+		if err := fs.readers[image].close(); err != nil {
+			log.Printf("forgetting %s: %v", pkg, err)
+		}
+		fs.readers[image] = nil
+	}
+	fs.fileReadersMu.Lock()
+	for inode := range fs.fileReaders {
+		if int((inode>>48)&0xFFFF)-1 == image { // see squashfsInode
+			delete(fs.fileReaders, inode)
+		}
+	}
+	fs.fileReadersMu.Unlock()
+}
+
+func (fs *fuseFS) GetStats(ctx context.Context, req *pb.GetStatsRequest) (*pb.GetStatsReply, error) {
+	packages, mounted, openReaders := fs.gauges()
+	reply := &pb.GetStatsReply{
+		Packages:      proto.Int64(int64(packages)),
+		MountedImages: proto.Int64(int64(mounted)),
+		OpenReaders:   proto.Int64(int64(openReaders)),
+	}
+	m := &fs.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ops := make([]string, 0, len(m.ops))
+	for op := range m.ops {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		reply.Op = append(reply.Op, &pb.GetStatsReply_Op{
+			Name:         proto.String(op),
+			Count:        proto.Uint64(m.ops[op].count),
+			TotalSeconds: proto.Float64(m.ops[op].sum),
+		})
+	}
+	var readBytes uint64
+	for _, n := range m.readBytes {
+		readBytes += n
+	}
+	reply.ReadBytes = proto.Uint64(readBytes)
+	reply.Autodownloads = proto.Uint64(m.autodownloads.count)
+	return reply, nil
+}
+
+func (fs *fuseFS) ListConflicts(ctx context.Context, req *pb.ListConflictsRequest) (*pb.ListConflictsReply, error) {
+	reply := &pb.ListConflictsReply{}
+	for _, c := range fs.listConflicts() {
+		reply.Conflict = append(reply.Conflict, &pb.ListConflictsReply_Conflict{
+			Path:   proto.String(c.Path),
+			Pkg:    c.Pkgs,
+			Reason: proto.String(c.Reason),
+		})
+	}
+	return reply, nil
+}
@@ -168,6 +168,29 @@ func TestFUSE(t *testing.T) {
 			t.Fatalf("Readlink(bin/less) = %v, want %v", got, want)
 		}
 	})
+
+	t.Run("WatchRepo", func(t *testing.T) {
+		// No ScanPackages call: the new package is picked up via inotify.
+		addPackage("less-amd64", "less-amd64-530-4", meta("less", "530-4"))
+
+		want := "../less-amd64-530-4/bin/less"
+		var target string
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+			// TODO: drop cache instead of waiting for it to expire
+			time.Sleep(2 * fuse.VirtualFileExpiration) // ensure cache expired
+
+			target, err = os.Readlink(tmpdir + "/bin/less")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target == want {
+				break
+			}
+		}
+		if target != want {
+			t.Fatalf("Readlink(bin/less) = %v, want %v", target, want)
+		}
+	})
 }
 
 func TestXattr(t *testing.T) {
@@ -262,7 +285,10 @@ func TestXattr(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	got := squashfs.XattrFromAttr(attr, buf)
+	got, ok := squashfs.XattrFromAttr(attr, buf)
+	if !ok {
+		t.Fatalf("XattrFromAttr(%q): unsupported namespace", attr)
+	}
 	want := squashfs.Xattr{
 		Type:     2,
 		FullName: "capability",
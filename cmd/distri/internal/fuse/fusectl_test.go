@@ -0,0 +1,127 @@
+package fuse
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+func TestFusectl(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distri-fusectl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	writeTestPackage(t, repo, "hello-amd64-1", nil, "bin/hello")
+	writeTestPackage(t, repo, "world-amd64-1", nil, "bin/world")
+
+	fs := newTestFS(repo)
+	fs.mountpoint = "/ro"
+	if err := fs.scanPackages(&nopLocker{}, []string{"hello-amd64-1", "world-amd64-1"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	listPackages := func() []string {
+		t.Helper()
+		resp, err := fs.ListPackages(ctx, &pb.ListPackagesRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, pkg := range resp.GetPackage() {
+			if pkg.GetSize() == 0 {
+				t.Errorf("ListPackages: %s has size 0", pkg.GetName())
+			}
+			names = append(names, pkg.GetName())
+		}
+		return names
+	}
+	if diff := cmp.Diff([]string{"hello-amd64-1", "world-amd64-1"}, listPackages()); diff != "" {
+		t.Errorf("ListPackages: unexpected packages: diff (-want +got):\n%s", diff)
+	}
+
+	for _, tt := range []struct {
+		path    string
+		wantPkg string
+		want    string
+	}{
+		{"/ro/bin/hello", "hello-amd64-1", "bin/hello"},
+		{"bin/world", "world-amd64-1", "bin/world"},
+		{"/ro/hello-amd64-1/bin/hello", "hello-amd64-1", "bin/hello"},
+	} {
+		resp, err := fs.ResolvePath(ctx, &pb.ResolvePathRequest{Path: proto.String(tt.path)})
+		if err != nil {
+			t.Fatalf("ResolvePath(%s): %v", tt.path, err)
+		}
+		if got, want := resp.GetPkg(), tt.wantPkg; got != want {
+			t.Errorf("ResolvePath(%s): got package %q, want %q", tt.path, got, want)
+		}
+		if got, want := resp.GetPath(), tt.want; got != want {
+			t.Errorf("ResolvePath(%s): got path %q, want %q", tt.path, got, want)
+		}
+	}
+	if _, err := fs.ResolvePath(ctx, &pb.ResolvePathRequest{Path: proto.String("/usr/bin/hello")}); err == nil {
+		t.Errorf("ResolvePath(/usr/bin/hello) unexpectedly succeeded for path outside of the mountpoint")
+	}
+
+	// Access /ro/hello-amd64-1/bin/hello, which mounts the image:
+	lookup := func(parent fuseops.InodeID, name string) fuseops.InodeID {
+		t.Helper()
+		op := &fuseops.LookUpInodeOp{Parent: parent, Name: name}
+		if err := fs.LookUpInode(ctx, op); err != nil {
+			t.Fatalf("LookUpInode(%s): %v", name, err)
+		}
+		return op.Entry.Child
+	}
+	hello := lookup(lookup(fs.fuseInode(0, rootInode), "bin"), "hello")
+	if err := fs.ReadFile(ctx, &fuseops.ReadFileOp{Inode: hello, Dst: make([]byte, 10)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.ForgetPackage(ctx, &pb.ForgetPackageRequest{Pkg: proto.String("hello-amd64-1")}); err != nil {
+		t.Fatal(err)
+	}
+	if fs.readers[0] != nil {
+		t.Errorf("ForgetPackage: reader of hello-amd64-1 not released")
+	}
+	// The kernel might still have cached inodes of forgotten packages:
+	if err := fs.GetInodeAttributes(ctx, &fuseops.GetInodeAttributesOp{Inode: hello}); err != fuse.ENOENT {
+		t.Errorf("GetInodeAttributes(/ro/hello-amd64-1/bin/hello) after ForgetPackage = %v, want ENOENT", err)
+	}
+	if err := fs.ReadFile(ctx, &fuseops.ReadFileOp{Inode: hello, Dst: make([]byte, 10)}); err != fuse.ENOENT {
+		t.Errorf("ReadFile(/ro/hello-amd64-1/bin/hello) after ForgetPackage = %v, want ENOENT", err)
+	}
+	if _, err := fs.ForgetPackage(ctx, &pb.ForgetPackageRequest{Pkg: proto.String("hello-amd64-1")}); err == nil {
+		t.Errorf("ForgetPackage unexpectedly succeeded for already forgotten package")
+	}
+	if diff := cmp.Diff([]string{"world-amd64-1"}, listPackages()); diff != "" {
+		t.Errorf("ListPackages: unexpected packages after ForgetPackage: diff (-want +got):\n%s", diff)
+	}
+	if _, ok := fs.dirs["/bin"].byName["hello"]; ok {
+		t.Errorf("ForgetPackage: /bin/hello still present")
+	}
+	if _, ok := fs.dirs["/bin"].byName["world"]; !ok {
+		t.Errorf("ForgetPackage: /bin/world unexpectedly removed")
+	}
+	if _, err := fs.ResolvePath(ctx, &pb.ResolvePathRequest{Path: proto.String("/ro/bin/hello")}); err == nil {
+		t.Errorf("ResolvePath(/ro/bin/hello) unexpectedly succeeded after ForgetPackage")
+	}
+
+	stats, err := fs.GetStats(ctx, &pb.GetStatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stats.GetPackages(), int64(1); got != want {
+		t.Errorf("GetStats: packages = %d, want %d", got, want)
+	}
+
+	fs.Destroy() // must not close the reader released by ForgetPackage again
+}
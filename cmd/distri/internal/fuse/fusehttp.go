@@ -1,61 +1,256 @@
 package fuse
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/google/renameio"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/xerrors"
 )
 
-// TODO: to make this performant enough, even just for starting emacs, we
-// probably need to cache relatively large blocks.
-
 var httpClient = &http.Client{Transport: &http.Transport{
 	// http.DefaultMaxIdleConnsPerHost is 2, which is not enough for concurrent
 	// requests.
 	MaxIdleConnsPerHost: 1024,
 }}
 
-type httpReaderAt struct {
-	fileurl string // e.g. http://localhost:7080/bash-4.4.18.squashfs
+// lazyReadahead is the number of chunks which are fetched in addition to the
+// chunks required by a read. Files are typically read sequentially, so reading
+// ahead saves round trips.
+const lazyReadahead = 4
+
+// lazyImage is a package image which is fetched from a remote repository as it
+// is read: only the chunks which are actually accessed are fetched (using HTTP
+// range requests), verified against the image’s chunk hashes and stored in the
+// chunk cache.
+type lazyImage struct {
+	fileurl string // e.g. https://repo.distr1.org/distri/jackherer/pkg/bash-amd64-5.0-4.squashfs
+	hashes  *chunkHashes
+	cache   *chunkCache
+
+	mu       sync.Mutex
+	inflight map[int]*chunkFetch // by chunk index, so that each chunk is fetched once
+}
+
+// chunkFetch is an in-flight fetch of a chunk, which concurrent reads of the
+// same chunk wait for instead of fetching the chunk again.
+type chunkFetch struct {
+	done  chan struct{} // closed once chunk and err are set
+	chunk []byte
+	err   error
 }
 
-func (hr *httpReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
-	req, err := http.NewRequest("GET", hr.fileurl, nil)
+func openLazyImage(fileurl string, cache *chunkCache) (*lazyImage, error) {
+	resp, err := httpClient.Get(fileurl + ChunkHashesSuffix)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))))
-	resp, err := httpClient.Do(req)
+	defer resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		return nil, xerrors.Errorf("%s: HTTP status %v", fileurl+ChunkHashesSuffix, resp.Status)
+	}
+	hashes, err := readChunkHashes(resp.Body)
 	if err != nil {
+		return nil, xerrors.Errorf("%s: %v", fileurl+ChunkHashesSuffix, err)
+	}
+	return &lazyImage{
+		fileurl:  fileurl,
+		hashes:   hashes,
+		cache:    cache,
+		inflight: make(map[int]*chunkFetch),
+	}, nil
+}
+
+// chunkLen returns the length of chunk idx, which is shorter than chunkSize for
+// the last chunk of the image.
+func (li *lazyImage) chunkLen(idx int) int64 {
+	if rest := li.hashes.size - int64(idx)*li.hashes.chunkSize; rest < li.hashes.chunkSize {
+		return rest
+	}
+	return li.hashes.chunkSize
+}
+
+func (li *lazyImage) ReadAt(p []byte, off int64) (n int, err error) {
+	if off >= li.hashes.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > li.hashes.size {
+		end = li.hashes.size
+		err = io.EOF
+	}
+	if end == off {
 		return 0, err
 	}
-	defer resp.Body.Close()
-	if got, want := resp.StatusCode, http.StatusPartialContent; got != want {
-		return 0, xerrors.Errorf("HTTP status %v", resp.Status)
+	first := int(off / li.hashes.chunkSize)
+	last := int((end - 1) / li.hashes.chunkSize)
+	chunks, fetchErr := li.chunks(first, last)
+	if fetchErr != nil {
+		return 0, fetchErr
 	}
-	for n < int(resp.ContentLength-1) {
-		nn, err := resp.Body.Read(p[n:])
-		if err != nil {
-			return 0, err
+	for idx := first; idx <= last; idx++ {
+		chunkOff := int64(idx) * li.hashes.chunkSize
+		b := chunks[idx]
+		if off > chunkOff {
+			b = b[off-chunkOff:]
 		}
-		n += nn
+		n += copy(p[n:end-off], b)
 	}
+	return n, err
+}
 
-	io.Copy(ioutil.Discard, resp.Body) // ensure resp.Body hits EOF
+// chunks returns the contents of chunks first to last (inclusive), fetching
+// those which are not cached (plus up to lazyReadahead subsequent chunks).
+// Chunks which are already being fetched by a concurrent read are waited for
+// instead of fetched again; fetches of unrelated chunks proceed concurrently.
+func (li *lazyImage) chunks(first, last int) (map[int][]byte, error) {
+	chunks := make(map[int][]byte, last-first+1)
+	missing := false
+	for idx := first; idx <= last; idx++ {
+		if b := li.cache.get(li.hashes.sums[idx]); b != nil {
+			chunks[idx] = b
+			continue
+		}
+		missing = true
+	}
+	if !missing {
+		return chunks, nil
+	}
 
-	log.Printf("[%s] %d-%d (len %d), read %d (content-length %d)", filepath.Base(hr.fileurl), off, off+int64(len(p)), len(p), n, resp.ContentLength)
-	return n, err
+	// Determine the chunks to fetch, merging adjacent chunks into one range,
+	// and the chunks to wait for:
+	type chunkRange struct{ first, last int }
+	var (
+		ranges  []chunkRange
+		pending = make(map[int]*chunkFetch) // chunks this read waits for
+		claimed = make(map[int]*chunkFetch) // chunks this read fetches
+	)
+	readahead := last + lazyReadahead
+	if max := len(li.hashes.sums) - 1; readahead > max {
+		readahead = max
+	}
+	li.mu.Lock()
+	for idx := first; idx <= readahead; idx++ {
+		if chunks[idx] != nil {
+			continue
+		}
+		if cf, ok := li.inflight[idx]; ok {
+			if idx <= last {
+				pending[idx] = cf
+			}
+			continue
+		}
+		// The chunk might have been fetched since we checked the cache:
+		if li.cache.contains(li.hashes.sums[idx]) {
+			if idx > last {
+				continue // read ahead only what is not cached
+			}
+			if b := li.cache.get(li.hashes.sums[idx]); b != nil {
+				chunks[idx] = b
+				continue
+			}
+		}
+		cf := &chunkFetch{done: make(chan struct{})}
+		li.inflight[idx] = cf
+		claimed[idx] = cf
+		if idx <= last {
+			pending[idx] = cf
+		}
+		if len(ranges) > 0 && ranges[len(ranges)-1].last == idx-1 {
+			ranges[len(ranges)-1].last = idx
+			continue
+		}
+		ranges = append(ranges, chunkRange{idx, idx})
+	}
+	li.mu.Unlock()
+
+	// Fetch without holding li.mu, so that reads of other chunks are not
+	// blocked by this read’s round trips:
+	var wg sync.WaitGroup
+	for _, r := range ranges {
+		r := r // copy
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b, err := li.fetch(r.first, r.last)
+			for idx := r.first; idx <= r.last; idx++ {
+				cf := claimed[idx]
+				cf.err = err
+				if err == nil {
+					l := li.chunkLen(idx)
+					cf.chunk, cf.err = li.verify(idx, b[:l:l])
+					b = b[l:]
+				}
+				if cf.err != nil && idx > last {
+					log.Printf("discarding read ahead: %v", cf.err)
+				}
+				li.mu.Lock()
+				delete(li.inflight, idx)
+				li.mu.Unlock()
+				close(cf.done)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for idx, cf := range pending {
+		<-cf.done
+		if cf.err != nil {
+			return nil, cf.err
+		}
+		chunks[idx] = cf.chunk
+	}
+	return chunks, nil
 }
 
+// verify checks chunk idx against its hash and stores it in the chunk cache.
+func (li *lazyImage) verify(idx int, chunk []byte) ([]byte, error) {
+	if sha256.Sum256(chunk) != li.hashes.sums[idx] {
+		return nil, xerrors.Errorf("%s: chunk %d (offset %d) does not match its hash", li.fileurl, idx, int64(idx)*li.hashes.chunkSize)
+	}
+	if err := li.cache.put(li.hashes.sums[idx], chunk); err != nil {
+		log.Printf("caching chunk: %v", err)
+	}
+	return chunk, nil
+}
+
+// fetch returns the contents of chunks first to last (inclusive) using an HTTP
+// range request.
+func (li *lazyImage) fetch(first, last int) ([]byte, error) {
+	off := int64(first) * li.hashes.chunkSize
+	end := int64(last)*li.hashes.chunkSize + li.chunkLen(last)
+	req, err := http.NewRequest("GET", li.fileurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end-1))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusPartialContent; got != want {
+		return nil, xerrors.Errorf("%s: HTTP status %v", li.fileurl, resp.Status)
+	}
+	b := make([]byte, end-off)
+	if _, err := io.ReadFull(resp.Body, b); err != nil {
+		return nil, xerrors.Errorf("%s: reading bytes %d-%d: %v", li.fileurl, off, end-1, err)
+	}
+	return b, nil
+}
+
+// Close implements io.Closer so that a lazyImage can be used in place of an
+// *os.File.
+func (li *lazyImage) Close() error { return nil }
+
 func autodownload(imgDir, fileurl string) (*os.File, error) {
 	dest := filepath.Join(imgDir, filepath.Base(fileurl))
 
@@ -0,0 +1,258 @@
+package fuse
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sync/errgroup"
+)
+
+// lazyTestServer serves a package image and its chunk hashes, recording the
+// HTTP Range headers of requests for the image.
+type lazyTestServer struct {
+	*httptest.Server
+
+	image []byte
+
+	mu     sync.Mutex
+	ranges []string
+	hook   func(rng string) // if non-nil, called before serving a range request
+}
+
+func newLazyTestServer(t *testing.T, size int) *lazyTestServer {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "distri-lazy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	image := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(image)
+	if err := ioutil.WriteFile(filepath.Join(dir, "hello-amd64-1.squashfs"), image, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var hashes bytes.Buffer
+	if err := WriteChunkHashes(&hashes, bytes.NewReader(image)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "hello-amd64-1.squashfs"+ChunkHashesSuffix), hashes.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &lazyTestServer{image: image}
+	fileServer := http.FileServer(http.Dir(dir))
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rng := r.Header.Get("Range"); rng != "" {
+			srv.mu.Lock()
+			srv.ranges = append(srv.ranges, rng)
+			hook := srv.hook
+			srv.mu.Unlock()
+			if hook != nil {
+				hook(rng)
+			}
+		}
+		fileServer.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (srv *lazyTestServer) requests() []string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	ranges := srv.ranges
+	srv.ranges = nil
+	return ranges
+}
+
+func openTestChunkCache(t *testing.T, max int64) *chunkCache {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "distri-chunkcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	cache, err := openChunkCache(dir, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestLazyImage(t *testing.T) {
+	const size = 20*chunkSize + 1234
+	srv := newLazyTestServer(t, size)
+	cache := openTestChunkCache(t, 1<<30)
+
+	li, err := openLazyImage(srv.URL+"/hello-amd64-1.squashfs", cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readAt := func(off int64, n int) {
+		t.Helper()
+		p := make([]byte, n)
+		got, err := li.ReadAt(p, off)
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		want := srv.image[off:]
+		if len(want) > n {
+			want = want[:n]
+		}
+		if !bytes.Equal(p[:got], want) {
+			t.Fatalf("ReadAt(%d bytes at %d): unexpected contents", n, off)
+		}
+	}
+
+	// A read spanning two chunks results in one request, which includes the
+	// read ahead chunks:
+	readAt(chunkSize-10, 20)
+	if diff := cmp.Diff([]string{"bytes=0-1572863"}, srv.requests()); diff != "" {
+		t.Errorf("unexpected requests: diff (-want +got):\n%s", diff)
+	}
+
+	// Reads within the read ahead chunks are served from the cache:
+	readAt(3*chunkSize, chunkSize)
+	if got := srv.requests(); len(got) > 0 {
+		t.Errorf("unexpected requests %q for cached chunks", got)
+	}
+
+	// Reading at the end of the image fetches only the last chunk:
+	readAt(20*chunkSize, 5000)
+	if diff := cmp.Diff([]string{"bytes=5242880-5244113"}, srv.requests()); diff != "" {
+		t.Errorf("unexpected requests: diff (-want +got):\n%s", diff)
+	}
+
+	// A new lazyImage (e.g. after a restart) uses the persistent cache:
+	cache, err = openChunkCache(cache.dir, cache.max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	li, err = openLazyImage(srv.URL+"/hello-amd64-1.squashfs", cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAt(0, 6*chunkSize)
+	if got := srv.requests(); len(got) > 0 {
+		t.Errorf("unexpected requests %q for cached chunks", got)
+	}
+}
+
+func TestLazyImageCorrupt(t *testing.T) {
+	srv := newLazyTestServer(t, 4*chunkSize)
+	li, err := openLazyImage(srv.URL+"/hello-amd64-1.squashfs", openTestChunkCache(t, 1<<30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	li.hashes.sums[1][0] ^= 0xff
+
+	// A corrupt chunk which was only read ahead is not cached:
+	if _, err := li.ReadAt(make([]byte, 10), 0); err != nil {
+		t.Fatal(err)
+	}
+	if chunks, _ := li.cache.cachedChunks(); chunks != 3 {
+		t.Errorf("cached %d chunks, want 3 (all but the corrupt chunk)", chunks)
+	}
+
+	if _, err := li.ReadAt(make([]byte, 10), chunkSize); err == nil {
+		t.Fatalf("ReadAt unexpectedly succeeded for chunk with mismatching hash")
+	}
+}
+
+func TestChunkCacheEviction(t *testing.T) {
+	srv := newLazyTestServer(t, 16*chunkSize)
+	cache := openTestChunkCache(t, 8*chunkSize)
+	li, err := openLazyImage(srv.URL+"/hello-amd64-1.squashfs", cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for off := int64(0); off < 16*chunkSize; off += chunkSize {
+		if _, err := li.ReadAt(make([]byte, 1), off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chunks, size := cache.cachedChunks()
+	if size > cache.max {
+		t.Errorf("cache size = %d, exceeds maximum of %d", size, cache.max)
+	}
+	if got, want := chunks, 8; got != want {
+		t.Errorf("cached chunks = %d, want %d", got, want)
+	}
+	// The least recently used chunks were evicted:
+	if cache.contains(li.hashes.sums[0]) {
+		t.Errorf("chunk 0 unexpectedly still cached")
+	}
+	if !cache.contains(li.hashes.sums[15]) {
+		t.Errorf("chunk 15 unexpectedly evicted")
+	}
+	fis, err := ioutil.ReadDir(cache.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files int
+	for _, fi := range fis {
+		sub, err := ioutil.ReadDir(filepath.Join(cache.dir, fi.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files += len(sub)
+	}
+	if got, want := files, 8; got != want {
+		t.Errorf("cache directory contains %d files, want %d", got, want)
+	}
+}
+
+func TestLazyImageConcurrent(t *testing.T) {
+	srv := newLazyTestServer(t, 20*chunkSize)
+	// Hold requests for the first chunk until released:
+	release := make(chan struct{})
+	held := make(chan struct{}, 1)
+	srv.hook = func(rng string) {
+		if strings.HasPrefix(rng, "bytes=0-") {
+			held <- struct{}{}
+			<-release
+		}
+	}
+	li, err := openLazyImage(srv.URL+"/hello-amd64-1.squashfs", openTestChunkCache(t, 1<<30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent reads of the same chunk are served by one request:
+	var eg errgroup.Group
+	for i := 0; i < 2; i++ {
+		eg.Go(func() error {
+			_, err := li.ReadAt(make([]byte, 10), 0)
+			return err
+		})
+	}
+	<-held
+
+	// Reads of unrelated chunks are not blocked by the held request:
+	if _, err := li.ReadAt(make([]byte, 10), 10*chunkSize); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := eg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"bytes=0-1310719",       // chunks 0 to 4 (including read ahead)
+		"bytes=2621440-3932159", // chunks 10 to 14 (including read ahead)
+	}
+	if diff := cmp.Diff(want, srv.requests()); diff != "" {
+		t.Errorf("unexpected requests: diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,257 @@
+package fuse
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// latencyBuckets are the upper bounds (in seconds) of the latency histograms.
+// FUSE operations which are served from memory take microseconds, whereas
+// operations which need to read (or even download) data take much longer.
+var latencyBuckets = []float64{
+	0.00001, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 60,
+}
+
+// histogram is a Prometheus histogram with latencyBuckets.
+type histogram struct {
+	counts []uint64 // per bucket (not cumulative), last element is +Inf
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets)+1)
+	}
+	h.counts[sort.SearchFloat64s(latencyBuckets, v)]++
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) write(w io.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cumulative uint64
+	for idx, le := range latencyBuckets {
+		if h.counts != nil {
+			cumulative += h.counts[idx]
+		}
+		fmt.Fprintf(w, "%s_bucket{%s%sle=%q} %d\n", name, labels, sep, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %v\n", name, labels, h.sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+// fuseMetrics are collected while serving the file system. The zero value is
+// ready to use.
+type fuseMetrics struct {
+	mu            sync.Mutex
+	ops           map[string]*histogram // by operation, e.g. LookUpInode
+	readBytes     map[int]uint64        // by image
+	autodownloads histogram
+}
+
+// observeOp records the latency of a FUSE operation which started at start.
+// Use it like so:
+//
+//	defer fs.metrics.observeOp("ReadFile", time.Now())
+func (m *fuseMetrics) observeOp(op string, start time.Time) {
+	elapsed := time.Since(start).Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ops == nil {
+		m.ops = make(map[string]*histogram)
+	}
+	h, ok := m.ops[op]
+	if !ok {
+		h = &histogram{}
+		m.ops[op] = h
+	}
+	h.observe(elapsed)
+}
+
+func (m *fuseMetrics) addReadBytes(image, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.readBytes == nil {
+		m.readBytes = make(map[int]uint64)
+	}
+	m.readBytes[image] += uint64(n)
+}
+
+func (m *fuseMetrics) observeAutodownload(start time.Time) {
+	elapsed := time.Since(start).Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.autodownloads.observe(elapsed)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// gauges returns the number of packages, mounted images and open readers.
+func (fs *fuseFS) gauges() (packages, mounted, openReaders int) {
+	fs.mu.Lock()
+	for idx, pkg := range fs.pkgs {
+		if pkg == "" {
+			continue // tombstone
+		}
+		packages++
+		if idx < len(fs.readers) && fs.readers[idx] != nil {
+			mounted++
+		}
+	}
+	fs.mu.Unlock()
+
+	fs.fileReadersMu.Lock()
+	openReaders = len(fs.fileReaders)
+	fs.fileReadersMu.Unlock()
+	return packages, mounted, openReaders
+}
+
+// writeMetrics writes all metrics to w in the Prometheus text format.
+func (fs *fuseFS) writeMetrics(w io.Writer) {
+	packages, mounted, openReaders := fs.gauges()
+	fs.mu.Lock()
+	pkgs := append([]string(nil), fs.pkgs...)
+	fs.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP distri_fuse_packages Number of packages provided by the file system.\n")
+	fmt.Fprintf(w, "# TYPE distri_fuse_packages gauge\n")
+	fmt.Fprintf(w, "distri_fuse_packages %d\n", packages)
+	fmt.Fprintf(w, "# HELP distri_fuse_mounted_images Number of package images which were accessed and are held open.\n")
+	fmt.Fprintf(w, "# TYPE distri_fuse_mounted_images gauge\n")
+	fmt.Fprintf(w, "distri_fuse_mounted_images %d\n", mounted)
+	fmt.Fprintf(w, "# HELP distri_fuse_open_readers Number of file readers held open for serving ReadFile.\n")
+	fmt.Fprintf(w, "# TYPE distri_fuse_open_readers gauge\n")
+	fmt.Fprintf(w, "distri_fuse_open_readers %d\n", openReaders)
+
+	m := &fs.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ops := make([]string, 0, len(m.ops))
+	for op := range m.ops {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	fmt.Fprintf(w, "# HELP distri_fuse_op_duration_seconds Latency of FUSE operations.\n")
+	fmt.Fprintf(w, "# TYPE distri_fuse_op_duration_seconds histogram\n")
+	for _, op := range ops {
+		m.ops[op].write(w, "distri_fuse_op_duration_seconds", fmt.Sprintf("op=%q", op))
+	}
+
+	images := make([]int, 0, len(m.readBytes))
+	for image := range m.readBytes {
+		images = append(images, image)
+	}
+	sort.Ints(images)
+	fmt.Fprintf(w, "# HELP distri_fuse_read_bytes_total Bytes returned by ReadFile, by package.\n")
+	fmt.Fprintf(w, "# TYPE distri_fuse_read_bytes_total counter\n")
+	for _, image := range images {
+		if image < 0 || image >= len(pkgs) || pkgs[image] == "" {
+			continue
+		}
+		fmt.Fprintf(w, "distri_fuse_read_bytes_total{package=\"%s\"} %d\n", labelEscaper.Replace(pkgs[image]), m.readBytes[image])
+	}
+
+	fmt.Fprintf(w, "# HELP distri_fuse_autodownload_duration_seconds Time spent making a package available which is not in the local repo.\n")
+	fmt.Fprintf(w, "# TYPE distri_fuse_autodownload_duration_seconds histogram\n")
+	m.autodownloads.write(w, "distri_fuse_autodownload_duration_seconds", "")
+}
+
+// writeDebug writes a human-readable overview of the file system to w.
+func (fs *fuseFS) writeDebug(w io.Writer) {
+	fs.metrics.mu.Lock()
+	readBytes := make(map[int]uint64, len(fs.metrics.readBytes))
+	for image, n := range fs.metrics.readBytes {
+		readBytes[image] = n
+	}
+	fs.metrics.mu.Unlock()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "repo:\t%s\n", fs.repo)
+	fmt.Fprintf(tw, "section:\t%s\n", fs.repoSection)
+	fmt.Fprintf(tw, "autodownload:\t%v\n", fs.autoDownload)
+	fmt.Fprintf(tw, "lazy:\t%v\n", fs.lazy)
+	if fs.cache != nil {
+		chunks, size := fs.cache.cachedChunks()
+		fmt.Fprintf(tw, "chunk cache:\t%d chunks, %d of %d bytes\n", chunks, size, fs.cache.max)
+	}
+	fmt.Fprintln(tw)
+
+	paths := make([]string, 0, len(fs.dirs))
+	for path := range fs.dirs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	fmt.Fprintf(tw, "EXCHANGE DIR\tENTRIES\n")
+	for _, path := range paths {
+		var entries int
+		for _, dirent := range fs.dirs[path].entries {
+			if dirent != nil {
+				entries++
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%d\n", path, entries)
+	}
+	fmt.Fprintln(tw)
+
+	if len(fs.conflicts) > 0 {
+		paths := make([]string, 0, len(fs.conflicts))
+		for path := range fs.conflicts {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		fmt.Fprintf(tw, "CONFLICT\tPACKAGES\tREASON\n")
+		for _, path := range paths {
+			c := fs.conflictLocked(path)
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", path, strings.Join(c.Pkgs, ", "), c.Reason)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	fmt.Fprintf(tw, "PACKAGE\tMOUNTED\tREAD BYTES\tORIGIN\n")
+	for idx, pkg := range fs.pkgs {
+		if pkg == "" {
+			continue // tombstone
+		}
+		mounted := idx < len(fs.readers) && fs.readers[idx] != nil
+		origin := fs.origins[pkg]
+		if origin == "" {
+			origin = fs.repo
+		}
+		fmt.Fprintf(tw, "%s\t%v\t%d\t%s\n", pkg, mounted, readBytes[idx], origin)
+	}
+	tw.Flush()
+}
+
+// httpHandler serves Prometheus metrics on /metrics and a debug page on
+// /debug/fuse.
+func (fs *fuseFS) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		fs.writeMetrics(w)
+	})
+	mux.HandleFunc("/debug/fuse", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fs.writeDebug(w)
+	})
+	return mux
+}
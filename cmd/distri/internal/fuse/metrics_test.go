@@ -0,0 +1,85 @@
+package fuse
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distri-metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	writeTestPackage(t, repo, "hello-amd64-1", nil, "bin/")
+	writeTestPackage(t, repo, "world-amd64-1", nil, "bin/")
+
+	fs := newTestFS(repo)
+	if err := fs.scanPackages(&nopLocker{}, []string{"hello-amd64-1", "world-amd64-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.mountImage(1); err != nil {
+		t.Fatal(err)
+	}
+	fs.metrics.observeOp("LookUpInode", time.Now().Add(-3*time.Millisecond))
+	fs.metrics.observeOp("LookUpInode", time.Now())
+	fs.metrics.addReadBytes(1, 4096)
+	fs.metrics.addReadBytes(1, 100)
+
+	srv := httptest.NewServer(fs.httpHandler())
+	defer srv.Close()
+	get := func(path string) string {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("%s: HTTP status %v", path, resp.Status)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	metrics := get("/metrics")
+	for _, want := range []string{
+		"distri_fuse_packages 2\n",
+		"distri_fuse_mounted_images 1\n",
+		"distri_fuse_open_readers 0\n",
+		`distri_fuse_op_duration_seconds_bucket{op="LookUpInode",le="0.001"} 1` + "\n",
+		`distri_fuse_op_duration_seconds_bucket{op="LookUpInode",le="0.005"} 2` + "\n",
+		`distri_fuse_op_duration_seconds_bucket{op="LookUpInode",le="+Inf"} 2` + "\n",
+		`distri_fuse_op_duration_seconds_count{op="LookUpInode"} 2` + "\n",
+		`distri_fuse_read_bytes_total{package="world-amd64-1"} 4196` + "\n",
+		"distri_fuse_autodownload_duration_seconds_count 0\n",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("/metrics does not contain %q:\n%s", want, metrics)
+		}
+	}
+
+	// The debug page is formatted into columns, so compare fields:
+	debug := get("/debug/fuse")
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(debug, "\n") {
+		lines[strings.Join(strings.Fields(line), " ")] = true
+	}
+	for _, want := range []string{
+		"world-amd64-1 true 4196 " + repo,
+		"hello-amd64-1 false 0 " + repo,
+		"/bin 0",
+	} {
+		if !lines[want] {
+			t.Errorf("/debug/fuse does not contain line %q:\n%s", want, debug)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package fuse
+
+import (
+	"log"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// invalidator is implemented by *fuse.Connection.
+type invalidator interface {
+	InvalidateEntry(parent fuseops.InodeID, name string) error
+	InvalidateInode(inode fuseops.InodeID, off, length int64) error
+}
+
+// invalidation is either an entry invalidation (name within parent) or an
+// inode invalidation (attributes and contents of inode).
+type invalidation struct {
+	parent fuseops.InodeID
+	name   string
+	inode  fuseops.InodeID
+}
+
+// notifier sends cache invalidations to the kernel, so that changes to the
+// exchange directories become visible immediately despite long cache
+// timeouts.
+//
+// Invalidations are sent from a separate goroutine: the kernel locks the
+// affected directory while processing an invalidation, so sending it while
+// holding fs.mu would deadlock with a concurrent LookUpInode in that directory.
+//
+// The zero value discards invalidations until start is called, which is fine
+// because the kernel cannot have cached anything before the file system is
+// mounted.
+type notifier struct {
+	mu        sync.Mutex
+	conn      invalidator
+	supported bool // kernel accepted an invalidation
+	pending   []invalidation
+	wake      chan struct{}
+}
+
+func (n *notifier) start(conn invalidator) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.conn = conn
+	n.wake = make(chan struct{}, 1)
+	go n.run(conn, n.wake)
+}
+
+func (n *notifier) enqueue(inv invalidation) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		return // not mounted (yet), or the kernel does not support invalidations
+	}
+	n.pending = append(n.pending, inv)
+	select {
+	case n.wake <- struct{}{}:
+	default:
+		// run has not yet picked up the previous wake-up
+	}
+}
+
+// expiration returns until when the kernel may cache virtual entries and
+// their attributes: indefinitely if changes are invalidated, or for
+// VirtualFileExpiration otherwise (e.g. before the kernel answered the first
+// invalidation).
+func (n *notifier) expiration() time.Time {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.supported {
+		return time.Now().Add(VirtualFileExpiration)
+	}
+	return never
+}
+
+// disable stops sending invalidations after the kernel answered ENOSYS.
+func (n *notifier) disable() {
+	log.Printf("kernel does not support FUSE cache invalidations, changes become visible after cache timeouts")
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.conn = nil
+	n.supported = false
+	n.pending = nil
+}
+
+func (n *notifier) run(conn invalidator, wake <-chan struct{}) {
+	// Probe for support by dropping the (uncached) attributes of the root
+	// directory, so that entries are not cached indefinitely in vain:
+	if err := conn.InvalidateInode(fuseops.RootInodeID, -1, 0); err == syscall.ENOSYS {
+		n.disable()
+		return
+	}
+	n.mu.Lock()
+	n.supported = true
+	n.mu.Unlock()
+	for range wake {
+		n.mu.Lock()
+		pending := n.pending
+		n.pending = nil
+		n.mu.Unlock()
+		for _, inv := range pending {
+			var err error
+			if inv.parent != 0 {
+				err = conn.InvalidateEntry(inv.parent, inv.name)
+			} else {
+				err = conn.InvalidateInode(inv.inode, 0, 0)
+			}
+			if err == syscall.ENOSYS {
+				n.disable()
+				return
+			}
+			if err != nil {
+				log.Printf("invalidating %+v: %v", inv, err)
+			}
+		}
+	}
+}
+
+// invalidateEntryLocked makes the kernel look up name in dir again. fs.mu must
+// be held.
+func (fs *fuseFS) invalidateEntryLocked(dir *dir, name string) {
+	if dir.inode == 0 {
+		return // not (yet) known to the kernel
+	}
+	fs.notifier.enqueue(invalidation{parent: dir.inode, name: name})
+}
+
+// invalidateInode makes the kernel request the attributes and contents of
+// inode again.
+func (fs *fuseFS) invalidateInode(inode fuseops.InodeID) {
+	fs.notifier.enqueue(invalidation{inode: inode})
+}
+
+// notifyingServer starts fs.notifier once the connection to the kernel is
+// established.
+type notifyingServer struct {
+	fuse.Server
+	fs *fuseFS
+}
+
+func (s *notifyingServer) ServeOps(c *fuse.Connection) {
+	s.fs.notifier.start(c)
+	s.Server.ServeOps(c)
+}
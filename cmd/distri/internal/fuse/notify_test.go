@@ -0,0 +1,156 @@
+package fuse
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// recordingInvalidator sends all invalidations to a channel.
+type recordingInvalidator chan invalidation
+
+func (r recordingInvalidator) InvalidateEntry(parent fuseops.InodeID, name string) error {
+	r <- invalidation{parent: parent, name: name}
+	return nil
+}
+
+func (r recordingInvalidator) InvalidateInode(inode fuseops.InodeID, off, length int64) error {
+	r <- invalidation{inode: inode}
+	return nil
+}
+
+// unsupportedInvalidator behaves like a kernel without FUSE_NOTIFY_INVAL_*.
+type unsupportedInvalidator struct{}
+
+func (unsupportedInvalidator) InvalidateEntry(fuseops.InodeID, string) error {
+	return syscall.ENOSYS
+}
+
+func (unsupportedInvalidator) InvalidateInode(fuseops.InodeID, int64, int64) error {
+	return syscall.ENOSYS
+}
+
+func TestNotify(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distri-notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	writeTestPackage(t, repo, "hello-amd64-1", nil, "bin/hello")
+	writeTestPackage(t, repo, "world-amd64-1", nil, "bin/world")
+
+	fs := newTestFS(repo)
+	fs.dirs["/"].inode = fuseops.RootInodeID
+	if err := fs.scanPackages(&nopLocker{}, []string{"hello-amd64-1"}); err != nil {
+		t.Fatal(err)
+	}
+	bin := fs.dirs["/bin"].inode
+
+	// Invalidations are only sent once mounted:
+	invalidations := make(recordingInvalidator, 100)
+	fs.notifier.start(invalidations)
+
+	// expect waits until want was sent, ignoring other invalidations.
+	expect := func(want invalidation) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case got := <-invalidations:
+				if got == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timeout waiting for invalidation %+v", want)
+			}
+		}
+	}
+
+	if err := fs.scanPackages(&nopLocker{}, []string{"hello-amd64-1", "world-amd64-1"}); err != nil {
+		t.Fatal(err)
+	}
+	expect(invalidation{parent: bin, name: "world"})
+
+	ctx := context.Background()
+	if _, err := fs.ForgetPackage(ctx, &pb.ForgetPackageRequest{Pkg: proto.String("hello-amd64-1")}); err != nil {
+		t.Fatal(err)
+	}
+	expect(invalidation{parent: fuseops.RootInodeID, name: "hello-amd64-1"})
+	expect(invalidation{parent: bin, name: "hello"})
+}
+
+func TestNotifyExpiration(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distri-notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	writeTestPackage(t, repo, "hello-amd64-1", nil, "bin/hello")
+
+	ctx := context.Background()
+	// lookup returns for how long the kernel may cache /bin/hello.
+	lookup := func(fs *fuseFS) time.Duration {
+		t.Helper()
+		op := &fuseops.LookUpInodeOp{
+			Parent: fs.dirs["/bin"].inode,
+			Name:   "hello",
+		}
+		if err := fs.LookUpInode(ctx, op); err != nil {
+			t.Fatal(err)
+		}
+		if op.Entry.AttributesExpiration != op.Entry.EntryExpiration {
+			t.Errorf("attributes expire at %v, entry at %v", op.Entry.AttributesExpiration, op.Entry.EntryExpiration)
+		}
+		return time.Until(op.Entry.EntryExpiration)
+	}
+	// waitFor waits until the notifier probed for invalidation support.
+	waitFor := func(fs *fuseFS, supported bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			fs.notifier.mu.Lock()
+			done := fs.notifier.supported == supported && (supported || fs.notifier.conn == nil)
+			fs.notifier.mu.Unlock()
+			if done {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout waiting for the notifier to probe")
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		name      string
+		conn      invalidator
+		supported bool
+	}{
+		{"supported", make(recordingInvalidator, 100), true},
+		{"ENOSYS", unsupportedInvalidator{}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newTestFS(repo)
+			if err := fs.scanPackages(&nopLocker{}, []string{"hello-amd64-1"}); err != nil {
+				t.Fatal(err)
+			}
+			if got := lookup(fs); got > VirtualFileExpiration {
+				t.Errorf("before mounting: entry cached for %v, want at most %v", got, VirtualFileExpiration)
+			}
+			fs.notifier.start(tt.conn)
+			waitFor(fs, tt.supported)
+			got := lookup(fs)
+			if tt.supported && got <= time.Hour {
+				t.Errorf("entry cached for %v despite invalidations, want longer", got)
+			}
+			if !tt.supported && got > VirtualFileExpiration {
+				t.Errorf("entry cached for %v without invalidations, want at most %v", got, VirtualFileExpiration)
+			}
+		})
+	}
+}
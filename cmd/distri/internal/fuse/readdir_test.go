@@ -0,0 +1,128 @@
+package fuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// direntPlusEntry is the subset of a fuse_direntplus which TestReadDirPlus
+// verifies.
+type direntPlusEntry struct {
+	Name   string
+	Inode  uint64 // fuse_dirent.ino
+	Nodeid uint64 // fuse_entry_out.nodeid
+	Mode   uint32 // fuse_entry_out.attr.mode
+}
+
+// parseDirentPlus parses the output of ReadDirPlus (in host byte order, i.e.
+// little endian on amd64).
+func parseDirentPlus(t *testing.T, b []byte) []direntPlusEntry {
+	t.Helper()
+	const (
+		entryOutSize = 128       // sizeof(struct fuse_entry_out)
+		modeOffset   = 40 + 60   // offsetof(struct fuse_entry_out, attr.mode)
+		direntSize   = 8 + 8 + 8 // sizeof(struct fuse_dirent) without name
+	)
+	le := binary.LittleEndian
+	var entries []direntPlusEntry
+	for len(b) > 0 {
+		if len(b) < entryOutSize+direntSize {
+			t.Fatalf("truncated direntplus: %d bytes left", len(b))
+		}
+		namelen := int(le.Uint32(b[entryOutSize+16:]))
+		entries = append(entries, direntPlusEntry{
+			Name:   string(b[entryOutSize+direntSize : entryOutSize+direntSize+namelen]),
+			Inode:  le.Uint64(b[entryOutSize:]),
+			Nodeid: le.Uint64(b),
+			Mode:   le.Uint32(b[modeOffset:]),
+		})
+		n := entryOutSize + direntSize + namelen
+		n += (8 - n%8) % 8 // FUSE_DIRENT_ALIGN
+		b = b[n:]
+	}
+	return entries
+}
+
+func TestReadDirPlus(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distri-readdirplus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	writeTestPackage(t, repo, "hello-amd64-1", nil, "bin/hello")
+	writeTestPackage(t, repo, "world-amd64-1", nil, "bin/world")
+
+	fs := newTestFS(repo)
+	if err := fs.scanPackages(&nopLocker{}, []string{"hello-amd64-1", "world-amd64-1"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	readDirPlus := func(inode fuseops.InodeID, offset fuseops.DirOffset) []direntPlusEntry {
+		t.Helper()
+		op := &fuseops.ReadDirPlusOp{
+			Inode:  inode,
+			Offset: offset,
+			Dst:    make([]byte, 4096),
+		}
+		if err := fs.ReadDirPlus(ctx, op); err != nil {
+			t.Fatal(err)
+		}
+		// ReadDir must return the same entries, minus the attributes:
+		rop := &fuseops.ReadDirOp{
+			Inode:  inode,
+			Offset: offset,
+			Dst:    make([]byte, 4096),
+		}
+		if err := fs.ReadDir(ctx, rop); err != nil {
+			t.Fatal(err)
+		}
+		entries := parseDirentPlus(t, op.Dst[:op.BytesRead])
+		for _, e := range entries {
+			if !bytes.Contains(rop.Dst[:rop.BytesRead], []byte(e.Name)) {
+				t.Errorf("ReadDir(%d) does not contain %q", inode, e.Name)
+			}
+		}
+		return entries
+	}
+
+	// Packages are scanned concurrently, so the order of entries varies:
+	bin := fs.dirs["/bin"]
+	var want []direntPlusEntry
+	for _, e := range bin.entries {
+		want = append(want, direntPlusEntry{
+			Name:   e.name,
+			Inode:  uint64(e.inode),
+			Nodeid: uint64(e.inode),
+			Mode:   syscall.S_IFLNK | 0444,
+		})
+	}
+	if got, want := len(want), 2; got != want {
+		t.Fatalf("/bin contains %d entries, want %d (hello and world)", got, want)
+	}
+	if diff := cmp.Diff(want, readDirPlus(bin.inode, 0)); diff != "" {
+		t.Errorf("ReadDirPlus(/bin): unexpected entries: diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want[1:], readDirPlus(bin.inode, 1)); diff != "" {
+		t.Errorf("ReadDirPlus(/bin, offset 1): unexpected entries: diff (-want +got):\n%s", diff)
+	}
+
+	// Package contents are read from the image:
+	pkgBin := fs.fuseInode(0, rootInode)
+	root := readDirPlus(pkgBin, 0)
+	if len(root) != 1 || root[0].Name != "bin" || root[0].Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		t.Fatalf("ReadDirPlus(/hello-amd64-1) = %+v, want a bin directory", root)
+	}
+	contents := readDirPlus(fuseops.InodeID(root[0].Nodeid), 0)
+	if len(contents) != 1 || contents[0].Name != "hello" || contents[0].Mode != syscall.S_IFREG|0755 {
+		t.Errorf("ReadDirPlus(/hello-amd64-1/bin) = %+v, want an executable hello file", contents)
+	}
+}
@@ -0,0 +1,436 @@
+package fuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// synthToolTimeout bounds how long a synthesizer tool may run. Accesses to the
+// files it generates block until then.
+var synthToolTimeout = 30 * time.Second
+
+// synthesizer generates cache files in an exchange directory from the union of
+// all packages’ files in that directory. Typically, cache files are generated
+// by hooks when installing packages, but distri packages have no hooks.
+type synthesizer struct {
+	dir   string   // exchange directory, e.g. /share/glib-2.0/schemas
+	files []string // generated files within dir, e.g. gschemas.compiled
+
+	// tool is the program (in the bin exchange directory) which generates
+	// files, if any. files are only provided when tool is available.
+	tool string
+
+	// input reports whether the file rel (relative to dir, e.g.
+	// packages/freedesktop.org.xml) is an input for generating files.
+	input func(rel string) bool
+
+	// generate returns the contents of files, given inputs, which maps paths
+	// relative to dir to the path of the file within its package, e.g.
+	// out/share/mime/packages/freedesktop.org.xml.
+	generate func(ctx context.Context, fs *fuseFS, inputs []synthInput) (map[string][]byte, error)
+}
+
+type synthInput struct {
+	rel  string // e.g. packages/freedesktop.org.xml
+	pkg  string // e.g. shared-mime-info-amd64-1.10-4
+	path string // e.g. out/share/mime/packages/freedesktop.org.xml
+}
+
+var synthesizers = []*synthesizer{
+	{
+		// ld.so.cache allows the dynamic linker to locate libraries without
+		// searching /ro/lib.
+		dir:   "/lib",
+		files: []string{"ld.so.cache"},
+		input: func(rel string) bool {
+			return !strings.ContainsRune(rel, '/') && sharedLibrary(rel)
+		},
+		generate: generateLdSoCache,
+	},
+
+	{
+		// gschemas.compiled is read by GSettings (e.g. GNOME and GTK apps).
+		dir:   "/share/glib-2.0/schemas",
+		files: []string{"gschemas.compiled"},
+		tool:  "glib-compile-schemas",
+		input: func(rel string) bool {
+			return !strings.ContainsRune(rel, '/') &&
+				(strings.HasSuffix(rel, ".gschema.xml") || strings.HasSuffix(rel, ".gschema.override"))
+		},
+		generate: func(ctx context.Context, fs *fuseFS, inputs []synthInput) (map[string][]byte, error) {
+			return fs.runSynthTool(ctx, inputs, "glib-compile-schemas", []string{"gschemas.compiled"}, func(dir string) []string {
+				return []string{"--targetdir=" + dir, dir}
+			})
+		},
+	},
+
+	{
+		// The shared MIME-info database is read by GIO and other desktop
+		// software to determine file types.
+		dir:   "/share/mime",
+		files: mimeFiles,
+		tool:  "update-mime-database",
+		input: func(rel string) bool {
+			return filepath.Dir(rel) == "packages" && strings.HasSuffix(rel, ".xml")
+		},
+		generate: func(ctx context.Context, fs *fuseFS, inputs []synthInput) (map[string][]byte, error) {
+			return fs.runSynthTool(ctx, inputs, "update-mime-database", mimeFiles, func(dir string) []string {
+				return []string{dir}
+			})
+		},
+	},
+}
+
+// mimeFiles are the files which update-mime-database generates.
+var mimeFiles = []string{
+	"XMLnamespaces",
+	"aliases",
+	"generic-icons",
+	"globs",
+	"globs2",
+	"icons",
+	"magic",
+	"mime.cache",
+	"subclasses",
+	"treemagic",
+	"types",
+	"version",
+}
+
+// synthState caches the files generated by a synthesizer until they are
+// invalidated by a change to the set of packages.
+type synthState struct {
+	*synthesizer
+
+	dirents []*dirent // nil if files are not currently provided (guarded by fuseFS.mu)
+
+	genMu sync.Mutex // serializes generation
+
+	mu       sync.Mutex
+	epoch    uint64            // incremented when invalidated
+	contents map[string][]byte // by file name, nil if not yet generated
+}
+
+func (st *synthState) invalidate() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.contents = nil
+	st.epoch++
+}
+
+// updateSynthesized provides the files of all synthesizers whose exchange
+// directory (and tool, if any) exists, and invalidates all previously generated
+// files. fs.mu must be held.
+func (fs *fuseFS) updateSynthesized() {
+	if fs.synth == nil {
+		for _, s := range synthesizers {
+			fs.synth = append(fs.synth, &synthState{synthesizer: s})
+		}
+	}
+	for _, st := range fs.synth {
+		st.invalidate()
+		for _, d := range st.dirents {
+			fs.invalidateInode(d.inode)
+		}
+		dir, available := fs.dirs[st.dir]
+		if st.tool != "" {
+			bin, ok := fs.dirs["/bin"]
+			available = available && ok && bin.byName[st.tool] != nil
+		}
+		switch {
+		case available && st.dirents == nil:
+			for _, name := range st.files {
+				for idx, entry := range dir.entries {
+					if entry != nil && entry.name == name {
+						dir.entries[idx] = nil // tombstone, e.g. a package-provided cache
+					}
+				}
+				dirent := &dirent{
+					name:  name,
+					inode: fs.allocateInodeLocked(),
+					synth: st,
+				}
+				dir.entries = append(dir.entries, dirent)
+				dir.byName[name] = dirent
+				fs.inodes[dirent.inode] = dirent
+				fs.invalidateEntryLocked(dir, name)
+				st.dirents = append(st.dirents, dirent)
+			}
+
+		case !available && st.dirents != nil:
+			for _, d := range st.dirents {
+				if dir != nil {
+					for idx, entry := range dir.entries {
+						if entry == d {
+							dir.entries[idx] = nil // tombstone
+						}
+					}
+					delete(dir.byName, d.name)
+					fs.invalidateEntryLocked(dir, d.name)
+				}
+				delete(fs.inodes, d.inode)
+			}
+			st.dirents = nil
+		}
+	}
+}
+
+// synthesize returns the contents of the synthesized file d, generating all
+// files of its synthesizer if required. Failed generations are not cached, so
+// the next access tries again.
+func (fs *fuseFS) synthesize(ctx context.Context, d *dirent) ([]byte, error) {
+	st := d.synth
+	st.genMu.Lock()
+	defer st.genMu.Unlock()
+	st.mu.Lock()
+	contents, epoch := st.contents, st.epoch
+	st.mu.Unlock()
+	if contents == nil {
+		var err error
+		contents, err = st.generate(ctx, fs, fs.synthInputs(st.synthesizer))
+		if err != nil {
+			log.Printf("generating %s/%s: %v", st.dir, strings.Join(st.files, ","), err)
+			return nil, err
+		}
+		st.mu.Lock()
+		if st.epoch == epoch {
+			st.contents = contents
+		}
+		st.mu.Unlock()
+	}
+	return contents[d.name], nil
+}
+
+// synthInputs returns the inputs for s, sorted by rel.
+func (fs *fuseFS) synthInputs(s *synthesizer) []synthInput {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var inputs []synthInput
+	for path, dir := range fs.dirs {
+		if path != s.dir && !strings.HasPrefix(path, s.dir+"/") {
+			continue
+		}
+		for _, dirent := range dir.entries {
+			if dirent == nil || dirent.linkTarget == "" {
+				continue // tombstone, subdirectory or synthesized file
+			}
+			rel := strings.TrimPrefix(filepath.Join(strings.TrimPrefix(path, s.dir), dirent.name), "/")
+			if !s.input(rel) {
+				continue
+			}
+			// e.g. /share/mime/packages/foo.xml → ../../../foo-amd64-1/out/share/mime/packages/foo.xml
+			target := filepath.Join(path, dirent.linkTarget)
+			// target is now /foo-amd64-1/out/share/mime/packages/foo.xml
+			parts := strings.SplitN(strings.TrimPrefix(target, "/"), "/", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			inputs = append(inputs, synthInput{
+				rel:  rel,
+				pkg:  parts[0],
+				path: parts[1],
+			})
+		}
+	}
+	sort.Slice(inputs, func(i, j int) bool {
+		return inputs[i].rel < inputs[j].rel
+	})
+	return inputs
+}
+
+// readPackageFile returns the contents of the file path within pkg.
+func (fs *fuseFS) readPackageFile(pkg, path string) ([]byte, error) {
+	image := -1
+	fs.mu.Lock()
+	for idx, p := range fs.pkgs {
+		if p == pkg {
+			image = idx
+			break
+		}
+	}
+	fs.mu.Unlock()
+	if image == -1 {
+		return nil, xerrors.Errorf("package %s not found", pkg)
+	}
+	rd, err := fs.mountImage(image)
+	if err != nil {
+		return nil, err
+	}
+	inode, err := LookupPath(rd.Reader, path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := rd.FileReader(inode)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// runSynthTool copies inputs into a temporary directory, runs tool with the
+// arguments returned by args (for at most synthToolTimeout) and returns the
+// resulting files.
+func (fs *fuseFS) runSynthTool(ctx context.Context, inputs []synthInput, tool string, files []string, args func(dir string) []string) (map[string][]byte, error) {
+	tmp, err := ioutil.TempDir("", "distri-synth")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	for _, in := range inputs {
+		b, err := fs.readPackageFile(in.pkg, in.path)
+		if err != nil {
+			log.Printf("%s: skipping %s: %v", tool, in.rel, err)
+			continue
+		}
+		fn := filepath.Join(tmp, in.rel)
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(fn, b, 0644); err != nil {
+			return nil, err
+		}
+	}
+	// Output goes to a file instead of a pipe, which child processes of tool
+	// could keep open past the deadline.
+	out, err := ioutil.TempFile("", "distri-synth-output")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	ctx, cancel := context.WithTimeout(ctx, synthToolTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, filepath.Join(fs.mountpoint, "bin", tool), args(tmp)...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err() // more descriptive than “signal: killed”
+		}
+		b, _ := ioutil.ReadFile(out.Name())
+		return nil, xerrors.Errorf("%v: %v (output: %s)", cmd.Args, err, bytes.TrimSpace(b))
+	}
+	result := make(map[string][]byte, len(files))
+	for _, name := range files {
+		b, err := ioutil.ReadFile(filepath.Join(tmp, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // not generated, e.g. treemagic without any tree magic
+			}
+			return nil, err
+		}
+		result[name] = b
+	}
+	return result, nil
+}
+
+// sharedLibrary reports whether name looks like the name of a shared library,
+// e.g. libc.so.6 or ld-linux-x86-64.so.2.
+func sharedLibrary(name string) bool {
+	if !strings.HasPrefix(name, "lib") && !strings.HasPrefix(name, "ld-") {
+		return false
+	}
+	return strings.HasSuffix(name, ".so") || strings.Contains(name, ".so.")
+}
+
+// dlCacheLibcmp compares library names like glibc’s _dl_cache_libcmp, i.e.
+// numbers are compared numerically.
+func dlCacheLibcmp(a, b string) int {
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	i, j := 0, 0
+	for i < len(a) {
+		switch {
+		case isDigit(a[i]) && j < len(b) && isDigit(b[j]):
+			var va, vb int
+			for ; i < len(a) && isDigit(a[i]); i++ {
+				va = va*10 + int(a[i]-'0')
+			}
+			for ; j < len(b) && isDigit(b[j]); j++ {
+				vb = vb*10 + int(b[j]-'0')
+			}
+			if va != vb {
+				return va - vb
+			}
+		case isDigit(a[i]):
+			return 1
+		case j < len(b) && isDigit(b[j]):
+			return -1
+		case j >= len(b) || a[i] != b[j]:
+			if j >= len(b) {
+				return int(a[i])
+			}
+			return int(a[i]) - int(b[j])
+		default:
+			i++
+			j++
+		}
+	}
+	if j < len(b) {
+		return -int(b[j])
+	}
+	return 0
+}
+
+// generateLdSoCache returns an ld.so.cache (in the glibc-ld.so.cache1.1 format)
+// which maps the names of all libraries in the lib exchange directory to their
+// path underneath the mountpoint.
+func generateLdSoCache(ctx context.Context, fs *fuseFS, inputs []synthInput) (map[string][]byte, error) {
+	const (
+		magic        = "glibc-ld.so.cache1.1"
+		headerSize   = len(magic) + 4 + 4 + 1 + 3 + 4 + 3*4
+		entrySize    = 4 + 4 + 4 + 4 + 8
+		flagsLibc6   = 0x0003 // FLAG_ELF_LIBC6
+		flagsX8664   = 0x0300 // FLAG_X8664_LIB64
+		endianLittle = 2      // cache_file_new_flags_endian_little
+	)
+	names := make([]string, 0, len(inputs))
+	for _, in := range inputs {
+		names = append(names, in.rel)
+	}
+	// ld.so looks up entries using binary search, expecting descending order:
+	sort.Slice(names, func(i, j int) bool {
+		return dlCacheLibcmp(names[i], names[j]) > 0
+	})
+
+	var strs bytes.Buffer
+	stringsOffset := headerSize + len(names)*entrySize
+	type entry struct{ key, value uint32 }
+	entries := make([]entry, len(names))
+	for idx, name := range names {
+		entries[idx].key = uint32(stringsOffset + strs.Len())
+		strs.WriteString(name)
+		strs.WriteByte(0)
+		entries[idx].value = uint32(stringsOffset + strs.Len())
+		strs.WriteString(filepath.Join(fs.mountpoint, "lib", name))
+		strs.WriteByte(0)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	le := binary.LittleEndian
+	binary.Write(&buf, le, uint32(len(names)))
+	binary.Write(&buf, le, uint32(strs.Len()))
+	buf.Write([]byte{endianLittle, 0, 0, 0}) // flags, padding
+	binary.Write(&buf, le, [4]uint32{})      // extension_offset, unused
+	for _, e := range entries {
+		binary.Write(&buf, le, int32(flagsLibc6|flagsX8664))
+		binary.Write(&buf, le, e.key)
+		binary.Write(&buf, le, e.value)
+		binary.Write(&buf, le, uint32(0)) // osversion
+		binary.Write(&buf, le, uint64(0)) // hwcap
+	}
+	buf.Write(strs.Bytes())
+	return map[string][]byte{"ld.so.cache": buf.Bytes()}, nil
+}
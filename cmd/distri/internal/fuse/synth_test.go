@@ -0,0 +1,288 @@
+package fuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+func TestDlCacheLibcmp(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int // sign only
+	}{
+		{"libfoo.so.10", "libfoo.so.2", 1},
+		{"libfoo.so.2", "libfoo.so.10", -1},
+		{"libfoo.so", "libfoo.so.1", -1},
+		{"libfoo.so.1", "libfoo.so.1", 0},
+		{"libbar.so", "libfoo.so", -1},
+		{"libc.so.6", "libc6.so", -1}, // digits sort after other characters
+	} {
+		got := dlCacheLibcmp(tt.a, tt.b)
+		switch {
+		case got < 0:
+			got = -1
+		case got > 0:
+			got = 1
+		}
+		if got != tt.want {
+			t.Errorf("dlCacheLibcmp(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// parseLdSoCache returns the key and value of each entry of an ld.so.cache in
+// the glibc-ld.so.cache1.1 format.
+func parseLdSoCache(t *testing.T, b []byte) [][2]string {
+	t.Helper()
+	const magic = "glibc-ld.so.cache1.1"
+	if !bytes.HasPrefix(b, []byte(magic)) {
+		t.Fatalf("ld.so.cache: magic not found")
+	}
+	le := binary.LittleEndian
+	nlibs := le.Uint32(b[len(magic):])
+	str := func(off uint32) string {
+		s := b[off:]
+		return string(s[:bytes.IndexByte(s, 0)])
+	}
+	var entries [][2]string
+	for i := uint32(0); i < nlibs; i++ {
+		e := b[48+i*24:]
+		if got, want := le.Uint32(e), uint32(0x0303); got != want {
+			t.Errorf("ld.so.cache entry %d: flags = %#x, want %#x", i, got, want)
+		}
+		entries = append(entries, [2]string{str(le.Uint32(e[4:])), str(le.Uint32(e[8:]))})
+	}
+	return entries
+}
+
+func TestSynthesizedFiles(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distri-synth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	writeTestPackage(t, repo, "glib-amd64-2.60-1", &pb.Meta{},
+		"bin/glib-compile-schemas",
+		"out/lib/libglib-2.0.so.0",
+		"out/lib/gio/modules/libgiofam.so",
+		"out/share/glib-2.0/schemas/org.gtk.Settings.gschema.xml")
+	writeTestPackage(t, repo, "foo-amd64-1", &pb.Meta{},
+		"out/lib/libfoo.so.1",
+		"out/lib/libfoo.so.10",
+		"out/lib/libfoo.so.2",
+		"out/lib/foo.conf")
+	writeTestPackage(t, repo, "bar-amd64-1", &pb.Meta{},
+		"out/share/glib-2.0/schemas/org.bar.gschema.xml")
+
+	// The file system runs tools from its mountpoint, which the test fakes:
+	mountpoint, err := ioutil.TempDir("", "distri-synth-mnt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mountpoint)
+	if err := os.MkdirAll(filepath.Join(mountpoint, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	const compileSchemas = `#!/bin/sh
+for arg; do
+	case "$arg" in
+	--targetdir=*) target="${arg#--targetdir=}" ;;
+	*) src="$arg" ;;
+	esac
+done
+cd "$src" && echo *.gschema.xml > "$target/gschemas.compiled"
+`
+	if err := ioutil.WriteFile(filepath.Join(mountpoint, "bin", "glib-compile-schemas"), []byte(compileSchemas), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := newTestFS(repo)
+	fs.mountpoint = mountpoint
+	if err := fs.scanPackages(&nopLocker{}, []string{"glib-amd64-2.60-1", "foo-amd64-1"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	read := func(path string) (string, bool) {
+		t.Helper()
+		dirent, ok := fs.dirs[filepath.Dir(path)].byName[filepath.Base(path)]
+		if !ok {
+			return "", false
+		}
+		if dirent.synth == nil {
+			t.Fatalf("%s: not a synthesized file", path)
+		}
+		attrs := fuseops.GetInodeAttributesOp{Inode: dirent.inode}
+		if err := fs.GetInodeAttributes(ctx, &attrs); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := attrs.Attributes.Mode, os.FileMode(0444); got != want {
+			t.Errorf("%s: mode = %v, want %v", path, got, want)
+		}
+		op := fuseops.ReadFileOp{
+			Inode: dirent.inode,
+			Dst:   make([]byte, 4096),
+		}
+		if err := fs.ReadFile(ctx, &op); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := attrs.Attributes.Size, uint64(op.BytesRead); got != want {
+			t.Errorf("%s: size = %d, but read %d bytes", path, got, want)
+		}
+		return string(op.Dst[:op.BytesRead]), true
+	}
+
+	ldSoCache, ok := read("/lib/ld.so.cache")
+	if !ok {
+		t.Fatalf("/lib/ld.so.cache not found")
+	}
+	want := [][2]string{
+		{"libglib-2.0.so.0", filepath.Join(mountpoint, "lib", "libglib-2.0.so.0")},
+		{"libfoo.so.10", filepath.Join(mountpoint, "lib", "libfoo.so.10")},
+		{"libfoo.so.2", filepath.Join(mountpoint, "lib", "libfoo.so.2")},
+		{"libfoo.so.1", filepath.Join(mountpoint, "lib", "libfoo.so.1")},
+	}
+	if diff := cmp.Diff(want, parseLdSoCache(t, []byte(ldSoCache))); diff != "" {
+		t.Errorf("ld.so.cache: unexpected entries: diff (-want +got):\n%s", diff)
+	}
+
+	if got, _ := read("/share/glib-2.0/schemas/gschemas.compiled"); got != "org.gtk.Settings.gschema.xml\n" {
+		t.Errorf("gschemas.compiled = %q, want %q", got, "org.gtk.Settings.gschema.xml\n")
+	}
+
+	// update-mime-database is not available:
+	if _, ok := read("/share/mime/mime.cache"); ok {
+		t.Errorf("/share/mime/mime.cache unexpectedly present")
+	}
+
+	// Adding and removing packages re-generates the files:
+	if err := fs.scanPackages(&nopLocker{}, []string{"glib-amd64-2.60-1", "foo-amd64-1", "bar-amd64-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := mustRead(t, read, "/share/glib-2.0/schemas/gschemas.compiled"), "org.bar.gschema.xml org.gtk.Settings.gschema.xml\n"; got != want {
+		t.Errorf("gschemas.compiled = %q, want %q", got, want)
+	}
+	if _, err := fs.ForgetPackage(ctx, &pb.ForgetPackageRequest{Pkg: proto.String("foo-amd64-1")}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want[:1], parseLdSoCache(t, []byte(mustRead(t, read, "/lib/ld.so.cache")))); diff != "" {
+		t.Errorf("ld.so.cache: unexpected entries after ForgetPackage: diff (-want +got):\n%s", diff)
+	}
+
+	// Without glib-compile-schemas, gschemas.compiled is no longer provided:
+	if _, err := fs.ForgetPackage(ctx, &pb.ForgetPackageRequest{Pkg: proto.String("glib-amd64-2.60-1")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := read("/share/glib-2.0/schemas/gschemas.compiled"); ok {
+		t.Errorf("gschemas.compiled unexpectedly present after ForgetPackage")
+	}
+}
+
+func mustRead(t *testing.T, read func(string) (string, bool), path string) string {
+	t.Helper()
+	got, ok := read(path)
+	if !ok {
+		t.Fatalf("%s not found", path)
+	}
+	return got
+}
+
+func TestSynthesizedFilesToolFailure(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distri-synth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	writeTestPackage(t, repo, "glib-amd64-2.60-1", nil,
+		"bin/glib-compile-schemas",
+		"out/share/glib-2.0/schemas/org.gtk.Settings.gschema.xml")
+
+	mountpoint, err := ioutil.TempDir("", "distri-synth-mnt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mountpoint)
+	if err := os.MkdirAll(filepath.Join(mountpoint, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	setTool := func(script string) {
+		t.Helper()
+		// Write a new file, as the previous one might still be executing:
+		fn := filepath.Join(mountpoint, "bin", "glib-compile-schemas")
+		if err := ioutil.WriteFile(fn+".new", []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(fn+".new", fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(old time.Duration) { synthToolTimeout = old }(synthToolTimeout)
+	synthToolTimeout = 100 * time.Millisecond
+
+	fs := newTestFS(repo)
+	fs.mountpoint = mountpoint
+	if err := fs.scanPackages(&nopLocker{}, []string{"glib-amd64-2.60-1"}); err != nil {
+		t.Fatal(err)
+	}
+	dirent, ok := fs.dirs["/share/glib-2.0/schemas"].byName["gschemas.compiled"]
+	if !ok {
+		t.Fatalf("gschemas.compiled not found")
+	}
+	ctx := context.Background()
+	read := func() (string, error) {
+		op := fuseops.ReadFileOp{
+			Inode: dirent.inode,
+			Dst:   make([]byte, 4096),
+		}
+		err := fs.ReadFile(ctx, &op)
+		return string(op.Dst[:op.BytesRead]), err
+	}
+
+	for _, tt := range []struct {
+		name   string
+		script string
+	}{
+		{"failing", "echo broken >&2; exit 1\n"},
+		// The child process keeps running (and its output open) after the
+		// shell is killed:
+		{"hanging", "sleep 10\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setTool(tt.script)
+			start := time.Now()
+			if _, err := read(); err != fuse.EIO {
+				t.Errorf("ReadFile = %v, want EIO", err)
+			}
+			if took := time.Since(start); took > 5*time.Second {
+				t.Errorf("ReadFile took %v, want at most %v", took, 5*time.Second)
+			}
+			attrs := fuseops.GetInodeAttributesOp{Inode: dirent.inode}
+			if err := fs.GetInodeAttributes(ctx, &attrs); err != fuse.EIO {
+				t.Errorf("GetInodeAttributes = %v, want EIO", err)
+			}
+		})
+	}
+
+	// Failures are not cached:
+	setTool("echo generated > \"${1#--targetdir=}/gschemas.compiled\"\n")
+	got, err := read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "generated\n"; got != want {
+		t.Errorf("gschemas.compiled = %q, want %q", got, want)
+	}
+}
@@ -35,10 +35,12 @@ func (mr *unionReader) Next() bool {
 		return false
 	}
 
-	if mr.err = mr.fs.mountImage(mr.image); mr.err != nil {
+	rd, err := mr.fs.mountImage(mr.image)
+	if err != nil {
+		mr.err = err
 		return false
 	}
-	mr.dir, mr.err = mr.fs.reader(mr.image).Readdir(squashfsInode)
+	mr.dir, mr.err = rd.Readdir(squashfsInode)
 	mr.idx++
 	return mr.err == nil
 }
@@ -0,0 +1,200 @@
+package fuse
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distr1/distri/internal/env"
+	"github.com/distr1/distri/internal/squashfs"
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// newTestFS returns a fuseFS like Mount, but without scanning repo.
+func newTestFS(repo string) *fuseFS {
+	return &fuseFS{
+		repo:         repo,
+		repoSection:  "pkg",
+		exchangeDirs: append([]string(nil), ExchangeDirs...),
+		declaredDirs: true,
+		fileReaders:  make(map[fuseops.InodeID]*io.SectionReader),
+		inodeCnt:     2,
+		dirs:         map[string]*dir{"/": {byName: make(map[string]*dirent)}},
+		inodes:       make(map[fuseops.InodeID]interface{}),
+		unions:       make(map[fuseops.InodeID][]fuseops.InodeID),
+		origins:      make(map[string]string),
+	}
+}
+
+// newTestRepo returns an HTTP server serving the debug section of a repository
+// which advertises pkgs. Package images are served from dir.
+func newTestRepo(t *testing.T, dir string, pkgs ...string) *httptest.Server {
+	t.Helper()
+	var mm pb.MirrorMeta
+	for _, pkg := range pkgs {
+		mm.Package = append(mm.Package, &pb.MirrorMeta_Package{
+			Name:          proto.String(pkg),
+			WellKnownPath: []string{"bin/" + strings.SplitN(pkg, "-", 2)[0]},
+		})
+	}
+	b, err := proto.Marshal(&mm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/debug/", http.StripPrefix("/debug/", http.FileServer(http.Dir(dir))))
+	mux.HandleFunc("/debug/meta.binaryproto", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(b)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// writeTestPackage writes the package pkg to dir, consisting of an image with
+// the specified files (e.g. bin/hello, or bin/ for an empty directory) and
+// meta (version 1 if nil). Files in bin/ are executable shell scripts, all
+// others are empty.
+func writeTestPackage(t *testing.T, dir, pkg string, meta *pb.Meta, files ...string) {
+	t.Helper()
+	f, err := os.Create(filepath.Join(dir, pkg+".squashfs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := squashfs.NewWriter(f, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var writeDir func(d *squashfs.Directory, prefix string)
+	writeDir = func(d *squashfs.Directory, prefix string) {
+		subdirs := make(map[string]bool)
+		for _, fn := range files {
+			if !strings.HasPrefix(fn, prefix) || fn == prefix {
+				continue
+			}
+			rel := strings.TrimPrefix(fn, prefix)
+			if idx := strings.IndexByte(rel, '/'); idx > -1 {
+				if !subdirs[rel[:idx]] {
+					subdirs[rel[:idx]] = true
+					writeDir(d.Directory(rel[:idx], time.Now(), 0555, 0, 0), prefix+rel[:idx]+"/")
+				}
+				continue
+			}
+			var (
+				mode    uint16 = 0644
+				content string
+			)
+			if prefix == "bin/" {
+				mode, content = 0755, "#!/bin/sh\n"
+			}
+			fw, err := d.File(rel, time.Now(), mode, 0, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := fw.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+			if err := fw.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := d.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeDir(w.Root, "")
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if meta == nil {
+		meta = &pb.Meta{Version: proto.String("1")}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, pkg+".meta.textproto"), []byte(proto.MarshalTextString(meta)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdatePackagesMultipleRepos(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "distri-repos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	for _, dir := range []string{"official", "internal", "roimg", "etc/repos.d"} {
+		if err := os.MkdirAll(filepath.Join(tmp, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestPackage(t, filepath.Join(tmp, "official"), "shared-amd64-1", nil, "bin/")
+	writeTestPackage(t, filepath.Join(tmp, "internal"), "shared-amd64-1", nil, "bin/")
+	writeTestPackage(t, filepath.Join(tmp, "internal"), "internal-amd64-1", nil, "bin/")
+
+	official := newTestRepo(t, filepath.Join(tmp, "official"), "hello-amd64-1", "shared-amd64-1")
+	internal := newTestRepo(t, filepath.Join(tmp, "internal"), "shared-amd64-1", "internal-amd64-1")
+	broken := httptest.NewServer(http.NotFoundHandler())
+	defer broken.Close()
+	for fn, repo := range map[string]string{
+		"0official.repo": official.URL,
+		"1broken.repo":   broken.URL,
+		"2internal.repo": internal.URL + "/",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(tmp, "etc/repos.d", fn), []byte(repo+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(old string) { env.DistriConfig = old }(env.DistriConfig)
+	env.DistriConfig = filepath.Join(tmp, "etc")
+
+	fs := newTestFS(filepath.Join(tmp, "roimg"))
+	fs.autoDownload = true
+	fs.repoSection = "debug"
+	if err := fs.updatePackages(); err != nil {
+		t.Fatal(err)
+	}
+
+	wantOrigins := map[string]string{
+		"hello-amd64-1":    official.URL + "/debug",
+		"shared-amd64-1":   official.URL + "/debug", // first repo takes precedence
+		"internal-amd64-1": internal.URL + "/debug",
+	}
+	if diff := cmp.Diff(wantOrigins, fs.origins); diff != "" {
+		t.Errorf("updatePackages: unexpected origins: diff (-want +got):\n%s", diff)
+	}
+	if got, want := len(fs.pkgs), 3; got != want {
+		t.Errorf("updatePackages: got %d packages (%q), want %d", got, fs.pkgs, want)
+	}
+	if got := fs.dirs["/bin"].byName["internal"]; got == nil || got.linkTarget != "../internal-amd64-1/bin/internal" {
+		t.Errorf("updatePackages: /bin/internal = %+v, want symlink to internal-amd64-1", got)
+	}
+
+	// Images are downloaded from the repository which advertised them:
+	for idx, pkg := range fs.pkgs {
+		if pkg == "hello-amd64-1" {
+			continue // not actually present in the official repository
+		}
+		if _, err := fs.mountImage(idx); err != nil {
+			t.Fatalf("mountImage(%s): %v", pkg, err)
+		}
+		if _, err := os.Stat(filepath.Join(fs.repo, pkg+".squashfs")); err != nil {
+			t.Errorf("%s was not downloaded: %v", pkg, err)
+		}
+	}
+
+	// Calling updatePackages again (e.g. upon SIGHUP) does not add duplicates:
+	if err := fs.updatePackages(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(fs.pkgs), 3; got != want {
+		t.Errorf("updatePackages: got %d packages (%q), want %d", got, fs.pkgs, want)
+	}
+}
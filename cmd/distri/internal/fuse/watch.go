@@ -0,0 +1,206 @@
+package fuse
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/distr1/distri"
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// watchDelay is how long the repo watcher waits for further changes before
+// scanning, so that e.g. a distri install of many packages results in a single
+// scan.
+const watchDelay = 100 * time.Millisecond
+
+// repoChange is a batch of inotify events on the repo directory.
+type repoChange struct {
+	pkgs     []string // packages whose .squashfs or .meta.textproto changed
+	overflow bool     // events were dropped, the entire repo must be scanned
+}
+
+// watchRepo watches fs.repo for package images being added (e.g. by distri
+// install, rsync or cp) or removed (e.g. by distri gc) and scans only the
+// changed packages. The returned stop function ends the watch.
+//
+// Partially written packages are never scanned: a package is only considered
+// present once both its .meta.textproto and its .squashfs file are complete,
+// i.e. were closed after writing or renamed into place. distri install renames
+// the .squashfs image last, and rsync writes to temporary files which do not
+// end in .squashfs.
+func (fs *fuseFS) watchRepo() (stop func() error, _ error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, xerrors.Errorf("inotify_init1: %v", err)
+	}
+	const mask = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_ONLYDIR
+	if _, err := unix.InotifyAddWatch(fd, fs.repo, mask); err != nil {
+		unix.Close(fd)
+		return nil, xerrors.Errorf("inotify_add_watch(%s): %v", fs.repo, err)
+	}
+	// The file descriptor is non-blocking, so reads go through the runtime
+	// poller and are interrupted when stop closes the file.
+	f := os.NewFile(uintptr(fd), "inotify")
+	changes := make(chan repoChange)
+	go func() {
+		defer close(changes)
+		if err := readRepoChanges(f, changes); err != nil && !xerrors.Is(err, os.ErrClosed) {
+			log.Printf("watching %s: %v", fs.repo, err)
+		}
+	}()
+	go fs.applyRepoChanges(changes)
+	return f.Close, nil
+}
+
+// readRepoChanges reads inotify events from f and sends them to changes until
+// reading fails or the watch is removed.
+func readRepoChanges(f *os.File, changes chan<- repoChange) error {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			return err
+		}
+		var change repoChange
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(ev.Len)]
+			off += unix.SizeofInotifyEvent + int(ev.Len)
+			if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+				change.overflow = true
+				continue
+			}
+			if ev.Mask&unix.IN_IGNORED != 0 {
+				return xerrors.Errorf("watch removed (repo deleted?)")
+			}
+			// name is padded with NUL bytes to an alignment boundary:
+			if pkg, ok := repoFilePkg(string(bytes.TrimRight(name, "\x00"))); ok {
+				change.pkgs = append(change.pkgs, pkg)
+			}
+		}
+		if len(change.pkgs) > 0 || change.overflow {
+			changes <- change
+		}
+	}
+}
+
+// repoFilePkg returns the package to which the repo file name belongs, e.g.
+// less-amd64-530 for less-amd64-530.meta.textproto.
+func repoFilePkg(name string) (string, bool) {
+	if strings.HasPrefix(name, ".") {
+		return "", false // e.g. rsync temporary file
+	}
+	for _, suffix := range []string{".squashfs", ".meta.textproto"} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), true
+		}
+	}
+	return "", false
+}
+
+// applyRepoChanges batches the changes it receives until none arrived for
+// watchDelay, then scans the changed packages.
+func (fs *fuseFS) applyRepoChanges(changes <-chan repoChange) {
+	var (
+		pending  = make(map[string]bool)
+		overflow bool
+		timer    = time.NewTimer(0)
+	)
+	<-timer.C
+	for {
+		select {
+		case change, ok := <-changes:
+			if !ok {
+				timer.Stop()
+				return
+			}
+			for _, pkg := range change.pkgs {
+				pending[pkg] = true
+			}
+			overflow = overflow || change.overflow
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(watchDelay)
+
+		case <-timer.C:
+			if err := fs.rescanPackages(pending, overflow); err != nil {
+				log.Printf("rescanning %s: %v", fs.repo, err)
+			}
+			pending = make(map[string]bool)
+			overflow = false
+		}
+	}
+}
+
+// rescanPackages updates the file system after the specified packages were
+// added to or removed from the repo. If all is true, the entire repo is scanned
+// instead.
+func (fs *fuseFS) rescanPackages(changed map[string]bool, all bool) error {
+	if all {
+		log.Printf("inotify queue overflow, scanning all packages")
+		pkgs, err := fs.findPackages()
+		if err != nil {
+			return err
+		}
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		return fs.scanPackages(&nopLocker{}, pkgs)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// Start with the already known packages, so that only changed packages are
+	// scanned and packages which are not in the repo (e.g. autodownload) are
+	// retained.
+	present := make(map[string]bool, len(fs.pkgs))
+	for _, pkg := range fs.pkgs {
+		if pkg == "" {
+			continue // tombstone
+		}
+		present[pkg] = true
+	}
+	var added, removed int
+	for pkg := range changed {
+		complete := true
+		for _, suffix := range []string{".meta.textproto", ".squashfs"} {
+			if _, err := os.Stat(filepath.Join(fs.repo, pkg+suffix)); err != nil {
+				complete = false
+				break
+			}
+		}
+		switch {
+		case complete && !present[pkg]:
+			added++
+		case !complete && present[pkg]:
+			removed++
+		}
+		if complete {
+			present[pkg] = true
+		} else {
+			delete(present, pkg)
+		}
+	}
+	if added == 0 && removed == 0 {
+		return nil
+	}
+	log.Printf("repo changed: %d packages added, %d removed", added, removed)
+	pkgs := make([]string, 0, len(present))
+	for pkg := range present {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return distri.PackageRevisionLess(pkgs[i], pkgs[j])
+	})
+	return fs.scanPackages(&nopLocker{}, pkgs)
+}
@@ -0,0 +1,66 @@
+package fuse
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+)
+
+func TestRescanReinstalled(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distri-rescan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	writeTestPackage(t, repo, "hello-amd64-1", nil, "bin/hello")
+
+	fs := newTestFS(repo)
+	if err := fs.scanPackages(&nopLocker{}, []string{"hello-amd64-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.mountImage(0); err != nil {
+		t.Fatal(err)
+	}
+	changed := map[string]bool{"hello-amd64-1": true}
+	exists := func() bool {
+		_, ok := fs.dirs["/bin"].byName["hello"]
+		return ok
+	}
+
+	// e.g. rm /roimg/hello-amd64-1.*
+	for _, suffix := range []string{".squashfs", ".meta.textproto"} {
+		if err := os.Remove(filepath.Join(repo, "hello-amd64-1"+suffix)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.rescanPackages(changed, false); err != nil {
+		t.Fatal(err)
+	}
+	if exists() {
+		t.Errorf("/bin/hello still exists after removing hello-amd64-1")
+	}
+	if got := fs.pkgs[0]; got != "" {
+		t.Errorf("removed package %q not tombstoned", got)
+	}
+	if fs.readers[0] != nil {
+		t.Errorf("reader of removed package not released")
+	}
+	if _, err := fs.mountImage(0); err != fuse.ENOENT {
+		t.Errorf("mountImage(removed package) = %v, want ENOENT", err)
+	}
+
+	// e.g. rsync, or distri install of the same version
+	writeTestPackage(t, repo, "hello-amd64-1", nil, "bin/hello")
+	if err := fs.rescanPackages(changed, false); err != nil {
+		t.Fatal(err)
+	}
+	if !exists() {
+		t.Errorf("/bin/hello missing after re-adding hello-amd64-1")
+	}
+	if _, err := fs.mountImage(len(fs.pkgs) - 1); err != nil {
+		t.Errorf("mountImage(re-added package): %v", err)
+	}
+}
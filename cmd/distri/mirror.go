@@ -1,14 +1,16 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/distr1/distri/cmd/distri/internal/fuse"
+	"github.com/distr1/distri/internal/env"
 	"github.com/distr1/distri/internal/squashfs"
 	"github.com/distr1/distri/pb"
 	"github.com/golang/protobuf/proto"
@@ -18,7 +20,12 @@ import (
 const mirrorHelp = `distri mirror [-flags]
 
 Make a package store fully usable as a repository
-by bundling metadata from packages into meta.binaryproto.
+by bundling metadata from packages into meta.binaryproto
+and writing chunk hashes (for distri fuse -lazy) for every package.
+
+Conflicts between packages which provide the same path
+in an exchange directory (e.g. /ro/bin/sh) are reported,
+resolved as distri fuse would using /etc/distri/pins.
 
 This is not required for distri install to work, but e.g. for debugfs.
 
@@ -29,38 +36,35 @@ Example:
 
 // TODO: have export automatically call mirror
 
-func walk(rd *squashfs.Reader, dirInode squashfs.Inode, dir string) ([]string, error) {
-	fis, err := rd.Readdir(dirInode)
-	if err != nil {
-		return nil, err
-	}
-	var files []string
-	for _, fi := range fis {
-		if fi.Mode().IsRegular() {
-			files = append(files, filepath.Join(dir, fi.Name()))
-		}
-		if fi.Mode().IsDir() {
-			tmp, err := walk(rd, fi.Sys().(*squashfs.FileInfo).Inode, filepath.Join(dir, fi.Name()))
-			if err != nil {
-				return nil, err
-			}
-			files = append(files, tmp...)
-		}
-	}
-	return files, nil
-}
-
 func mirror(args []string) error {
 	fset := flag.NewFlagSet("mirror", flag.ExitOnError)
 	fset.Usage = usage(fset, mirrorHelp)
 	fset.Parse(args)
 
+	policy, err := fuse.LoadConflictPolicy(env.DistriConfig)
+	if err != nil {
+		return err
+	}
+
 	var mm pb.MirrorMeta
 
 	fis, err := ioutil.ReadDir(".")
 	if err != nil {
 		return err
 	}
+	var metas []*pb.Meta
+	for _, fi := range fis {
+		if !strings.HasSuffix(fi.Name(), ".meta.textproto") {
+			continue
+		}
+		meta, err := pb.ReadMetaFile(fi.Name())
+		if err != nil {
+			return err
+		}
+		metas = append(metas, meta)
+	}
+	exchangeDirs := fuse.DeclaredExchangeDirs(fuse.ExchangeDirs, metas...)
+
 	for _, fi := range fis {
 		if !strings.HasSuffix(fi.Name(), ".squashfs") {
 			continue
@@ -78,26 +82,34 @@ func mirror(args []string) error {
 		if err != nil {
 			return err
 		}
-		for _, wk := range fuse.ExchangeDirs {
+		fsys := rd.FS()
+		for _, wk := range exchangeDirs {
 			wk = strings.TrimPrefix(wk, "/")
-			inode, err := fuse.LookupPath(rd, wk)
-			if err != nil {
-				if _, ok := err.(*fuse.FileNotFoundError); ok {
+			if _, err := fsys.Stat(wk); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
 					continue
 				}
 				return err
 			}
-
-			files, err := walk(rd, inode, wk)
+			err := fs.WalkDir(fsys, wk, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() {
+					mmp.WellKnownPath = append(mmp.WellKnownPath, path)
+				}
+				return nil
+			})
 			if err != nil {
 				return err
 			}
-			for _, fn := range files {
-				mmp.WellKnownPath = append(mmp.WellKnownPath, fn)
-			}
 		}
 
 		mm.Package = append(mm.Package, &mmp)
+
+		if err := writeChunkHashes(fi); err != nil {
+			return err
+		}
 	}
 
 	b, err := proto.Marshal(&mm)
@@ -110,5 +122,43 @@ func mirror(args []string) error {
 	}
 	log.Printf("wrote %d packages to meta.binaryproto (%d bytes)", len(mm.Package), len(b))
 
+	paths := make(map[string][]string, len(mm.Package))
+	for _, pkg := range mm.Package {
+		paths[pkg.GetName()] = pkg.GetWellKnownPath()
+	}
+	conflicts := policy.FindConflicts(paths)
+	for _, c := range conflicts {
+		log.Printf("conflict: %v", c)
+	}
+	if len(conflicts) > 0 {
+		log.Printf("%d exchange directory conflicts", len(conflicts))
+	}
+
 	return nil
 }
+
+// writeChunkHashes writes the chunk hashes of the package image fi, unless they
+// are up to date.
+func writeChunkHashes(fi os.FileInfo) error {
+	fn := fi.Name() + fuse.ChunkHashesSuffix
+	if st, err := os.Stat(fn); err == nil && !st.ModTime().Before(fi.ModTime()) {
+		return nil // up to date
+	}
+	f, err := os.Open(fi.Name())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	out, err := renameio.TempFile("", fn)
+	if err != nil {
+		return err
+	}
+	defer out.Cleanup()
+	if err := fuse.WriteChunkHashes(out, f); err != nil {
+		return err
+	}
+	if err := out.Chmod(0644); err != nil {
+		return err
+	}
+	return out.CloseAtomicallyReplace()
+}
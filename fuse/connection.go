@@ -24,6 +24,7 @@ import (
 	"runtime"
 	"sync"
 	"syscall"
+	"unsafe"
 
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/internal/buffer"
@@ -82,9 +83,10 @@ type Connection struct {
 // State that is maintained for each in-flight op. This is stuffed into the
 // context that the user uses to reply to the op.
 type opState struct {
-	inMsg  *buffer.InMessage
-	outMsg *buffer.OutMessage
-	op     interface{}
+	inMsg     *buffer.InMessage
+	outMsg    *buffer.OutMessage
+	largeRead *buffer.LargeRead // for ReadFileOp larger than outMsg, or nil
+	op        interface{}
 }
 
 // Create a connection wrapping the supplied file descriptor connected to the
@@ -158,6 +160,7 @@ func (c *Connection) Init() (err error) {
 	initOp.MaxReadahead = maxReadahead
 	initOp.MaxWrite = buffer.MaxWriteSize
 
+	kernelFlags := initOp.Flags
 	initOp.Flags = 0
 
 	// Tell the kernel not to use pitifully small 4 KiB writes.
@@ -168,6 +171,30 @@ func (c *Connection) Init() (err error) {
 		initOp.Flags |= fusekernel.InitWritebackCache
 	}
 
+	// The remaining features must be offered by the kernel.
+	if c.cfg.EnableReaddirplus && c.protocol.HasReaddirplus() {
+		initOp.Flags |= kernelFlags & fusekernel.InitDoReaddirplus
+		if c.cfg.EnableReaddirplusAuto {
+			initOp.Flags |= kernelFlags & fusekernel.InitReaddirplusAuto
+		}
+	}
+
+	if c.cfg.EnableParallelDirOps && c.protocol.HasParallelDirOps() {
+		initOp.Flags |= kernelFlags & fusekernel.InitParallelDirOps
+	}
+
+	if c.cfg.MaxPages > 0 && c.protocol.HasMaxPages() && kernelFlags&fusekernel.InitMaxPages != 0 {
+		// Read responses must fit into our buffers. Writes remain limited by
+		// MaxWrite.
+		maxPages := buffer.MaxLargeReadSize / syscall.Getpagesize()
+
+		initOp.Flags |= fusekernel.InitMaxPages
+		initOp.MaxPages = c.cfg.MaxPages
+		if int(initOp.MaxPages) > maxPages {
+			initOp.MaxPages = uint16(maxPages)
+		}
+	}
+
 	c.Reply(ctx, nil)
 	return
 }
@@ -383,7 +410,8 @@ func (c *Connection) ReadOp() (ctx context.Context, op interface{}, err error) {
 
 		// Convert the message to an op.
 		outMsg := c.getOutMessage()
-		op, err = convertInMessage(inMsg, outMsg, c.protocol)
+		var largeRead *buffer.LargeRead
+		op, largeRead, err = convertInMessage(inMsg, outMsg, c.protocol)
 		if err != nil {
 			c.putOutMessage(outMsg)
 			err = fmt.Errorf("convertInMessage: %v", err)
@@ -403,7 +431,7 @@ func (c *Connection) ReadOp() (ctx context.Context, op interface{}, err error) {
 
 		// Set up a context that remembers information about this op.
 		ctx = c.beginOp(inMsg.Header().Opcode, inMsg.Header().Unique)
-		ctx = context.WithValue(ctx, contextKey, opState{inMsg, outMsg, op})
+		ctx = context.WithValue(ctx, contextKey, opState{inMsg, outMsg, largeRead, op})
 
 		// Return the op to the user.
 		return
@@ -468,6 +496,9 @@ func (c *Connection) Reply(ctx context.Context, opErr error) {
 	// Make sure we destroy the messages when we're done.
 	defer c.putInMessage(inMsg)
 	defer c.putOutMessage(outMsg)
+	if state.largeRead != nil {
+		defer state.largeRead.Release()
+	}
 
 	// Clean up state for this op.
 	c.finishOp(inMsg.Header().Opcode, inMsg.Header().Unique)
@@ -490,13 +521,107 @@ func (c *Connection) Reply(ctx context.Context, opErr error) {
 	noResponse := c.kernelResponse(outMsg, inMsg.Header().Unique, op, opErr)
 
 	if !noResponse {
-		err := c.writeMessage(outMsg.Bytes())
+		msg := outMsg.Bytes()
+		if state.largeRead != nil && opErr == nil {
+			msg = state.largeRead.Bytes(outMsg, op.(*fuseops.ReadFileOp).BytesRead)
+		}
+		err := c.writeMessage(msg)
 		if err != nil && c.errorLogger != nil {
-			c.errorLogger.Printf("writeMessage: %v %v", err, outMsg.Bytes())
+			c.errorLogger.Printf("writeMessage: %v %v", err, msg)
 		}
 	}
 }
 
+// InvalidateEntry asks the kernel to drop the entry for name within the
+// directory parent from its dentry cache (FUSE_NOTIFY_INVAL_ENTRY), e.g. after
+// the file system removed or replaced the entry. The next access to the entry
+// results in a LookUpInodeOp. It is not an error if the entry is not cached.
+//
+// The kernel locks parent while processing the notification, so
+// InvalidateEntry must not be called while an op is waiting on the caller
+// (e.g. from within an op handler), lest it deadlock.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) InvalidateEntry(
+	parent fuseops.InodeID,
+	name string) (err error) {
+	if !c.protocol.HasInvalidate() {
+		err = syscall.ENOSYS
+		return
+	}
+
+	outMsg := c.getOutMessage()
+	defer c.putOutMessage(outMsg)
+
+	size := int(unsafe.Sizeof(fusekernel.NotifyInvalEntryOut{}))
+	out := (*fusekernel.NotifyInvalEntryOut)(outMsg.Grow(size))
+	out.Parent = uint64(parent)
+	out.Namelen = uint32(len(name))
+	outMsg.AppendString(name)
+	outMsg.AppendString("\x00")
+
+	if c.debugLogger != nil {
+		c.debugLog(0, 1, "-> NotifyInvalEntry (parent %v, name %q)", parent, name)
+	}
+
+	err = c.writeNotify(outMsg, fusekernel.NotifyCodeInvalEntry)
+	return
+}
+
+// InvalidateInode asks the kernel to drop the cached attributes of inode
+// (FUSE_NOTIFY_INVAL_INODE), as well as the cached data in the range starting
+// at off of the specified length. A length of zero (or less) means until the
+// end of the file, a negative off means to only drop the attributes. It is not
+// an error if the inode is not cached.
+//
+// See InvalidateEntry for restrictions on when to call InvalidateInode.
+//
+// LOCKS_EXCLUDED(c.mu)
+func (c *Connection) InvalidateInode(
+	inode fuseops.InodeID,
+	off int64,
+	length int64) (err error) {
+	if !c.protocol.HasInvalidate() {
+		err = syscall.ENOSYS
+		return
+	}
+
+	outMsg := c.getOutMessage()
+	defer c.putOutMessage(outMsg)
+
+	size := int(unsafe.Sizeof(fusekernel.NotifyInvalInodeOut{}))
+	out := (*fusekernel.NotifyInvalInodeOut)(outMsg.Grow(size))
+	out.Ino = uint64(inode)
+	out.Off = off
+	out.Len = length
+
+	if c.debugLogger != nil {
+		c.debugLog(0, 1, "-> NotifyInvalInode (inode %v, off %d, len %d)", inode, off, length)
+	}
+
+	err = c.writeNotify(outMsg, fusekernel.NotifyCodeInvalInode)
+	return
+}
+
+// Write the supplied notification message, whose payload must already be
+// filled in, to the kernel. Notifications are distinguished from replies by a
+// zero unique ID and carry the notification code in the error field.
+func (c *Connection) writeNotify(m *buffer.OutMessage, code int32) (err error) {
+	h := m.OutHeader()
+	h.Unique = 0
+	h.Error = code
+	h.Len = uint32(m.Len())
+
+	err = c.writeMessage(m.Bytes())
+	if err == syscall.ENOENT {
+		// The kernel does not have the inode in its cache: nothing to
+		// invalidate.
+		err = nil
+	}
+
+	return
+}
+
 // Close the connection. Must not be called until operations that were read
 // from the connection have been responded to.
 func (c *Connection) close() (err error) {
@@ -36,11 +36,12 @@ import (
 // Convert a kernel message to an appropriate op. If the op is unknown, a
 // special unexported type will be used.
 //
-// The caller is responsible for arranging for the message to be destroyed.
+// The caller is responsible for arranging for the message to be destroyed, and
+// for releasing largeRead (if any) once the reply was sent.
 func convertInMessage(
 	inMsg *buffer.InMessage,
 	outMsg *buffer.OutMessage,
-	protocol fusekernel.Protocol) (o interface{}, err error) {
+	protocol fusekernel.Protocol) (o interface{}, largeRead *buffer.LargeRead, err error) {
 	switch inMsg.Header().Opcode {
 	case fusekernel.OpLookup:
 		buf := inMsg.ConsumeBytes(inMsg.Len())
@@ -106,6 +107,32 @@ func convertInMessage(
 			N:     in.Nlookup,
 		}
 
+	case fusekernel.OpBatchForget:
+		type input fusekernel.BatchForgetIn
+		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
+		if in == nil {
+			err = errors.New("Corrupt OpBatchForget")
+			return
+		}
+
+		to := &fuseops.BatchForgetOp{
+			Entries: make([]fuseops.BatchForgetEntry, 0, in.Count),
+		}
+		for i := uint32(0); i < in.Count; i++ {
+			type entry fusekernel.ForgetOne
+			e := (*entry)(inMsg.Consume(unsafe.Sizeof(entry{})))
+			if e == nil {
+				err = errors.New("Corrupt OpBatchForget")
+				return
+			}
+
+			to.Entries = append(to.Entries, fuseops.BatchForgetEntry{
+				Inode: fuseops.InodeID(e.Nodeid),
+				N:     e.Nlookup,
+			})
+		}
+		o = to
+
 	case fusekernel.OpMkdir:
 		in := (*fusekernel.MkdirIn)(inMsg.Consume(fusekernel.MkdirInSize(protocol)))
 		if in == nil {
@@ -279,6 +306,12 @@ func convertInMessage(
 		o = to
 
 		readSize := int(in.Size)
+		if readSize > buffer.MaxReadSize && readSize <= buffer.MaxLargeReadSize {
+			// See MountConfig.MaxPages.
+			largeRead = buffer.NewLargeRead()
+			to.Dst = largeRead.Dst(readSize)
+			return
+		}
 		p := outMsg.GrowNoZero(readSize)
 		if p == nil {
 			err = fmt.Errorf("Can't grow for %d-byte read", readSize)
@@ -316,6 +349,32 @@ func convertInMessage(
 		sh.Len = readSize
 		sh.Cap = readSize
 
+	case fusekernel.OpReaddirplus:
+		in := (*fusekernel.ReadIn)(inMsg.Consume(fusekernel.ReadInSize(protocol)))
+		if in == nil {
+			err = errors.New("Corrupt OpReaddirplus")
+			return
+		}
+
+		to := &fuseops.ReadDirPlusOp{
+			Inode:  fuseops.InodeID(inMsg.Header().Nodeid),
+			Handle: fuseops.HandleID(in.Fh),
+			Offset: fuseops.DirOffset(in.Offset),
+		}
+		o = to
+
+		readSize := int(in.Size)
+		p := outMsg.GrowNoZero(readSize)
+		if p == nil {
+			err = fmt.Errorf("Can't grow for %d-byte read", readSize)
+			return
+		}
+
+		sh := (*reflect.SliceHeader)(unsafe.Pointer(&to.Dst))
+		sh.Data = uintptr(p)
+		sh.Len = readSize
+		sh.Cap = readSize
+
 	case fusekernel.OpRelease:
 		type input fusekernel.ReleaseIn
 		in := (*input)(inMsg.Consume(unsafe.Sizeof(input{})))
@@ -578,6 +637,10 @@ func (c *Connection) kernelResponse(
 		noResponse = true
 		return
 
+	case *fuseops.BatchForgetOp:
+		noResponse = true
+		return
+
 	case *interruptOp:
 		noResponse = true
 		return
@@ -633,37 +696,37 @@ func (c *Connection) kernelResponseForOp(
 	case *fuseops.LookUpInodeOp:
 		size := int(fusekernel.EntryOutSize(c.protocol))
 		out := (*fusekernel.EntryOut)(m.Grow(size))
-		convertChildInodeEntry(&o.Entry, out)
+		fuseops.ConvertChildInodeEntry(&o.Entry, out)
 
 	case *fuseops.GetInodeAttributesOp:
 		size := int(fusekernel.AttrOutSize(c.protocol))
 		out := (*fusekernel.AttrOut)(m.Grow(size))
-		out.AttrValid, out.AttrValidNsec = convertExpirationTime(
+		out.AttrValid, out.AttrValidNsec = fuseops.ConvertExpirationTime(
 			o.AttributesExpiration)
-		convertAttributes(o.Inode, &o.Attributes, &out.Attr)
+		fuseops.ConvertAttributes(o.Inode, &o.Attributes, &out.Attr)
 
 	case *fuseops.SetInodeAttributesOp:
 		size := int(fusekernel.AttrOutSize(c.protocol))
 		out := (*fusekernel.AttrOut)(m.Grow(size))
-		out.AttrValid, out.AttrValidNsec = convertExpirationTime(
+		out.AttrValid, out.AttrValidNsec = fuseops.ConvertExpirationTime(
 			o.AttributesExpiration)
-		convertAttributes(o.Inode, &o.Attributes, &out.Attr)
+		fuseops.ConvertAttributes(o.Inode, &o.Attributes, &out.Attr)
 
 	case *fuseops.MkDirOp:
 		size := int(fusekernel.EntryOutSize(c.protocol))
 		out := (*fusekernel.EntryOut)(m.Grow(size))
-		convertChildInodeEntry(&o.Entry, out)
+		fuseops.ConvertChildInodeEntry(&o.Entry, out)
 
 	case *fuseops.MkNodeOp:
 		size := int(fusekernel.EntryOutSize(c.protocol))
 		out := (*fusekernel.EntryOut)(m.Grow(size))
-		convertChildInodeEntry(&o.Entry, out)
+		fuseops.ConvertChildInodeEntry(&o.Entry, out)
 
 	case *fuseops.CreateFileOp:
 		eSize := int(fusekernel.EntryOutSize(c.protocol))
 
 		e := (*fusekernel.EntryOut)(m.Grow(eSize))
-		convertChildInodeEntry(&o.Entry, e)
+		fuseops.ConvertChildInodeEntry(&o.Entry, e)
 
 		oo := (*fusekernel.OpenOut)(m.Grow(int(unsafe.Sizeof(fusekernel.OpenOut{}))))
 		oo.Fh = uint64(o.Handle)
@@ -671,12 +734,12 @@ func (c *Connection) kernelResponseForOp(
 	case *fuseops.CreateSymlinkOp:
 		size := int(fusekernel.EntryOutSize(c.protocol))
 		out := (*fusekernel.EntryOut)(m.Grow(size))
-		convertChildInodeEntry(&o.Entry, out)
+		fuseops.ConvertChildInodeEntry(&o.Entry, out)
 
 	case *fuseops.CreateLinkOp:
 		size := int(fusekernel.EntryOutSize(c.protocol))
 		out := (*fusekernel.EntryOut)(m.Grow(size))
-		convertChildInodeEntry(&o.Entry, out)
+		fuseops.ConvertChildInodeEntry(&o.Entry, out)
 
 	case *fuseops.RenameOp:
 		// Empty response
@@ -697,6 +760,10 @@ func (c *Connection) kernelResponseForOp(
 		// much the user read.
 		m.ShrinkTo(buffer.OutMessageHeaderSize + o.BytesRead)
 
+	case *fuseops.ReadDirPlusOp:
+		// Like ReadDirOp.
+		m.ShrinkTo(buffer.OutMessageHeaderSize + o.BytesRead)
+
 	case *fuseops.ReleaseDirHandleOp:
 		// Empty response
 
@@ -714,9 +781,11 @@ func (c *Connection) kernelResponseForOp(
 
 	case *fuseops.ReadFileOp:
 		// convertInMessage already set up the destination buffer to be at the end
-		// of the out message. We need only shrink to the right size based on how
-		// much the user read.
-		m.ShrinkTo(buffer.OutMessageHeaderSize + o.BytesRead)
+		// of the out message (unless it was too large, see buffer.LargeRead). We
+		// need only shrink to the right size based on how much the user read.
+		if m.Len() > buffer.OutMessageHeaderSize {
+			m.ShrinkTo(buffer.OutMessageHeaderSize + o.BytesRead)
+		}
 
 	case *fuseops.WriteFileOp:
 		out := (*fusekernel.WriteOut)(m.Grow(int(unsafe.Sizeof(fusekernel.WriteOut{}))))
@@ -794,13 +863,16 @@ func (c *Connection) kernelResponseForOp(
 		// Empty response
 
 	case *initOp:
-		out := (*fusekernel.InitOut)(m.Grow(int(unsafe.Sizeof(fusekernel.InitOut{}))))
+		out := (*fusekernel.InitOut)(m.Grow(int(fusekernel.InitOutSize(c.protocol))))
 
 		out.Major = o.Library.Major
 		out.Minor = o.Library.Minor
 		out.MaxReadahead = o.MaxReadahead
 		out.Flags = uint32(o.Flags)
 		out.MaxWrite = o.MaxWrite
+		if o.Flags&fusekernel.InitMaxPages != 0 {
+			out.MaxPages = o.MaxPages
+		}
 
 	default:
 		panic(fmt.Sprintf("Unexpected op: %#v", op))
@@ -813,81 +885,6 @@ func (c *Connection) kernelResponseForOp(
 // General conversions
 ////////////////////////////////////////////////////////////////////////
 
-func convertTime(t time.Time) (secs uint64, nsec uint32) {
-	totalNano := t.UnixNano()
-	secs = uint64(totalNano / 1e9)
-	nsec = uint32(totalNano % 1e9)
-	return
-}
-
-func convertAttributes(
-	inodeID fuseops.InodeID,
-	in *fuseops.InodeAttributes,
-	out *fusekernel.Attr) {
-	out.Ino = uint64(inodeID)
-	out.Size = in.Size
-	out.Atime, out.AtimeNsec = convertTime(in.Atime)
-	out.Mtime, out.MtimeNsec = convertTime(in.Mtime)
-	out.Ctime, out.CtimeNsec = convertTime(in.Ctime)
-	out.SetCrtime(convertTime(in.Crtime))
-	out.Nlink = in.Nlink
-	out.Uid = in.Uid
-	out.Gid = in.Gid
-	// round up to the nearest 512 boundary
-	out.Blocks = (in.Size + 512 - 1) / 512
-
-	// Set the mode.
-	out.Mode = uint32(in.Mode) & 0777
-	switch {
-	default:
-		out.Mode |= syscall.S_IFREG
-	case in.Mode&os.ModeDir != 0:
-		out.Mode |= syscall.S_IFDIR
-	case in.Mode&os.ModeDevice != 0:
-		if in.Mode&os.ModeCharDevice != 0 {
-			out.Mode |= syscall.S_IFCHR
-		} else {
-			out.Mode |= syscall.S_IFBLK
-		}
-	case in.Mode&os.ModeNamedPipe != 0:
-		out.Mode |= syscall.S_IFIFO
-	case in.Mode&os.ModeSymlink != 0:
-		out.Mode |= syscall.S_IFLNK
-	case in.Mode&os.ModeSocket != 0:
-		out.Mode |= syscall.S_IFSOCK
-	}
-	if in.Mode&os.ModeSetuid != 0 {
-		out.Mode |= syscall.S_ISUID
-	}
-}
-
-// Convert an absolute cache expiration time to a relative time from now for
-// consumption by the fuse kernel module.
-func convertExpirationTime(t time.Time) (secs uint64, nsecs uint32) {
-	// Fuse represents durations as unsigned 64-bit counts of seconds and 32-bit
-	// counts of nanoseconds (cf. http://goo.gl/EJupJV). So negative durations
-	// are right out. There is no need to cap the positive magnitude, because
-	// 2^64 seconds is well longer than the 2^63 ns range of time.Duration.
-	d := t.Sub(time.Now())
-	if d > 0 {
-		secs = uint64(d / time.Second)
-		nsecs = uint32((d % time.Second) / time.Nanosecond)
-	}
-
-	return
-}
-
-func convertChildInodeEntry(
-	in *fuseops.ChildInodeEntry,
-	out *fusekernel.EntryOut) {
-	out.Nodeid = uint64(in.Child)
-	out.Generation = uint64(in.Generation)
-	out.EntryValid, out.EntryValidNsec = convertExpirationTime(in.EntryExpiration)
-	out.AttrValid, out.AttrValidNsec = convertExpirationTime(in.AttributesExpiration)
-
-	convertAttributes(in.Child, &in.Attributes, &out.Attr)
-}
-
 func convertFileMode(unixMode uint32) os.FileMode {
 	mode := os.FileMode(unixMode & 0777)
 	switch unixMode & syscall.S_IFMT {
@@ -205,6 +205,23 @@ type ForgetInodeOp struct {
 	N uint64
 }
 
+// Decrement the reference counts of multiple inodes at once, as the kernel
+// does when evicting many inodes (FUSE_BATCH_FORGET). Each entry is equivalent
+// to a ForgetInodeOp. fuseutil.NewFileSystemServer translates this op into
+// calls to ForgetInode.
+type BatchForgetOp struct {
+	Entries []BatchForgetEntry
+}
+
+// BatchForgetEntry is an entry of BatchForgetOp.
+type BatchForgetEntry struct {
+	// The inode whose reference count should be decremented.
+	Inode InodeID
+
+	// The amount to decrement the reference count.
+	N uint64
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Inode creation
 ////////////////////////////////////////////////////////////////////////
@@ -531,6 +548,37 @@ type ReadDirOp struct {
 	BytesRead int
 }
 
+// Read entries from a directory previously opened with OpenDir, along with
+// the attributes of each entry (FUSE_READDIRPLUS). The kernel only sends this
+// op instead of ReadDirOp when fuse.MountConfig.EnableReaddirplus is set.
+//
+// The kernel treats each returned entry (except "." and "..") like the
+// response to a LookUpInodeOp: it caches the entry and the attributes
+// according to their expiration times, and increments the lookup count of the
+// child inode (see notes on ForgetInodeOp).
+type ReadDirPlusOp struct {
+	// The directory inode that we are reading, and the handle previously
+	// returned by OpenDir when opening that inode.
+	Inode  InodeID
+	Handle HandleID
+
+	// The offset within the directory at which to read. See notes on
+	// ReadDirOp.Offset.
+	Offset DirOffset
+
+	// The destination buffer, whose length gives the size of the read.
+	//
+	// The output data should consist of a sequence of FUSE directory entries
+	// with attributes in the format generated by fuse_add_direntry_plus, which
+	// is consumed by parse_dirplusfile. Use fuseutil.WriteDirentPlus to generate
+	// this data.
+	Dst []byte
+
+	// Set by the file system: the number of bytes read into Dst. See notes on
+	// ReadDirOp.BytesRead.
+	BytesRead int
+}
+
 // Release a previously-minted directory handle. The kernel sends this when
 // there are no more references to an open directory: all file descriptors are
 // closed and all memory mappings are unmapped.
@@ -19,6 +19,7 @@ import (
 	"unsafe"
 
 	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/internal/fusekernel"
 )
 
 type DirentType uint32
@@ -103,3 +104,33 @@ func WriteDirent(buf []byte, d Dirent) (n int) {
 
 	return
 }
+
+// Write the supplied directory entry and the attributes of its child into the
+// given buffer in the format expected in fuseops.ReadDirPlusOp.Dst, returning
+// the number of bytes written. Return zero if the entry would not fit.
+//
+// The kernel treats e like the response to a LookUpInodeOp for d.Name, see
+// notes on fuseops.ReadDirPlusOp. e.Child must equal d.Inode, or be zero to
+// return d without attributes, which the kernel then looks up separately.
+func WriteDirentPlus(buf []byte, e fuseops.ChildInodeEntry, d Dirent) (n int) {
+	// We want to write bytes with the layout of fuse_direntplus, i.e. a
+	// fuse_entry_out followed by a fuse_dirent. fuse_entry_out is a multiple of
+	// 8 bytes, so the alignment notes in WriteDirent still apply.
+	const entryOutSize = int(unsafe.Sizeof(fusekernel.EntryOut{}))
+
+	if entryOutSize > len(buf) {
+		return
+	}
+
+	direntLen := WriteDirent(buf[entryOutSize:], d)
+	if direntLen == 0 {
+		return
+	}
+
+	var out fusekernel.EntryOut
+	fuseops.ConvertChildInodeEntry(&e, &out)
+	n += copy(buf, (*[entryOutSize]byte)(unsafe.Pointer(&out))[:])
+	n += direntLen
+
+	return
+}
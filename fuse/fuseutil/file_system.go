@@ -49,6 +49,7 @@ type FileSystem interface {
 	Unlink(context.Context, *fuseops.UnlinkOp) error
 	OpenDir(context.Context, *fuseops.OpenDirOp) error
 	ReadDir(context.Context, *fuseops.ReadDirOp) error
+	ReadDirPlus(context.Context, *fuseops.ReadDirPlusOp) error
 	ReleaseDirHandle(context.Context, *fuseops.ReleaseDirHandleOp) error
 	OpenFile(context.Context, *fuseops.OpenFileOp) error
 	ReadFile(context.Context, *fuseops.ReadFileOp) error
@@ -111,13 +112,14 @@ func (s *fileSystemServer) ServeOps(c *fuse.Connection) {
 		}
 
 		s.opsInFlight.Add(1)
-		if _, ok := op.(*fuseops.ForgetInodeOp); ok {
+		switch op.(type) {
+		case *fuseops.ForgetInodeOp, *fuseops.BatchForgetOp:
 			// Special case: call in this goroutine for
 			// forget inode ops, which may come in a
 			// flurry from the kernel and are generally
 			// cheap for the file system to handle
 			s.handleOp(c, ctx, op)
-		} else {
+		default:
 			go s.handleOp(c, ctx, op)
 		}
 	}
@@ -150,6 +152,17 @@ func (s *fileSystemServer) handleOp(
 	case *fuseops.ForgetInodeOp:
 		err = s.fs.ForgetInode(ctx, typed)
 
+	case *fuseops.BatchForgetOp:
+		for _, e := range typed.Entries {
+			forget := &fuseops.ForgetInodeOp{
+				Inode: e.Inode,
+				N:     e.N,
+			}
+			if ferr := s.fs.ForgetInode(ctx, forget); ferr != nil {
+				err = ferr
+			}
+		}
+
 	case *fuseops.MkDirOp:
 		err = s.fs.MkDir(ctx, typed)
 
@@ -180,6 +193,9 @@ func (s *fileSystemServer) handleOp(
 	case *fuseops.ReadDirOp:
 		err = s.fs.ReadDir(ctx, typed)
 
+	case *fuseops.ReadDirPlusOp:
+		err = s.fs.ReadDirPlus(ctx, typed)
+
 	case *fuseops.ReleaseDirHandleOp:
 		err = s.fs.ReleaseDirHandle(ctx, typed)
 
@@ -135,6 +135,13 @@ func (fs *NotImplementedFileSystem) ReadDir(
 	return
 }
 
+func (fs *NotImplementedFileSystem) ReadDirPlus(
+	ctx context.Context,
+	op *fuseops.ReadDirPlusOp) (err error) {
+	err = fuse.ENOSYS
+	return
+}
+
 func (fs *NotImplementedFileSystem) ReleaseDirHandle(
 	ctx context.Context,
 	op *fuseops.ReleaseDirHandleOp) (err error) {
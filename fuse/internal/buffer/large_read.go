@@ -0,0 +1,63 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// LargeRead holds the reply to a read which is larger than MaxReadSize and
+// hence does not fit into an OutMessage: the header of the OutMessage,
+// followed by the data. This way, only replies to large reads pay for a
+// buffer of MaxLargeReadSize.
+//
+// Must be created with NewLargeRead.
+type LargeRead struct {
+	buf [OutMessageHeaderSize + MaxLargeReadSize]byte
+}
+
+var largeReads = sync.Pool{
+	New: func() interface{} { return new(LargeRead) },
+}
+
+// NewLargeRead returns an unused LargeRead. Call Release once the reply was
+// sent.
+func NewLargeRead() *LargeRead {
+	return largeReads.Get().(*LargeRead)
+}
+
+// Release makes r available to future calls of NewLargeRead.
+func (r *LargeRead) Release() {
+	largeReads.Put(r)
+}
+
+// Dst returns the destination buffer for a read of n bytes, which must not
+// exceed MaxLargeReadSize.
+func (r *LargeRead) Dst(n int) []byte {
+	return r.buf[OutMessageHeaderSize : OutMessageHeaderSize+n]
+}
+
+// Bytes returns the reply consisting of the header of m, whose payload must be
+// empty, and the first n bytes of Dst.
+func (r *LargeRead) Bytes(m *OutMessage, n int) []byte {
+	if m.Len() != OutMessageHeaderSize {
+		panic("LargeRead.Bytes called with a non-empty OutMessage")
+	}
+	h := m.OutHeader()
+	h.Len = uint32(OutMessageHeaderSize + n)
+	copy(r.buf[:OutMessageHeaderSize], (*[OutMessageHeaderSize]byte)(unsafe.Pointer(h))[:])
+	return r.buf[:OutMessageHeaderSize+n]
+}
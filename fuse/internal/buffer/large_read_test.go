@@ -0,0 +1,54 @@
+package buffer
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+
+	"github.com/jacobsa/fuse/internal/fusekernel"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestLargeRead(t *testing.T) {
+	var om OutMessage
+	om.Reset()
+	*om.OutHeader() = fusekernel.OutHeader{
+		Unique: 0xcafebabeba5eba11,
+	}
+
+	r := NewLargeRead()
+	defer r.Release()
+
+	// Fill the whole destination buffer, of which only a part is read.
+	dst := r.Dst(MaxLargeReadSize)
+	if err := fillWithGarbage(unsafe.Pointer(&dst[0]), len(dst)); err != nil {
+		t.Fatalf("fillWithGarbage: %v", err)
+	}
+	const n = MaxReadSize + 1
+
+	b := r.Bytes(&om, n)
+	if got, want := len(b), OutMessageHeaderSize+n; got != want {
+		t.Fatalf("len(r.Bytes()) = %d, want %d", got, want)
+	}
+
+	got := *(*fusekernel.OutHeader)(unsafe.Pointer(&b[0]))
+	want := fusekernel.OutHeader{
+		Len:    uint32(OutMessageHeaderSize + n),
+		Unique: 0xcafebabeba5eba11,
+	}
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("diff -got +want:\n%s", diff)
+	}
+
+	if !bytes.Equal(b[OutMessageHeaderSize:], dst[:n]) {
+		t.Error("data differs")
+	}
+}
+
+func TestOutMessageSize(t *testing.T) {
+	// Every in-flight op holds an OutMessage, so only LargeRead should be sized
+	// for MaxLargeReadSize.
+	if got, want := unsafe.Sizeof(OutMessage{}), uintptr(MaxReadSize+4096); got > want {
+		t.Errorf("sizeof(OutMessage) = %d, want at most %d", got, want)
+	}
+}
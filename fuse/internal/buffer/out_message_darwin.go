@@ -19,3 +19,7 @@ package buffer
 //
 // Experimentally determined on OS X.
 const MaxReadSize = 1 << 20
+
+// The maximum read size when MountConfig.MaxPages is set, which is not
+// supported on OS X.
+const MaxLargeReadSize = MaxReadSize
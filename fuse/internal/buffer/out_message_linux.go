@@ -19,3 +19,8 @@ package buffer
 //
 // For 4 KiB pages, this is 128 KiB (cf. https://goo.gl/HOiEYo)
 const MaxReadSize = 1 << 17
+
+// The maximum read size when MountConfig.MaxPages is set to the kernel's
+// maximum of 256 pages (FUSE_MAX_MAX_PAGES). Larger reads than MaxReadSize are
+// answered from a LargeRead.
+const MaxLargeReadSize = 1 << 20
@@ -46,7 +46,7 @@ const (
 	ProtoVersionMinMajor = 7
 	ProtoVersionMinMinor = 8
 	ProtoVersionMaxMajor = 7
-	ProtoVersionMaxMinor = 12
+	ProtoVersionMaxMinor = 28
 )
 
 const (
@@ -266,6 +266,8 @@ const (
 	InitAsyncDIO        InitFlags = 1 << 15
 	InitWritebackCache  InitFlags = 1 << 16
 	InitNoOpenSupport   InitFlags = 1 << 17
+	InitParallelDirOps  InitFlags = 1 << 18
+	InitMaxPages        InitFlags = 1 << 22
 
 	InitCaseSensitive InitFlags = 1 << 29 // OS X only
 	InitVolRename     InitFlags = 1 << 30 // OS X only
@@ -296,6 +298,8 @@ var initFlagNames = []flagName{
 	{uint32(InitAsyncDIO), "InitAsyncDIO"},
 	{uint32(InitWritebackCache), "InitWritebackCache"},
 	{uint32(InitNoOpenSupport), "InitNoOpenSupport"},
+	{uint32(InitParallelDirOps), "InitParallelDirOps"},
+	{uint32(InitMaxPages), "InitMaxPages"},
 
 	{uint32(InitCaseSensitive), "InitCaseSensitive"},
 	{uint32(InitVolRename), "InitVolRename"},
@@ -380,6 +384,8 @@ const (
 	OpDestroy     = 38
 	OpIoctl       = 39 // Linux?
 	OpPoll        = 40 // Linux?
+	OpBatchForget = 42 // no reply
+	OpReaddirplus = 44
 
 	// OS X
 	OpSetvolname = 61
@@ -410,6 +416,16 @@ type ForgetIn struct {
 	Nlookup uint64
 }
 
+type BatchForgetIn struct {
+	Count uint32
+	dummy uint32
+}
+
+type ForgetOne struct {
+	Nodeid  uint64
+	Nlookup uint64
+}
+
 type GetattrIn struct {
 	GetattrFlags uint32
 	dummy        uint32
@@ -701,12 +717,26 @@ type InitIn struct {
 const InitInSize = int(unsafe.Sizeof(InitIn{}))
 
 type InitOut struct {
-	Major        uint32
-	Minor        uint32
-	MaxReadahead uint32
-	Flags        uint32
-	Unused       uint32
-	MaxWrite     uint32
+	Major               uint32
+	Minor               uint32
+	MaxReadahead        uint32
+	Flags               uint32
+	MaxBackground       uint16
+	CongestionThreshold uint16
+	MaxWrite            uint32
+	TimeGran            uint32
+	MaxPages            uint16
+	padding             uint16
+	unused              [8]uint32
+}
+
+func InitOutSize(p Protocol) uintptr {
+	switch {
+	case p.LT(Protocol{7, 23}):
+		return unsafe.Offsetof(InitOut{}.TimeGran)
+	default:
+		return unsafe.Sizeof(InitOut{})
+	}
 }
 
 type InterruptIn struct {
@@ -73,3 +73,20 @@ func (a Protocol) HasUmask() bool {
 func (a Protocol) HasInvalidate() bool {
 	return a.is712()
 }
+
+// HasReaddirplus returns whether ReadDirPlus (and the InitDoReaddirplus and
+// InitReaddirplusAuto flags) are supported.
+func (a Protocol) HasReaddirplus() bool {
+	return a.GE(Protocol{7, 21})
+}
+
+// HasParallelDirOps returns whether the InitParallelDirOps flag is supported.
+func (a Protocol) HasParallelDirOps() bool {
+	return a.GE(Protocol{7, 25})
+}
+
+// HasMaxPages returns whether the InitMaxPages flag and InitOut field MaxPages
+// are supported.
+func (a Protocol) HasMaxPages() bool {
+	return a.GE(Protocol{7, 28})
+}
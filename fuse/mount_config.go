@@ -113,6 +113,29 @@ type MountConfig struct {
 	// syscall doesn't return until the file system returns.
 	DisableWritebackCaching bool
 
+	// Answer the kernel's requests to read directories with ReadDirPlusOp
+	// instead of ReadDirOp, which returns the attributes of each entry along
+	// with its name (FUSE_DO_READDIRPLUS). This saves a LookUpInodeOp per entry
+	// when the user looks at the attributes, e.g. for `ls -l`. The file system
+	// must implement ReadDirPlusOp.
+	EnableReaddirplus bool
+
+	// Let the kernel decide whether to use ReadDirPlusOp or ReadDirOp based on
+	// whether the user looked up entries after previous reads of the same
+	// directory (FUSE_READDIRPLUS_AUTO). Only effective with EnableReaddirplus.
+	EnableReaddirplusAuto bool
+
+	// Allow the kernel to send concurrent lookups and directory reads for the
+	// same directory (FUSE_PARALLEL_DIROPS). Without this flag, the kernel
+	// serializes them.
+	EnableParallelDirOps bool
+
+	// The maximum number of pages the kernel should use for a single request
+	// (FUSE_MAX_PAGES), e.g. to read files in chunks larger than the default of
+	// 32 pages (128 KiB). Zero means the kernel default. Values are capped to
+	// what fits into the buffers of this package.
+	MaxPages uint16
+
 	// OS X only.
 	//
 	// Normally on OS X we mount with the novncache option
@@ -43,4 +43,5 @@ type initOp struct {
 	Library      fusekernel.Protocol
 	MaxReadahead uint32
 	MaxWrite     uint32
+	MaxPages     uint16
 }
@@ -25,4 +25,4 @@ require (
 
 replace github.com/jacobsa/fuse => ./fuse
 
-go 1.13
+go 1.16
@@ -0,0 +1,66 @@
+package squashfs
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	// metadataCacheBlocks is the number of decoded metadata blocks (of up to
+	// metadataBlockSize bytes each) a Reader keeps in memory.
+	metadataCacheBlocks = 256
+
+	// inodeCacheSize is the number of decoded inode headers a Reader keeps in
+	// memory.
+	inodeCacheSize = 4096
+)
+
+// lru is a bounded cache which evicts the least recently used entry once it is
+// full. It is safe for concurrent use by multiple goroutines.
+type lru struct {
+	mu    sync.Mutex
+	max   int
+	ll    *list.List // front is most recently used
+	items map[int64]*list.Element
+}
+
+type lruEntry struct {
+	key   int64
+	value interface{}
+}
+
+func newLRU(max int) *lru {
+	return &lru{
+		max:   max,
+		ll:    list.New(),
+		items: make(map[int64]*list.Element),
+	}
+}
+
+func (c *lru) get(key int64) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruEntry).value, true
+}
+
+func (c *lru) add(key int64, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		// Another goroutine raced us to adding this entry.
+		c.ll.MoveToFront(el)
+		el.Value.(*lruEntry).value = value
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value})
+	if c.ll.Len() > c.max {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
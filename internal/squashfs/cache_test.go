@@ -0,0 +1,24 @@
+package squashfs
+
+import "testing"
+
+func TestLRU(t *testing.T) {
+	c := newLRU(2)
+	c.add(1, "one")
+	c.add(2, "two")
+	if _, ok := c.get(1); !ok { // 1 is now the most recently used entry
+		t.Fatalf("entry 1 unexpectedly not cached")
+	}
+	c.add(3, "three") // evicts 2
+	if _, ok := c.get(2); ok {
+		t.Errorf("entry 2 unexpectedly still cached")
+	}
+	for _, key := range []int64{1, 3} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("entry %d unexpectedly not cached", key)
+		}
+	}
+	if got, want := c.ll.Len(), 2; got != want {
+		t.Errorf("unexpected cache size: got %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,261 @@
+package squashfs
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// maxSymlinks is the number of symbolic links followed while resolving a
+// path before giving up, like Linux’s MAXSYMLINKS.
+const maxSymlinks = 40
+
+// FS provides access to the file system image read by a Reader via the io/fs
+// interfaces, so that images can be used with e.g. fs.WalkDir,
+// http.FileServer or testing/fstest.
+//
+// Symbolic links are followed by Open, Stat, ReadDir and ReadFile, provided
+// they are relative and point to a path within the image. Absolute symbolic
+// links (e.g. into /ro) cannot be resolved and result in fs.ErrNotExist.
+//
+// The Sys method of returned fs.FileInfos returns a *FileInfo, which carries
+// the Inode for use with the Reader.
+type FS struct {
+	rd *Reader
+}
+
+var (
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+)
+
+// FS returns an FS for the image read by r.
+func (r *Reader) FS() *FS {
+	return &FS{rd: r}
+}
+
+// resolve returns the inode for name, following symbolic links in all but the
+// last path component. The last path component is followed only if follow is
+// true.
+func (fsys *FS) resolve(op, name string, follow bool) (Inode, error) {
+	if !fs.ValidPath(name) {
+		return 0, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	var (
+		inode = fsys.rd.RootInode()
+		dir   []string // resolved components leading to inode
+		parts []string // components yet to be resolved
+		links int
+	)
+	if name != "." {
+		parts = strings.Split(name, "/")
+	}
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		child, err := fsys.rd.Lookup(inode, part)
+		if err != nil {
+			return 0, fsys.pathError(op, name, err)
+		}
+		if len(parts) == 0 && !follow {
+			return child, nil
+		}
+		fi, err := fsys.rd.Stat(part, child)
+		if err != nil {
+			return 0, fsys.pathError(op, name, err)
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			if len(parts) > 0 && !fi.IsDir() {
+				return 0, &fs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+			}
+			inode = child
+			dir = append(dir, part)
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return 0, &fs.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+		target, err := fsys.rd.ReadLink(child)
+		if err != nil {
+			return 0, fsys.pathError(op, name, err)
+		}
+		if path.IsAbs(target) {
+			return 0, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		resolved := path.Join(append(append([]string{}, dir...), target)...)
+		if resolved == ".." || strings.HasPrefix(resolved, "../") {
+			// The symbolic link points outside of the image.
+			return 0, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		// Restart the lookup from the root with the link target spliced in.
+		inode = fsys.rd.RootInode()
+		dir = nil
+		if resolved != "." {
+			parts = append(strings.Split(resolved, "/"), parts...)
+		}
+	}
+	return inode, nil
+}
+
+func (fsys *FS) pathError(op, name string, err error) error {
+	if _, ok := err.(*FileNotFoundError); ok {
+		err = fs.ErrNotExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (fsys *FS) stat(op, name string, follow bool) (fs.FileInfo, error) {
+	inode, err := fsys.resolve(op, name, follow)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := fsys.rd.Stat(path.Base(name), inode)
+	if err != nil {
+		return nil, fsys.pathError(op, name, err)
+	}
+	return fi, nil
+}
+
+// Open implements fs.FS.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	fi, err := fsys.stat("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	inode := fi.Sys().(*FileInfo).Inode
+	if fi.IsDir() {
+		fis, err := fsys.rd.Readdir(inode)
+		if err != nil {
+			return nil, fsys.pathError("open", name, err)
+		}
+		entries := make([]fs.DirEntry, len(fis))
+		for idx, fi := range fis {
+			entries[idx] = fs.FileInfoToDirEntry(fi)
+		}
+		return &fsDir{name: name, fi: fi, entries: entries}, nil
+	}
+	f := &fsFile{name: name, fi: fi}
+	if fi.Mode().IsRegular() {
+		f.SectionReader, err = fsys.rd.FileReader(inode)
+		if err != nil {
+			return nil, fsys.pathError("open", name, err)
+		}
+	} else {
+		// Device nodes, FIFOs and sockets have no contents within the image.
+		f.SectionReader = io.NewSectionReader(eofReaderAt{}, 0, 0)
+	}
+	return f, nil
+}
+
+// Stat implements fs.StatFS.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	return fsys.stat("stat", name, true)
+}
+
+// Lstat is like Stat, but does not follow a symbolic link in the last path
+// component.
+func (fsys *FS) Lstat(name string) (fs.FileInfo, error) {
+	return fsys.stat("lstat", name, false)
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	inode, err := fsys.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	fis, err := fsys.rd.Readdir(inode)
+	if err != nil {
+		return nil, fsys.pathError("readdir", name, err)
+	}
+	entries := make([]fs.DirEntry, len(fis))
+	for idx, fi := range fis {
+		entries[idx] = fs.FileInfoToDirEntry(fi)
+	}
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	fi, err := fsys.stat("readfile", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: syscall.EISDIR}
+	}
+	fr, err := fsys.rd.FileReader(fi.Sys().(*FileInfo).Inode)
+	if err != nil {
+		return nil, fsys.pathError("readfile", name, err)
+	}
+	b := make([]byte, fr.Size())
+	if _, err := io.ReadFull(fr, b); err != nil {
+		return nil, fsys.pathError("readfile", name, err)
+	}
+	return b, nil
+}
+
+// ReadLink returns the target of the symbolic link name.
+func (fsys *FS) ReadLink(name string) (string, error) {
+	fi, err := fsys.stat("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if fi.Mode()&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := fsys.rd.ReadLink(fi.Sys().(*FileInfo).Inode)
+	if err != nil {
+		return "", fsys.pathError("readlink", name, err)
+	}
+	return target, nil
+}
+
+type eofReaderAt struct{}
+
+func (eofReaderAt) ReadAt(p []byte, off int64) (int, error) { return 0, io.EOF }
+
+// fsFile is an fs.File for non-directories.
+type fsFile struct {
+	*io.SectionReader
+	name string
+	fi   fs.FileInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.fi, nil }
+func (f *fsFile) Close() error               { return nil }
+
+// fsDir is an fs.ReadDirFile.
+type fsDir struct {
+	name    string
+	fi      fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.fi, nil }
+func (d *fsDir) Close() error               { return nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
@@ -0,0 +1,123 @@
+package squashfs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/orcaman/writerseeker"
+	"golang.org/x/sys/unix"
+)
+
+func TestFS(t *testing.T) {
+	t.Parallel()
+
+	buf := &writerseeker.WriterSeeker{}
+	if err := writeTestImage(buf, false); err != nil {
+		t.Fatal(err)
+	}
+	rd, err := NewReader(buf.BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(rd.FS(),
+		"leer",
+		"hellö wörld",
+		"second link",
+		"fragments/file00",
+		"subdir/deep/yo"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSSymlinks(t *testing.T) {
+	t.Parallel()
+
+	buf := &writerseeker.WriterSeeker{}
+	w, err := NewWriter(buf, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const perm = unix.S_IRUSR | unix.S_IRGRP | unix.S_IROTH
+	// Entries must be added in sorted order.
+	lib := w.Root.Directory("lib", time.Now(), 0555, 0, 0)
+	symlink := func(target, name string) {
+		t.Helper()
+		if err := lib.Symlink(target, name, time.Now(), perm, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlink("../../escape", "escape")
+	symlink("/ro/glibc-amd64-2.27-3/out/lib/libc.so.6", "libc.so.6")
+	symlink("libfoo.so.1", "libfoo.so")
+	symlink("libfoo.so.1.2", "libfoo.so.1")
+	ff, err := lib.File("libfoo.so.1.2", time.Now(), perm, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ff.Write([]byte("ELF")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ff.Close(); err != nil {
+		t.Fatal(err)
+	}
+	symlink("loop", "loop")
+	if err := lib.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Symlink("lib", "lib64", time.Now(), perm, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rd, err := NewReader(buf.BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := rd.FS()
+
+	for _, name := range []string{"lib/libfoo.so", "lib64/libfoo.so.1"} {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), "ELF"; got != want {
+			t.Errorf("ReadFile(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	target, err := fsys.ReadLink("lib64/libfoo.so")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := target, "libfoo.so.1"; got != want {
+		t.Errorf("ReadLink(lib64/libfoo.so) = %q, want %q", got, want)
+	}
+
+	fi, err := fsys.Lstat("lib/libfoo.so")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("Lstat(lib/libfoo.so): unexpected mode: got %v, want symlink", fi.Mode())
+	}
+
+	for _, name := range []string{"lib/libc.so.6", "lib/escape", "lib/nonexistant"} {
+		if _, err := fsys.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%q) = %v, want fs.ErrNotExist", name, err)
+		}
+	}
+	if _, err := fsys.Stat("lib/loop"); !errors.Is(err, unix.ELOOP) {
+		t.Errorf("Stat(lib/loop) = %v, want ELOOP", err)
+	}
+	if _, err := fsys.ReadLink("lib/libfoo.so.1.2"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("ReadLink(lib/libfoo.so.1.2) = %v, want fs.ErrInvalid", err)
+	}
+}
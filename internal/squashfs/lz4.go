@@ -0,0 +1,163 @@
+package squashfs
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// This file implements the LZ4 block format, which is what SquashFS stores in
+// LZ4 compressed blocks (without the LZ4 frame format around it):
+// https://github.com/lz4/lz4/blob/v1.9.2/doc/lz4_Block_format.md
+
+const (
+	lz4MinMatch     = 4
+	lz4MFLimit      = 12 // the last match must start at least 12 bytes before the end
+	lz4LastLiterals = 5  // the last 5 bytes are always literals
+	lz4MaxOffset    = 65535
+	lz4HashLog      = 14
+)
+
+var errLZ4Corrupt = errors.New("lz4: corrupt input")
+
+func lz4Hash(seq uint32) uint32 {
+	return (seq * 2654435761) >> (32 - lz4HashLog)
+}
+
+// lz4AppendLength appends the LZ4 length continuation bytes for a length
+// which did not fit into a token nibble.
+func lz4AppendLength(dst []byte, l int) []byte {
+	for ; l >= 255; l -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(l))
+}
+
+func lz4AppendSequence(dst, literals []byte, offset, matchLen int) []byte {
+	var token byte
+	if len(literals) >= 15 {
+		token = 15 << 4
+	} else {
+		token = byte(len(literals)) << 4
+	}
+	ml := matchLen - lz4MinMatch
+	if matchLen > 0 {
+		if ml >= 15 {
+			token |= 15
+		} else {
+			token |= byte(ml)
+		}
+	}
+	dst = append(dst, token)
+	if len(literals) >= 15 {
+		dst = lz4AppendLength(dst, len(literals)-15)
+	}
+	dst = append(dst, literals...)
+	if matchLen == 0 {
+		return dst // last sequence: literals only
+	}
+	dst = append(dst, byte(offset), byte(offset>>8))
+	if ml >= 15 {
+		dst = lz4AppendLength(dst, ml-15)
+	}
+	return dst
+}
+
+// lz4CompressBlock appends the LZ4 compressed version of src to dst, using a
+// greedy hash-chain-less match finder. table is used as scratch space.
+func lz4CompressBlock(dst, src []byte, table *[1 << lz4HashLog]int32) []byte {
+	*table = [1 << lz4HashLog]int32{}
+	anchor := 0
+	if len(src) > lz4MFLimit {
+		limit := len(src) - lz4MFLimit
+		for i := 0; i < limit; {
+			seq := binary.LittleEndian.Uint32(src[i:])
+			h := lz4Hash(seq)
+			ref := int(table[h]) - 1 // entries are stored off by one, 0 means empty
+			table[h] = int32(i + 1)
+			if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(src[ref:]) != seq {
+				i++
+				continue
+			}
+			matchLen := lz4MinMatch
+			for i+matchLen < len(src)-lz4LastLiterals && src[ref+matchLen] == src[i+matchLen] {
+				matchLen++
+			}
+			dst = lz4AppendSequence(dst, src[anchor:i], i-ref, matchLen)
+			i += matchLen
+			anchor = i
+		}
+	}
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// lz4ReadLength reads LZ4 length continuation bytes starting at src[i].
+func lz4ReadLength(src []byte, i int) (length, next int, _ error) {
+	for {
+		if i >= len(src) {
+			return 0, 0, errLZ4Corrupt
+		}
+		b := src[i]
+		i++
+		length += int(b)
+		if b != 255 {
+			return length, i, nil
+		}
+	}
+}
+
+// lz4DecompressBlock decompresses the LZ4 block src into dst, returning the
+// number of bytes written to dst.
+func lz4DecompressBlock(dst, src []byte) (int, error) {
+	var si, di int
+	for si < len(src) {
+		token := src[si]
+		si++
+
+		litLen := int(token >> 4)
+		if litLen == 15 {
+			l, next, err := lz4ReadLength(src, si)
+			if err != nil {
+				return 0, err
+			}
+			litLen += l
+			si = next
+		}
+		if si+litLen > len(src) || di+litLen > len(dst) {
+			return 0, errLZ4Corrupt
+		}
+		di += copy(dst[di:], src[si:si+litLen])
+		si += litLen
+		if si == len(src) {
+			break // last sequence: literals only
+		}
+
+		if si+2 > len(src) {
+			return 0, errLZ4Corrupt
+		}
+		offset := int(src[si]) | int(src[si+1])<<8
+		si += 2
+		if offset == 0 || offset > di {
+			return 0, errLZ4Corrupt
+		}
+		matchLen := int(token & 15)
+		if matchLen == 15 {
+			l, next, err := lz4ReadLength(src, si)
+			if err != nil {
+				return 0, err
+			}
+			matchLen += l
+			si = next
+		}
+		matchLen += lz4MinMatch
+		if di+matchLen > len(dst) {
+			return 0, errLZ4Corrupt
+		}
+		// Matches may overlap with the bytes they produce, so copy byte-wise.
+		for ref := di - offset; matchLen > 0; matchLen-- {
+			dst[di] = dst[ref]
+			di++
+			ref++
+		}
+	}
+	return di, nil
+}
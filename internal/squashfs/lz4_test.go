@@ -0,0 +1,66 @@
+package squashfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestLZ4RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	testbin, err := ioutil.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(testbin) > dataBlockSize {
+		testbin = testbin[:dataBlockSize]
+	}
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	var table [1 << lz4HashLog]int32
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short", []byte("hello")},
+		{"repetitive", bytes.Repeat([]byte("distri "), 10000)},
+		{"zeros", make([]byte, dataBlockSize)},
+		{"random", random},
+		{"testbin", testbin},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed := lz4CompressBlock(nil, tt.data, &table)
+			got := make([]byte, len(tt.data))
+			n, err := lz4DecompressBlock(got, compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got[:n], tt.data) {
+				t.Fatalf("round trip mismatch: got %d bytes, want %d bytes", n, len(tt.data))
+			}
+		})
+	}
+}
+
+func TestLZ4Corrupt(t *testing.T) {
+	t.Parallel()
+
+	dst := make([]byte, 64)
+	for _, src := range [][]byte{
+		{0xf0},            // truncated literal length
+		{0x10},            // missing literal
+		{0x11, 'a', 5, 0}, // offset beyond output
+		{0x11, 'a', 0, 0}, // zero offset
+		{0x1f, 'a', 1, 0}, // truncated match length
+		{0x10, 'a', 1},    // truncated offset
+	} {
+		if _, err := lz4DecompressBlock(dst, src); err == nil {
+			t.Errorf("lz4DecompressBlock(%x) unexpectedly succeeded", src)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package squashfs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmapReaderAt implements io.ReaderAt on top of a read-only memory mapping of
+// a file, saving a pread(2) system call per read.
+//
+// The mapping is removed by Reader.Close, or once the mmapReaderAt is garbage
+// collected. Note that reads fault (SIGBUS) if the file is truncated while
+// mapped, which is fine for distri images: they are immutable and replaced
+// atomically.
+type mmapReaderAt struct {
+	mu   sync.RWMutex // guards data against unmap during ReadAt
+	data []byte
+}
+
+func mmapFile(f *os.File) (*mmapReaderAt, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := st.Size()
+	if !st.Mode().IsRegular() || size == 0 || int64(int(size)) != size {
+		return nil, fmt.Errorf("%s: cannot mmap file of mode %v and size %d", f.Name(), st.Mode(), size)
+	}
+	data, err := unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	m := &mmapReaderAt{data: data}
+	runtime.SetFinalizer(m, (*mmapReaderAt).unmap)
+	return m, nil
+}
+
+func (m *mmapReaderAt) unmap() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data := m.data
+	if data == nil {
+		return nil // already unmapped
+	}
+	m.data = nil
+	runtime.SetFinalizer(m, nil)
+	return unix.Munmap(data)
+}
+
+// ReadAt implements io.ReaderAt.
+func (m *mmapReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.data == nil {
+		return 0, os.ErrClosed
+	}
+	if off < 0 || off > int64(len(m.data)) {
+		return 0, fmt.Errorf("invalid offset %d (file size %d)", off, len(m.data))
+	}
+	n := copy(p, m.data[off:])
+	// The finalizer must not unmap the data while we are copying from it.
+	runtime.KeepAlive(m)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,144 @@
+package squashfs
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// A dataBlock is a data or fragment block on its way through the Writer’s
+// pipeline: blocks are compressed concurrently, but written to the underlying
+// io.WriteSeeker in the order in which they were submitted, so that the
+// resulting image does not depend on scheduling.
+type dataBlock struct {
+	// raw is the uncompressed block, or nil for a marker, which only serves to
+	// learn the offset at which the next block will be written.
+	raw []byte
+
+	// written is called (on the goroutine which submitted blocks) once the
+	// block was written to offset off, with its SquashFS block size entry.
+	written func(off int64, size uint32)
+
+	done chan struct{} // closed once compression finished
+	comp *bytes.Buffer // compressed block, if smaller than raw
+	err  error
+}
+
+var rawBlockPool = sync.Pool{
+	New: func() interface{} { return make([]byte, dataBlockSize) },
+}
+
+var compBufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// submitBlock queues a copy of block for writing and returns once the number
+// of blocks in flight is below the configured parallelism again. Errors of
+// earlier blocks are returned by subsequent calls.
+func (w *Writer) submitBlock(block []byte, written func(off int64, size uint32)) error {
+	b := &dataBlock{
+		written: written,
+		done:    make(chan struct{}),
+	}
+	if block == nil || w.comp == nil {
+		// Nothing to compress.
+		b.raw = block
+		close(b.done)
+	} else {
+		b.raw = rawBlockPool.Get().([]byte)[:len(block)]
+		copy(b.raw, block)
+		if w.parallelism > 1 {
+			go w.compressBlock(b)
+		} else {
+			w.compressBlock(b)
+		}
+	}
+	w.pending = append(w.pending, b)
+	return w.retireBlocks(w.parallelism)
+}
+
+func (w *Writer) compressBlock(b *dataBlock) {
+	defer close(b.done)
+	comp := w.compressors.Get().(compressor)
+	defer w.compressors.Put(comp)
+	buf := compBufPool.Get().(*bytes.Buffer)
+	if err := comp.compress(buf, b.raw); err != nil {
+		b.err = err
+		compBufPool.Put(buf)
+		return
+	}
+	// Only use the compressed data if it is smaller: Linux returns i/o
+	// errors when it encounters a compressed block which is larger than the
+	// uncompressed data:
+	// https://github.com/torvalds/linux/blob/3ca24ce9ff764bc27bceb9b2fd8ece74846c3fd3/fs/squashfs/block.c#L150
+	if buf.Len() >= len(b.raw) {
+		compBufPool.Put(buf)
+		return
+	}
+	b.comp = buf
+}
+
+// retireBlocks writes pending blocks in submission order. It waits for
+// compression to finish until less than max blocks are pending, then writes
+// all blocks which are already compressed.
+func (w *Writer) retireBlocks(max int) error {
+	for len(w.pending) > 0 {
+		b := w.pending[0]
+		if len(w.pending) < max {
+			select {
+			case <-b.done:
+			default:
+				return nil // keep compressing in the background
+			}
+		} else {
+			<-b.done
+		}
+		w.pending = w.pending[1:]
+		if err := w.writeBlock(b); err != nil {
+			// Wait for the remaining blocks so that their buffers can be reused.
+			for _, b := range w.pending {
+				<-b.done
+			}
+			w.pending = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// flushBlocks writes all pending blocks.
+func (w *Writer) flushBlocks() error {
+	return w.retireBlocks(1)
+}
+
+func (w *Writer) writeBlock(b *dataBlock) error {
+	defer func() {
+		if b.raw != nil && w.comp != nil {
+			rawBlockPool.Put(b.raw[:cap(b.raw)])
+		}
+		if b.comp != nil {
+			compBufPool.Put(b.comp)
+		}
+	}()
+	if b.err != nil {
+		return b.err
+	}
+	off, err := w.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	var size uint32
+	if b.comp != nil {
+		if _, err := w.w.Write(b.comp.Bytes()); err != nil {
+			return err
+		}
+		size = uint32(b.comp.Len())
+	} else {
+		if _, err := w.w.Write(b.raw); err != nil {
+			return err
+		}
+		size = uint32(len(b.raw)) | dataBlockUncompressed
+	}
+	b.written(off, size)
+	return nil
+}
@@ -6,22 +6,57 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"golang.org/x/xerrors"
 )
 
+// A Reader reads a SquashFS file system image. It is safe for concurrent use by
+// multiple goroutines.
 type Reader struct {
 	r     io.ReaderAt
 	super superblock
+
+	// decompress is nil if the compression of the image is not supported, in
+	// which case reading compressed blocks fails.
+	decompress decompressFunc
+
+	// blocks caches decoded metadata blocks (*metadataBlock) by their offset
+	// within the image, inodes caches inode headers by Inode.
+	blocks *lru
+	inodes *lru
+
+	fragmentsOnce sync.Once
+	fragments     []fragmentEntry
+	fragmentsErr  error
+
+	idsOnce sync.Once
+	ids     []uint32 // uid/gid lookup table
+	idsErr  error
+
+	// fragMu guards the most recently read fragment block: many small files
+	// are typically read in directory order and share a fragment block.
+	fragMu        sync.Mutex
+	fragCachedIdx int64
+	fragCached    []byte
 }
 
+// NewReader returns a Reader for the SquashFS image in r. If r is an *os.File,
+// the image is accessed via mmap(2) when possible.
 func NewReader(r io.ReaderAt) (*Reader, error) {
+	if f, ok := r.(*os.File); ok {
+		// Fall back to reading via r if the file cannot be mapped.
+		if m, err := mmapFile(f); err == nil {
+			r = m
+		}
+	}
+
 	var sb superblock
 
 	if err := binary.Read(io.NewSectionReader(r, 0, int64(binary.Size(sb))), binary.LittleEndian, &sb); err != nil {
@@ -33,66 +68,155 @@ func NewReader(r io.ReaderAt) (*Reader, error) {
 	}
 
 	//log.Printf("superblock: %+v", sb)
+	decompress, _ := decompressorFor(Compression(sb.Compression))
 	return &Reader{
-		r:     r,
-		super: sb,
+		r:             r,
+		super:         sb,
+		decompress:    decompress,
+		blocks:        newLRU(metadataCacheBlocks),
+		inodes:        newLRU(inodeCacheSize),
+		fragCachedIdx: -1,
 	}, nil
 }
 
-// TODO: maybe mmap instead of seeking?
+// Close releases the memory mapping of the image (see NewReader), if any, after
+// which reads fail. Close does not close the io.ReaderAt passed to NewReader.
+func (r *Reader) Close() error {
+	if m, ok := r.r.(*mmapReaderAt); ok {
+		return m.unmap()
+	}
+	return nil
+}
+
+// checkSize returns an error if n bytes of what cannot possibly be stored in
+// the image. Counts and sizes read from the image must be checked before
+// allocating or looping accordingly, as corrupted images might contain
+// arbitrary values.
+func (r *Reader) checkSize(what string, n int64) error {
+	if n < 0 || n > r.super.BytesUsed {
+		return fmt.Errorf("corrupt %s: %d bytes exceed image size %d", what, n, r.super.BytesUsed)
+	}
+	return nil
+}
+
+// decompressBlock decompresses src into dst, returning the number of bytes
+// written to dst.
+func (r *Reader) decompressBlock(dst, src []byte) (int, error) {
+	if r.decompress == nil {
+		_, err := decompressorFor(Compression(r.super.Compression))
+		return 0, err
+	}
+	return r.decompress(dst, src)
+}
 
 func (r *Reader) inode(i Inode) (blockoffset int64, offset int64) {
 	return int64(i >> 16), int64(i & 0xFFFF)
 }
 
-type blockReader struct {
-	r   io.ReadSeeker
-	buf *bytes.Buffer
+// metadataBlock is a decoded (i.e. uncompressed) metadata block.
+type metadataBlock struct {
+	data []byte // must not be modified: shared via the Reader’s cache
+	next int64  // offset of the following metadata block within the image
+}
+
+// metadataBlock returns the decoded metadata block at offset off within the
+// image, reading and decoding it unless it is cached.
+func (r *Reader) metadataBlock(off int64) (*metadataBlock, error) {
+	if b, ok := r.blocks.get(off); ok {
+		return b.(*metadataBlock), nil
+	}
+	var hdr [2]byte
+	if _, err := io.ReadFull(io.NewSectionReader(r.r, off, int64(len(hdr))), hdr[:]); err != nil {
+		return nil, err
+	}
+	l := binary.LittleEndian.Uint16(hdr[:])
+	uncompressed := l&0x8000 > 0
+	l &= 0x7FFF
+	//log.Printf("block of len %d, uncompressed: %v", l, uncompressed)
+	src := make([]byte, l)
+	if _, err := io.ReadFull(io.NewSectionReader(r.r, off+int64(len(hdr)), int64(l)), src); err != nil {
+		return nil, err
+	}
+	data := src
+	if !uncompressed {
+		dst := make([]byte, metadataBlockSize)
+		n, err := r.decompressBlock(dst, src)
+		if err != nil {
+			return nil, xerrors.Errorf("decompressing metadata block at %d: %v", off, err)
+		}
+		data = dst[:n]
+	}
+	b := &metadataBlock{
+		data: data,
+		next: off + int64(len(hdr)) + int64(l),
+	}
+	r.blocks.add(off, b)
+	return b, nil
+}
 
-	off int64 // TODO: remove this once using mmap
+// blockReader reads consecutive metadata blocks as one stream.
+type blockReader struct {
+	rd   *Reader
+	next int64  // offset of the next metadata block
+	buf  []byte // unread data of the current metadata block
 }
 
 func (br *blockReader) Read(p []byte) (n int, err error) {
-	n, err = br.buf.Read(p)
-	//log.Printf("n = %v, err = %v", n, err)
-	if err == io.EOF {
-		br.buf.Reset()
-		var l uint16
-		if err := binary.Read(br.r, binary.LittleEndian, &l); err != nil {
-			return 0, err
-		}
-		//uncompressed := l&0x8000 > 0
-		l &= 0x7FFF
-		//log.Printf("block of len %d, uncompressed: %v", l, uncompressed)
-		if _, err := io.CopyN(br.buf, br.r, int64(l)); err != nil {
+	for len(br.buf) == 0 {
+		b, err := br.rd.metadataBlock(br.next)
+		if err != nil {
 			return 0, err
 		}
-		n, err = br.buf.Read(p)
-		//log.Printf("(retry) n = %v, err = %v", n, err)
+		br.buf = b.data
+		br.next = b.next
 	}
-	return n, err
+	n = copy(p, br.buf)
+	br.buf = br.buf[n:]
+	return n, nil
 }
 
 func (r *Reader) blockReader(blockoffset, offset int64) (io.Reader, error) {
 	//log.Printf("blockoffset %v (%x), offset %v (%x)", blockoffset, blockoffset, offset, offset)
 	br := &blockReader{
-		r:   io.NewSectionReader(r.r, blockoffset, 5500*1024*1024), // TODO: correct limit? can we use IntMax
-		buf: bytes.NewBuffer(make([]byte, 0, metadataBlockSize)),
-		off: blockoffset,
+		rd:   r,
+		next: blockoffset,
 	}
 	//log.Printf("discarding %d bytes", offset)
-	if _, err := io.CopyN(ioutil.Discard, br, offset); err != nil {
-		return nil, err
+	for offset > 0 {
+		b, err := r.metadataBlock(br.next)
+		if err != nil {
+			return nil, err
+		}
+		br.next = b.next
+		if offset <= int64(len(b.data)) {
+			br.buf = b.data[offset:]
+			break
+		}
+		offset -= int64(len(b.data))
 	}
 	return br, nil
 }
 
 // TODO: define an inode type to use instead of interface{}?
 func (r *Reader) readInode(i Inode) (interface{}, error) {
+	if inode, ok := r.inodes.get(int64(i)); ok {
+		return inode, nil
+	}
+	inode, _, err := r.readInodeBody(i)
+	if err != nil {
+		return nil, err
+	}
+	r.inodes.add(int64(i), inode)
+	return inode, nil
+}
+
+// readInodeBody is like readInode, but additionally returns a reader
+// positioned after the inode header, e.g. at the block sizes of a file inode.
+func (r *Reader) readInodeBody(i Inode) (interface{}, io.Reader, error) {
 	blockoffset, offset := r.inode(i)
 	br, err := r.blockReader(r.super.InodeTableStart+blockoffset, offset)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// We need the inode type before we know which type to pass to binary.Read,
@@ -100,7 +224,7 @@ func (r *Reader) readInode(i Inode) (interface{}, error) {
 	var inodeType uint16
 	typeBuf := bytes.NewBuffer(make([]byte, 0, binary.Size(inodeType)))
 	if err := binary.Read(io.TeeReader(br, typeBuf), binary.LittleEndian, &inodeType); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	br = io.MultiReader(typeBuf, br)
 
@@ -115,108 +239,165 @@ func (r *Reader) readInode(i Inode) (interface{}, error) {
 	case dirType:
 		var di dirInodeHeader
 		if err := binary.Read(br, binary.LittleEndian, &di); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		return di, nil
+		return di, br, nil
 
 	case fileType:
 		var ri regInodeHeader
 		if err := binary.Read(br, binary.LittleEndian, &ri); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		return ri, nil
+		return ri, br, nil
 
 	case symlinkType:
 		var si symlinkInodeHeader
 		if err := binary.Read(br, binary.LittleEndian, &si); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		return si, nil
+		return si, br, nil
 
 	case ldirType:
 		var di ldirInodeHeader
 		if err := binary.Read(br, binary.LittleEndian, &di); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		return di, nil
+		return di, br, nil
 
 	case lregType:
 		var di lregInodeHeader
 		if err := binary.Read(br, binary.LittleEndian, &di); err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		return di, br, nil
+
+	case blkdevType, chrdevType:
+		var di devInodeHeader
+		if err := binary.Read(br, binary.LittleEndian, &di); err != nil {
+			return nil, nil, err
+		}
+		return di, br, nil
+
+	case lblkdevType, lchrdevType:
+		var di ldevInodeHeader
+		if err := binary.Read(br, binary.LittleEndian, &di); err != nil {
+			return nil, nil, err
+		}
+		return di, br, nil
+
+	case fifoType, socketType:
+		var di ipcInodeHeader
+		if err := binary.Read(br, binary.LittleEndian, &di); err != nil {
+			return nil, nil, err
 		}
-		return di, nil
+		return di, br, nil
+
+	case lfifoType, lsocketType:
+		var di lipcInodeHeader
+		if err := binary.Read(br, binary.LittleEndian, &di); err != nil {
+			return nil, nil, err
+		}
+		return di, br, nil
 
 		// TODO:
-		// blkdevType
-		// chrdevType
-		// fifoType
-		// socketType
-		// // The larger types are used for e.g. sparse files, xattrs, etc.
-		// ldirType
 		// lsymlinkType
-		// lblkdevType
-		// lchrdevType
-		// lfifoType
-		// lsocketType
 
 	}
-	return nil, fmt.Errorf("unknown inode type %d", inodeType)
+	return nil, nil, fmt.Errorf("unknown inode type %d", inodeType)
 }
 
 func (r *Reader) RootInode() Inode {
 	return r.super.RootInode
 }
 
+// InodeByNumber returns the inode with inode number num (as stored in the inode
+// itself, starting at 1) using the export table, which is only present in
+// images written using WithExportTable.
+func (r *Reader) InodeByNumber(num uint32) (Inode, error) {
+	if r.super.LookupTableStart == -1 {
+		return 0, fmt.Errorf("image has no export table")
+	}
+	if num == 0 || num > r.super.Inodes {
+		return 0, fmt.Errorf("inode number %d out of range [1, %d]", num, r.super.Inodes)
+	}
+	const entriesPerBlock = metadataBlockSize / 8 /* sizeof(Inode) */
+	block := int64(num-1) / entriesPerBlock
+	offset := (int64(num-1) % entriesPerBlock) * 8 /* sizeof(Inode) */
+	var blockOffset uint64
+	if err := binary.Read(io.NewSectionReader(r.r, r.super.LookupTableStart+block*8 /* sizeof(uint64) */, 8), binary.LittleEndian, &blockOffset); err != nil {
+		return 0, xerrors.Errorf("reading export table index: %v", err)
+	}
+	br, err := r.blockReader(int64(blockOffset), offset)
+	if err != nil {
+		return 0, err
+	}
+	var inode Inode
+	if err := binary.Read(br, binary.LittleEndian, &inode); err != nil {
+		return 0, xerrors.Errorf("reading export table: %v", err)
+	}
+	return inode, nil
+}
+
 func (r *Reader) Stat(name string, i Inode) (os.FileInfo, error) {
 	inode, err := r.readInode(i)
 	if err != nil {
 		return nil, err
 	}
+	fi, err := r.fileInfo(name, i, inode)
+	if err != nil {
+		return nil, err
+	}
+	h := inode.(interface{ header() inodeHeader }).header()
+	if fi.Uid, err = r.id(h.Uid); err != nil {
+		return nil, err
+	}
+	if fi.Gid, err = r.id(h.Gid); err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+func (r *Reader) fileInfo(name string, i Inode, inode interface{}) (*FileInfo, error) {
 	//log.Printf("i %d, inode: %T, %+v", i, inode, inode)
 	switch x := inode.(type) {
 	case dirInodeHeader:
 		return &FileInfo{
 			name:    name,
 			size:    int64(x.FileSize),
-			mode:    os.ModeDir | os.FileMode(x.Mode),
+			mode:    os.ModeDir | decodeMode(x.Mode),
 			modTime: time.Unix(int64(x.Mtime), 0),
 			Inode:   i,
+			Nlink:   x.Nlink,
 		}, nil
 
 	case ldirInodeHeader:
 		return &FileInfo{
 			name:    name,
 			size:    int64(x.FileSize),
-			mode:    os.ModeDir | os.FileMode(x.Mode),
+			mode:    os.ModeDir | decodeMode(x.Mode),
 			modTime: time.Unix(int64(x.Mtime), 0),
 			Inode:   i,
+			Nlink:   x.Nlink,
 		}, nil
 
 	case regInodeHeader:
-		mode := os.FileMode(x.Mode & 0777)
-		if x.Mode&syscall.S_ISUID != 0 {
-			mode |= os.ModeSetuid
-		}
 		return &FileInfo{
 			name:    name,
 			size:    int64(x.FileSize),
-			mode:    mode,
+			mode:    decodeMode(x.Mode),
 			modTime: time.Unix(int64(x.Mtime), 0),
 			Inode:   i,
+			Nlink:   1, // basic file inodes cannot be hard linked
 		}, nil
 
 	case lregInodeHeader:
-		mode := os.FileMode(x.Mode & 0777)
-		if x.Mode&syscall.S_ISUID != 0 {
-			mode |= os.ModeSetuid
-		}
 		return &FileInfo{
 			name:    name,
 			size:    int64(x.FileSize),
-			mode:    mode,
+			mode:    decodeMode(x.Mode),
 			modTime: time.Unix(int64(x.Mtime), 0),
 			Inode:   i,
+			Nlink:   x.Nlink,
 		}, nil
 
 	case symlinkInodeHeader:
@@ -226,12 +407,71 @@ func (r *Reader) Stat(name string, i Inode) (os.FileInfo, error) {
 			mode:    os.ModeSymlink | os.FileMode(x.Mode),
 			modTime: time.Unix(int64(x.Mtime), 0),
 			Inode:   i,
+			Nlink:   x.Nlink,
 		}, nil
+
+	case devInodeHeader:
+		return devFileInfo(name, i, x), nil
+
+	case ldevInodeHeader:
+		return devFileInfo(name, i, x.devInodeHeader), nil
+
+	case ipcInodeHeader:
+		return ipcFileInfo(name, i, x), nil
+
+	case lipcInodeHeader:
+		return ipcFileInfo(name, i, x.ipcInodeHeader), nil
 	}
 
 	return nil, fmt.Errorf("unknown inode type %T", inode)
 }
 
+// decodeMode converts the Unix mode bits stored in an inode header to the
+// permission bits of an os.FileMode, including the setuid, setgid and sticky
+// bits.
+func decodeMode(m uint16) os.FileMode {
+	mode := os.FileMode(m & 0777)
+	if m&syscall.S_ISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&syscall.S_ISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&syscall.S_ISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+func devFileInfo(name string, i Inode, x devInodeHeader) *FileInfo {
+	mode := os.ModeDevice | decodeMode(x.Mode)
+	if x.InodeType == chrdevType || x.InodeType == lchrdevType {
+		mode |= os.ModeCharDevice
+	}
+	return &FileInfo{
+		name:    name,
+		mode:    mode,
+		modTime: time.Unix(int64(x.Mtime), 0),
+		Inode:   i,
+		Nlink:   x.Nlink,
+		Rdev:    decodeDev(x.Rdev),
+	}
+}
+
+func ipcFileInfo(name string, i Inode, x ipcInodeHeader) *FileInfo {
+	mode := os.ModeNamedPipe
+	if x.InodeType == socketType || x.InodeType == lsocketType {
+		mode = os.ModeSocket
+	}
+	return &FileInfo{
+		name:    name,
+		mode:    mode | decodeMode(x.Mode),
+		modTime: time.Unix(int64(x.Mtime), 0),
+		Inode:   i,
+		Nlink:   x.Nlink,
+	}
+}
+
 func (r *Reader) ReadLink(i Inode) (string, error) {
 	// TODO: reduce code duplication with readInode
 	blockoffset, offset := r.inode(i)
@@ -257,6 +497,9 @@ func (r *Reader) ReadLink(i Inode) (string, error) {
 		return "", err
 	}
 
+	if err := r.checkSize("symlink target", int64(si.SymlinkSize)); err != nil {
+		return "", err
+	}
 	// Assumption: r.r is positioned right after the inode
 	buf := make([]byte, si.SymlinkSize)
 	if _, err := io.ReadFull(br, buf); err != nil {
@@ -265,24 +508,320 @@ func (r *Reader) ReadLink(i Inode) (string, error) {
 	return string(buf), nil
 }
 
-func (r *Reader) FileReader(inode Inode) (*io.SectionReader, error) {
-	//log.Printf("Readfile(%v)", inode)
-	i, err := r.readInode(inode)
+// fileLayout describes where the contents of a file are stored.
+type fileLayout struct {
+	startBlock int64
+	fileSize   int64
+	blocksizes []uint32
+	// fragment is the fragment block holding the tail end of the file at
+	// fragOffset, or invalidFragment.
+	fragment   uint32
+	fragOffset uint32
+}
+
+func (r *Reader) fileLayout(inode Inode) (*fileLayout, error) {
+	i, br, err := r.readInodeBody(inode)
 	if err != nil {
 		return nil, err
 	}
-	//log.Printf("i: %+v", i)
-	// TODO(compression): read the blocksizes to read compressed blocks
+	var l fileLayout
 	switch ri := i.(type) {
 	case regInodeHeader:
-		off := int64(ri.StartBlock) + int64(ri.Offset)
-		return io.NewSectionReader(r.r, off, int64(ri.FileSize)), nil
+		l.startBlock = int64(ri.StartBlock)
+		l.fileSize = int64(ri.FileSize)
+		l.fragment, l.fragOffset = ri.Fragment, ri.Offset
 	case lregInodeHeader:
-		off := int64(ri.StartBlock) + int64(ri.Offset)
-		return io.NewSectionReader(r.r, off, int64(ri.FileSize)), nil
+		l.startBlock = int64(ri.StartBlock)
+		l.fileSize = int64(ri.FileSize)
+		l.fragment, l.fragOffset = ri.Fragment, ri.Offset
 	default:
 		return nil, fmt.Errorf("BUG: non-file inode type")
 	}
+	if l.fileSize < 0 {
+		return nil, fmt.Errorf("corrupt file size %d", uint64(l.fileSize))
+	}
+	blockSize := int64(r.super.BlockSize)
+	blocks := (l.fileSize + blockSize - 1) / blockSize
+	if l.fragment != invalidFragment {
+		// The tail end of the file is stored in a fragment block.
+		blocks = l.fileSize / blockSize
+	}
+	// Even sparse blocks have a block list entry within the inode table:
+	if err := r.checkSize("block list", blocks*4 /* sizeof(uint32) */); err != nil {
+		return nil, err
+	}
+	l.blocksizes = make([]uint32, blocks)
+	if err := binary.Read(br, binary.LittleEndian, l.blocksizes); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (r *Reader) FileReader(inode Inode) (*io.SectionReader, error) {
+	//log.Printf("Readfile(%v)", inode)
+	l, err := r.fileLayout(inode)
+	if err != nil {
+		return nil, err
+	}
+	startBlock, fileSize := l.startBlock, l.fileSize
+	blocksizes := l.blocksizes
+	fragment, fragOffset := l.fragment, l.fragOffset
+
+	uncompressed := true
+	for _, size := range blocksizes {
+		if size&dataBlockUncompressed == 0 {
+			uncompressed = false
+			break
+		}
+	}
+	if uncompressed && fragment == invalidFragment {
+		// Fast path: uncompressed blocks are stored back to back, so the file
+		// contents can be read directly.
+		return io.NewSectionReader(r.r, startBlock, fileSize), nil
+	}
+
+	fr := &fileReader{
+		r:          r,
+		fileSize:   fileSize,
+		offsets:    make([]int64, len(blocksizes)),
+		sizes:      blocksizes,
+		fragment:   fragment,
+		fragOffset: fragOffset,
+		cachedIdx:  -1,
+	}
+	off := startBlock
+	for idx, size := range blocksizes {
+		fr.offsets[idx] = off
+		off += int64(size &^ dataBlockUncompressed)
+	}
+	return io.NewSectionReader(fr, 0, fileSize), nil
+}
+
+// readDataBlock reads the data block with the specified size entry, located at
+// off, into dst, which must be large enough to hold an uncompressed block. It
+// returns the number of bytes written to dst.
+//
+// A size entry of 0 denotes a sparse block, i.e. a block of zeros which is not
+// stored in the image, for which dst is zeroed.
+func (r *Reader) readDataBlock(dst []byte, off int64, size uint32) (int, error) {
+	if size == 0 {
+		for i := range dst {
+			dst[i] = 0
+		}
+		return len(dst), nil
+	}
+	l := int(size &^ dataBlockUncompressed)
+	if size&dataBlockUncompressed != 0 {
+		if l > len(dst) {
+			return 0, fmt.Errorf("corrupt data block at %d: size %d exceeds block size", off, l)
+		}
+		return io.ReadFull(io.NewSectionReader(r.r, off, int64(l)), dst[:l])
+	}
+	src := make([]byte, l)
+	if _, err := io.ReadFull(io.NewSectionReader(r.r, off, int64(l)), src); err != nil {
+		return 0, err
+	}
+	return r.decompressBlock(dst, src)
+}
+
+// fragmentEntry returns the fragment table entry of fragment block idx. The
+// fragment table is read on first use.
+func (r *Reader) fragmentEntry(idx uint32) (fragmentEntry, error) {
+	r.fragmentsOnce.Do(func() {
+		r.fragments, r.fragmentsErr = r.readFragmentTable()
+	})
+	if r.fragmentsErr != nil {
+		return fragmentEntry{}, r.fragmentsErr
+	}
+	if int(idx) >= len(r.fragments) {
+		return fragmentEntry{}, fmt.Errorf("fragment %d out of range (image has %d fragments)", idx, len(r.fragments))
+	}
+	return r.fragments[idx], nil
+}
+
+// id returns the user or group id stored at index idx of the id table.
+func (r *Reader) id(idx uint16) (uint32, error) {
+	r.idsOnce.Do(func() {
+		r.ids, r.idsErr = r.readIdTable()
+	})
+	if r.idsErr != nil {
+		return 0, r.idsErr
+	}
+	if int(idx) >= len(r.ids) {
+		return 0, fmt.Errorf("id %d out of range (image has %d ids)", idx, len(r.ids))
+	}
+	return r.ids[idx], nil
+}
+
+func (r *Reader) readIdTable() ([]uint32, error) {
+	const entriesPerBlock = metadataBlockSize / 4 /* sizeof(uint32) */
+	num := int64(r.super.NoIds)
+	blocks := (num + entriesPerBlock - 1) / entriesPerBlock
+	index := make([]uint64, blocks)
+	if err := binary.Read(io.NewSectionReader(r.r, r.super.IdTableStart, blocks*8 /* sizeof(uint64) */), binary.LittleEndian, index); err != nil {
+		return nil, xerrors.Errorf("reading id table index: %v", err)
+	}
+	ids := make([]uint32, 0, num)
+	for _, blockOffset := range index {
+		n := num - int64(len(ids))
+		if n > entriesPerBlock {
+			n = entriesPerBlock
+		}
+		br, err := r.blockReader(int64(blockOffset), 0)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]uint32, n)
+		if err := binary.Read(br, binary.LittleEndian, entries); err != nil {
+			return nil, xerrors.Errorf("reading id table: %v", err)
+		}
+		ids = append(ids, entries...)
+	}
+	return ids, nil
+}
+
+func (r *Reader) readFragmentTable() ([]fragmentEntry, error) {
+	const entriesPerBlock = metadataBlockSize / 16 /* sizeof(fragmentEntry) */
+	num := int64(r.super.Fragments)
+	if err := r.checkSize("fragment table", num*16 /* sizeof(fragmentEntry) */); err != nil {
+		return nil, err
+	}
+	blocks := (num + entriesPerBlock - 1) / entriesPerBlock
+	index := make([]uint64, blocks)
+	if err := binary.Read(io.NewSectionReader(r.r, r.super.FragmentTableStart, blocks*8 /* sizeof(uint64) */), binary.LittleEndian, index); err != nil {
+		return nil, xerrors.Errorf("reading fragment table index: %v", err)
+	}
+	fragments := make([]fragmentEntry, 0, num)
+	for _, blockOffset := range index {
+		n := num - int64(len(fragments))
+		if n > entriesPerBlock {
+			n = entriesPerBlock
+		}
+		br, err := r.blockReader(int64(blockOffset), 0)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]fragmentEntry, n)
+		if err := binary.Read(br, binary.LittleEndian, entries); err != nil {
+			return nil, xerrors.Errorf("reading fragment table: %v", err)
+		}
+		fragments = append(fragments, entries...)
+	}
+	return fragments, nil
+}
+
+// readFragment copies the tail end of a file, stored at offset within
+// fragment block idx, into dst.
+func (r *Reader) readFragment(dst []byte, idx, offset uint32) error {
+	entry, err := r.fragmentEntry(idx)
+	if err != nil {
+		return err
+	}
+	if entry.Size&dataBlockUncompressed != 0 {
+		// The tail end can be read directly from the image.
+		if uint64(offset)+uint64(len(dst)) > uint64(entry.Size&^dataBlockUncompressed) {
+			return fmt.Errorf("corrupt fragment %d: tail end at %d+%d exceeds fragment block", idx, offset, len(dst))
+		}
+		_, err := io.ReadFull(io.NewSectionReader(r.r, int64(entry.Start)+int64(offset), int64(len(dst))), dst)
+		return err
+	}
+
+	r.fragMu.Lock()
+	defer r.fragMu.Unlock()
+	if r.fragCachedIdx != int64(idx) {
+		if r.fragCached == nil {
+			r.fragCached = make([]byte, r.super.BlockSize)
+		}
+		r.fragCachedIdx = -1
+		n, err := r.readDataBlock(r.fragCached[:cap(r.fragCached)], int64(entry.Start), entry.Size)
+		if err != nil {
+			return xerrors.Errorf("reading fragment %d: %v", idx, err)
+		}
+		r.fragCached = r.fragCached[:n]
+		r.fragCachedIdx = int64(idx)
+	}
+	if int(offset)+len(dst) > len(r.fragCached) {
+		return fmt.Errorf("corrupt fragment %d: tail end at %d+%d exceeds fragment block", idx, offset, len(dst))
+	}
+	copy(dst, r.fragCached[offset:])
+	return nil
+}
+
+// fileReader implements io.ReaderAt for files consisting of (possibly
+// compressed) data blocks and an optional tail end in a fragment block.
+type fileReader struct {
+	r        *Reader
+	fileSize int64
+	offsets  []int64  // location of each data block within the image
+	sizes    []uint32 // size entry of each data block
+
+	// fragment is the fragment block holding the tail end of the file at
+	// fragOffset, or invalidFragment.
+	fragment   uint32
+	fragOffset uint32
+
+	// mu guards the most recently decompressed block: reads are typically
+	// sequential and smaller than a data block.
+	mu        sync.Mutex
+	cachedIdx int
+	cached    []byte
+}
+
+// block returns the uncompressed contents of data block idx. fr.mu must be
+// held.
+func (fr *fileReader) block(idx int) ([]byte, error) {
+	if fr.cachedIdx == idx {
+		return fr.cached, nil
+	}
+	if fr.cached == nil {
+		fr.cached = make([]byte, fr.r.super.BlockSize)
+	}
+	fr.cachedIdx = -1
+	if idx == len(fr.sizes) {
+		if fr.fragment == invalidFragment {
+			return nil, fmt.Errorf("data block %d out of range", idx)
+		}
+		tail := fr.cached[:cap(fr.cached)][:fr.fileSize-int64(idx)*int64(fr.r.super.BlockSize)]
+		if err := fr.r.readFragment(tail, fr.fragment, fr.fragOffset); err != nil {
+			return nil, err
+		}
+		fr.cached = tail
+		fr.cachedIdx = idx
+		return fr.cached, nil
+	}
+	n, err := fr.r.readDataBlock(fr.cached[:cap(fr.cached)], fr.offsets[idx], fr.sizes[idx])
+	if err != nil {
+		return nil, xerrors.Errorf("reading data block %d: %v", idx, err)
+	}
+	fr.cached = fr.cached[:n]
+	fr.cachedIdx = idx
+	return fr.cached, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (fr *fileReader) ReadAt(p []byte, off int64) (n int, err error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	blockSize := int64(fr.r.super.BlockSize)
+	for len(p) > 0 && off < fr.fileSize {
+		idx := off / blockSize
+		block, err := fr.block(int(idx))
+		if err != nil {
+			return n, err
+		}
+		inBlock := off - idx*blockSize
+		if inBlock >= int64(len(block)) {
+			return n, fmt.Errorf("corrupt data block %d: got %d bytes, want more than %d", idx, len(block), inBlock)
+		}
+		copied := copy(p, block[inBlock:])
+		p = p[copied:]
+		n += copied
+		off += int64(copied)
+	}
+	if len(p) > 0 {
+		return n, io.EOF
+	}
+	return n, nil
 }
 
 type FileNotFoundError struct {
@@ -293,17 +832,36 @@ func (e *FileNotFoundError) Error() string {
 	return fmt.Sprintf("%q not found", e.path)
 }
 
-func (r *Reader) lookupComponent(parent Inode, component string) (Inode, error) {
-	rfis, err := r.readdir(parent, false)
+// Lookup returns the inode of the directory entry called name within the
+// directory parent. For large directories, the directory index is used to skip
+// to the relevant part of the listing.
+func (r *Reader) Lookup(parent Inode, name string) (Inode, error) {
+	br, err := r.dirListing(parent, name)
 	if err != nil {
 		return 0, err
 	}
-	for _, rfi := range rfis {
-		if rfi.Name() == component {
-			return rfi.Sys().(*FileInfo).Inode, nil
+	var (
+		found  bool
+		result Inode
+	)
+	if err := walkDirListing(br, func(entry string, inode Inode) bool {
+		if entry == name {
+			found = true
+			result = inode
 		}
+		// Directory entries are sorted, so we can stop once we are past name.
+		return entry < name
+	}); err != nil {
+		return 0, err
 	}
-	return 0, &FileNotFoundError{path: component}
+	if !found {
+		return 0, &FileNotFoundError{path: name}
+	}
+	return result, nil
+}
+
+func (r *Reader) lookupComponent(parent Inode, component string) (Inode, error) {
+	return r.Lookup(parent, component)
 }
 
 func (r *Reader) lookupPath(path string, followSymlink bool) (Inode, error) {
@@ -355,7 +913,43 @@ func (r *Reader) Readdir(dirInode Inode) ([]os.FileInfo, error) {
 
 func (r *Reader) readdir(dirInode Inode, stat bool) ([]os.FileInfo, error) {
 	//log.Printf("Readdir(%v (%x))", dirInode, dirInode)
-	i, err := r.readInode(dirInode)
+	br, err := r.dirListing(dirInode, "")
+	if err != nil {
+		return nil, err
+	}
+	var (
+		fis     []os.FileInfo
+		statErr error
+	)
+	if err := walkDirListing(br, func(name string, inode Inode) bool {
+		var fi os.FileInfo
+		if stat {
+			fi, statErr = r.Stat(name, inode)
+			if statErr != nil {
+				return false
+			}
+		} else {
+			fi = &FileInfo{
+				name:  name,
+				Inode: inode,
+			}
+		}
+		fis = append(fis, fi)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	if statErr != nil {
+		return nil, statErr
+	}
+	return fis, nil
+}
+
+// dirListing returns a reader for the directory listing of dirInode. If name
+// is non-empty and the directory has a directory index, the listing starts at
+// the last directory header whose first entry does not sort after name.
+func (r *Reader) dirListing(dirInode Inode, name string) (io.Reader, error) {
+	i, body, err := r.readInodeBody(dirInode)
 	if err != nil {
 		return nil, err
 	}
@@ -363,6 +957,7 @@ func (r *Reader) readdir(dirInode Inode, stat bool) ([]os.FileInfo, error) {
 		startBlock int64
 		fileSize   int64
 		offset     int64
+		icount     int
 	)
 	switch x := i.(type) {
 	case dirInodeHeader:
@@ -374,28 +969,67 @@ func (r *Reader) readdir(dirInode Inode, stat bool) ([]os.FileInfo, error) {
 		startBlock = int64(x.StartBlock)
 		fileSize = int64(x.FileSize)
 		offset = int64(x.Offset)
+		icount = int(x.Icount)
 
 	default:
 		return nil, fmt.Errorf("unknown directory inode type %T", i)
 	}
 
+	// See also https://elixir.bootlin.com/linux/v4.18.9/source/fs/squashfs/dir.c#L63
+	limit := fileSize - int64(len(".")) - int64(len(".."))
+
+	if name != "" && icount > 0 {
+		index, names, err := readDirIndex(body, icount)
+		if err != nil {
+			return nil, err
+		}
+		// Find the first index entry which sorts after name, the entry before
+		// it covers name. See also get_dir_index_using_name in
+		// https://elixir.bootlin.com/linux/v4.18.9/source/fs/squashfs/namei.c#L128
+		n := sort.Search(len(names), func(j int) bool { return names[j] > name })
+		if n > 0 {
+			di := index[n-1]
+			startBlock = int64(di.StartBlock)
+			offset = (offset + int64(di.Index)) % metadataBlockSize
+			limit -= int64(di.Index)
+		}
+	}
+
 	br, err := r.blockReader(r.super.DirectoryTableStart+startBlock, offset)
 	if err != nil {
 		return nil, err
 	}
+	return io.LimitReader(br, limit), nil
+}
 
-	// See also https://elixir.bootlin.com/linux/v4.18.9/source/fs/squashfs/dir.c#L63
-	limit := fileSize - int64(len(".")) - int64(len(".."))
-	br = io.LimitReader(br, limit)
+// readDirIndex reads icount directory index entries from r, returning the
+// entries and the corresponding names.
+func readDirIndex(r io.Reader, icount int) ([]dirIndex, []string, error) {
+	index := make([]dirIndex, icount)
+	names := make([]string, icount)
+	for i := range index {
+		if err := binary.Read(r, binary.LittleEndian, &index[i]); err != nil {
+			return nil, nil, xerrors.Errorf("reading directory index: %v", err)
+		}
+		name := make([]byte, index[i].Size+1) // SquashFS stores size-1
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, nil, xerrors.Errorf("reading directory index: %v", err)
+		}
+		names[i] = string(name)
+	}
+	return index, names, nil
+}
 
-	var fis []os.FileInfo
+// walkDirListing calls fn for each entry of the directory listing read from br,
+// until fn returns false or the listing ends.
+func walkDirListing(br io.Reader, fn func(name string, inode Inode) bool) error {
 	for {
 		var dh dirHeader
 		if err := binary.Read(br, binary.LittleEndian, &dh); err != nil {
 			if err == io.EOF {
-				return fis, nil
+				return nil
 			}
-			return nil, err
+			return err
 		}
 		dh.Count++ // SquashFS stores count-1
 		//log.Printf("dh: %+v", dh)
@@ -403,34 +1037,20 @@ func (r *Reader) readdir(dirInode Inode, stat bool) ([]os.FileInfo, error) {
 		for i := 0; i < int(dh.Count); i++ {
 			var de dirEntry
 			if err := binary.Read(br, binary.LittleEndian, &de); err != nil {
-				return nil, err
+				return err
 			}
 			de.Size++ // SquashFS stores size-1
 			//log.Printf("de: %+v", de)
 			name := make([]byte, de.Size)
 			if _, err := io.ReadFull(br, name); err != nil {
-				return nil, err
+				return err
 			}
 			//log.Printf("name: %q", string(name))
-
-			var fi os.FileInfo
-			if stat {
-				var err error
-				fi, err = r.Stat(string(name), Inode(int64(dh.StartBlock)<<16|int64(de.Offset)))
-				if err != nil {
-					return nil, err
-				}
-			} else {
-				fi = &FileInfo{
-					name:  string(name),
-					Inode: Inode(int64(dh.StartBlock)<<16 | int64(de.Offset)),
-				}
+			if !fn(string(name), Inode(int64(dh.StartBlock)<<16|int64(de.Offset))) {
+				return nil
 			}
-			fis = append(fis, fi)
 		}
 	}
-
-	return fis, nil
 }
 
 type FileInfo struct {
@@ -439,6 +1059,14 @@ type FileInfo struct {
 	mode    os.FileMode
 	modTime time.Time
 	Inode   Inode
+	// Nlink is the number of hard links to the inode. Only populated by
+	// Reader.Stat and Reader.Readdir.
+	Nlink uint32
+	// Rdev is the device number (see unix.Mkdev) of device nodes.
+	Rdev uint64
+	// Uid and Gid are the owner of the inode. Only populated by Reader.Stat
+	// and Reader.Readdir.
+	Uid, Gid uint32
 }
 
 func (fi *FileInfo) Name() string       { return fi.name }
@@ -459,7 +1087,9 @@ func (r *Reader) ReadXattrs(inode Inode) ([]Xattr, error) {
 	case regInodeHeader,
 		dirInodeHeader,
 		ldirInodeHeader,
-		symlinkInodeHeader:
+		symlinkInodeHeader,
+		devInodeHeader,
+		ipcInodeHeader:
 		return nil, nil // no extended attributes
 
 	case lregInodeHeader:
@@ -468,6 +1098,18 @@ func (r *Reader) ReadXattrs(inode Inode) ([]Xattr, error) {
 		}
 		xid = x.Xattr
 
+	case ldevInodeHeader:
+		if x.Xattr == invalidXattr {
+			return nil, nil // device has no extended attributes
+		}
+		xid = x.Xattr
+
+	case lipcInodeHeader:
+		if x.Xattr == invalidXattr {
+			return nil, nil // fifo or socket has no extended attributes
+		}
+		xid = x.Xattr
+
 	default:
 		return nil, fmt.Errorf("unknown inode type %T", i)
 	}
@@ -475,22 +1117,25 @@ func (r *Reader) ReadXattrs(inode Inode) ([]Xattr, error) {
 	const idEntriesPerBlock = 512 // = 8192 / 16 /* sizeof(xattrId) */
 	block := xid / idEntriesPerBlock
 	offset := (xid % idEntriesPerBlock) * 16
-	log.Printf("xattr id %d, block %d, offset %d", xid, block, offset)
-	log.Printf("r.super.XattrIdTableStart = 0x%x, r.super.XattrIdTableStart = %v", r.super.XattrIdTableStart, r.super.XattrIdTableStart)
-	br := io.Reader(io.NewSectionReader(r.r, r.super.XattrIdTableStart, int64(16 /* sizeof(xattrTableHeader) */ +(block+1)*4 /* sizeof(uint32) */)))
+	//log.Printf("xattr id %d, block %d, offset %d", xid, block, offset)
+	//log.Printf("r.super.XattrIdTableStart = 0x%x, r.super.XattrIdTableStart = %v", r.super.XattrIdTableStart, r.super.XattrIdTableStart)
+	br := io.Reader(io.NewSectionReader(r.r, r.super.XattrIdTableStart, int64(16 /* sizeof(xattrTableHeader) */ +(block+1)*8 /* sizeof(uint64) */)))
 	var tableHeader xattrTableHeader
 	if err := binary.Read(br, binary.LittleEndian, &tableHeader); err != nil {
 		return nil, err
 	}
+	if xid >= tableHeader.XattrIds {
+		return nil, fmt.Errorf("xattr id %d out of range (image has %d xattr ids)", xid, tableHeader.XattrIds)
+	}
 	// index starts here
-	if _, err := io.CopyN(ioutil.Discard, br, int64(block*4 /* sizeof(uint32) */)); err != nil {
+	if _, err := io.CopyN(ioutil.Discard, br, int64(block*8 /* sizeof(uint64) */)); err != nil {
 		return nil, err
 	}
-	var blockOffset uint32
+	var blockOffset uint64
 	if err := binary.Read(br, binary.LittleEndian, &blockOffset); err != nil {
 		return nil, err
 	}
-	log.Printf("blockOffset = 0x%x (%d)", blockOffset, blockOffset)
+	//log.Printf("blockOffset = 0x%x (%d)", blockOffset, blockOffset)
 	br, err = r.blockReader(int64(blockOffset), int64(offset))
 	if err != nil {
 		return nil, err
@@ -499,16 +1144,26 @@ func (r *Reader) ReadXattrs(inode Inode) ([]Xattr, error) {
 	if err := binary.Read(br, binary.LittleEndian, &id); err != nil {
 		return nil, err
 	}
-	log.Printf("id: %+v", id)
-	log.Printf("tableHeader: %+v (start 0x%x)", tableHeader, tableHeader.XattrTableStart)
+	//log.Printf("id: %+v", id)
+	//log.Printf("tableHeader: %+v (start 0x%x)", tableHeader, tableHeader.XattrTableStart)
+
+	// The key/value pairs precede the xattr id table, which limits their size:
+	tableSize := int64(blockOffset) - int64(tableHeader.XattrTableStart)
+	if err := r.checkSize("xattr table", tableSize); err != nil {
+		return nil, err
+	}
+	if int64(id.Count)*8 /* sizeof(Type+NameSize+ValSize) */ > tableSize {
+		return nil, fmt.Errorf("corrupt xattr id %d: %d xattrs exceed xattr table (%d bytes)", xid, id.Count, tableSize)
+	}
 
+	// The xattrs of an inode are stored consecutively:
+	blockoffset, xoffset := r.inode(Inode(id.Xattr))
+	br, err = r.blockReader(int64(tableHeader.XattrTableStart)+blockoffset, xoffset)
+	if err != nil {
+		return nil, err
+	}
 	var xattrs []Xattr
 	for i := 0; i < int(id.Count); i++ {
-		blockoffset, offset := r.inode(Inode(id.Xattr))
-		br, err = r.blockReader(int64(tableHeader.XattrTableStart)+blockoffset, offset)
-		if err != nil {
-			return nil, err
-		}
 		var typ, nameSize uint16
 		if err := binary.Read(br, binary.LittleEndian, &typ); err != nil {
 			return nil, err
@@ -516,21 +1171,24 @@ func (r *Reader) ReadXattrs(inode Inode) ([]Xattr, error) {
 		if err := binary.Read(br, binary.LittleEndian, &nameSize); err != nil {
 			return nil, err
 		}
-		log.Printf("type = %v, nameSize = %v", typ, nameSize)
+		//log.Printf("type = %v, nameSize = %v", typ, nameSize)
 		name := make([]byte, nameSize)
 		if _, err := io.ReadFull(br, name); err != nil {
 			return nil, err
 		}
-		log.Printf("name = %v", string(name))
+		//log.Printf("name = %v", string(name))
 		var valSize uint32
 		if err := binary.Read(br, binary.LittleEndian, &valSize); err != nil {
 			return nil, err
 		}
+		if int64(valSize) > tableSize {
+			return nil, fmt.Errorf("corrupt xattr id %d: value of %d bytes exceeds xattr table (%d bytes)", xid, valSize, tableSize)
+		}
 		val := make([]byte, valSize)
 		if _, err := io.ReadFull(br, val); err != nil {
 			return nil, err
 		}
-		log.Printf("val = %x", val)
+		//log.Printf("val = %x", val)
 		xattrs = append(xattrs, Xattr{
 			Type:     typ,
 			FullName: xattrPrefix[int(typ)] + string(name),
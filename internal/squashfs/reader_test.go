@@ -1,14 +1,19 @@
 package squashfs
 
 import (
+	"bytes"
 	"crypto/md5"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/orcaman/writerseeker"
+	"golang.org/x/sys/unix"
 )
 
 func cmpFileInfo(got os.FileInfo, want FileInfo) error {
@@ -344,3 +349,292 @@ func TestReadXattr(t *testing.T) {
 		}
 	}
 }
+
+// writeLargeDirImage returns a Reader for an image containing a directory
+// called “big” with n empty files, named so that they sort in creation order.
+func writeLargeDirImage(tb testing.TB, n int) *Reader {
+	tb.Helper()
+	buf := &writerseeker.WriterSeeker{}
+	writeLargeDir(tb, buf, n)
+	rd, err := NewReader(buf.BytesReader())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return rd
+}
+
+// largeDirImageFile is like writeLargeDirImage, but stores the image in a
+// temporary file (which the returned function removes), so that the Reader
+// uses mmap.
+func largeDirImageFile(tb testing.TB, n int) (*Reader, func()) {
+	tb.Helper()
+	f, err := ioutil.TempFile("", "squashfs-large-dir")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	writeLargeDir(tb, f, n)
+	rd, err := NewReader(f)
+	if err != nil {
+		cleanup()
+		tb.Fatal(err)
+	}
+	return rd, cleanup
+}
+
+func writeLargeDir(tb testing.TB, ws io.WriteSeeker, n int) {
+	tb.Helper()
+	w, err := NewWriter(ws, time.Now())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	big := w.Root.Directory("big", time.Now(), 0555, 0, 0)
+	for i := 0; i < n; i++ {
+		f, err := big.File(largeDirEntry(i), time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, 0, 0, nil)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := big.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := w.Root.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func largeDirEntry(i int) string {
+	return fmt.Sprintf("locale-entry-%05d", i)
+}
+
+func TestLookupLargeDirectory(t *testing.T) {
+	t.Parallel()
+
+	const n = 5000
+	rd := writeLargeDirImage(t, n)
+	dir, err := rd.LookupPath("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := rd.readInode(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ldir, ok := i.(ldirInodeHeader)
+	if !ok {
+		t.Fatalf("unexpected directory inode type: got %T, want ldirInodeHeader", i)
+	}
+	if ldir.Icount == 0 {
+		t.Fatalf("large directory has no directory index")
+	}
+
+	fis, err := rd.Readdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(fis), n; got != want {
+		t.Fatalf("unexpected number of directory entries: got %d, want %d", got, want)
+	}
+	for idx, fi := range fis {
+		if got, want := fi.Name(), largeDirEntry(idx); got != want {
+			t.Fatalf("unexpected directory entry %d: got %q, want %q", idx, got, want)
+		}
+		inode, err := rd.Lookup(dir, fi.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := inode, fi.Sys().(*FileInfo).Inode; got != want {
+			t.Fatalf("Lookup(%q) = %v, want %v", fi.Name(), got, want)
+		}
+	}
+
+	for _, name := range []string{
+		"a",                         // sorts before all entries
+		largeDirEntry(2500) + "-no", // sorts between entries
+		"z",                         // sorts after all entries
+	} {
+		if _, err := rd.Lookup(dir, name); err == nil {
+			t.Errorf("Lookup(%q) unexpectedly succeeded", name)
+		} else if _, ok := err.(*FileNotFoundError); !ok {
+			t.Errorf("Lookup(%q): unexpected error: %v", name, err)
+		}
+	}
+}
+
+func BenchmarkLookupLargeDirectory(b *testing.B) {
+	const n = 5000
+	rd := writeLargeDirImage(b, n)
+	dir, err := rd.LookupPath("big")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("Index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := rd.Lookup(dir, largeDirEntry(i%n)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Linear", func(b *testing.B) {
+		// Lookup as implemented before directory index support.
+		for i := 0; i < b.N; i++ {
+			fis, err := rd.readdir(dir, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+			name := largeDirEntry(i % n)
+			var found bool
+			for _, fi := range fis {
+				if fi.Name() == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				b.Fatalf("%q not found", name)
+			}
+		}
+	})
+}
+
+func TestConcurrentReader(t *testing.T) {
+	t.Parallel()
+
+	f, err := ioutil.TempFile("", "squashfs-concurrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := writeTestImage(f, false); err != nil {
+		t.Fatal(err)
+	}
+	rd, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rd.r.(*mmapReaderAt); !ok {
+		t.Errorf("Reader unexpectedly not using mmap: got %T", rd.r)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, entry := range testImageEntries(t) {
+				inode, err := rd.LookupPath(entry.path)
+				if err != nil {
+					errs <- err
+					return
+				}
+				in, err := rd.FileReader(inode)
+				if err != nil {
+					errs <- err
+					return
+				}
+				got, err := ioutil.ReadAll(in)
+				if err != nil {
+					errs <- err
+					return
+				}
+				want, err := ioutil.ReadAll(entry.contents)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(got, want) {
+					errs <- fmt.Errorf("path %q differs", entry.path)
+					return
+				}
+				if _, err := rd.Readdir(rd.RootInode()); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestReaderClose(t *testing.T) {
+	t.Parallel()
+
+	f, err := ioutil.TempFile("", "squashfs-close")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := writeTestImage(f, false); err != nil {
+		t.Fatal(err)
+	}
+	rd, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inode, err := rd.LookupPath("hellö wörld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := rd.FileReader(inode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rd.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(in); err == nil {
+		t.Errorf("reading from a closed Reader unexpectedly succeeded")
+	}
+	if err := rd.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func BenchmarkReaddirParallel(b *testing.B) {
+	rd, cleanup := largeDirImageFile(b, 5000)
+	defer cleanup()
+	dir, err := rd.LookupPath("big")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := rd.Readdir(dir); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkLookupPathParallel(b *testing.B) {
+	const n = 5000
+	rd, cleanup := largeDirImageFile(b, n)
+	defer cleanup()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			if _, err := rd.LookupPath("big/" + largeDirEntry(i%n)); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
@@ -0,0 +1,364 @@
+package squashfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+)
+
+// A CorruptionError describes an inconsistency found by Reader.Verify.
+type CorruptionError struct {
+	// Offset is the byte offset within the image at which the inconsistency
+	// was found, or -1 if it cannot be attributed to a specific location.
+	Offset int64
+
+	// Path is the path (within the image) of the affected inode, if any.
+	Path string
+
+	Err error
+}
+
+func (e *CorruptionError) Error() string {
+	var loc string
+	if e.Offset > -1 {
+		loc = fmt.Sprintf("offset %#x: ", e.Offset)
+	}
+	if e.Path != "" {
+		loc += fmt.Sprintf("%q: ", e.Path)
+	}
+	return loc + e.Err.Error()
+}
+
+func (e *CorruptionError) Unwrap() error { return e.Err }
+
+type verifier struct {
+	r        *Reader
+	problems []*CorruptionError
+
+	// fragSizes holds the uncompressed size of each fragment block, or -1 if
+	// the fragment block could not be read.
+	fragSizes []int64
+
+	inodes map[Inode]bool // all inodes reachable from the root directory
+}
+
+func (v *verifier) report(off int64, path string, format string, args ...interface{}) {
+	v.problems = append(v.problems, &CorruptionError{
+		Offset: off,
+		Path:   path,
+		Err:    fmt.Errorf(format, args...),
+	})
+}
+
+// Verify checks the structural integrity of the image: the superblock, the id,
+// fragment, export and xattr tables, the inode and directory tables (by
+// walking the entire directory tree) and every data and fragment block.
+//
+// Verify returns all inconsistencies found, i.e. an intact image results in
+// no CorruptionErrors.
+func (r *Reader) Verify() []*CorruptionError {
+	v := &verifier{
+		r:      r,
+		inodes: make(map[Inode]bool),
+	}
+	if !v.verifySuperblock() {
+		return v.problems // further checks would only result in noise
+	}
+	v.verifyIdTable()
+	v.verifyFragments()
+	v.verifyTree()
+	v.verifyExportTable()
+	return v.problems
+}
+
+// inRange reports whether the byte range [off, off+n) lies within the image
+// (as per the superblock).
+func (v *verifier) inRange(off, n int64) bool {
+	return off >= int64(binary.Size(superblock{})) && n >= 0 && off+n <= v.r.super.BytesUsed
+}
+
+func (v *verifier) verifySuperblock() bool {
+	sb := v.r.super
+	ok := true
+	if sb.Major != majorVersion || sb.Minor != minorVersion {
+		v.report(0, "", "unsupported SquashFS version %d.%d", sb.Major, sb.Minor)
+		ok = false
+	}
+	if sb.BlockLog > 20 || sb.BlockSize != 1<<sb.BlockLog || sb.BlockSize < 4096 {
+		v.report(0, "", "invalid block size %d (block log %d)", sb.BlockSize, sb.BlockLog)
+		ok = false
+	}
+	if _, err := decompressorFor(Compression(sb.Compression)); err != nil {
+		v.report(0, "", "%v", err)
+		ok = false
+	}
+
+	// Detect truncated images by reading the last byte.
+	if sb.BytesUsed < int64(binary.Size(superblock{})) {
+		v.report(0, "", "invalid image size %d", sb.BytesUsed)
+		return false
+	}
+	var last [1]byte
+	if _, err := v.r.r.ReadAt(last[:], sb.BytesUsed-1); err != nil {
+		v.report(sb.BytesUsed-1, "", "image truncated: superblock specifies %d bytes: %v", sb.BytesUsed, err)
+		ok = false
+	}
+
+	// The subsequent checks allocate and loop according to these counts:
+	for _, count := range []struct {
+		name string
+		n    int64
+		size int64 // minimum size of each entry within the image
+	}{
+		{"inodes", int64(sb.Inodes), int64(binary.Size(inodeHeader{}))},
+		{"fragments", int64(sb.Fragments), 16 /* sizeof(fragmentEntry) */},
+		{"ids", int64(sb.NoIds), 4 /* sizeof(uint32) */},
+	} {
+		if err := v.r.checkSize(count.name, count.n*count.size); err != nil {
+			v.report(0, "", "%v", err)
+			ok = false
+		}
+	}
+
+	for _, table := range []struct {
+		name     string
+		start    int64
+		optional bool
+	}{
+		{"inode table", sb.InodeTableStart, false},
+		{"directory table", sb.DirectoryTableStart, false},
+		{"fragment table", sb.FragmentTableStart, sb.Fragments == 0},
+		{"id table", sb.IdTableStart, false},
+		{"xattr id table", sb.XattrIdTableStart, true},
+		{"export table", sb.LookupTableStart, true},
+	} {
+		if table.optional && table.start == -1 {
+			continue
+		}
+		if !v.inRange(table.start, 0) {
+			v.report(0, "", "%s start %#x out of range", table.name, table.start)
+			ok = false
+		}
+	}
+	if sb.InodeTableStart >= sb.DirectoryTableStart {
+		v.report(0, "", "inode table (%#x) does not precede directory table (%#x)", sb.InodeTableStart, sb.DirectoryTableStart)
+		ok = false
+	}
+	return ok
+}
+
+// verifyLookupTable checks the index of a table consisting of entries of size
+// entrySize, stored in metadata blocks, and all of its metadata blocks.
+func (v *verifier) verifyLookupTable(name string, start, entries, entrySize int64) {
+	if err := v.r.checkSize(name, entries*entrySize); err != nil {
+		v.report(start, "", "%v", err)
+		return
+	}
+	perBlock := metadataBlockSize / entrySize
+	blocks := (entries + perBlock - 1) / perBlock
+	index := make([]uint64, blocks)
+	if err := binary.Read(io.NewSectionReader(v.r.r, start, blocks*8 /* sizeof(uint64) */), binary.LittleEndian, index); err != nil {
+		v.report(start, "", "reading %s index: %v", name, err)
+		return
+	}
+	for idx, blockOffset := range index {
+		n := entries - int64(idx)*perBlock
+		if n > perBlock {
+			n = perBlock
+		}
+		b, err := v.r.metadataBlock(int64(blockOffset))
+		if err != nil {
+			v.report(int64(blockOffset), "", "reading %s block %d: %v", name, idx, err)
+			continue
+		}
+		if got, want := int64(len(b.data)), n*entrySize; got < want {
+			v.report(int64(blockOffset), "", "%s block %d too short: got %d bytes, want %d", name, idx, got, want)
+		}
+	}
+}
+
+func (v *verifier) verifyIdTable() {
+	v.verifyLookupTable("id table", v.r.super.IdTableStart, int64(v.r.super.NoIds), 4 /* sizeof(uint32) */)
+}
+
+func (v *verifier) verifyFragments() {
+	sb := v.r.super
+	if sb.Fragments == 0 {
+		return
+	}
+	fragments, err := v.r.readFragmentTable()
+	if err != nil {
+		v.report(sb.FragmentTableStart, "", "%v", err)
+		return
+	}
+	buf := make([]byte, sb.BlockSize)
+	v.fragSizes = make([]int64, len(fragments))
+	for idx, entry := range fragments {
+		v.fragSizes[idx] = -1
+		if entry.Size == 0 {
+			v.report(int64(entry.Start), "", "fragment block %d has size 0", idx)
+			continue
+		}
+		if !v.inRange(int64(entry.Start), int64(entry.Size&^dataBlockUncompressed)) {
+			v.report(int64(entry.Start), "", "fragment block %d out of range", idx)
+			continue
+		}
+		n, err := v.r.readDataBlock(buf, int64(entry.Start), entry.Size)
+		if err != nil {
+			v.report(int64(entry.Start), "", "reading fragment block %d: %v", idx, err)
+			continue
+		}
+		v.fragSizes[idx] = int64(n)
+	}
+}
+
+func (v *verifier) verifyExportTable() {
+	sb := v.r.super
+	if sb.LookupTableStart == -1 {
+		return
+	}
+	v.verifyLookupTable("export table", sb.LookupTableStart, int64(sb.Inodes), 8 /* sizeof(Inode) */)
+	for num := uint32(1); num <= sb.Inodes; num++ {
+		inode, err := v.r.InodeByNumber(num)
+		if err != nil {
+			v.report(sb.LookupTableStart, "", "export table: inode %d: %v", num, err)
+			return // the remaining entries are likely affected as well
+		}
+		if !v.inodes[inode] {
+			v.report(sb.LookupTableStart, "", "export table: inode %d refers to unreachable inode %#x", num, inode)
+			continue
+		}
+		i, err := v.r.readInode(inode)
+		if err != nil {
+			continue // already reported by verifyTree
+		}
+		if got := i.(interface{ header() inodeHeader }).header().InodeNumber; got != num {
+			v.report(sb.LookupTableStart, "", "export table: inode %d refers to inode number %d", num, got)
+		}
+	}
+}
+
+// inodeOffset returns the location of inode within the image.
+func (v *verifier) inodeOffset(inode Inode) int64 {
+	blockoffset, _ := v.r.inode(inode)
+	return v.r.super.InodeTableStart + blockoffset
+}
+
+func (v *verifier) verifyTree() {
+	v.verifyInode(".", v.r.RootInode(), true)
+	if got, want := len(v.inodes), int(v.r.super.Inodes); got != want {
+		v.report(-1, "", "found %d inodes, superblock specifies %d", got, want)
+	}
+}
+
+func (v *verifier) verifyInode(name string, inode Inode, wantDir bool) {
+	if v.inodes[inode] {
+		if wantDir {
+			v.report(v.inodeOffset(inode), name, "directory %#x is referenced more than once", inode)
+		}
+		return // hard link to a verified inode
+	}
+	v.inodes[inode] = true
+	i, err := v.r.readInode(inode)
+	if err != nil {
+		v.report(v.inodeOffset(inode), name, "reading inode: %v", err)
+		return
+	}
+	if h := i.(interface{ header() inodeHeader }).header(); int(h.Uid) >= int(v.r.super.NoIds) || int(h.Gid) >= int(v.r.super.NoIds) {
+		v.report(v.inodeOffset(inode), name, "owner %d:%d out of range (image has %d ids)", h.Uid, h.Gid, v.r.super.NoIds)
+	}
+	if _, err := v.r.ReadXattrs(inode); err != nil {
+		v.report(v.inodeOffset(inode), name, "reading xattrs: %v", err)
+	}
+	switch i.(type) {
+	case dirInodeHeader, ldirInodeHeader:
+		v.verifyDir(name, inode)
+	case regInodeHeader, lregInodeHeader:
+		if wantDir {
+			v.report(v.inodeOffset(inode), name, "not a directory")
+		}
+		v.verifyFile(name, inode)
+	case symlinkInodeHeader:
+		if wantDir {
+			v.report(v.inodeOffset(inode), name, "not a directory")
+		}
+		if _, err := v.r.ReadLink(inode); err != nil {
+			v.report(v.inodeOffset(inode), name, "reading symlink target: %v", err)
+		}
+	default:
+		if wantDir {
+			v.report(v.inodeOffset(inode), name, "not a directory")
+		}
+	}
+}
+
+func (v *verifier) verifyDir(name string, inode Inode) {
+	br, err := v.r.dirListing(inode, "")
+	if err != nil {
+		v.report(v.inodeOffset(inode), name, "reading directory: %v", err)
+		return
+	}
+	type entry struct {
+		name  string
+		inode Inode
+	}
+	var entries []entry
+	if err := walkDirListing(br, func(name string, inode Inode) bool {
+		entries = append(entries, entry{name, inode})
+		return true
+	}); err != nil {
+		v.report(v.inodeOffset(inode), name, "reading directory listing: %v", err)
+	}
+	for idx, e := range entries {
+		if idx > 0 && entries[idx-1].name >= e.name {
+			v.report(v.inodeOffset(inode), name, "directory entries not sorted: %q follows %q", e.name, entries[idx-1].name)
+		}
+		fi, err := v.r.Stat(e.name, e.inode)
+		isDir := err == nil && fi.IsDir()
+		v.verifyInode(path.Join(name, e.name), e.inode, isDir)
+	}
+}
+
+func (v *verifier) verifyFile(name string, inode Inode) {
+	l, err := v.r.fileLayout(inode)
+	if err != nil {
+		v.report(v.inodeOffset(inode), name, "reading block list: %v", err)
+		return
+	}
+	blockSize := int64(v.r.super.BlockSize)
+	buf := make([]byte, blockSize)
+	off := l.startBlock
+	for idx, size := range l.blocksizes {
+		if size == 0 {
+			continue // sparse block
+		}
+		want := blockSize
+		if rest := l.fileSize - int64(idx)*blockSize; rest < want {
+			want = rest
+		}
+		onDisk := int64(size &^ dataBlockUncompressed)
+		if !v.inRange(off, onDisk) || off+onDisk > v.r.super.InodeTableStart {
+			v.report(off, name, "data block %d (%d bytes) out of range", idx, onDisk)
+			return // subsequent blocks are out of range, too
+		}
+		n, err := v.r.readDataBlock(buf, off, size)
+		if err != nil {
+			v.report(off, name, "reading data block %d: %v", idx, err)
+		} else if int64(n) != want {
+			v.report(off, name, "data block %d has %d bytes, want %d", idx, n, want)
+		}
+		off += onDisk
+	}
+	if l.fragment == invalidFragment {
+		return
+	}
+	tail := l.fileSize % blockSize
+	if int(l.fragment) >= len(v.fragSizes) {
+		v.report(v.inodeOffset(inode), name, "fragment %d out of range (image has %d fragments)", l.fragment, len(v.fragSizes))
+		return
+	}
+	if fragSize := v.fragSizes[l.fragment]; fragSize > -1 && int64(l.fragOffset)+tail > fragSize {
+		v.report(v.inodeOffset(inode), name, "tail end at %d+%d exceeds fragment block %d (%d bytes)", l.fragOffset, tail, l.fragment, fragSize)
+	}
+}
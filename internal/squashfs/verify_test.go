@@ -0,0 +1,155 @@
+package squashfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/orcaman/writerseeker"
+)
+
+func testImageBytes(t *testing.T, opts ...WriterOption) []byte {
+	t.Helper()
+	var ws writerseeker.WriterSeeker
+	if err := writeTestImage(&ws, true, opts...); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(ws.Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range testImageVariants() {
+		tt := tt // copy
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var ws writerseeker.WriterSeeker
+			if err := writeTestImage(&ws, tt.xattr, tt.opts...); err != nil {
+				t.Fatal(err)
+			}
+			rd, err := NewReader(ws.BytesReader())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, problem := range rd.Verify() {
+				t.Errorf("Verify: %v", problem)
+			}
+		})
+	}
+}
+
+func TestVerifyCorruptDataBlock(t *testing.T) {
+	t.Parallel()
+
+	b := testImageBytes(t, WithCompression(ZlibCompression))
+	rd, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inode, err := rd.LookupPath("testbin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := rd.fileLayout(inode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.blocksizes[0]&dataBlockUncompressed != 0 {
+		t.Fatalf("first data block of testbin unexpectedly stored uncompressed")
+	}
+	// Garble the middle of the first (compressed) data block.
+	off := l.startBlock + int64(l.blocksizes[0])/2
+	for i := int64(0); i < 16; i++ {
+		b[off+i] ^= 0xff
+	}
+
+	rd, err = NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := rd.Verify()
+	if len(problems) == 0 {
+		t.Fatalf("Verify unexpectedly found no problems in corrupted image")
+	}
+	var found bool
+	for _, problem := range problems {
+		t.Logf("problem: %v", problem)
+		if problem.Offset == l.startBlock && problem.Path == "testbin" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Verify did not report corrupted data block at offset %#x of testbin", l.startBlock)
+	}
+}
+
+func TestVerifyTruncated(t *testing.T) {
+	t.Parallel()
+
+	b := testImageBytes(t)
+	rd, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Images are padded to 4096 bytes, so cut off more than the padding.
+	rd, err = NewReader(bytes.NewReader(b[:rd.super.BytesUsed-100]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := rd.Verify()
+	if len(problems) == 0 {
+		t.Fatalf("Verify unexpectedly found no problems in truncated image")
+	}
+	if got, want := problems[0].Error(), "image truncated"; !strings.Contains(got, want) {
+		t.Errorf("Verify: got %q, want a problem containing %q", got, want)
+	}
+}
+
+// TestVerifyBitFlips flips one bit in every byte of the metadata (inode,
+// directory, fragment, id and xattr tables). Verify must report such
+// corruption (unless it is inconsequential, e.g. in a modification time)
+// instead of crashing, allocating excessive amounts of memory or looping
+// endlessly.
+func TestVerifyBitFlips(t *testing.T) {
+	// Not parallel: memory usage is measured.
+
+	b := testImageBytes(t)
+	rd, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const maxAlloc = 64 << 20 // generous: the image is much smaller
+	for off := rd.super.InodeTableStart; off < rd.super.BytesUsed; off++ {
+		bit := uint(off % 8)
+		b[off] ^= 1 << bit
+		rd, err := NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			rd.Verify()
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Verify did not return after flipping bit %d at offset %#x", bit, off)
+		}
+		runtime.ReadMemStats(&after)
+		if alloc := after.TotalAlloc - before.TotalAlloc; alloc > maxAlloc {
+			t.Errorf("Verify allocated %d bytes after flipping bit %d at offset %#x", alloc, bit, off)
+		}
+		b[off] ^= 1 << bit // restore
+	}
+}
@@ -1,23 +1,30 @@
-// Package squashfs implements writing SquashFS file system images using zlib
-// compression for data blocks (inodes and directory entries are written
-// uncompressed for simplicity).
+// Package squashfs implements writing SquashFS file system images, optionally
+// using zlib or lz4 compression for data blocks (inodes and directory entries
+// are written uncompressed for simplicity).
 //
 // Note that SquashFS requires directory entries to be sorted, i.e. files and
 // directories need to be added in the correct order.
 //
+// Files with identical contents are stored only once.
+//
 // This package intentionally only implements a subset of SquashFS. Notably,
-// block devices, character devices, FIFOs, sockets and xattrs are not
-// supported.
+// xattrs are not supported.
 package squashfs
 
 import (
 	"bytes"
-	"compress/zlib"
+	"crypto/sha256"
 	"encoding/binary"
+	"fmt"
+	"hash"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/sys/unix"
@@ -26,14 +33,6 @@ import (
 // inode contains a block number + offset within that block.
 type Inode int64
 
-const (
-	zlibCompression = 1 + iota
-	lzmaCompression
-	lzoCompression
-	xzCompression
-	lz4Compression
-)
-
 const (
 	invalidFragment = 0xFFFFFFFF
 	invalidXattr    = 0xFFFFFFFF
@@ -80,14 +79,18 @@ const (
 )
 
 type inodeHeader struct {
-	InodeType   uint16
-	Mode        uint16
+	InodeType uint16
+	Mode      uint16
+	// Uid and Gid are indexes into the id table.
 	Uid         uint16
 	Gid         uint16
 	Mtime       int32
 	InodeNumber uint32
 }
 
+// header returns the inode header which all inode types embed.
+func (h inodeHeader) header() inodeHeader { return h }
+
 // fileType
 type regInodeHeader struct {
 	inodeHeader
@@ -139,6 +142,13 @@ type devInodeHeader struct {
 	Rdev  uint32
 }
 
+// lchrdevType and lblkdevType
+type ldevInodeHeader struct {
+	devInodeHeader
+
+	Xattr uint32
+}
+
 // fifoType and socketType
 type ipcInodeHeader struct {
 	inodeHeader
@@ -146,6 +156,44 @@ type ipcInodeHeader struct {
 	Nlink uint32
 }
 
+// lfifoType and lsocketType
+type lipcInodeHeader struct {
+	ipcInodeHeader
+
+	Xattr uint32
+}
+
+// encodeDev converts a Linux device number (as returned by unix.Mkdev) to the
+// 32-bit encoding stored in SquashFS, see new_encode_dev in
+// include/linux/kdev_t.h.
+func encodeDev(dev uint64) uint32 {
+	major, minor := unix.Major(dev), unix.Minor(dev)
+	return (minor & 0xff) | (major << 8) | ((minor &^ 0xff) << 12)
+}
+
+// decodeDev is the inverse of encodeDev.
+func decodeDev(dev uint32) uint64 {
+	major := (dev & 0xfff00) >> 8
+	minor := (dev & 0xff) | ((dev >> 12) & 0xfff00)
+	return unix.Mkdev(major, minor)
+}
+
+// encodeMode converts the permission bits of mode, including the setuid, setgid
+// and sticky bits, to the Unix mode bits stored in an inode header.
+func encodeMode(mode os.FileMode) uint16 {
+	m := uint16(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= unix.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= unix.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= unix.S_ISVTX
+	}
+	return m
+}
+
 // dirType
 type dirInodeHeader struct {
 	inodeHeader
@@ -170,12 +218,32 @@ type ldirInodeHeader struct {
 	Xattr       uint32
 }
 
+// fragmentEntry describes a fragment block, i.e. a data block holding the
+// tail ends of multiple files.
+type fragmentEntry struct {
+	Start  uint64
+	Size   uint32
+	Unused uint32
+}
+
 type dirHeader struct {
 	Count       uint32
 	StartBlock  uint32
 	InodeOffset uint32
 }
 
+// dirIndex follows an ldirInodeHeader (Icount times) and points to a directory
+// header within the directory listing, so that lookups can skip over
+// preceding entries.
+type dirIndex struct {
+	Index      uint32 // byte offset of the directory header within the listing
+	StartBlock uint32 // metadata block containing the directory header
+	Size       uint32
+
+	// Followed by a byte array of Size + 1 bytes: the name of the first entry
+	// following the directory header.
+}
+
 type dirEntry struct {
 	Offset      uint16
 	InodeNumber int16
@@ -204,7 +272,9 @@ type Xattr struct {
 	Value    []byte
 }
 
-func XattrFromAttr(attr string, val []byte) Xattr {
+// XattrFromAttr converts the extended attribute attr with value val. It
+// returns false if attr uses a prefix (namespace) which SquashFS cannot store.
+func XattrFromAttr(attr string, val []byte) (Xattr, bool) {
 	for typ, prefix := range xattrPrefix {
 		if !strings.HasPrefix(attr, prefix) {
 			continue
@@ -213,9 +283,9 @@ func XattrFromAttr(attr string, val []byte) Xattr {
 			Type:     uint16(typ),
 			FullName: strings.TrimPrefix(attr, prefix),
 			Value:    val,
-		}
+		}, true
 	}
-	return Xattr{}
+	return Xattr{}, false
 }
 
 type xattrId struct {
@@ -224,29 +294,6 @@ type xattrId struct {
 	Size  uint32
 }
 
-func writeIdTable(w io.WriteSeeker, ids []uint32) (start int64, err error) {
-	metaOff, err := w.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return 0, err
-	}
-	var buf bytes.Buffer
-	if err := binary.Write(&buf, binary.LittleEndian, ids); err != nil {
-		return 0, err
-	}
-
-	if err := binary.Write(w, binary.LittleEndian, uint16(buf.Len())|0x8000); err != nil {
-		return 0, err
-	}
-	if _, err := io.Copy(w, &buf); err != nil {
-		return 0, err
-	}
-	off, err := w.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return 0, err
-	}
-	return off, binary.Write(w, binary.LittleEndian, metaOff)
-}
-
 type fullDirEntry struct {
 	startBlock  uint32
 	offset      uint16
@@ -263,6 +310,13 @@ const (
 	minorVersion      = 0
 )
 
+// dataBlockUncompressed is set in data block size entries for blocks which are
+// stored uncompressed (SQUASHFS_COMPRESSED_BIT_BLOCK).
+const dataBlockUncompressed = 1 << 24
+
+// zeroBlock is compared against data blocks to detect sparse blocks.
+var zeroBlock [dataBlockSize]byte
+
 type Writer struct {
 	// Root represents the file system root. Like all directories, Flush must be
 	// called precisely once.
@@ -271,13 +325,71 @@ type Writer struct {
 	xattrs   []Xattr
 	xattrIds []xattrId
 
+	// ids is the uid/gid lookup table, idIndex maps each id to its index
+	// within ids.
+	ids     []uint32
+	idIndex map[uint32]uint16
+
 	w io.WriteSeeker
 
 	sb       superblock
 	inodeBuf bytes.Buffer
 	dirBuf   bytes.Buffer
 
+	// comp is non-nil if data blocks are compressed. As compressors are not
+	// safe for concurrent use, compressors holds one per compressing
+	// goroutine.
+	comp        compressor
+	compressors sync.Pool
+
+	// parallelism is the maximum number of data blocks compressed
+	// concurrently, see WithParallelism. pending holds the blocks submitted
+	// for compression which were not yet written, in submission order.
+	parallelism int
+	pending     []*dataBlock
+
+	// fragBuf accumulates file tails (smaller than dataBlockSize) until the
+	// next tail does not fit anymore, at which point it is written as a
+	// fragment block.
+	fragBuf   bytes.Buffer
+	fragments []fragmentEntry
+
+	// contents maps the SHA-256 hash of the contents of all files written so
+	// far to their location, so that duplicate files can share data. Because
+	// SquashFS requires the data blocks of a file to be stored back to back,
+	// only entire files (not individual blocks) can be deduplicated.
+	contents map[[sha256.Size]byte]*fileContents
+
+	// fileInodes lists all file inodes written so far. Their data block
+	// locations are only known once all blocks were written, so they are
+	// filled in by Flush.
+	fileInodes []fileInode
+
 	writeInodeNumTo map[string][]int64
+
+	// links maps the path of all non-directory inodes written so far to their
+	// inode, so that hard links can refer to them.
+	links map[string]*linkTarget
+
+	// inodeRefs contains the location of all inodes written so far, indexed by
+	// inode number - 1.
+	inodeRefs []Inode
+	// exportTable is set by WithExportTable.
+	exportTable bool
+
+	// sourceDateEpoch is set by WithSourceDateEpoch.
+	reproducible    bool
+	sourceDateEpoch time.Time
+}
+
+// linkTarget is an inode which hard links can refer to.
+type linkTarget struct {
+	startBlock  uint32
+	offset      uint16
+	inodeNumber uint32
+	entryType   uint16
+	nlink       uint32
+	nlinkOffset int // of the Nlink field within the inode table
 }
 
 // TODO: document what this is doing and what it is used for
@@ -290,23 +402,113 @@ func slog(block uint32) uint16 {
 	return 0
 }
 
+// superblock flags
+const (
+	noI = 1 << iota // uncompressed metadata
+	noD             // uncompressed data
+	_
+	noF               // uncompressed fragments
+	noFrag            // never use fragments
+	alwaysFrag        // always use fragments
+	duplicateChecking // de-duplication
+	exportable        // exportable via NFS
+	noX               // uncompressed xattrs
+	noXattr           // no xattrs
+	compopt           // compressor-specific options present?
+)
+
 // filesystemFlags returns flags for a SquashFS file system created by this
 // package (disabling most features for now).
 func filesystemFlags() uint16 {
-	const (
-		noI = 1 << iota // uncompressed metadata
-		noD             // uncompressed data
-		_
-		noF               // uncompressed fragments
-		noFrag            // never use fragments
-		alwaysFrag        // always use fragments
-		duplicateChecking // de-duplication
-		exportable        // exportable via NFS
-		noX               // uncompressed xattrs
-		noXattr           // no xattrs
-		compopt           // compressor-specific options present?
-	)
-	return noI | noF | noFrag | noX | noXattr
+	return noI | noF | noX | noXattr | duplicateChecking
+}
+
+// A WriterOption configures optional behavior of a Writer.
+type WriterOption func(*Writer) error
+
+// WithCompression makes the Writer compress data blocks using c. Blocks which
+// do not get smaller when compressed are stored uncompressed.
+//
+// Without this option, all data blocks are stored uncompressed.
+func WithCompression(c Compression) WriterOption {
+	return func(w *Writer) error {
+		comp, err := newCompressor(c)
+		if err != nil {
+			return err
+		}
+		w.comp = comp
+		w.compressors.Put(comp)
+		w.compressors.New = func() interface{} {
+			comp, _ := newCompressor(c) // cannot fail, c was checked above
+			return comp
+		}
+		w.sb.Compression = uint16(c)
+		w.sb.Flags &^= noF // fragment blocks are compressed like data blocks
+		return nil
+	}
+}
+
+// WithParallelism makes the Writer compress up to n data blocks concurrently
+// (only relevant when combined with WithCompression). The resulting image is
+// identical regardless of n. With n <= 1, blocks are compressed on the
+// goroutine calling Write.
+//
+// Without this option, runtime.GOMAXPROCS(0) blocks are compressed
+// concurrently.
+func WithParallelism(n int) WriterOption {
+	return func(w *Writer) error {
+		w.parallelism = n
+		return nil
+	}
+}
+
+// WithExportTable makes the Writer write an inode lookup table (also called
+// export table), which is required for exporting the file system via NFS or
+// using open_by_handle_at(2) on it, and which Reader.InodeByNumber uses.
+func WithExportTable() WriterOption {
+	return func(w *Writer) error {
+		w.exportTable = true
+		w.sb.Flags |= exportable
+		return nil
+	}
+}
+
+// WithSourceDateEpoch makes the Writer produce reproducible images, as per
+// https://reproducible-builds.org/specs/source-date-epoch/: the mkfs time and
+// all modification times later than epoch are clamped to epoch, and the
+// permissions of files, directories, device nodes, FIFOs, sockets and symbolic
+// links are normalized to 0755 (executable or directory), 0644 (not executable)
+// or 0777 (symbolic links). Setuid, setgid and sticky bits are kept. Owners are
+// stored as specified: mapping build-specific owners is up to the caller.
+func WithSourceDateEpoch(epoch time.Time) WriterOption {
+	return func(w *Writer) error {
+		w.reproducible = true
+		w.sourceDateEpoch = epoch
+		w.sb.MkfsTime = w.mtime(time.Unix(int64(w.sb.MkfsTime), 0))
+		return nil
+	}
+}
+
+// mtime returns the modification time to store for t, see
+// WithSourceDateEpoch.
+func (w *Writer) mtime(t time.Time) int32 {
+	if w.reproducible && t.After(w.sourceDateEpoch) {
+		t = w.sourceDateEpoch
+	}
+	return int32(t.Unix())
+}
+
+// fileMode returns the mode to store for a file, directory, device node, FIFO
+// or socket of the specified mode, see WithSourceDateEpoch.
+func (w *Writer) fileMode(mode uint16) uint16 {
+	if !w.reproducible {
+		return mode
+	}
+	perm := uint16(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	return mode&^0777 | perm
 }
 
 // NewWriter returns a Writer which will write a SquashFS file system image to w
@@ -316,12 +518,7 @@ func filesystemFlags() uint16 {
 // directory of the Writer.
 //
 // File data is written to w even before Flush is called.
-func NewWriter(w io.WriteSeeker, mkfsTime time.Time) (*Writer, error) {
-	// Skip over superblock to the data area, we come back to the superblock
-	// when flushing.
-	if _, err := w.Seek(96, io.SeekStart); err != nil {
-		return nil, err
-	}
+func NewWriter(w io.WriteSeeker, mkfsTime time.Time, opts ...WriterOption) (*Writer, error) {
 	wr := &Writer{
 		w: w,
 		sb: superblock{
@@ -329,21 +526,45 @@ func NewWriter(w io.WriteSeeker, mkfsTime time.Time) (*Writer, error) {
 			MkfsTime:          int32(mkfsTime.Unix()),
 			BlockSize:         dataBlockSize,
 			Fragments:         0,
-			Compression:       zlibCompression,
+			Compression:       uint16(ZlibCompression),
 			BlockLog:          slog(dataBlockSize),
 			Flags:             filesystemFlags(),
-			NoIds:             1, // just one uid/gid mapping (for root)
 			Major:             majorVersion,
 			Minor:             minorVersion,
 			XattrIdTableStart: -1, // not present
 			LookupTableStart:  -1, // not present
 		},
 		writeInodeNumTo: make(map[string][]int64),
+		contents:        make(map[[sha256.Size]byte]*fileContents),
+		parallelism:     runtime.GOMAXPROCS(0),
+		links:           make(map[string]*linkTarget),
+		// root (0) is always present, and most images need no other ids.
+		ids:     []uint32{0},
+		idIndex: map[uint32]uint16{0: 0},
+	}
+	for _, opt := range opts {
+		if err := opt(wr); err != nil {
+			return nil, err
+		}
 	}
+
+	// Skip over superblock to the data area, we come back to the superblock
+	// when flushing.
+	if _, err := w.Seek(96, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if opts := compressorOptions(Compression(wr.sb.Compression)); wr.comp != nil && opts != nil {
+		wr.sb.Flags |= compopt
+		if err := wr.writeMetadataChunks(bytes.NewReader(opts)); err != nil {
+			return nil, err
+		}
+	}
+
 	wr.Root = &Directory{
 		w:       wr,
 		name:    "", // root
 		modTime: mkfsTime,
+		mode:    0755,
 	}
 	return wr, nil
 }
@@ -353,10 +574,40 @@ type Directory struct {
 	w          *Writer
 	name       string
 	modTime    time.Time
+	mode       os.FileMode
+	uid, gid   uint32
 	dirEntries []fullDirEntry
 	parent     *Directory
 }
 
+// id returns the index of the user or group id within the id table, adding id
+// to the table if necessary.
+func (w *Writer) id(id uint32) (uint16, error) {
+	if idx, ok := w.idIndex[id]; ok {
+		return idx, nil
+	}
+	if len(w.ids) >= math.MaxUint16 {
+		return 0, fmt.Errorf("too many distinct user and group ids (at most %d are supported)", math.MaxUint16)
+	}
+	idx := uint16(len(w.ids))
+	w.ids = append(w.ids, id)
+	w.idIndex[id] = idx
+	return idx, nil
+}
+
+// owner returns the id table indexes of uid and gid.
+func (w *Writer) owner(uid, gid uint32) (uidIdx, gidIdx uint16, _ error) {
+	uidIdx, err := w.id(uid)
+	if err != nil {
+		return 0, 0, err
+	}
+	gidIdx, err = w.id(gid)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uidIdx, gidIdx, nil
+}
+
 func (d *Directory) path() string {
 	if d.parent == nil {
 		return d.name
@@ -365,97 +616,139 @@ func (d *Directory) path() string {
 }
 
 type file struct {
-	w       *Writer
-	d       *Directory
-	off     int64
-	size    uint32
-	name    string
-	modTime time.Time
-	mode    uint16
+	w        *Writer
+	d        *Directory
+	contents *fileContents
+	size     uint32
+	name     string
+	modTime  time.Time
+	mode     uint16
+	uid, gid uint16 // id table indexes
 
 	// buf accumulates at least dataBlockSize bytes, at which point a new block
 	// is being written.
 	buf bytes.Buffer
 
-	// blocksizes stores, for each block of dataBlockSize bytes (uncompressed),
-	// the number of bytes the block compressed down to.
-	blocksizes []uint32
+	// blocks is the number of data blocks submitted so far, not counting
+	// sparse blocks.
+	blocks int
 
-	// compBuf is used for holding a block during compression to avoid memory
-	// allocations.
-	compBuf *bytes.Buffer
-	// zlibWriter is re-used for each compressed block
-	zlibWriter *zlib.Writer
+	// hash is fed all contents written to the file, for deduplication.
+	hash hash.Hash
 
 	xattrRef uint32
 }
 
-// Directory creates a new directory with the specified name and modTime.
-func (d *Directory) Directory(name string, modTime time.Time) *Directory {
+// fileContents describes where the contents of a file were stored.
+// startBlock and blocksizes are filled in as data blocks are written.
+type fileContents struct {
+	startBlock int64
+	// blocksizes stores, for each block of dataBlockSize bytes
+	// (uncompressed), its SquashFS block size entry. Sparse blocks (all
+	// zeros) are not stored and have a block size entry of 0.
+	blocksizes []uint32
+	sparse     uint64 // number of bytes in sparse blocks
+	fragment   uint32
+	fragOffset uint32
+}
+
+// fileInode locates a file inode within the Writer’s inodeBuf.
+type fileInode struct {
+	offset   int
+	contents *fileContents
+}
+
+// Directory creates a new directory with the specified name, modTime, mode and
+// owner.
+func (d *Directory) Directory(name string, modTime time.Time, mode os.FileMode, uid, gid uint32) *Directory {
 	return &Directory{
 		w:       d.w,
 		name:    name,
 		modTime: modTime,
+		mode:    mode,
+		uid:     uid,
+		gid:     gid,
 		parent:  d,
 	}
 }
 
-// File creates a file with the specified name, modTime and mode. The returned
-// io.WriterCloser must be closed after writing the file.
-func (d *Directory) File(name string, modTime time.Time, mode uint16, xattrs []Xattr) (io.WriteCloser, error) {
-	off, err := d.w.w.Seek(0, io.SeekCurrent)
+// File creates a file with the specified name, modTime, mode and owner. The
+// returned io.WriterCloser must be closed after writing the file.
+func (d *Directory) File(name string, modTime time.Time, mode uint16, uid, gid uint32, xattrs []Xattr) (io.WriteCloser, error) {
+	uidIdx, gidIdx, err := d.w.owner(uid, gid)
 	if err != nil {
 		return nil, err
 	}
-
-	// zlib.BestSpeed results in only a 2x slow-down over no compression
-	// (compared to >4x slow-down with DefaultCompression), but generates
-	// results which are in the same ball park (10% larger).
-	zw, err := zlib.NewWriterLevel(nil, zlib.BestSpeed)
-	if err != nil {
+	contents := &fileContents{fragment: invalidFragment}
+	// The file starts wherever the previously submitted blocks end.
+	if err := d.w.submitBlock(nil, func(off int64, _ uint32) {
+		contents.startBlock = off
+	}); err != nil {
 		return nil, err
 	}
 
 	xattrRef := uint32(invalidXattr)
 	if len(xattrs) > 0 {
-		xattrRef = uint32(len(d.w.xattrs))
-		d.w.xattrs = append(d.w.xattrs, xattrs[0]) // TODO: support multiple
-		size := len(xattrs[0].FullName) + len(xattrs[0].Value)
+		// Store the xattrs independently of the order in which the file system
+		// listed them, so that images are reproducible.
+		xattrs = append([]Xattr(nil), xattrs...)
+		sort.Slice(xattrs, func(i, j int) bool {
+			if xattrs[i].Type != xattrs[j].Type {
+				return xattrs[i].Type < xattrs[j].Type
+			}
+			return xattrs[i].FullName < xattrs[j].FullName
+		})
+		xattrRef = uint32(len(d.w.xattrIds))
+		d.w.xattrs = append(d.w.xattrs, xattrs...)
+		var size int
+		for _, attr := range xattrs {
+			size += len(attr.FullName) + len(attr.Value)
+		}
 		d.w.xattrIds = append(d.w.xattrIds, xattrId{
 			// Xattr is populated in writeXattrTables
-			Count: 1, // TODO: support multiple
+			Count: uint32(len(xattrs)),
 			Size:  uint32(size),
 		})
 	}
 	return &file{
-		w:          d.w,
-		d:          d,
-		off:        off,
-		name:       name,
-		modTime:    modTime,
-		mode:       mode,
-		compBuf:    bytes.NewBuffer(make([]byte, dataBlockSize)),
-		zlibWriter: zw,
-		xattrRef:   xattrRef,
+		w:        d.w,
+		d:        d,
+		contents: contents,
+		name:     name,
+		modTime:  modTime,
+		mode:     mode,
+		uid:      uidIdx,
+		gid:      gidIdx,
+		hash:     sha256.New(),
+		xattrRef: xattrRef,
 	}, nil
 }
 
 // Symlink creates a symbolic link from newname to oldname with the specified
-// modTime and mode.
-func (d *Directory) Symlink(oldname, newname string, modTime time.Time, mode os.FileMode) error {
+// modTime, mode and owner.
+func (d *Directory) Symlink(oldname, newname string, modTime time.Time, mode os.FileMode, uid, gid uint32) error {
+	symlinkMode := uint16(mode)
+	if d.w.reproducible {
+		symlinkMode = 0777
+	}
+	uidIdx, gidIdx, err := d.w.owner(uid, gid)
+	if err != nil {
+		return err
+	}
 	startBlock := d.w.inodeBuf.Len() / metadataBlockSize
 	offset := d.w.inodeBuf.Len() - startBlock*metadataBlockSize
+	inodeBufOffset := d.w.inodeBuf.Len()
 
 	if err := binary.Write(&d.w.inodeBuf, binary.LittleEndian, symlinkInodeHeader{
 		inodeHeader: inodeHeader{
 			InodeType:   symlinkType,
-			Mode:        uint16(mode),
-			Uid:         0,
-			Gid:         0,
-			Mtime:       int32(modTime.Unix()),
+			Mode:        symlinkMode,
+			Uid:         uidIdx,
+			Gid:         gidIdx,
+			Mtime:       d.w.mtime(modTime),
 			InodeNumber: d.w.sb.Inodes + 1,
 		},
-		Nlink:       1, // TODO(later): when is this not 1?
+		Nlink:       1, // incremented by Link
 		SymlinkSize: uint32(len(oldname)),
 	}); err != nil {
 		return err
@@ -464,81 +757,224 @@ func (d *Directory) Symlink(oldname, newname string, modTime time.Time, mode os.
 		return err
 	}
 
-	d.dirEntries = append(d.dirEntries, fullDirEntry{
+	d.addLinkable(newname, &linkTarget{
 		startBlock:  uint32(startBlock),
 		offset:      uint16(offset),
 		inodeNumber: d.w.sb.Inodes + 1,
 		entryType:   symlinkType,
-		name:        newname,
+		nlink:       1,
+		nlinkOffset: inodeBufOffset + binary.Size(inodeHeader{}),
 	})
 
-	d.w.sb.Inodes++
+	d.w.addInode(startBlock, offset)
 	return nil
 }
 
-// Flush writes directory entries and creates inodes for the directory.
-func (d *Directory) Flush() error {
-	countByStartBlock := make(map[uint32]uint32)
-	for _, de := range d.dirEntries {
-		countByStartBlock[de.startBlock]++
+// Device creates a device node with the specified name, modTime, mode, owner and
+// device number rdev (as returned by unix.Mkdev). A character device is
+// created if mode contains os.ModeCharDevice, a block device otherwise.
+func (d *Directory) Device(name string, modTime time.Time, mode os.FileMode, uid, gid uint32, rdev uint64) error {
+	inodeType := uint16(blkdevType)
+	if mode&os.ModeCharDevice != 0 {
+		inodeType = chrdevType
 	}
+	return d.special(name, inodeType, modTime, mode, uid, gid, rdev)
+}
+
+// Fifo creates a named pipe with the specified name, modTime, mode and owner.
+func (d *Directory) Fifo(name string, modTime time.Time, mode os.FileMode, uid, gid uint32) error {
+	return d.special(name, fifoType, modTime, mode, uid, gid, 0)
+}
 
+// Socket creates a unix domain socket with the specified name, modTime, mode
+// and owner.
+func (d *Directory) Socket(name string, modTime time.Time, mode os.FileMode, uid, gid uint32) error {
+	return d.special(name, socketType, modTime, mode, uid, gid, 0)
+}
+
+// special creates an inode without contents, i.e. a device node (using rdev),
+// FIFO or socket.
+func (d *Directory) special(name string, inodeType uint16, modTime time.Time, mode os.FileMode, uid, gid uint32, rdev uint64) error {
+	uidIdx, gidIdx, err := d.w.owner(uid, gid)
+	if err != nil {
+		return err
+	}
+	startBlock := d.w.inodeBuf.Len() / metadataBlockSize
+	offset := d.w.inodeBuf.Len() - startBlock*metadataBlockSize
+	inodeBufOffset := d.w.inodeBuf.Len()
+
+	ih := inodeHeader{
+		InodeType:   inodeType,
+		Mode:        d.w.fileMode(encodeMode(mode)),
+		Uid:         uidIdx,
+		Gid:         gidIdx,
+		Mtime:       d.w.mtime(modTime),
+		InodeNumber: d.w.sb.Inodes + 1,
+	}
+	var inode interface{} = ipcInodeHeader{
+		inodeHeader: ih,
+		Nlink:       1, // incremented by Link
+	}
+	if inodeType == blkdevType || inodeType == chrdevType {
+		inode = devInodeHeader{
+			inodeHeader: ih,
+			Nlink:       1, // incremented by Link
+			Rdev:        encodeDev(rdev),
+		}
+	}
+	if err := binary.Write(&d.w.inodeBuf, binary.LittleEndian, inode); err != nil {
+		return err
+	}
+
+	d.addLinkable(name, &linkTarget{
+		startBlock:  uint32(startBlock),
+		offset:      uint16(offset),
+		inodeNumber: d.w.sb.Inodes + 1,
+		entryType:   inodeType,
+		nlink:       1,
+		nlinkOffset: inodeBufOffset + binary.Size(inodeHeader{}),
+	})
+
+	d.w.addInode(startBlock, offset)
+	return nil
+}
+
+// addInode accounts for an inode, which was written to the inode table at the
+// specified location.
+func (w *Writer) addInode(startBlock, offset int) {
+	w.inodeRefs = append(w.inodeRefs, Inode((startBlock*(metadataBlockSize+2))<<16|offset))
+	w.sb.Inodes++
+}
+
+// addLinkable adds a directory entry named name for the non-directory inode t,
+// which hard links can subsequently refer to.
+func (d *Directory) addLinkable(name string, t *linkTarget) {
+	d.dirEntries = append(d.dirEntries, fullDirEntry{
+		startBlock:  t.startBlock,
+		offset:      t.offset,
+		inodeNumber: t.inodeNumber,
+		entryType:   t.entryType,
+		name:        name,
+	})
+	d.w.links[filepath.Join(d.path(), name)] = t
+}
+
+// Link creates a hard link newname to oldname, which must be a file, symbolic
+// link, device node, FIFO or socket created before and is specified relative
+// to the file system root (e.g. “out/bin/git”).
+func (d *Directory) Link(oldname, newname string) error {
+	t, ok := d.w.links[oldname]
+	if !ok {
+		return fmt.Errorf("Link(%q, %q): %q was not previously created (or is a directory)", oldname, newname, oldname)
+	}
+	t.nlink++
+	// Directly manipulating unread data in bytes.Buffer via Bytes(), as in
+	// Directory.Flush.
+	b := d.w.inodeBuf.Bytes()
+	binary.LittleEndian.PutUint32(b[t.nlinkOffset:t.nlinkOffset+4], t.nlink)
+	d.addLinkable(newname, t)
+	return nil
+}
+
+// Flush writes directory entries and creates inodes for the directory.
+func (d *Directory) Flush() error {
 	dirBufStartBlock := d.w.dirBuf.Len() / metadataBlockSize
 	dirBufOffset := d.w.dirBuf.Len()
 
-	currentBlock := int64(-1)
-	currentInodeOffset := int64(-1)
-	var subdirs int
-	for _, de := range d.dirEntries {
-		if de.entryType == dirType {
-			subdirs++
-		}
-		if int64(de.startBlock) != currentBlock {
-			dh := dirHeader{
-				Count:       countByStartBlock[de.startBlock] - 1,
-				StartBlock:  de.startBlock * (metadataBlockSize + 2),
-				InodeOffset: de.inodeNumber,
+	const (
+		dirHeaderSize = 12 // sizeof(dirHeader)
+		dirEntrySize  = 8  // sizeof(dirEntry), excluding the name
+	)
+	var (
+		subdirs int
+		// index contains an entry for every directory header which starts a
+		// new metadata block worth of listing, like mksquashfs(1) does.
+		index      []dirIndex
+		indexNames []string
+		indexStart int // listing offset of the most recent index entry
+	)
+	for i := 0; i < len(d.dirEntries); {
+		first := d.dirEntries[i]
+		pos := d.w.dirBuf.Len() - dirBufOffset
+		size := pos + dirHeaderSize + dirEntrySize + len(first.name)
+		if pos > 0 && size-indexStart > metadataBlockSize {
+			index = append(index, dirIndex{
+				Index:      uint32(pos),
+				StartBlock: uint32((dirBufOffset + pos) / metadataBlockSize * (metadataBlockSize + 2)),
+				Size:       uint32(len(first.name) - 1),
+			})
+			indexNames = append(indexNames, first.name)
+			indexStart = pos
+		}
+
+		// All entries following a directory header need to refer to inodes
+		// within the same metadata block, with an inode number which is
+		// representable as int16 offset. A header can cover at most 256
+		// entries, and we start a new header (and index entry) whenever the
+		// listing exceeds another metadata block.
+		n := 1
+		for ; i+n < len(d.dirEntries) && n < 256; n++ {
+			de := d.dirEntries[i+n]
+			delta := int64(de.inodeNumber) - int64(first.inodeNumber)
+			if de.startBlock != first.startBlock || delta < math.MinInt16 || delta > math.MaxInt16 {
+				break
 			}
-			if err := binary.Write(&d.w.dirBuf, binary.LittleEndian, &dh); err != nil {
-				return err
+			size += dirEntrySize + len(de.name)
+			if size-indexStart > metadataBlockSize {
+				break
 			}
-
-			currentBlock = int64(de.startBlock)
-			currentInodeOffset = int64(de.inodeNumber)
 		}
-		if err := binary.Write(&d.w.dirBuf, binary.LittleEndian, &dirEntry{
-			Offset:      de.offset,
-			InodeNumber: int16(de.inodeNumber - uint32(currentInodeOffset)),
-			EntryType:   de.entryType,
-			Size:        uint16(len(de.name) - 1),
-		}); err != nil {
-			return err
+		dh := dirHeader{
+			Count:       uint32(n - 1),
+			StartBlock:  first.startBlock * (metadataBlockSize + 2),
+			InodeOffset: first.inodeNumber,
 		}
-		if _, err := d.w.dirBuf.Write([]byte(de.name)); err != nil {
+		if err := binary.Write(&d.w.dirBuf, binary.LittleEndian, &dh); err != nil {
 			return err
 		}
+		for _, de := range d.dirEntries[i : i+n] {
+			if de.entryType == dirType {
+				subdirs++
+			}
+			if err := binary.Write(&d.w.dirBuf, binary.LittleEndian, &dirEntry{
+				Offset:      de.offset,
+				InodeNumber: int16(int64(de.inodeNumber) - int64(first.inodeNumber)),
+				EntryType:   de.entryType,
+				Size:        uint16(len(de.name) - 1),
+			}); err != nil {
+				return err
+			}
+			if _, err := d.w.dirBuf.Write([]byte(de.name)); err != nil {
+				return err
+			}
+		}
+		i += n
 	}
 
 	startBlock := d.w.inodeBuf.Len() / metadataBlockSize
 	offset := d.w.inodeBuf.Len() - startBlock*metadataBlockSize
 	inodeBufOffset := d.w.inodeBuf.Len()
 
+	uidIdx, gidIdx, err := d.w.owner(d.uid, d.gid)
+	if err != nil {
+		return err
+	}
+
 	// parentInodeOffset is the offset (in bytes) of the ParentInode field
 	// within a dirInodeHeader or ldirInodeHeader
 	var parentInodeOffset int64
 
 	if len(d.dirEntries) > 256 ||
-		d.w.dirBuf.Len()-dirBufOffset > metadataBlockSize {
+		d.w.dirBuf.Len()-dirBufOffset > metadataBlockSize ||
+		len(index) > 0 {
 		parentInodeOffset = (2 + 2 + 2 + 2 + 4 + 4) + 4 + 4 + 4
 		if err := binary.Write(&d.w.inodeBuf, binary.LittleEndian, ldirInodeHeader{
 			inodeHeader: inodeHeader{
-				InodeType: ldirType,
-				Mode: unix.S_IRUSR | unix.S_IXUSR |
-					unix.S_IRGRP | unix.S_IXGRP |
-					unix.S_IROTH | unix.S_IXOTH,
-				Uid:         0,
-				Gid:         0,
-				Mtime:       int32(d.modTime.Unix()),
+				InodeType:   ldirType,
+				Mode:        d.w.fileMode(encodeMode(d.mode)),
+				Uid:         uidIdx,
+				Gid:         gidIdx,
+				Mtime:       d.w.mtime(d.modTime),
 				InodeNumber: d.w.sb.Inodes + 1,
 			},
 
@@ -546,23 +982,29 @@ func (d *Directory) Flush() error {
 			FileSize:    uint32(d.w.dirBuf.Len()-dirBufOffset) + 3,
 			StartBlock:  uint32(dirBufStartBlock * (metadataBlockSize + 2)),
 			ParentInode: d.w.sb.Inodes + 2, // invalid
-			Icount:      0,                 // no directory index
+			Icount:      uint16(len(index)),
 			Offset:      uint16(dirBufOffset - dirBufStartBlock*metadataBlockSize),
 			Xattr:       invalidXattr,
 		}); err != nil {
 			return err
 		}
+		for idx, di := range index {
+			if err := binary.Write(&d.w.inodeBuf, binary.LittleEndian, &di); err != nil {
+				return err
+			}
+			if _, err := d.w.inodeBuf.Write([]byte(indexNames[idx])); err != nil {
+				return err
+			}
+		}
 	} else {
 		parentInodeOffset = (2 + 2 + 2 + 2 + 4 + 4) + 4 + 4 + 2 + 2
 		if err := binary.Write(&d.w.inodeBuf, binary.LittleEndian, dirInodeHeader{
 			inodeHeader: inodeHeader{
-				InodeType: dirType,
-				Mode: unix.S_IRUSR | unix.S_IXUSR |
-					unix.S_IRGRP | unix.S_IXGRP |
-					unix.S_IROTH | unix.S_IXOTH,
-				Uid:         0,
-				Gid:         0,
-				Mtime:       int32(d.modTime.Unix()),
+				InodeType:   dirType,
+				Mode:        d.w.fileMode(encodeMode(d.mode)),
+				Uid:         uidIdx,
+				Gid:         gidIdx,
+				Mtime:       d.w.mtime(d.modTime),
 				InodeNumber: d.w.sb.Inodes + 1,
 			},
 			StartBlock:  uint32(dirBufStartBlock * (metadataBlockSize + 2)),
@@ -600,7 +1042,7 @@ func (d *Directory) Flush() error {
 		d.w.sb.RootInode = Inode((startBlock*(metadataBlockSize+2))<<16 | offset)
 	}
 
-	d.w.sb.Inodes++
+	d.w.addInode(startBlock, offset)
 
 	return nil
 }
@@ -611,6 +1053,7 @@ func (f *file) Write(p []byte) (n int, err error) {
 	if n > 0 {
 		// Keep track of the uncompressed file size.
 		f.size += uint32(n)
+		f.hash.Write(p[:n])
 		for f.buf.Len() >= dataBlockSize {
 			if err := f.writeBlock(); err != nil {
 				return 0, err
@@ -629,90 +1072,160 @@ func (f *file) writeBlock() error {
 	b := f.buf.Bytes()
 	block := b[:n]
 	rest := b[n:]
-	/*
-		f.compBuf.Reset()
-		f.zlibWriter.Reset(f.compBuf)
-		if _, err := f.zlibWriter.Write(block); err != nil {
-			return err
-		}
-		if err := f.zlibWriter.Close(); err != nil {
-			return err
-		}
 
-		size := f.compBuf.Len()
-		if size > len(block) {
-			// Copy uncompressed data: Linux returns i/o errors when it encounters a
-			// compressed block which is larger than the uncompressed data:
-			// https://github.com/torvalds/linux/blob/3ca24ce9ff764bc27bceb9b2fd8ece74846c3fd3/fs/squashfs/block.c#L150
-			size = len(block) | (1 << 24) // SQUASHFS_COMPRESSED_BIT_BLOCK
-			if _, err := f.w.w.Write(block); err != nil {
-				return err
-			}
-		} else {
-			if _, err := io.Copy(f.w.w, f.compBuf); err != nil {
-				return err
-			}
+	contents := f.contents
+	idx := len(contents.blocksizes)
+	contents.blocksizes = append(contents.blocksizes, 0)
+	if bytes.Equal(block, zeroBlock[:len(block)]) {
+		// Store the block as a sparse block (size entry 0) instead of writing
+		// it: readers synthesize the zeros.
+		contents.sparse += uint64(len(block))
+	} else {
+		f.blocks++
+		if err := f.w.submitBlock(block, func(_ int64, size uint32) {
+			contents.blocksizes[idx] = size
+		}); err != nil {
+			return err
 		}
-	*/
-	// Copy uncompressed data: Linux returns i/o errors when it encounters a
-	// compressed block which is larger than the uncompressed data:
-	// https://github.com/torvalds/linux/blob/3ca24ce9ff764bc27bceb9b2fd8ece74846c3fd3/fs/squashfs/block.c#L150
-	size := len(block) | (1 << 24) // SQUASHFS_COMPRESSED_BIT_BLOCK
-	if _, err := f.w.w.Write(block); err != nil {
-		return err
 	}
 
-	f.blocksizes = append(f.blocksizes, uint32(size))
-
 	// Keep the rest in f.buf for the next write
 	copy(b, rest)
 	f.buf.Truncate(len(rest))
 	return nil
 }
 
+// addFragment appends tail to the current fragment block, starting a new
+// fragment block if tail does not fit, and returns the index of the fragment
+// block and the offset of tail within it.
+func (w *Writer) addFragment(tail []byte) (index, offset uint32, _ error) {
+	if w.fragBuf.Len()+len(tail) > dataBlockSize {
+		if err := w.flushFragment(); err != nil {
+			return 0, 0, err
+		}
+	}
+	index = uint32(len(w.fragments))
+	offset = uint32(w.fragBuf.Len())
+	if _, err := w.fragBuf.Write(tail); err != nil {
+		return 0, 0, err
+	}
+	return index, offset, nil
+}
+
+// flushFragment writes the current fragment block (if any) to the underlying
+// io.WriteSeeker.
+func (w *Writer) flushFragment() error {
+	if w.fragBuf.Len() == 0 {
+		return nil
+	}
+	idx := len(w.fragments)
+	w.fragments = append(w.fragments, fragmentEntry{})
+	if err := w.submitBlock(w.fragBuf.Bytes(), func(off int64, size uint32) {
+		w.fragments[idx] = fragmentEntry{
+			Start: uint64(off),
+			Size:  size,
+		}
+	}); err != nil {
+		return err
+	}
+	w.fragBuf.Reset()
+	return nil
+}
+
+// fillFileInodes fills in the start block and block sizes of all file inodes,
+// which must only be called once all data blocks were written.
+func (w *Writer) fillFileInodes() {
+	b := w.inodeBuf.Bytes()
+	hdrSize := binary.Size(inodeHeader{})
+	lregSize := binary.Size(lregInodeHeader{})
+	for _, fi := range w.fileInodes {
+		binary.LittleEndian.PutUint64(b[fi.offset+hdrSize:], uint64(fi.contents.startBlock))
+		for idx, size := range fi.contents.blocksizes {
+			binary.LittleEndian.PutUint32(b[fi.offset+lregSize+4*idx:], size)
+		}
+	}
+}
+
 // Close implements io.Closer
 func (f *file) Close() error {
-	for f.buf.Len() > 0 {
-		if err := f.writeBlock(); err != nil {
-			return err
+	var sum [sha256.Size]byte
+	f.hash.Sum(sum[:0])
+	contents, dup := f.w.contents[sum]
+	if dup {
+		// An identical file was written before: discard the data blocks we
+		// just wrote (they are the most recently written data) and refer to
+		// the existing blocks and tail end instead. The blocks need to be
+		// written first so that we do not seek back while they are pending.
+		if f.blocks > 0 {
+			if err := f.w.flushBlocks(); err != nil {
+				return err
+			}
+			if _, err := f.w.w.Seek(f.contents.startBlock, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		f.buf.Reset()
+	} else {
+		contents = f.contents
+		// Write only ever leaves less than dataBlockSize bytes in f.buf, which
+		// we store as the tail end in a (shared) fragment block instead of in a
+		// data block of its own.
+		if f.buf.Len() > 0 {
+			var err error
+			contents.fragment, contents.fragOffset, err = f.w.addFragment(f.buf.Bytes())
+			if err != nil {
+				return err
+			}
+			f.buf.Reset()
+		}
+		if f.size > 0 {
+			f.w.contents[sum] = contents
 		}
 	}
 
 	startBlock := f.w.inodeBuf.Len() / metadataBlockSize
 	offset := f.w.inodeBuf.Len() - startBlock*metadataBlockSize
+	inodeBufOffset := f.w.inodeBuf.Len()
 
 	if err := binary.Write(&f.w.inodeBuf, binary.LittleEndian, lregInodeHeader{
 		inodeHeader: inodeHeader{
 			InodeType:   lregType,
-			Mode:        f.mode,
-			Uid:         0,
-			Gid:         0,
-			Mtime:       int32(f.modTime.Unix()),
+			Mode:        f.w.fileMode(f.mode),
+			Uid:         f.uid,
+			Gid:         f.gid,
+			Mtime:       f.w.mtime(f.modTime),
 			InodeNumber: f.w.sb.Inodes + 1,
 		},
-		StartBlock: uint64(f.off),
+		StartBlock: 0, // filled in by Flush
 		FileSize:   uint64(f.size),
-		Nlink:      1,
-		Fragment:   invalidFragment,
-		Offset:     0,
+		Sparse:     contents.sparse,
+		Nlink:      1, // incremented by Link
+		Fragment:   contents.fragment,
+		Offset:     contents.fragOffset,
 		Xattr:      f.xattrRef,
 	}); err != nil {
 		return err
 	}
 
-	if err := binary.Write(&f.w.inodeBuf, binary.LittleEndian, f.blocksizes); err != nil {
+	// Block sizes are filled in by Flush.
+	if err := binary.Write(&f.w.inodeBuf, binary.LittleEndian, make([]uint32, len(contents.blocksizes))); err != nil {
 		return err
 	}
+	f.w.fileInodes = append(f.w.fileInodes, fileInode{
+		offset:   inodeBufOffset,
+		contents: contents,
+	})
 
-	f.d.dirEntries = append(f.d.dirEntries, fullDirEntry{
+	f.d.addLinkable(f.name, &linkTarget{
 		startBlock:  uint32(startBlock),
 		offset:      uint16(offset),
 		inodeNumber: f.w.sb.Inodes + 1,
 		entryType:   fileType,
-		name:        f.name,
+		nlink:       1,
+		nlinkOffset: inodeBufOffset + binary.Size(inodeHeader{}) + 8 + 8 + 8, // StartBlock, FileSize, Sparse
 	})
 
-	f.w.sb.Inodes++
+	f.w.addInode(startBlock, offset)
 
 	return nil
 }
@@ -767,8 +1280,6 @@ func (w *Writer) writeXattrTables() (int64, error) {
 	if err := writeXattr(&xattrBuf, w.xattrs); err != nil {
 		return 0, err
 	}
-	xattrBlocks := (xattrBuf.Len() + (metadataBlockSize - 1)) / metadataBlockSize
-
 	if err := w.writeMetadataChunks(&xattrBuf); err != nil {
 		return 0, err
 	}
@@ -782,12 +1293,16 @@ func (w *Writer) writeXattrTables() (int64, error) {
 	var xattrIdBuf bytes.Buffer
 	size := uint64(0)
 	for _, id := range w.xattrIds {
-		id.Xattr = uint64(size)
-		size += uint64(id.Size) + 8 /* sizeof(Type+NameSize+ValSize) */
+		// Like inode references, xattr references consist of the offset of
+		// the (uncompressed) metadata block and the offset within the block.
+		block := size / metadataBlockSize
+		id.Xattr = (block*(metadataBlockSize+2 /* sizeof(uint16) */))<<16 | size%metadataBlockSize
+		size += uint64(id.Size) + uint64(id.Count)*8 /* sizeof(Type+NameSize+ValSize) */
 		if err := binary.Write(&xattrIdBuf, binary.LittleEndian, id); err != nil {
 			return 0, err
 		}
 	}
+	idBlocks := (xattrIdBuf.Len() + (metadataBlockSize - 1)) / metadataBlockSize
 	if err := w.writeMetadataChunks(&xattrIdBuf); err != nil {
 		return 0, err
 	}
@@ -799,12 +1314,12 @@ func (w *Writer) writeXattrTables() (int64, error) {
 	}
 	if err := binary.Write(w.w, binary.LittleEndian, xattrTableHeader{
 		XattrTableStart: xattrTableStart,
-		XattrIds:        uint32(len(w.xattrs)),
+		XattrIds:        uint32(len(w.xattrIds)),
 	}); err != nil {
 		return 0, err
 	}
 	// write block index
-	for i := 0; i < xattrBlocks; i++ {
+	for i := 0; i < idBlocks; i++ {
 		if err := binary.Write(w.w, binary.LittleEndian, struct {
 			BlockOffset uint64
 		}{
@@ -816,6 +1331,44 @@ func (w *Writer) writeXattrTables() (int64, error) {
 	return off, nil
 }
 
+// writeFragmentTable writes the fragment table and returns its offset.
+func (w *Writer) writeFragmentTable() (int64, error) {
+	if len(w.fragments) == 0 {
+		return w.w.Seek(0, io.SeekCurrent)
+	}
+	return w.writeLookupTable(w.fragments)
+}
+
+// writeLookupTable writes the entries of the slice data in metadata blocks,
+// followed by an index of the metadata block locations, and returns the offset
+// of the index. This is the layout of the fragment table and export table.
+func (w *Writer) writeLookupTable(data interface{}) (int64, error) {
+	off, err := w.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, data); err != nil {
+		return 0, err
+	}
+	blocks := (buf.Len() + (metadataBlockSize - 1)) / metadataBlockSize
+	if err := w.writeMetadataChunks(&buf); err != nil {
+		return 0, err
+	}
+
+	indexOff, err := w.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < blocks; i++ {
+		blockOffset := uint64(off) + uint64(i)*(metadataBlockSize+2 /* sizeof(uint16) */)
+		if err := binary.Write(w.w, binary.LittleEndian, blockOffset); err != nil {
+			return 0, err
+		}
+	}
+	return indexOff, nil
+}
+
 // writeMetadataChunks copies from r to w in blocks of metadataBlockSize bytes
 // each, prefixing each block with a uint16 length header, setting the
 // uncompressed bit.
@@ -847,7 +1400,15 @@ func (w *Writer) Flush() error {
 
 	// (2) compressor-specific options omitted
 
-	// (3) data has already been written
+	// (3) data has already been written, except for the last fragment block
+	// and blocks which are still being compressed
+	if err := w.flushFragment(); err != nil {
+		return err
+	}
+	if err := w.flushBlocks(); err != nil {
+		return err
+	}
+	w.fillFileInodes()
 
 	// (4) write inode table
 	off, err := w.w.Seek(0, io.SeekCurrent)
@@ -871,21 +1432,30 @@ func (w *Writer) Flush() error {
 		return err
 	}
 
-	// (6) fragment table omitted
-	off, err = w.w.Seek(0, io.SeekCurrent)
+	// (6) write fragment table
+	off, err = w.writeFragmentTable()
 	if err != nil {
 		return err
 	}
 	w.sb.FragmentTableStart = off
+	w.sb.Fragments = uint32(len(w.fragments))
 
-	// (7) export table omitted
+	// (7) write export table
+	if w.exportTable {
+		off, err = w.writeLookupTable(w.inodeRefs)
+		if err != nil {
+			return err
+		}
+		w.sb.LookupTableStart = off
+	}
 
 	// (8) write uid/gid lookup table
-	idTableStart, err := writeIdTable(w.w, []uint32{0})
+	idTableStart, err := w.writeLookupTable(w.ids)
 	if err != nil {
 		return err
 	}
 	w.sb.IdTableStart = idTableStart
+	w.sb.NoIds = uint16(len(w.ids))
 
 	// (9) xattr table
 	off, err = w.writeXattrTables()
@@ -906,6 +1476,15 @@ func (w *Writer) Flush() error {
 		if _, err := w.w.Write(padding); err != nil {
 			return err
 		}
+		off += 4096 - pad
+	}
+
+	// Discarded duplicate data blocks might extend beyond the end of the file
+	// system, so truncate the file if possible.
+	if t, ok := w.w.(interface{ Truncate(int64) error }); ok {
+		if err := t.Truncate(off); err != nil {
+			return err
+		}
 	}
 
 	// (1) Write superblock
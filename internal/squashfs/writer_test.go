@@ -2,6 +2,7 @@ package squashfs
 
 import (
 	"bytes"
+	"encoding/binary"
 	"flag"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -20,12 +22,30 @@ import (
 
 var fsImagePath = flag.String("fs_image_path", "", "Store the SquashFS test file system in the specified path for manual inspection")
 
-func writeTestImage(iow io.WriteSeeker, xattr bool) error {
-	w, err := NewWriter(iow, time.Now())
+func writeTestImage(iow io.WriteSeeker, xattr bool, opts ...WriterOption) error {
+	w, err := NewWriter(iow, time.Now(), opts...)
 	if err != nil {
 		return err
 	}
 
+	// Enough small files to fill more than one fragment block.
+	fragdir := w.Root.Directory("fragments", time.Now(), 0555, 0, 0)
+	for i := 0; i < fragmentTestFiles; i++ {
+		ff, err := fragdir.File(fmt.Sprintf("file%02d", i), time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, 0, 0, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := ff.Write([]byte(fragmentTestContents(i))); err != nil {
+			return err
+		}
+		if err := ff.Close(); err != nil {
+			return err
+		}
+	}
+	if err := fragdir.Flush(); err != nil {
+		return err
+	}
+
 	var xattrs []Xattr
 	if xattr {
 		xattrs = append(xattrs, Xattr{
@@ -34,7 +54,7 @@ func writeTestImage(iow io.WriteSeeker, xattr bool) error {
 			Value:    []byte{1, 0, 0, 2, 0, 32, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
 		})
 	}
-	ff, err := w.Root.File("hellö wörld", time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, xattrs)
+	ff, err := w.Root.File("hellö wörld", time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, 0, 0, xattrs)
 	if err != nil {
 		return err
 	}
@@ -45,7 +65,7 @@ func writeTestImage(iow io.WriteSeeker, xattr bool) error {
 		return err
 	}
 
-	ff, err = w.Root.File("leer", time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, nil)
+	ff, err = w.Root.File("leer", time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, 0, 0, nil)
 	if err != nil {
 		return err
 	}
@@ -55,7 +75,7 @@ func writeTestImage(iow io.WriteSeeker, xattr bool) error {
 
 	ff, err = w.Root.File("second file", time.Now(), unix.S_IRUSR|unix.S_IXUSR|
 		unix.S_IRGRP|unix.S_IXGRP|
-		unix.S_IROTH|unix.S_IXOTH,
+		unix.S_IROTH|unix.S_IXOTH, 0, 0,
 		nil)
 	if err != nil {
 		return err
@@ -67,14 +87,18 @@ func writeTestImage(iow io.WriteSeeker, xattr bool) error {
 		return err
 	}
 
-	if err := w.Root.Symlink("second file", "second link", time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH); err != nil {
+	if err := w.Root.Link("second file", "second file link"); err != nil {
 		return err
 	}
 
-	subdir := w.Root.Directory("subdir", time.Now())
+	if err := w.Root.Symlink("second file", "second link", time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, 0, 0); err != nil {
+		return err
+	}
+
+	subdir := w.Root.Directory("subdir", time.Now(), 0555, 0, 0)
 
-	subsubdir := subdir.Directory("deep", time.Now())
-	ff, err = subsubdir.File("yo", time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, nil)
+	subsubdir := subdir.Directory("deep", time.Now(), 0555, 0, 0)
+	ff, err = subsubdir.File("yo", time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, 0, 0, nil)
 	if err != nil {
 		return err
 	}
@@ -90,7 +114,7 @@ func writeTestImage(iow io.WriteSeeker, xattr bool) error {
 
 	// TODO: write another file in subdir now, will result in invalid parent inode
 
-	ff, err = subdir.File("third file (in subdir)", time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, nil)
+	ff, err = subdir.File("third file (in subdir)", time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, 0, 0, nil)
 	if err != nil {
 		return err
 	}
@@ -106,7 +130,7 @@ func writeTestImage(iow io.WriteSeeker, xattr bool) error {
 	}
 	ff, err = w.Root.File("testbin", time.Now(), unix.S_IRUSR|unix.S_IXUSR|
 		unix.S_IRGRP|unix.S_IXGRP|
-		unix.S_IROTH|unix.S_IXOTH,
+		unix.S_IROTH|unix.S_IXOTH, 0, 0,
 		nil)
 	if err != nil {
 		return err
@@ -123,6 +147,24 @@ func writeTestImage(iow io.WriteSeeker, xattr bool) error {
 		return err
 	}
 
+	// An identical copy, which will share data with testbin.
+	ff, err = w.Root.File("testbin copy", time.Now(), unix.S_IRUSR|unix.S_IXUSR|
+		unix.S_IRGRP|unix.S_IXGRP|
+		unix.S_IROTH|unix.S_IXOTH, 0, 0,
+		nil)
+	if err != nil {
+		return err
+	}
+	if _, err := zf.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(ff, zf); err != nil {
+		return err
+	}
+	if err := ff.Close(); err != nil {
+		return err
+	}
+
 	if err := w.Root.Flush(); err != nil {
 		return err
 	}
@@ -132,6 +174,47 @@ func writeTestImage(iow io.WriteSeeker, xattr bool) error {
 	return nil
 }
 
+const fragmentTestFiles = 50
+
+// fragmentTestContents returns the contents of the i-th file in the fragments
+// directory of the test image. The sizes vary so that tail ends are packed at
+// unaligned offsets.
+func fragmentTestContents(i int) string {
+	return strings.Repeat(fmt.Sprintf("fragment %d\n", i), 300+i*7)
+}
+
+// testImageEntry is a file of the test image and its expected contents.
+type testImageEntry struct {
+	path     string
+	contents io.Reader
+}
+
+func testImageEntries(t *testing.T) []testImageEntry {
+	fbin, err := os.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fbinCopy, err := os.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []testImageEntry{
+		{"leer", strings.NewReader("")},
+		{"hellö wörld", strings.NewReader("hello world!")},
+		{"testbin", fbin},
+		{"testbin copy", fbinCopy},
+		{"subdir/third file (in subdir)", strings.NewReader("contents\n")},
+		{"second file link", strings.NewReader("NON.\n")},
+	}
+	for _, i := range []int{0, 17, fragmentTestFiles - 1} {
+		entries = append(entries, testImageEntry{
+			path:     fmt.Sprintf("fragments/file%02d", i),
+			contents: strings.NewReader(fragmentTestContents(i)),
+		})
+	}
+	return entries
+}
+
 func TestUnsquashfs(t *testing.T) {
 	t.Parallel()
 
@@ -139,16 +222,17 @@ func TestUnsquashfs(t *testing.T) {
 		t.Skip("unsquashfs not found in $PATH")
 	}
 
-	for _, xattr := range []bool{false, true} {
-		t.Run(fmt.Sprintf("xattr %v", xattr), func(t *testing.T) {
+	for _, tt := range testImageVariants() {
+		tt := tt // copy
+		t.Run(tt.name, func(t *testing.T) {
 			var (
 				f   *os.File
 				err error
 			)
 			if *fsImagePath != "" {
-				f, err = os.Create(*fsImagePath + fmt.Sprintf("-xattr-%v", xattr))
+				f, err = os.Create(*fsImagePath + "-" + strings.ReplaceAll(tt.name, " ", "-"))
 			} else {
-				f, err = ioutil.TempFile("", fmt.Sprintf("squashfs-xattr-%v", xattr))
+				f, err = ioutil.TempFile("", "squashfs-"+strings.ReplaceAll(tt.name, " ", "-"))
 				if err == nil {
 					defer os.Remove(f.Name())
 				}
@@ -157,7 +241,7 @@ func TestUnsquashfs(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			if err := writeTestImage(f, xattr); err != nil {
+			if err := writeTestImage(f, tt.xattr, tt.opts...); err != nil {
 				t.Fatal(err)
 			}
 
@@ -177,21 +261,8 @@ func TestUnsquashfs(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			fbin, err := os.Open(os.Args[0])
-			if err != nil {
-				t.Fatal(err)
-			}
-
 			// Verify the extracted files match our expectations.
-			for _, entry := range []struct {
-				path     string
-				contents io.Reader
-			}{
-				{"leer", strings.NewReader("")},
-				{"hellö wörld", strings.NewReader("hello world!")},
-				{"testbin", fbin},
-				{"subdir/third file (in subdir)", strings.NewReader("contents\n")},
-			} {
+			for _, entry := range testImageEntries(t) {
 				entry := entry // copy
 				t.Run(entry.path, func(t *testing.T) {
 					t.Parallel()
@@ -216,14 +287,47 @@ func TestUnsquashfs(t *testing.T) {
 	}
 }
 
+// testImageVariant describes a flavor of the test image written by
+// writeTestImage.
+type testImageVariant struct {
+	name  string
+	xattr bool
+	opts  []WriterOption
+}
+
+func testImageVariants() []testImageVariant {
+	var variants []testImageVariant
+	for _, xattr := range []bool{false, true} {
+		variants = append(variants, testImageVariant{
+			name:  fmt.Sprintf("xattr %v", xattr),
+			xattr: xattr,
+		})
+	}
+	for _, c := range []Compression{ZlibCompression, LZ4Compression} {
+		variants = append(variants, testImageVariant{
+			name:  fmt.Sprintf("compression %v", c),
+			xattr: true,
+			opts:  []WriterOption{WithCompression(c)},
+		})
+	}
+	variants = append(variants, testImageVariant{
+		name:  "export table",
+		xattr: true,
+		opts:  []WriterOption{WithExportTable()},
+	})
+	return variants
+}
+
 func TestReader(t *testing.T) {
 	t.Parallel()
 
-	for _, xattr := range []bool{false, true} {
-		t.Run(fmt.Sprintf("xattr %v", xattr), func(t *testing.T) {
+	for _, tt := range testImageVariants() {
+		tt := tt // copy
+		xattr := tt.xattr
+		t.Run(tt.name, func(t *testing.T) {
 			var err error
 			buf := &writerseeker.WriterSeeker{}
-			if err := writeTestImage(buf, xattr); err != nil {
+			if err := writeTestImage(buf, xattr, tt.opts...); err != nil {
 				t.Fatal(err)
 			}
 
@@ -236,21 +340,8 @@ func TestReader(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			fbin, err := os.Open(os.Args[0])
-			if err != nil {
-				t.Fatal(err)
-			}
-
 			// Verify the extracted files match our expectations.
-			for _, entry := range []struct {
-				path     string
-				contents io.Reader
-			}{
-				{"leer", strings.NewReader("")},
-				{"hellö wörld", strings.NewReader("hello world!")},
-				{"testbin", fbin},
-				{"subdir/third file (in subdir)", strings.NewReader("contents\n")},
-			} {
+			for _, entry := range testImageEntries(t) {
 				entry := entry // copy
 				t.Run(entry.path, func(t *testing.T) {
 					// TODO: is this t.Parallel()-safe?
@@ -276,6 +367,12 @@ func TestReader(t *testing.T) {
 				})
 			}
 
+			// The tail ends in the fragments directory do not fit into a
+			// single fragment block.
+			if got, want := rd.super.Fragments, uint32(2); got < want {
+				t.Errorf("unexpected number of fragment blocks: got %d, want at least %d", got, want)
+			}
+
 			if xattr {
 				t.Run("xattrs", func(t *testing.T) {
 					inode, err := rd.LookupPath("hellö wörld")
@@ -304,3 +401,677 @@ func TestReader(t *testing.T) {
 		})
 	}
 }
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	var uncompressed writerseeker.WriterSeeker
+	if err := writeTestImage(&uncompressed, false); err != nil {
+		t.Fatal(err)
+	}
+	uncompressedSize, err := uncompressed.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []Compression{ZlibCompression, LZ4Compression} {
+		c := c // copy
+		t.Run(c.String(), func(t *testing.T) {
+			var buf writerseeker.WriterSeeker
+			if err := writeTestImage(&buf, false, WithCompression(c)); err != nil {
+				t.Fatal(err)
+			}
+			size, err := buf.Seek(0, io.SeekEnd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size >= uncompressedSize {
+				t.Fatalf("%v compressed image unexpectedly large: got %d bytes, uncompressed image has %d bytes", c, size, uncompressedSize)
+			}
+			rd, err := NewReader(buf.BytesReader())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := Compression(rd.super.Compression), c; got != want {
+				t.Fatalf("unexpected compression: got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestUnsupportedCompression(t *testing.T) {
+	t.Parallel()
+
+	var buf writerseeker.WriterSeeker
+	if _, err := NewWriter(&buf, time.Now(), WithCompression(LZOCompression)); err == nil {
+		t.Fatalf("NewWriter(WithCompression(lzo)) unexpectedly succeeded")
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	t.Parallel()
+
+	var buf writerseeker.WriterSeeker
+	if err := writeTestImage(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	rd, err := NewReader(buf.BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := rd.super.BytesUsed; size >= 2*st.Size() {
+		t.Fatalf("image unexpectedly large: got %d bytes, testbin has %d bytes", size, st.Size())
+	}
+
+	var starts []uint64
+	for _, path := range []string{"testbin", "testbin copy"} {
+		inode, err := rd.LookupPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i, err := rd.readInode(inode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		starts = append(starts, i.(lregInodeHeader).StartBlock)
+	}
+	if starts[0] != starts[1] {
+		t.Errorf("duplicate file not deduplicated: testbin starts at %d, testbin copy at %d", starts[0], starts[1])
+	}
+}
+
+func TestHardLink(t *testing.T) {
+	t.Parallel()
+
+	var buf writerseeker.WriterSeeker
+	if err := writeTestImage(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	rd, err := NewReader(buf.BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inodes []Inode
+	for _, path := range []string{"second file", "second file link"} {
+		inode, err := rd.LlookupPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := rd.Stat(path, inode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fi.Sys().(*FileInfo).Nlink, uint32(2); got != want {
+			t.Errorf("%s: unexpected number of hard links: got %d, want %d", path, got, want)
+		}
+		inodes = append(inodes, inode)
+	}
+	if inodes[0] != inodes[1] {
+		t.Errorf("hard link refers to a different inode: got %v, want %v", inodes[1], inodes[0])
+	}
+
+	inode, err := rd.LlookupPath("leer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := rd.Stat("leer", inode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fi.Sys().(*FileInfo).Nlink, uint32(1); got != want {
+		t.Errorf("leer: unexpected number of hard links: got %d, want %d", got, want)
+	}
+}
+
+func TestSpecialFiles(t *testing.T) {
+	t.Parallel()
+
+	var buf writerseeker.WriterSeeker
+	w, err := NewWriter(&buf, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := w.Root.Directory("dev", time.Now(), 0555, 0, 0)
+	if err := dev.Device("console", time.Now(), os.ModeDevice|os.ModeCharDevice|0620, 0, 5, unix.Mkdev(5, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Fifo("initctl", time.Now(), 0600, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Device("null", time.Now(), os.ModeDevice|os.ModeCharDevice|0666, 0, 0, unix.Mkdev(1, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Device("sda", time.Now(), os.ModeDevice|0660, 0, 6, unix.Mkdev(8, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Socket("sock", time.Now(), os.ModeSetuid|os.ModeSetgid|os.ModeSticky|0755, 1000, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Link("dev/null", "zero-link"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rd, err := NewReader(buf.BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		path     string
+		mode     os.FileMode
+		uid, gid uint32
+		rdev     uint64
+		nlink    uint32
+	}{
+		{"dev/console", os.ModeDevice | os.ModeCharDevice | 0620, 0, 5, unix.Mkdev(5, 1), 1},
+		{"dev/initctl", os.ModeNamedPipe | 0600, 0, 0, 0, 1},
+		{"dev/null", os.ModeDevice | os.ModeCharDevice | 0666, 0, 0, unix.Mkdev(1, 3), 2},
+		{"dev/sda", os.ModeDevice | 0660, 0, 6, unix.Mkdev(8, 0), 1},
+		{"dev/sock", os.ModeSocket | os.ModeSetuid | os.ModeSetgid | os.ModeSticky | 0755, 1000, 100, 0, 1},
+		{"dev/zero-link", os.ModeDevice | os.ModeCharDevice | 0666, 0, 0, unix.Mkdev(1, 3), 2},
+	} {
+		inode, err := rd.LlookupPath(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := rd.Stat(tt.path, inode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fi.Mode(), tt.mode; got != want {
+			t.Errorf("%s: unexpected mode: got %v, want %v", tt.path, got, want)
+		}
+		sfi := fi.Sys().(*FileInfo)
+		if sfi.Uid != tt.uid || sfi.Gid != tt.gid {
+			t.Errorf("%s: unexpected owner: got %d:%d, want %d:%d", tt.path, sfi.Uid, sfi.Gid, tt.uid, tt.gid)
+		}
+		if got, want := sfi.Rdev, tt.rdev; got != want {
+			t.Errorf("%s: unexpected device number: got %d:%d, want %d:%d", tt.path, unix.Major(got), unix.Minor(got), unix.Major(want), unix.Minor(want))
+		}
+		if got, want := sfi.Nlink, tt.nlink; got != want {
+			t.Errorf("%s: unexpected number of hard links: got %d, want %d", tt.path, got, want)
+		}
+	}
+}
+
+// writeUmaskImage writes an image containing a file and special inodes, created
+// with permissions as if the specified umask was in effect.
+func writeUmaskImage(iow io.WriteSeeker, umask os.FileMode, opts ...WriterOption) error {
+	w, err := NewWriter(iow, time.Now(), opts...)
+	if err != nil {
+		return err
+	}
+	f, err := w.Root.File("README", time.Now(), uint16(0666&^umask), 0, 0, nil)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	dev := w.Root.Directory("dev", time.Now(), 0777&^umask, 0, 0)
+	if err := dev.Fifo("initctl", time.Now(), 0666&^umask, 0, 0); err != nil {
+		return err
+	}
+	if err := dev.Socket("log", time.Now(), 0777&^umask, 0, 0); err != nil {
+		return err
+	}
+	if err := dev.Device("null", time.Now(), os.ModeDevice|os.ModeCharDevice|0666&^umask, 0, 0, unix.Mkdev(1, 3)); err != nil {
+		return err
+	}
+	if err := dev.Device("tty", time.Now(), os.ModeDevice|os.ModeCharDevice|0666&^umask, 0, 5, unix.Mkdev(5, 0)); err != nil {
+		return err
+	}
+	if err := dev.Flush(); err != nil {
+		return err
+	}
+	if err := w.Root.Flush(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	t.Parallel()
+
+	epoch := WithSourceDateEpoch(time.Unix(1500000000, 0))
+	var images [2]writerseeker.WriterSeeker
+	for idx, umask := range []os.FileMode{0022, 0002} {
+		if err := writeUmaskImage(&images[idx], umask, epoch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadAll(images[0].Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(images[1].Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("images written with a different umask differ")
+	}
+
+	rd, err := NewReader(images[1].BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		path string
+		mode os.FileMode
+		gid  uint32
+	}{
+		{".", os.ModeDir | 0755, 0},
+		{"dev", os.ModeDir | 0755, 0},
+		{"dev/null", os.ModeDevice | os.ModeCharDevice | 0644, 0},
+		{"dev/tty", os.ModeDevice | os.ModeCharDevice | 0644, 5}, // owners are kept
+		{"dev/initctl", os.ModeNamedPipe | 0644, 0},
+		{"dev/log", os.ModeSocket | 0755, 0},
+		{"README", 0644, 0},
+	} {
+		fi, err := rd.FS().Lstat(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fi.Mode(), tt.mode; got != want {
+			t.Errorf("%s: unexpected mode: got %v, want %v", tt.path, got, want)
+		}
+		if sfi := fi.Sys().(*FileInfo); sfi.Uid != 0 || sfi.Gid != tt.gid {
+			t.Errorf("%s: unexpected owner: got %d:%d, want 0:%d", tt.path, sfi.Uid, sfi.Gid, tt.gid)
+		}
+	}
+}
+
+func TestExportTable(t *testing.T) {
+	t.Parallel()
+
+	var buf writerseeker.WriterSeeker
+	if err := writeTestImage(&buf, false, WithExportTable()); err != nil {
+		t.Fatal(err)
+	}
+	rd, err := NewReader(buf.BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rd.super.Flags&exportable == 0 {
+		t.Errorf("exportable flag not set in superblock")
+	}
+	for _, path := range []string{"", "leer", "second link", "subdir/deep/yo", "fragments/file42", "testbin"} {
+		inode := rd.RootInode()
+		if path != "" {
+			inode, err = rd.LlookupPath(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		blockoffset, offset := rd.inode(inode)
+		br, err := rd.blockReader(rd.super.InodeTableStart+blockoffset, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ih inodeHeader
+		if err := binary.Read(br, binary.LittleEndian, &ih); err != nil {
+			t.Fatal(err)
+		}
+		got, err := rd.InodeByNumber(ih.InodeNumber)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != inode {
+			t.Errorf("InodeByNumber(%d) = %v, want %v (%q)", ih.InodeNumber, got, inode, path)
+		}
+	}
+
+	// Images without export table
+	var plain writerseeker.WriterSeeker
+	if err := writeTestImage(&plain, false); err != nil {
+		t.Fatal(err)
+	}
+	rd, err = NewReader(plain.BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rd.InodeByNumber(1); err == nil {
+		t.Errorf("InodeByNumber unexpectedly succeeded on an image without export table")
+	}
+}
+
+func TestParallelCompression(t *testing.T) {
+	t.Parallel()
+
+	// Clamp all timestamps so that images are comparable.
+	epoch := WithSourceDateEpoch(time.Unix(1500000000, 0))
+	var serial writerseeker.WriterSeeker
+	if err := writeTestImage(&serial, true, epoch, WithCompression(ZlibCompression), WithParallelism(1)); err != nil {
+		t.Fatal(err)
+	}
+	var parallel writerseeker.WriterSeeker
+	if err := writeTestImage(&parallel, true, epoch, WithCompression(ZlibCompression), WithParallelism(8)); err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadAll(serial.Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(parallel.Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("image written with parallel compression differs from serially written image")
+	}
+}
+
+// compressibleContents returns n bytes of pseudo-random text, which compresses
+// roughly like program code.
+func compressibleContents(n int) []byte {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz {}();\n\t"
+	b := make([]byte, n)
+	x := uint32(1)
+	for i := range b {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		b[i] = alphabet[x%uint32(len(alphabet))]
+	}
+	return b
+}
+
+func BenchmarkWriter(b *testing.B) {
+	contents := compressibleContents(32 * 1024 * 1024)
+	for _, bb := range []struct {
+		name        string
+		parallelism int
+	}{
+		{"Serial", 1},
+		{"Parallel", runtime.GOMAXPROCS(0)},
+	} {
+		bb := bb // copy
+		b.Run(bb.name, func(b *testing.B) {
+			b.SetBytes(int64(len(contents)))
+			for i := 0; i < b.N; i++ {
+				var buf writerseeker.WriterSeeker
+				w, err := NewWriter(&buf, time.Now(), WithCompression(ZlibCompression), WithParallelism(bb.parallelism))
+				if err != nil {
+					b.Fatal(err)
+				}
+				f, err := w.Root.File("firmware.bin", time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, 0, 0, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := f.Write(contents); err != nil {
+					b.Fatal(err)
+				}
+				if err := f.Close(); err != nil {
+					b.Fatal(err)
+				}
+				if err := w.Root.Flush(); err != nil {
+					b.Fatal(err)
+				}
+				if err := w.Flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSparseFile(t *testing.T) {
+	t.Parallel()
+
+	zeros := make([]byte, 2*dataBlockSize)
+	data := compressibleContents(dataBlockSize)
+	var sparse []byte
+	sparse = append(sparse, zeros[:dataBlockSize]...) // sparse block
+	sparse = append(sparse, data...)                  // data block
+	sparse = append(sparse, zeros...)                 // 2 sparse blocks
+	sparse = append(sparse, "tail"...)                // fragment
+	files := []struct {
+		name       string
+		contents   []byte
+		wantSparse uint64
+	}{
+		{"sparse", sparse, 3 * dataBlockSize},
+		{"zeros", append(zeros, zeros[:100]...), 2 * dataBlockSize},
+	}
+
+	f, err := ioutil.TempFile("", "squashfs-sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	w, err := NewWriter(f, time.Now(), WithCompression(ZlibCompression))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		ff, err := w.Root.File(file.name, time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, 0, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ff.Write(file.contents); err != nil {
+			t.Fatal(err)
+		}
+		if err := ff.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Root.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rd, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range rd.Verify() {
+		t.Errorf("Verify: %v", problem)
+	}
+	for _, file := range files {
+		inode, err := rd.LookupPath(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i, err := rd.readInode(inode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := i.(lregInodeHeader).Sparse, file.wantSparse; got != want {
+			t.Errorf("%s: sparse bytes: got %d, want %d", file.name, got, want)
+		}
+		l, err := rd.fileLayout(inode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sparse uint64
+		for _, size := range l.blocksizes {
+			if size == 0 {
+				sparse += dataBlockSize
+			}
+		}
+		if got, want := sparse, file.wantSparse; got != want {
+			t.Errorf("%s: %d bytes in blocks of size 0, want %d", file.name, got, want)
+		}
+		got, err := rd.FS().ReadFile(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, file.contents) {
+			t.Errorf("%s: Reader returned unexpected contents", file.name)
+		}
+	}
+
+	if _, err := exec.LookPath("unsquashfs"); err != nil {
+		t.Skip("unsquashfs not found in $PATH")
+	}
+	out, err := ioutil.TempDir("", "unsquashfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+	cmd := exec.Command("unsquashfs", "-d", filepath.Join(out, "x"), f.Name())
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		got, err := ioutil.ReadFile(filepath.Join(out, "x", file.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, file.contents) {
+			t.Errorf("%s: unsquashfs extracted unexpected contents", file.name)
+		}
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	t.Parallel()
+
+	const users = 3000 // more ids than fit into one metadata block
+	var buf writerseeker.WriterSeeker
+	w, err := NewWriter(&buf, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Symlink("spool", "mail", time.Now(), 0777, 8, 12); err != nil {
+		t.Fatal(err)
+	}
+	spool := w.Root.Directory("spool", time.Now(), os.ModeSetgid|0775, 8, 12) // mail:mail
+	for i := 0; i < users; i++ {
+		f, err := spool.File(fmt.Sprintf("user%04d", i), time.Now(), 0600, uint32(10000+i), 12, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := spool.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := w.Root.File("utempter", time.Now(), unix.S_ISGID|0711, 0, 22, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rd, err := NewReader(buf.BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// root, mail (uid), mail (gid), utmp and one per user, each stored once.
+	if got, want := int(rd.super.NoIds), 4+users; got != want {
+		t.Errorf("unexpected number of ids: got %d, want %d", got, want)
+	}
+	for _, problem := range rd.Verify() {
+		t.Errorf("Verify: %v", problem)
+	}
+	for _, tt := range []struct {
+		path     string
+		uid, gid uint32
+		mode     os.FileMode
+	}{
+		{".", 0, 0, os.ModeDir | 0755},
+		{"spool", 8, 12, os.ModeDir | os.ModeSetgid | 0775},
+		{"spool/user0000", 10000, 12, 0600},
+		{"spool/user2999", 12999, 12, 0600},
+		{"utempter", 0, 22, os.ModeSetgid | 0711},
+		{"mail", 8, 12, os.ModeSymlink | 0777},
+	} {
+		fi, err := rd.FS().Lstat(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sfi := fi.Sys().(*FileInfo)
+		if sfi.Uid != tt.uid || sfi.Gid != tt.gid {
+			t.Errorf("%s: unexpected owner: got %d:%d, want %d:%d", tt.path, sfi.Uid, sfi.Gid, tt.uid, tt.gid)
+		}
+		if got, want := fi.Mode(), tt.mode; got != want {
+			t.Errorf("%s: unexpected mode: got %v, want %v", tt.path, got, want)
+		}
+	}
+}
+
+func TestMultipleXattrs(t *testing.T) {
+	t.Parallel()
+
+	const files = 600 // more xattr ids than fit into one metadata block
+	capability := []byte{1, 0, 0, 2, 0, 32, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	var buf writerseeker.WriterSeeker
+	w, err := NewWriter(&buf, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < files; i++ {
+		// Deliberately not in the order in which the xattrs are stored:
+		xattrs := []Xattr{
+			{Type: XattrTypeUser, FullName: "foo", Value: []byte(fmt.Sprintf("foo%d", i))},
+			{Type: XattrTypeSecurity, FullName: "capability", Value: capability},
+			{Type: XattrTypeUser, FullName: "bar", Value: []byte("bar")},
+		}
+		f, err := w.Root.File(fmt.Sprintf("file%03d", i), time.Now(), 0755, 0, 0, xattrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Root.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rd, err := NewReader(buf.BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range rd.Verify() {
+		t.Errorf("Verify: %v", problem)
+	}
+	for _, i := range []int{0, 1, files / 2, files - 1} {
+		path := fmt.Sprintf("file%03d", i)
+		inode, err := rd.LookupPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := rd.ReadXattrs(inode)
+		if err != nil {
+			t.Fatalf("ReadXattrs(%s): %v", path, err)
+		}
+		want := []Xattr{
+			{Type: XattrTypeUser, FullName: "user.bar", Value: []byte("bar")},
+			{Type: XattrTypeUser, FullName: "user.foo", Value: []byte(fmt.Sprintf("foo%d", i))},
+			{Type: XattrTypeSecurity, FullName: "security.capability", Value: capability},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%s: unexpected xattrs: diff (-want +got):\n%s", path, diff)
+		}
+	}
+}
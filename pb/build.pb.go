@@ -940,7 +940,12 @@ type Build struct {
 	// directories (as opposed to global exchange directories). This is to be used
 	// for tight coupling situations, e.g. when a plugin mechanism does not
 	// guarantee ABI compatibility across versions.
-	RuntimeUnion         []*Union `protobuf:"bytes,15,rep,name=runtime_union,json=runtimeUnion" json:"runtime_union,omitempty"`
+	RuntimeUnion []*Union `protobuf:"bytes,15,rep,name=runtime_union,json=runtimeUnion" json:"runtime_union,omitempty"`
+	// Exchange directories (relative to the package, e.g. “out/share/fonts”)
+	// declared by this package, in addition to the default exchange directories
+	// of distri fuse. Files which any package places in a declared exchange
+	// directory are made available underneath /ro, e.g. /ro/share/fonts.
+	ExchangeDir          []string `protobuf:"bytes,19,rep,name=exchange_dir,json=exchangeDir" json:"exchange_dir,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -1150,6 +1155,13 @@ func (m *Build) GetRuntimeUnion() []*Union {
 	return nil
 }
 
+func (m *Build) GetExchangeDir() []string {
+	if m != nil {
+		return m.ExchangeDir
+	}
+	return nil
+}
+
 // XXX_OneofFuncs is for the internal use of the proto package.
 func (*Build) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), func(msg proto.Message) (n int), []interface{}) {
 	return _Build_OneofMarshaler, _Build_OneofUnmarshaler, _Build_OneofSizer, []interface{}{
@@ -1343,67 +1355,68 @@ func init() {
 func init() { proto.RegisterFile("build.proto", fileDescriptor_14ce178a580e4ede) }
 
 var fileDescriptor_14ce178a580e4ede = []byte{
-	// 985 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x55, 0x5b, 0x8f, 0xdb, 0xc4,
-	0x17, 0xdf, 0x6c, 0xd6, 0x9b, 0xf8, 0xd8, 0xd9, 0xcb, 0xf4, 0xff, 0x47, 0x56, 0x10, 0x6c, 0x1a,
-	0x71, 0x89, 0x0a, 0x1b, 0xd0, 0x56, 0x20, 0x90, 0xda, 0x07, 0x36, 0xa5, 0x5d, 0x24, 0x2a, 0x45,
-	0xb3, 0xf4, 0x11, 0x59, 0x8e, 0x3d, 0xeb, 0x8c, 0x62, 0x7b, 0x46, 0xf6, 0x64, 0x21, 0x1f, 0x93,
-	0x4f, 0xc2, 0x3b, 0x4f, 0x68, 0x8e, 0x67, 0xe2, 0x49, 0xfb, 0xc6, 0x9b, 0xcf, 0xe5, 0x77, 0xe6,
-	0x5c, 0x7f, 0x86, 0x60, 0xb5, 0xe5, 0x45, 0x36, 0x97, 0xb5, 0x50, 0x82, 0x1c, 0xcb, 0xd5, 0xf4,
-	0x0a, 0xfc, 0x5b, 0xad, 0xba, 0x57, 0x4c, 0x12, 0x02, 0x27, 0x49, 0x9d, 0x3f, 0x46, 0xbd, 0x49,
-	0x7f, 0xe6, 0x53, 0xfc, 0x9e, 0xfe, 0xd5, 0x83, 0xe1, 0x02, 0x5d, 0x58, 0x4d, 0xbe, 0x85, 0xff,
-	0xb1, 0x3f, 0x55, 0x9d, 0xc4, 0xa9, 0xa8, 0x1e, 0x78, 0xbe, 0xad, 0x59, 0xfc, 0x50, 0x24, 0xb9,
-	0x01, 0x10, 0xb4, 0x2d, 0xac, 0xe9, 0x75, 0x91, 0xe4, 0x64, 0x06, 0x17, 0xa9, 0x90, 0xbb, 0x58,
-	0x89, 0x18, 0x9f, 0xce, 0x78, 0x1d, 0x1d, 0x4f, 0x7a, 0xb3, 0x21, 0x3d, 0xd3, 0xfa, 0xdf, 0xc4,
-	0xad, 0xd1, 0x92, 0x2f, 0xe0, 0xbc, 0x8d, 0x5d, 0x26, 0x1b, 0x13, 0xf6, 0x04, 0xc3, 0x8e, 0x50,
-	0xfd, 0x36, 0xd9, 0xb4, 0x11, 0x3f, 0x05, 0x48, 0xb6, 0x4a, 0xd4, 0x4c, 0xe7, 0x10, 0x79, 0x18,
-	0xcb, 0xd1, 0x90, 0xa7, 0x10, 0xb6, 0x71, 0x8a, 0x0c, 0x83, 0xf4, 0x31, 0x48, 0x80, 0xba, 0x5f,
-	0x51, 0x35, 0xfd, 0x01, 0xc2, 0x85, 0x8e, 0x67, 0xcb, 0x9a, 0xc1, 0x85, 0x29, 0xab, 0x7b, 0xbb,
-	0x2d, 0xe9, 0xac, 0x2d, 0xa9, 0x34, 0x8f, 0x6b, 0xe4, 0x5b, 0xd6, 0x88, 0xea, 0x03, 0x64, 0xa9,
-	0xb5, 0x1f, 0x22, 0xd1, 0x19, 0x91, 0x2f, 0x21, 0x58, 0xb2, 0xba, 0xb0, 0xc0, 0x39, 0x3c, 0xe9,
-	0xaa, 0x7d, 0xe0, 0xc5, 0xc1, 0xab, 0x97, 0xfb, 0x8a, 0xb5, 0x05, 0xe1, 0xe7, 0x30, 0x5a, 0xee,
-	0xd4, 0x7a, 0xff, 0xf2, 0xf4, 0x0c, 0xc2, 0x37, 0xa2, 0x14, 0x99, 0x95, 0x7f, 0x07, 0xff, 0x8d,
-	0xb0, 0xd1, 0x23, 0x18, 0xf0, 0xaa, 0x51, 0x49, 0x51, 0x44, 0xbd, 0x49, 0x6f, 0xe6, 0x53, 0x2b,
-	0x92, 0x2b, 0x08, 0x78, 0x29, 0x45, 0xad, 0x62, 0x99, 0xa8, 0x35, 0x8e, 0xc2, 0xa7, 0xd0, 0xaa,
-	0x96, 0x89, 0x5a, 0x93, 0xff, 0xc3, 0x69, 0x2e, 0x62, 0x56, 0x3d, 0x9a, 0xc6, 0x79, 0xb9, 0xf8,
-	0xb9, 0x7a, 0x9c, 0xfe, 0x7d, 0x02, 0x83, 0x5f, 0x4c, 0x8c, 0xa7, 0x10, 0x36, 0xbb, 0x46, 0xb1,
-	0x32, 0x8b, 0xb7, 0x15, 0x57, 0x26, 0xe9, 0xc0, 0xe8, 0xde, 0x55, 0x5c, 0x91, 0x6b, 0x18, 0x34,
-	0xbb, 0xb2, 0xe0, 0xd5, 0x26, 0x3a, 0x9e, 0xf4, 0x67, 0xc1, 0xcd, 0x93, 0xb9, 0x5c, 0xcd, 0x4d,
-	0x80, 0xf9, 0x7d, 0x6b, 0xa2, 0xd6, 0x87, 0x7c, 0x0c, 0x3e, 0x2b, 0xa5, 0xda, 0xc5, 0x7a, 0x3d,
-	0xda, 0x77, 0x87, 0xa8, 0x78, 0xc5, 0x6b, 0xf2, 0x25, 0x78, 0xe9, 0xba, 0x14, 0x19, 0xae, 0x43,
-	0x70, 0x73, 0xe9, 0x46, 0x5a, 0x68, 0x03, 0x6d, 0xed, 0xe4, 0x1b, 0x80, 0x34, 0x91, 0xc9, 0x8a,
-	0x17, 0x5c, 0xed, 0x22, 0x0f, 0xbd, 0xcf, 0x0f, 0xbc, 0x13, 0x49, 0x1d, 0x17, 0xf2, 0x19, 0x9c,
-	0xe8, 0x06, 0x47, 0xa7, 0xe8, 0x7a, 0xe1, 0xba, 0xbe, 0xe6, 0x05, 0xa3, 0x68, 0x25, 0xcf, 0xe0,
-	0xb4, 0x66, 0x55, 0x52, 0xb2, 0x68, 0x80, 0x7e, 0xc4, 0xf5, 0xa3, 0x68, 0xa1, 0xc6, 0x83, 0x7c,
-	0x04, 0xa7, 0x19, 0x2b, 0x98, 0x62, 0xd1, 0x10, 0xab, 0x30, 0xd2, 0xf8, 0x25, 0x0c, 0x4c, 0xd1,
-	0x7a, 0x36, 0xa2, 0xc8, 0x30, 0x9e, 0x99, 0x8d, 0x11, 0xb5, 0xa5, 0x62, 0x7f, 0xa0, 0xa5, 0x9d,
-	0x8b, 0x15, 0xc7, 0xcf, 0xc1, 0xc3, 0x4a, 0x75, 0xfc, 0x86, 0xa9, 0x2d, 0xcf, 0x10, 0x3b, 0xa4,
-	0x46, 0xd2, 0x97, 0xeb, 0xe0, 0xf0, 0x7b, 0xfc, 0x13, 0xf4, 0x17, 0x89, 0xd4, 0xf7, 0xe2, 0x74,
-	0xc5, 0x0c, 0xdc, 0x69, 0xc2, 0x18, 0x86, 0xba, 0x4c, 0x27, 0xa1, 0xbd, 0x3c, 0x7e, 0x01, 0x27,
-	0xba, 0x11, 0x3a, 0xb3, 0xa6, 0x4e, 0x71, 0x63, 0x4c, 0xce, 0x46, 0xd4, 0xe8, 0x8c, 0x35, 0xca,
-	0x59, 0xa6, 0xbd, 0x3c, 0x7e, 0x01, 0xa7, 0x6d, 0x7b, 0xfe, 0x4b, 0xcd, 0xd3, 0x6b, 0xf0, 0x16,
-	0x45, 0xc2, 0x4b, 0x5d, 0x5b, 0x5e, 0x88, 0x95, 0x41, 0xe2, 0x37, 0xb9, 0x80, 0xbe, 0x65, 0x12,
-	0x9f, 0xea, 0xcf, 0x69, 0x06, 0xe1, 0xbd, 0x2c, 0xb8, 0x5a, 0x26, 0xe9, 0x26, 0xc9, 0xd9, 0xbe,
-	0x23, 0xbd, 0xae, 0x23, 0xe4, 0x0a, 0xbc, 0x54, 0x87, 0xc4, 0x15, 0x0b, 0x6e, 0x7c, 0x3d, 0x48,
-	0x7c, 0x83, 0xb6, 0x7a, 0x7d, 0x1d, 0xf5, 0xb6, 0x52, 0xbc, 0x64, 0x71, 0xc6, 0x24, 0xae, 0xae,
-	0x4f, 0xc1, 0xa8, 0x5e, 0x31, 0x39, 0xfd, 0x0a, 0xbc, 0x77, 0x15, 0x17, 0x95, 0x4d, 0xa0, 0xb7,
-	0x4f, 0x40, 0x6b, 0xe4, 0x26, 0xb7, 0x29, 0xc9, 0x4d, 0x3e, 0xfd, 0xc7, 0x03, 0x0f, 0x2f, 0x12,
-	0xc7, 0x26, 0xb6, 0x75, 0x6a, 0xd3, 0x31, 0x92, 0x4e, 0x72, 0x9d, 0x34, 0xb6, 0x73, 0xf8, 0xad,
-	0x3b, 0xf2, 0xc8, 0xea, 0x86, 0x8b, 0x2a, 0xea, 0xb7, 0x1d, 0x31, 0x22, 0xf9, 0x04, 0xa0, 0xe5,
-	0x0c, 0x5c, 0xda, 0x4b, 0x4c, 0xce, 0x47, 0x0d, 0x0e, 0xe9, 0x0a, 0x82, 0x74, 0xcd, 0xea, 0x7a,
-	0x17, 0x4b, 0x9e, 0x6e, 0x70, 0xa9, 0xf5, 0xa4, 0x51, 0xb5, 0xe4, 0xe9, 0x06, 0x73, 0x66, 0x12,
-	0x0f, 0x43, 0xe7, 0xcc, 0x24, 0xf9, 0x1a, 0x00, 0x59, 0x39, 0x6e, 0x14, 0x93, 0xe6, 0xbe, 0x46,
-	0xba, 0x2b, 0xfb, 0x7f, 0x02, 0xf5, 0x57, 0xfb, 0xdf, 0xc3, 0x33, 0x18, 0xa6, 0xab, 0x96, 0x61,
-	0xa2, 0xc1, 0xa4, 0x37, 0x0b, 0x6e, 0x42, 0xec, 0xa0, 0x61, 0x9d, 0xbb, 0x23, 0xba, 0xb7, 0x93,
-	0xef, 0x21, 0x44, 0x32, 0xb5, 0xfe, 0x67, 0xe8, 0x8f, 0x27, 0xe6, 0x52, 0xef, 0xdd, 0x11, 0x3d,
-	0xf0, 0xd3, 0x38, 0xa4, 0x52, 0x8b, 0xbb, 0xe8, 0x70, 0x2e, 0xf1, 0x6a, 0x9c, 0xeb, 0x47, 0x9e,
-	0x43, 0x20, 0x59, 0x5d, 0x58, 0x18, 0x20, 0x0c, 0x8f, 0xdf, 0x61, 0xdd, 0xbb, 0x23, 0xea, 0x7a,
-	0x91, 0x1f, 0x61, 0x24, 0x91, 0x54, 0x2d, 0x2c, 0x44, 0x18, 0x32, 0xcc, 0x01, 0xdb, 0xde, 0x1d,
-	0xd1, 0x43, 0x4f, 0x9d, 0x67, 0xae, 0xe9, 0xd7, 0x22, 0x47, 0x5d, 0x9e, 0x2e, 0x2d, 0xeb, 0x3c,
-	0x5d, 0x3f, 0x72, 0x0d, 0x7e, 0x2e, 0x2c, 0x88, 0x20, 0x68, 0xd4, 0x82, 0x3a, 0x44, 0xe7, 0xf1,
-	0xfe, 0x42, 0xfa, 0xef, 0x2f, 0x24, 0xf9, 0xbc, 0x63, 0xfa, 0x21, 0x46, 0x0b, 0x1c, 0x76, 0xea,
-	0x68, 0xff, 0x3b, 0x18, 0x35, 0xfa, 0x3a, 0x62, 0xd9, 0x9e, 0x47, 0x14, 0x74, 0x94, 0xe7, 0x9e,
-	0x0d, 0x0d, 0x1b, 0xf7, 0x88, 0xe6, 0x30, 0xb2, 0xcf, 0x6f, 0xf5, 0xda, 0x47, 0xe7, 0xdd, 0xe1,
-	0xe0, 0x1d, 0xd0, 0xd0, 0xd8, 0x51, 0xba, 0xf5, 0x61, 0x60, 0x32, 0xff, 0x37, 0x00, 0x00, 0xff,
-	0xff, 0xe1, 0x25, 0xea, 0xf2, 0x6a, 0x08, 0x00, 0x00,
+	// 1004 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x55, 0xeb, 0x6e, 0xe3, 0xc4,
+	0x17, 0xaf, 0x9b, 0xe6, 0xe2, 0x63, 0xa7, 0x97, 0xe9, 0xff, 0x8f, 0xac, 0x20, 0x68, 0x36, 0xe2,
+	0x12, 0x2d, 0x34, 0xa0, 0xae, 0x40, 0x20, 0xed, 0x7e, 0xa0, 0x29, 0xbb, 0x45, 0x62, 0xa5, 0x6a,
+	0xca, 0x7e, 0x44, 0xd6, 0xc4, 0x9e, 0x3a, 0xa3, 0xd8, 0x9e, 0x91, 0x3d, 0x29, 0xe4, 0x61, 0x78,
+	0x28, 0x9e, 0x84, 0x57, 0x40, 0x73, 0x3c, 0x13, 0xbb, 0xbb, 0xdf, 0xf8, 0xe6, 0x73, 0xf9, 0x9d,
+	0x39, 0xd7, 0x9f, 0x21, 0x58, 0x6d, 0x45, 0x9e, 0x2e, 0x54, 0x25, 0xb5, 0x24, 0x87, 0x6a, 0x35,
+	0xbb, 0x00, 0xff, 0xda, 0xa8, 0xee, 0x35, 0x57, 0x84, 0xc0, 0x11, 0xab, 0xb2, 0xc7, 0xc8, 0x9b,
+	0xf6, 0xe6, 0x3e, 0xc5, 0xef, 0xd9, 0xdf, 0x1e, 0x8c, 0x96, 0xe8, 0xc2, 0x2b, 0xf2, 0x2d, 0xfc,
+	0x8f, 0xff, 0xa9, 0x2b, 0x16, 0x27, 0xb2, 0x7c, 0x10, 0xd9, 0xb6, 0xe2, 0xf1, 0x43, 0xce, 0x32,
+	0x0b, 0x20, 0x68, 0x5b, 0x3a, 0xd3, 0xeb, 0x9c, 0x65, 0x64, 0x0e, 0xa7, 0x89, 0x54, 0xbb, 0x58,
+	0xcb, 0x18, 0x9f, 0x4e, 0x45, 0x15, 0x1d, 0x4e, 0xbd, 0xf9, 0x88, 0x1e, 0x1b, 0xfd, 0x6f, 0xf2,
+	0xda, 0x6a, 0xc9, 0x17, 0x70, 0xd2, 0xc4, 0x2e, 0xd8, 0xc6, 0x86, 0x3d, 0xc2, 0xb0, 0x63, 0x54,
+	0xbf, 0x65, 0x9b, 0x26, 0xe2, 0xa7, 0x00, 0x6c, 0xab, 0x65, 0xc5, 0x4d, 0x0e, 0x51, 0x1f, 0x63,
+	0x75, 0x34, 0xe4, 0x19, 0x84, 0x4d, 0x9c, 0x3c, 0xc5, 0x20, 0x3d, 0x0c, 0x12, 0xa0, 0xee, 0x57,
+	0x54, 0xcd, 0x7e, 0x80, 0x70, 0x69, 0xe2, 0xb9, 0xb2, 0xe6, 0x70, 0x6a, 0xcb, 0x6a, 0xdf, 0x6e,
+	0x4a, 0x3a, 0x6e, 0x4a, 0x2a, 0xec, 0xe3, 0x06, 0xf9, 0x96, 0xd7, 0xb2, 0xfc, 0x00, 0x59, 0x18,
+	0xed, 0x87, 0x48, 0x74, 0x46, 0xe4, 0x2b, 0x08, 0xee, 0x78, 0x95, 0x3b, 0xe0, 0x02, 0xce, 0xdb,
+	0x6a, 0x1f, 0x44, 0xfe, 0xe4, 0xd5, 0xb3, 0x7d, 0xc5, 0xc6, 0x82, 0xf0, 0x13, 0x18, 0xdf, 0xed,
+	0xf4, 0x7a, 0xff, 0xf2, 0xec, 0x18, 0xc2, 0x37, 0xb2, 0x90, 0xa9, 0x93, 0x7f, 0x07, 0xff, 0x8d,
+	0x74, 0xd1, 0x23, 0x18, 0x8a, 0xb2, 0xd6, 0x2c, 0xcf, 0x23, 0x6f, 0xea, 0xcd, 0x7d, 0xea, 0x44,
+	0x72, 0x01, 0x81, 0x28, 0x94, 0xac, 0x74, 0xac, 0x98, 0x5e, 0xe3, 0x28, 0x7c, 0x0a, 0x8d, 0xea,
+	0x8e, 0xe9, 0x35, 0xf9, 0x3f, 0x0c, 0x32, 0x19, 0xf3, 0xf2, 0xd1, 0x36, 0xae, 0x9f, 0xc9, 0x9f,
+	0xcb, 0xc7, 0xd9, 0x3f, 0x47, 0x30, 0xfc, 0xc5, 0xc6, 0x78, 0x06, 0x61, 0xbd, 0xab, 0x35, 0x2f,
+	0xd2, 0x78, 0x5b, 0x0a, 0x6d, 0x93, 0x0e, 0xac, 0xee, 0x5d, 0x29, 0x34, 0xb9, 0x84, 0x61, 0xbd,
+	0x2b, 0x72, 0x51, 0x6e, 0xa2, 0xc3, 0x69, 0x6f, 0x1e, 0x5c, 0x9d, 0x2f, 0xd4, 0x6a, 0x61, 0x03,
+	0x2c, 0xee, 0x1b, 0x13, 0x75, 0x3e, 0xe4, 0x63, 0xf0, 0x79, 0xa1, 0xf4, 0x2e, 0x36, 0xeb, 0xd1,
+	0xbc, 0x3b, 0x42, 0xc5, 0x8d, 0xa8, 0xc8, 0x97, 0xd0, 0x4f, 0xd6, 0x85, 0x4c, 0x71, 0x1d, 0x82,
+	0xab, 0xb3, 0x6e, 0xa4, 0xa5, 0x31, 0xd0, 0xc6, 0x4e, 0xbe, 0x01, 0x48, 0x98, 0x62, 0x2b, 0x91,
+	0x0b, 0xbd, 0x8b, 0xfa, 0xe8, 0x7d, 0xf2, 0xc4, 0x9b, 0x29, 0xda, 0x71, 0x21, 0x9f, 0xc1, 0x91,
+	0x69, 0x70, 0x34, 0x40, 0xd7, 0xd3, 0xae, 0xeb, 0x6b, 0x91, 0x73, 0x8a, 0x56, 0xf2, 0x1c, 0x06,
+	0x15, 0x2f, 0x59, 0xc1, 0xa3, 0x21, 0xfa, 0x91, 0xae, 0x1f, 0x45, 0x0b, 0xb5, 0x1e, 0xe4, 0x23,
+	0x18, 0xa4, 0x3c, 0xe7, 0x9a, 0x47, 0x23, 0xac, 0xc2, 0x4a, 0x93, 0x57, 0x30, 0xb4, 0x45, 0x9b,
+	0xd9, 0xc8, 0x3c, 0xc5, 0x78, 0x76, 0x36, 0x56, 0x34, 0x96, 0x92, 0xff, 0x81, 0x96, 0x66, 0x2e,
+	0x4e, 0x9c, 0xbc, 0x80, 0x3e, 0x56, 0x6a, 0xe2, 0xd7, 0x5c, 0x6f, 0x45, 0x8a, 0xd8, 0x11, 0xb5,
+	0x92, 0xb9, 0xdc, 0x0e, 0x0e, 0xbf, 0x27, 0x3f, 0x41, 0x6f, 0xc9, 0x94, 0xb9, 0x97, 0x4e, 0x57,
+	0xec, 0xc0, 0x5b, 0x0d, 0x99, 0xc0, 0xc8, 0x94, 0xd9, 0x49, 0x68, 0x2f, 0x4f, 0x5e, 0xc2, 0x91,
+	0x69, 0x84, 0xc9, 0xac, 0xae, 0x12, 0xdc, 0x18, 0x9b, 0xb3, 0x15, 0x0d, 0x3a, 0xe5, 0xb5, 0xee,
+	0x2c, 0xd3, 0x5e, 0x9e, 0xbc, 0x84, 0x41, 0xd3, 0x9e, 0xff, 0x52, 0xf3, 0xec, 0x12, 0xfa, 0xcb,
+	0x9c, 0x89, 0xc2, 0xd4, 0x96, 0xe5, 0x72, 0x65, 0x91, 0xf8, 0x4d, 0x4e, 0xa1, 0xe7, 0x98, 0xc4,
+	0xa7, 0xe6, 0x73, 0x96, 0x42, 0x78, 0xaf, 0x72, 0xa1, 0xef, 0x58, 0xb2, 0x61, 0x19, 0xdf, 0x77,
+	0xc4, 0x6b, 0x3b, 0x42, 0x2e, 0xa0, 0x9f, 0x98, 0x90, 0xb8, 0x62, 0xc1, 0x95, 0x6f, 0x06, 0x89,
+	0x6f, 0xd0, 0x46, 0x6f, 0xae, 0xa3, 0xda, 0x96, 0x5a, 0x14, 0x3c, 0x4e, 0xb9, 0xc2, 0xd5, 0xf5,
+	0x29, 0x58, 0xd5, 0x0d, 0x57, 0xb3, 0xaf, 0xa0, 0xff, 0xae, 0x14, 0xb2, 0x74, 0x09, 0x78, 0xfb,
+	0x04, 0x8c, 0x46, 0x6d, 0x32, 0x97, 0x92, 0xda, 0x64, 0xb3, 0xbf, 0x06, 0xd0, 0xc7, 0x8b, 0xc4,
+	0xb1, 0xc9, 0x6d, 0x95, 0xb8, 0x74, 0xac, 0x64, 0x92, 0x5c, 0xb3, 0xda, 0x75, 0x0e, 0xbf, 0x4d,
+	0x47, 0x1e, 0x79, 0x55, 0x0b, 0x59, 0x46, 0xbd, 0xa6, 0x23, 0x56, 0x24, 0x9f, 0x00, 0x34, 0x9c,
+	0x81, 0x4b, 0x7b, 0x86, 0xc9, 0xf9, 0xa8, 0xc1, 0x21, 0x5d, 0x40, 0x90, 0xac, 0x79, 0x55, 0xed,
+	0x62, 0x25, 0x92, 0x0d, 0x2e, 0xb5, 0x99, 0x34, 0xaa, 0xee, 0x44, 0xb2, 0xc1, 0x9c, 0xb9, 0xc2,
+	0xc3, 0x30, 0x39, 0x73, 0x45, 0xbe, 0x06, 0x40, 0x56, 0x8e, 0x6b, 0xcd, 0x95, 0xbd, 0xaf, 0xb1,
+	0xe9, 0xca, 0xfe, 0x9f, 0x40, 0xfd, 0x95, 0xfb, 0x24, 0xcf, 0x61, 0x94, 0xac, 0x1a, 0x86, 0x89,
+	0x86, 0x53, 0x6f, 0x1e, 0x5c, 0x85, 0xd8, 0x41, 0xcb, 0x3a, 0xb7, 0x07, 0x74, 0x6f, 0x27, 0xdf,
+	0x43, 0x88, 0x64, 0xea, 0xfc, 0x8f, 0xa7, 0x9e, 0x3b, 0xb1, 0x2e, 0xf5, 0xde, 0x1e, 0xd0, 0x27,
+	0x7e, 0x06, 0x87, 0x54, 0xea, 0x70, 0xa7, 0x2d, 0xae, 0x4b, 0xbc, 0x06, 0xd7, 0xf5, 0x23, 0x2f,
+	0x20, 0x50, 0xbc, 0xca, 0x1d, 0x0c, 0xa6, 0x9e, 0x3b, 0xfe, 0x0e, 0xeb, 0xde, 0x1e, 0xd0, 0xae,
+	0x17, 0xf9, 0x11, 0xc6, 0x0a, 0x49, 0xd5, 0xc1, 0xc2, 0xa9, 0xe7, 0x18, 0xe6, 0x09, 0xdb, 0xde,
+	0x1e, 0xd0, 0xa7, 0x9e, 0x26, 0xcf, 0xcc, 0xd0, 0xaf, 0x43, 0x8e, 0xdb, 0x3c, 0xbb, 0xb4, 0x6c,
+	0xf2, 0xec, 0xfa, 0x91, 0x4b, 0xf0, 0x33, 0xe9, 0x40, 0x64, 0xea, 0xb9, 0x86, 0xef, 0xb9, 0xfb,
+	0xf6, 0x80, 0xb6, 0x1e, 0xef, 0x2f, 0xa4, 0xff, 0xfe, 0x42, 0x92, 0xcf, 0x5b, 0xa6, 0x1f, 0x61,
+	0xb4, 0xa0, 0xc3, 0x4e, 0x2d, 0xed, 0x7f, 0x07, 0xe3, 0xda, 0x5c, 0x47, 0xac, 0x9a, 0xf3, 0x88,
+	0x82, 0x96, 0xf2, 0xba, 0x67, 0x43, 0xc3, 0xba, 0x23, 0x91, 0x05, 0x8c, 0xdd, 0xf3, 0x5b, 0xb3,
+	0xf6, 0xd1, 0x49, 0x7b, 0x38, 0x78, 0x07, 0x34, 0xb4, 0x76, 0x94, 0x9a, 0x7f, 0x6f, 0xb2, 0x66,
+	0x65, 0xc6, 0x91, 0xca, 0xcf, 0xdd, 0xbf, 0xb7, 0xd1, 0xdd, 0x88, 0xea, 0xda, 0x87, 0xa1, 0x2d,
+	0xee, 0xdf, 0x01, 0x00, 0x1d, 0xb1, 0xbf, 0xd2, 0x8d, 0x08, 0x00, 0x00,
 }
@@ -216,6 +216,602 @@ func (m *ScanPackagesReply) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_ScanPackagesReply proto.InternalMessageInfo
 
+type ListPackagesRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListPackagesRequest) Reset()         { *m = ListPackagesRequest{} }
+func (m *ListPackagesRequest) String() string { return proto.CompactTextString(m) }
+func (*ListPackagesRequest) ProtoMessage()    {}
+func (*ListPackagesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{6}
+}
+
+func (m *ListPackagesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListPackagesRequest.Unmarshal(m, b)
+}
+func (m *ListPackagesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListPackagesRequest.Marshal(b, m, deterministic)
+}
+func (m *ListPackagesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListPackagesRequest.Merge(m, src)
+}
+func (m *ListPackagesRequest) XXX_Size() int {
+	return xxx_messageInfo_ListPackagesRequest.Size(m)
+}
+func (m *ListPackagesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListPackagesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListPackagesRequest proto.InternalMessageInfo
+
+type ListPackagesReply struct {
+	Package              []*ListPackagesReply_Package `protobuf:"bytes,1,rep,name=package" json:"package,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                     `json:"-"`
+	XXX_unrecognized     []byte                       `json:"-"`
+	XXX_sizecache        int32                        `json:"-"`
+}
+
+func (m *ListPackagesReply) Reset()         { *m = ListPackagesReply{} }
+func (m *ListPackagesReply) String() string { return proto.CompactTextString(m) }
+func (*ListPackagesReply) ProtoMessage()    {}
+func (*ListPackagesReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{7}
+}
+
+func (m *ListPackagesReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListPackagesReply.Unmarshal(m, b)
+}
+func (m *ListPackagesReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListPackagesReply.Marshal(b, m, deterministic)
+}
+func (m *ListPackagesReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListPackagesReply.Merge(m, src)
+}
+func (m *ListPackagesReply) XXX_Size() int {
+	return xxx_messageInfo_ListPackagesReply.Size(m)
+}
+func (m *ListPackagesReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListPackagesReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListPackagesReply proto.InternalMessageInfo
+
+func (m *ListPackagesReply) GetPackage() []*ListPackagesReply_Package {
+	if m != nil {
+		return m.Package
+	}
+	return nil
+}
+
+type ListPackagesReply_Package struct {
+	// name is the full package name, e.g. bash-amd64-5.0-4.
+	Name *string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	// mounted is true if the package image was accessed and is held open.
+	Mounted *bool `protobuf:"varint,2,opt,name=mounted" json:"mounted,omitempty"`
+	// size is the size of the package image in bytes, or 0 if the image is
+	// not (yet) available locally.
+	Size *int64 `protobuf:"varint,3,opt,name=size" json:"size,omitempty"`
+	// origin is the repository section from which the package is fetched
+	// (e.g. https://repo.distr1.org/distri/jackherer/pkg), or empty for
+	// packages in the local repository.
+	Origin               *string  `protobuf:"bytes,4,opt,name=origin" json:"origin,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListPackagesReply_Package) Reset()         { *m = ListPackagesReply_Package{} }
+func (m *ListPackagesReply_Package) String() string { return proto.CompactTextString(m) }
+func (*ListPackagesReply_Package) ProtoMessage()    {}
+func (*ListPackagesReply_Package) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{7, 0}
+}
+
+func (m *ListPackagesReply_Package) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListPackagesReply_Package.Unmarshal(m, b)
+}
+func (m *ListPackagesReply_Package) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListPackagesReply_Package.Marshal(b, m, deterministic)
+}
+func (m *ListPackagesReply_Package) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListPackagesReply_Package.Merge(m, src)
+}
+func (m *ListPackagesReply_Package) XXX_Size() int {
+	return xxx_messageInfo_ListPackagesReply_Package.Size(m)
+}
+func (m *ListPackagesReply_Package) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListPackagesReply_Package.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListPackagesReply_Package proto.InternalMessageInfo
+
+func (m *ListPackagesReply_Package) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *ListPackagesReply_Package) GetMounted() bool {
+	if m != nil && m.Mounted != nil {
+		return *m.Mounted
+	}
+	return false
+}
+
+func (m *ListPackagesReply_Package) GetSize() int64 {
+	if m != nil && m.Size != nil {
+		return *m.Size
+	}
+	return 0
+}
+
+func (m *ListPackagesReply_Package) GetOrigin() string {
+	if m != nil && m.Origin != nil {
+		return *m.Origin
+	}
+	return ""
+}
+
+type ResolvePathRequest struct {
+	// path is relative to the mountpoint (e.g. bin/bash), or an absolute path
+	// underneath the mountpoint (e.g. /ro/bin/bash).
+	Path                 *string  `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResolvePathRequest) Reset()         { *m = ResolvePathRequest{} }
+func (m *ResolvePathRequest) String() string { return proto.CompactTextString(m) }
+func (*ResolvePathRequest) ProtoMessage()    {}
+func (*ResolvePathRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{8}
+}
+
+func (m *ResolvePathRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResolvePathRequest.Unmarshal(m, b)
+}
+func (m *ResolvePathRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResolvePathRequest.Marshal(b, m, deterministic)
+}
+func (m *ResolvePathRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResolvePathRequest.Merge(m, src)
+}
+func (m *ResolvePathRequest) XXX_Size() int {
+	return xxx_messageInfo_ResolvePathRequest.Size(m)
+}
+func (m *ResolvePathRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResolvePathRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResolvePathRequest proto.InternalMessageInfo
+
+func (m *ResolvePathRequest) GetPath() string {
+	if m != nil && m.Path != nil {
+		return *m.Path
+	}
+	return ""
+}
+
+type ResolvePathReply struct {
+	// pkg is the package providing path, e.g. bash-amd64-5.0-4.
+	Pkg *string `protobuf:"bytes,1,opt,name=pkg" json:"pkg,omitempty"`
+	// path is the path within the package, e.g. bin/bash.
+	Path                 *string  `protobuf:"bytes,2,opt,name=path" json:"path,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResolvePathReply) Reset()         { *m = ResolvePathReply{} }
+func (m *ResolvePathReply) String() string { return proto.CompactTextString(m) }
+func (*ResolvePathReply) ProtoMessage()    {}
+func (*ResolvePathReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{9}
+}
+
+func (m *ResolvePathReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResolvePathReply.Unmarshal(m, b)
+}
+func (m *ResolvePathReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResolvePathReply.Marshal(b, m, deterministic)
+}
+func (m *ResolvePathReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResolvePathReply.Merge(m, src)
+}
+func (m *ResolvePathReply) XXX_Size() int {
+	return xxx_messageInfo_ResolvePathReply.Size(m)
+}
+func (m *ResolvePathReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResolvePathReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResolvePathReply proto.InternalMessageInfo
+
+func (m *ResolvePathReply) GetPkg() string {
+	if m != nil && m.Pkg != nil {
+		return *m.Pkg
+	}
+	return ""
+}
+
+func (m *ResolvePathReply) GetPath() string {
+	if m != nil && m.Path != nil {
+		return *m.Path
+	}
+	return ""
+}
+
+type ForgetPackageRequest struct {
+	// pkg is the full package name, e.g. bash-amd64-5.0-4.
+	Pkg                  *string  `protobuf:"bytes,1,opt,name=pkg" json:"pkg,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ForgetPackageRequest) Reset()         { *m = ForgetPackageRequest{} }
+func (m *ForgetPackageRequest) String() string { return proto.CompactTextString(m) }
+func (*ForgetPackageRequest) ProtoMessage()    {}
+func (*ForgetPackageRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{10}
+}
+
+func (m *ForgetPackageRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ForgetPackageRequest.Unmarshal(m, b)
+}
+func (m *ForgetPackageRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ForgetPackageRequest.Marshal(b, m, deterministic)
+}
+func (m *ForgetPackageRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ForgetPackageRequest.Merge(m, src)
+}
+func (m *ForgetPackageRequest) XXX_Size() int {
+	return xxx_messageInfo_ForgetPackageRequest.Size(m)
+}
+func (m *ForgetPackageRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ForgetPackageRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ForgetPackageRequest proto.InternalMessageInfo
+
+func (m *ForgetPackageRequest) GetPkg() string {
+	if m != nil && m.Pkg != nil {
+		return *m.Pkg
+	}
+	return ""
+}
+
+type ForgetPackageReply struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ForgetPackageReply) Reset()         { *m = ForgetPackageReply{} }
+func (m *ForgetPackageReply) String() string { return proto.CompactTextString(m) }
+func (*ForgetPackageReply) ProtoMessage()    {}
+func (*ForgetPackageReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{11}
+}
+
+func (m *ForgetPackageReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ForgetPackageReply.Unmarshal(m, b)
+}
+func (m *ForgetPackageReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ForgetPackageReply.Marshal(b, m, deterministic)
+}
+func (m *ForgetPackageReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ForgetPackageReply.Merge(m, src)
+}
+func (m *ForgetPackageReply) XXX_Size() int {
+	return xxx_messageInfo_ForgetPackageReply.Size(m)
+}
+func (m *ForgetPackageReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_ForgetPackageReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ForgetPackageReply proto.InternalMessageInfo
+
+type GetStatsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetStatsRequest) Reset()         { *m = GetStatsRequest{} }
+func (m *GetStatsRequest) String() string { return proto.CompactTextString(m) }
+func (*GetStatsRequest) ProtoMessage()    {}
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{12}
+}
+
+func (m *GetStatsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetStatsRequest.Unmarshal(m, b)
+}
+func (m *GetStatsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetStatsRequest.Marshal(b, m, deterministic)
+}
+func (m *GetStatsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetStatsRequest.Merge(m, src)
+}
+func (m *GetStatsRequest) XXX_Size() int {
+	return xxx_messageInfo_GetStatsRequest.Size(m)
+}
+func (m *GetStatsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetStatsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetStatsRequest proto.InternalMessageInfo
+
+type GetStatsReply struct {
+	Packages             *int64              `protobuf:"varint,1,opt,name=packages" json:"packages,omitempty"`
+	MountedImages        *int64              `protobuf:"varint,2,opt,name=mounted_images,json=mountedImages" json:"mounted_images,omitempty"`
+	OpenReaders          *int64              `protobuf:"varint,3,opt,name=open_readers,json=openReaders" json:"open_readers,omitempty"`
+	Op                   []*GetStatsReply_Op `protobuf:"bytes,4,rep,name=op" json:"op,omitempty"`
+	ReadBytes            *uint64             `protobuf:"varint,5,opt,name=read_bytes,json=readBytes" json:"read_bytes,omitempty"`
+	Autodownloads        *uint64             `protobuf:"varint,6,opt,name=autodownloads" json:"autodownloads,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
+}
+
+func (m *GetStatsReply) Reset()         { *m = GetStatsReply{} }
+func (m *GetStatsReply) String() string { return proto.CompactTextString(m) }
+func (*GetStatsReply) ProtoMessage()    {}
+func (*GetStatsReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{13}
+}
+
+func (m *GetStatsReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetStatsReply.Unmarshal(m, b)
+}
+func (m *GetStatsReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetStatsReply.Marshal(b, m, deterministic)
+}
+func (m *GetStatsReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetStatsReply.Merge(m, src)
+}
+func (m *GetStatsReply) XXX_Size() int {
+	return xxx_messageInfo_GetStatsReply.Size(m)
+}
+func (m *GetStatsReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetStatsReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetStatsReply proto.InternalMessageInfo
+
+func (m *GetStatsReply) GetPackages() int64 {
+	if m != nil && m.Packages != nil {
+		return *m.Packages
+	}
+	return 0
+}
+
+func (m *GetStatsReply) GetMountedImages() int64 {
+	if m != nil && m.MountedImages != nil {
+		return *m.MountedImages
+	}
+	return 0
+}
+
+func (m *GetStatsReply) GetOpenReaders() int64 {
+	if m != nil && m.OpenReaders != nil {
+		return *m.OpenReaders
+	}
+	return 0
+}
+
+func (m *GetStatsReply) GetOp() []*GetStatsReply_Op {
+	if m != nil {
+		return m.Op
+	}
+	return nil
+}
+
+func (m *GetStatsReply) GetReadBytes() uint64 {
+	if m != nil && m.ReadBytes != nil {
+		return *m.ReadBytes
+	}
+	return 0
+}
+
+func (m *GetStatsReply) GetAutodownloads() uint64 {
+	if m != nil && m.Autodownloads != nil {
+		return *m.Autodownloads
+	}
+	return 0
+}
+
+type GetStatsReply_Op struct {
+	// name of the FUSE operation, e.g. LookUpInode.
+	Name                 *string  `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Count                *uint64  `protobuf:"varint,2,opt,name=count" json:"count,omitempty"`
+	TotalSeconds         *float64 `protobuf:"fixed64,3,opt,name=total_seconds,json=totalSeconds" json:"total_seconds,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetStatsReply_Op) Reset()         { *m = GetStatsReply_Op{} }
+func (m *GetStatsReply_Op) String() string { return proto.CompactTextString(m) }
+func (*GetStatsReply_Op) ProtoMessage()    {}
+func (*GetStatsReply_Op) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{13, 0}
+}
+
+func (m *GetStatsReply_Op) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetStatsReply_Op.Unmarshal(m, b)
+}
+func (m *GetStatsReply_Op) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetStatsReply_Op.Marshal(b, m, deterministic)
+}
+func (m *GetStatsReply_Op) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetStatsReply_Op.Merge(m, src)
+}
+func (m *GetStatsReply_Op) XXX_Size() int {
+	return xxx_messageInfo_GetStatsReply_Op.Size(m)
+}
+func (m *GetStatsReply_Op) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetStatsReply_Op.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetStatsReply_Op proto.InternalMessageInfo
+
+func (m *GetStatsReply_Op) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *GetStatsReply_Op) GetCount() uint64 {
+	if m != nil && m.Count != nil {
+		return *m.Count
+	}
+	return 0
+}
+
+func (m *GetStatsReply_Op) GetTotalSeconds() float64 {
+	if m != nil && m.TotalSeconds != nil {
+		return *m.TotalSeconds
+	}
+	return 0
+}
+
+type ListConflictsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListConflictsRequest) Reset()         { *m = ListConflictsRequest{} }
+func (m *ListConflictsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListConflictsRequest) ProtoMessage()    {}
+func (*ListConflictsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{14}
+}
+
+func (m *ListConflictsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListConflictsRequest.Unmarshal(m, b)
+}
+func (m *ListConflictsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListConflictsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListConflictsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListConflictsRequest.Merge(m, src)
+}
+func (m *ListConflictsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListConflictsRequest.Size(m)
+}
+func (m *ListConflictsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListConflictsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListConflictsRequest proto.InternalMessageInfo
+
+type ListConflictsReply struct {
+	Conflict             []*ListConflictsReply_Conflict `protobuf:"bytes,1,rep,name=conflict" json:"conflict,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                       `json:"-"`
+	XXX_unrecognized     []byte                         `json:"-"`
+	XXX_sizecache        int32                          `json:"-"`
+}
+
+func (m *ListConflictsReply) Reset()         { *m = ListConflictsReply{} }
+func (m *ListConflictsReply) String() string { return proto.CompactTextString(m) }
+func (*ListConflictsReply) ProtoMessage()    {}
+func (*ListConflictsReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{15}
+}
+
+func (m *ListConflictsReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListConflictsReply.Unmarshal(m, b)
+}
+func (m *ListConflictsReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListConflictsReply.Marshal(b, m, deterministic)
+}
+func (m *ListConflictsReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListConflictsReply.Merge(m, src)
+}
+func (m *ListConflictsReply) XXX_Size() int {
+	return xxx_messageInfo_ListConflictsReply.Size(m)
+}
+func (m *ListConflictsReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListConflictsReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListConflictsReply proto.InternalMessageInfo
+
+func (m *ListConflictsReply) GetConflict() []*ListConflictsReply_Conflict {
+	if m != nil {
+		return m.Conflict
+	}
+	return nil
+}
+
+type ListConflictsReply_Conflict struct {
+	// path is the exchange directory entry, e.g. /bin/sh.
+	Path *string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	// pkg contains all packages providing path, in order of precedence, i.e.
+	// the first package provides path.
+	Pkg []string `protobuf:"bytes,2,rep,name=pkg" json:"pkg,omitempty"`
+	// reason describes why the first package takes precedence, e.g. pinned.
+	Reason               *string  `protobuf:"bytes,3,opt,name=reason" json:"reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListConflictsReply_Conflict) Reset()         { *m = ListConflictsReply_Conflict{} }
+func (m *ListConflictsReply_Conflict) String() string { return proto.CompactTextString(m) }
+func (*ListConflictsReply_Conflict) ProtoMessage()    {}
+func (*ListConflictsReply_Conflict) Descriptor() ([]byte, []int) {
+	return fileDescriptor_25b8a32cc84c7f03, []int{15, 0}
+}
+
+func (m *ListConflictsReply_Conflict) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListConflictsReply_Conflict.Unmarshal(m, b)
+}
+func (m *ListConflictsReply_Conflict) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListConflictsReply_Conflict.Marshal(b, m, deterministic)
+}
+func (m *ListConflictsReply_Conflict) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListConflictsReply_Conflict.Merge(m, src)
+}
+func (m *ListConflictsReply_Conflict) XXX_Size() int {
+	return xxx_messageInfo_ListConflictsReply_Conflict.Size(m)
+}
+func (m *ListConflictsReply_Conflict) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListConflictsReply_Conflict.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListConflictsReply_Conflict proto.InternalMessageInfo
+
+func (m *ListConflictsReply_Conflict) GetPath() string {
+	if m != nil && m.Path != nil {
+		return *m.Path
+	}
+	return ""
+}
+
+func (m *ListConflictsReply_Conflict) GetPkg() []string {
+	if m != nil {
+		return m.Pkg
+	}
+	return nil
+}
+
+func (m *ListConflictsReply_Conflict) GetReason() string {
+	if m != nil && m.Reason != nil {
+		return *m.Reason
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*PingRequest)(nil), "pb.PingRequest")
 	proto.RegisterType((*PingReply)(nil), "pb.PingReply")
@@ -223,25 +819,66 @@ func init() {
 	proto.RegisterType((*MkdirAllReply)(nil), "pb.MkdirAllReply")
 	proto.RegisterType((*ScanPackagesRequest)(nil), "pb.ScanPackagesRequest")
 	proto.RegisterType((*ScanPackagesReply)(nil), "pb.ScanPackagesReply")
+	proto.RegisterType((*ListPackagesRequest)(nil), "pb.ListPackagesRequest")
+	proto.RegisterType((*ListPackagesReply)(nil), "pb.ListPackagesReply")
+	proto.RegisterType((*ListPackagesReply_Package)(nil), "pb.ListPackagesReply.Package")
+	proto.RegisterType((*ResolvePathRequest)(nil), "pb.ResolvePathRequest")
+	proto.RegisterType((*ResolvePathReply)(nil), "pb.ResolvePathReply")
+	proto.RegisterType((*ForgetPackageRequest)(nil), "pb.ForgetPackageRequest")
+	proto.RegisterType((*ForgetPackageReply)(nil), "pb.ForgetPackageReply")
+	proto.RegisterType((*GetStatsRequest)(nil), "pb.GetStatsRequest")
+	proto.RegisterType((*GetStatsReply)(nil), "pb.GetStatsReply")
+	proto.RegisterType((*GetStatsReply_Op)(nil), "pb.GetStatsReply.Op")
+	proto.RegisterType((*ListConflictsRequest)(nil), "pb.ListConflictsRequest")
+	proto.RegisterType((*ListConflictsReply)(nil), "pb.ListConflictsReply")
+	proto.RegisterType((*ListConflictsReply_Conflict)(nil), "pb.ListConflictsReply.Conflict")
 }
 
 func init() { proto.RegisterFile("fusectl.proto", fileDescriptor_25b8a32cc84c7f03) }
 
 var fileDescriptor_25b8a32cc84c7f03 = []byte{
-	// 196 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x4d, 0x2b, 0x2d, 0x4e,
-	0x4d, 0x2e, 0xc9, 0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2a, 0x48, 0x52, 0xe2, 0xe5,
-	0xe2, 0x0e, 0xc8, 0xcc, 0x4b, 0x0f, 0x4a, 0x2d, 0x2c, 0x4d, 0x2d, 0x2e, 0x51, 0xe2, 0xe6, 0xe2,
-	0x84, 0x70, 0x0b, 0x72, 0x2a, 0x95, 0x94, 0xb9, 0xf8, 0x7d, 0xb3, 0x53, 0x32, 0x8b, 0x1c, 0x73,
-	0x72, 0xa0, 0xf2, 0x42, 0x02, 0x5c, 0xcc, 0x29, 0x99, 0x45, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x9c,
-	0x41, 0x20, 0xa6, 0x12, 0x3f, 0x17, 0x2f, 0x42, 0x11, 0x48, 0x97, 0x28, 0x97, 0x70, 0x70, 0x72,
-	0x62, 0x5e, 0x40, 0x62, 0x72, 0x76, 0x62, 0x7a, 0x6a, 0x31, 0xcc, 0x64, 0x61, 0x2e, 0x41, 0x54,
-	0xe1, 0x82, 0x9c, 0x4a, 0xa3, 0x15, 0x8c, 0x5c, 0x2c, 0x6e, 0xa1, 0xc1, 0xae, 0x42, 0x1a, 0x5c,
-	0x2c, 0x20, 0x7b, 0x85, 0xf8, 0xf5, 0x0a, 0x92, 0xf4, 0x90, 0x1c, 0x24, 0xc5, 0x8b, 0x10, 0x00,
-	0x19, 0xce, 0x20, 0x64, 0xc2, 0xc5, 0x01, 0xb3, 0x4f, 0x48, 0x18, 0x24, 0x89, 0xe6, 0x44, 0x29,
-	0x41, 0x54, 0x41, 0x88, 0x2e, 0x07, 0x2e, 0x1e, 0x64, 0xdb, 0x85, 0xc4, 0x41, 0x8a, 0xb0, 0x38,
-	0x53, 0x4a, 0x14, 0x53, 0x02, 0x6c, 0x02, 0x20, 0x00, 0x00, 0xff, 0xff, 0xec, 0x83, 0x0e, 0x7e,
-	0x3c, 0x01, 0x00, 0x00,
+	// 654 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x54, 0xcd, 0x6e, 0xd3, 0x40,
+	0x10, 0xc6, 0x3f, 0x6d, 0x93, 0x49, 0x4d, 0x9a, 0x6d, 0x1a, 0x2c, 0x4b, 0x15, 0xc1, 0x2d, 0x92,
+	0x4f, 0x39, 0x54, 0x48, 0x20, 0x21, 0x24, 0xa0, 0xa2, 0x80, 0x04, 0x6a, 0xb5, 0x11, 0xe7, 0xc8,
+	0xb5, 0xb7, 0xa9, 0x15, 0xd7, 0xbb, 0xd8, 0x1b, 0x50, 0x78, 0x15, 0x9e, 0x82, 0x03, 0x0f, 0xc5,
+	0x5b, 0xa0, 0xfd, 0x73, 0xe2, 0xc4, 0xb7, 0x9d, 0x6f, 0xbe, 0x99, 0x9d, 0xfd, 0x66, 0x66, 0xc1,
+	0xbb, 0x5b, 0x56, 0x24, 0xe1, 0xf9, 0x84, 0x95, 0x94, 0x53, 0x64, 0xb3, 0xdb, 0xd0, 0x83, 0xde,
+	0x4d, 0x56, 0xcc, 0x31, 0xf9, 0xbe, 0x24, 0x15, 0x0f, 0x7b, 0xd0, 0x55, 0x26, 0xcb, 0x57, 0xe1,
+	0x19, 0xf4, 0xbf, 0x2e, 0xd2, 0xac, 0x7c, 0x97, 0xe7, 0xda, 0x8f, 0x8e, 0xc0, 0x49, 0xb3, 0xd2,
+	0xb7, 0xc6, 0x56, 0xd4, 0xc5, 0xe2, 0x18, 0xf6, 0xc1, 0x5b, 0x93, 0x44, 0xd4, 0x09, 0x1c, 0x4f,
+	0x93, 0xb8, 0xb8, 0x89, 0x93, 0x45, 0x3c, 0x27, 0x95, 0xc9, 0x7c, 0x0c, 0x83, 0x26, 0xac, 0xb9,
+	0x5f, 0xb2, 0x8a, 0x6f, 0x73, 0xff, 0x58, 0x30, 0x68, 0xe2, 0x2c, 0x5f, 0xa1, 0x97, 0x70, 0xc0,
+	0x14, 0xe0, 0x5b, 0x63, 0x27, 0xea, 0x5d, 0x9c, 0x4e, 0xd8, 0xed, 0x64, 0x87, 0x37, 0xd1, 0x16,
+	0x36, 0xec, 0x20, 0x81, 0x03, 0x8d, 0x21, 0x04, 0x6e, 0x11, 0x3f, 0x10, 0xfd, 0x00, 0x79, 0x46,
+	0x3e, 0x1c, 0x3c, 0xd0, 0x65, 0xc1, 0x49, 0xea, 0xdb, 0x63, 0x2b, 0xea, 0x60, 0x63, 0x0a, 0x76,
+	0x95, 0xfd, 0x22, 0xbe, 0x33, 0xb6, 0x22, 0x07, 0xcb, 0x33, 0x1a, 0xc1, 0x3e, 0x2d, 0xb3, 0x79,
+	0x56, 0xf8, 0xae, 0xcc, 0xa1, 0xad, 0x30, 0x02, 0x84, 0x49, 0x45, 0xf3, 0x1f, 0xe4, 0x26, 0xe6,
+	0xf7, 0x46, 0x2f, 0x04, 0x2e, 0x8b, 0xf9, 0xbd, 0xb9, 0x4f, 0x9c, 0xc3, 0x57, 0x70, 0xd4, 0x60,
+	0x8a, 0xb7, 0x1d, 0x81, 0xc3, 0x16, 0x73, 0xa3, 0x2b, 0x5b, 0xcc, 0xeb, 0x48, 0x7b, 0x23, 0x32,
+	0x82, 0xe1, 0x15, 0x2d, 0xe7, 0xc4, 0x3c, 0x78, 0xa3, 0x2b, 0xcd, 0xe8, 0x70, 0x08, 0x68, 0x8b,
+	0x29, 0xe4, 0x1e, 0x40, 0xff, 0x23, 0xe1, 0x53, 0x1e, 0xf3, 0x5a, 0xea, 0xbf, 0x36, 0x78, 0x6b,
+	0x4c, 0x94, 0x12, 0x40, 0x47, 0x0b, 0x57, 0xc9, 0x8c, 0x0e, 0xae, 0x6d, 0xf4, 0x1c, 0x1e, 0x6b,
+	0x6d, 0x66, 0xd9, 0x83, 0x64, 0xd8, 0x92, 0xe1, 0x69, 0xf4, 0xb3, 0x04, 0xd1, 0x33, 0x38, 0xa4,
+	0x8c, 0x14, 0xb3, 0x92, 0xc4, 0x29, 0x29, 0x2b, 0xad, 0x5f, 0x4f, 0x60, 0x58, 0x41, 0xe8, 0x1c,
+	0x6c, 0xca, 0x7c, 0x57, 0xf6, 0x71, 0x28, 0xfa, 0xd8, 0x28, 0x62, 0x72, 0xcd, 0xb0, 0x4d, 0x19,
+	0x3a, 0x05, 0x10, 0x39, 0x66, 0xb7, 0x2b, 0x4e, 0x2a, 0x7f, 0x6f, 0x6c, 0x45, 0x2e, 0xee, 0x0a,
+	0xe4, 0xbd, 0x00, 0xd0, 0x39, 0x78, 0xf1, 0x92, 0xd3, 0x94, 0xfe, 0x2c, 0x72, 0x1a, 0xa7, 0x95,
+	0xbf, 0x2f, 0x19, 0x4d, 0x30, 0x98, 0x82, 0x7d, 0xcd, 0x5a, 0x3b, 0x3f, 0x84, 0xbd, 0x44, 0x14,
+	0x2e, 0x5f, 0xe1, 0x62, 0x65, 0xa0, 0x33, 0xf0, 0x38, 0xe5, 0x71, 0x3e, 0xab, 0x48, 0x42, 0x8b,
+	0x54, 0x95, 0x6f, 0xe1, 0x43, 0x09, 0x4e, 0x15, 0x16, 0x8e, 0x60, 0x28, 0x26, 0xef, 0x92, 0x16,
+	0x77, 0x79, 0x96, 0xac, 0xf5, 0xfc, 0x6d, 0x01, 0xda, 0x72, 0x08, 0x51, 0x5f, 0x43, 0x27, 0xd1,
+	0x88, 0x1e, 0xde, 0xa7, 0x66, 0x78, 0x9b, 0xcc, 0x89, 0x31, 0x71, 0x1d, 0x10, 0x7c, 0x82, 0x8e,
+	0x41, 0xdb, 0x06, 0xca, 0xb4, 0xdf, 0x1e, 0x3b, 0x66, 0x78, 0x46, 0xb0, 0x5f, 0x92, 0xb8, 0xa2,
+	0x85, 0xac, 0xbd, 0x8b, 0xb5, 0x75, 0xf1, 0xcf, 0x01, 0xf7, 0xea, 0xdb, 0xf4, 0x03, 0x8a, 0xc0,
+	0x15, 0x7b, 0x8e, 0xfa, 0xa2, 0x8a, 0x8d, 0x0f, 0x20, 0xf0, 0xd6, 0x80, 0x98, 0x98, 0x47, 0xe8,
+	0x05, 0x74, 0xcc, 0x7e, 0xa3, 0x63, 0xe1, 0xdc, 0xfa, 0x12, 0x82, 0x41, 0x13, 0x54, 0x51, 0x6f,
+	0xe1, 0x70, 0x73, 0xdb, 0xd1, 0x13, 0x41, 0x6a, 0xf9, 0x16, 0x82, 0x93, 0x5d, 0x47, 0x9d, 0x61,
+	0x73, 0xb5, 0x55, 0x86, 0x96, 0xcf, 0x22, 0x38, 0xd9, 0x75, 0xa8, 0x0c, 0x6f, 0xa0, 0xb7, 0xb1,
+	0x67, 0x68, 0x24, 0x78, 0xbb, 0x2b, 0x1a, 0x0c, 0x77, 0x70, 0x15, 0x7e, 0x09, 0x5e, 0x63, 0x85,
+	0x90, 0x2f, 0x88, 0x6d, 0xfb, 0x17, 0x8c, 0x5a, 0x3c, 0xb5, 0x7a, 0x66, 0xb0, 0x95, 0x7a, 0x5b,
+	0xfb, 0x17, 0x0c, 0x9a, 0x60, 0x7d, 0x75, 0x63, 0x32, 0xd4, 0xd5, 0x6d, 0xf3, 0x16, 0x8c, 0x5a,
+	0x3c, 0x32, 0xc9, 0xff, 0x01, 0x00, 0x2d, 0xe3, 0xd1, 0x9f, 0xed, 0x05, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -264,6 +901,20 @@ type FUSEClient interface {
 	// ScanPackages discovers new packages in the mounted repository. This is
 	// called by “distri install”.
 	ScanPackages(ctx context.Context, in *ScanPackagesRequest, opts ...grpc.CallOption) (*ScanPackagesReply, error)
+	// ListPackages returns all packages provided by the file system.
+	ListPackages(ctx context.Context, in *ListPackagesRequest, opts ...grpc.CallOption) (*ListPackagesReply, error)
+	// ResolvePath returns the package (and the path within the package) which
+	// provides the specified path, e.g. the target of the /ro/bin/bash symlink.
+	ResolvePath(ctx context.Context, in *ResolvePathRequest, opts ...grpc.CallOption) (*ResolvePathReply, error)
+	// ForgetPackage closes the package image and removes the package from the
+	// exchange directories, without scanning the repository. This is called by
+	// “distri gc”.
+	ForgetPackage(ctx context.Context, in *ForgetPackageRequest, opts ...grpc.CallOption) (*ForgetPackageReply, error)
+	// GetStats returns statistics about the file system.
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsReply, error)
+	// ListConflicts returns all exchange directory entries which are provided
+	// by more than one package, see /etc/distri/pins.
+	ListConflicts(ctx context.Context, in *ListConflictsRequest, opts ...grpc.CallOption) (*ListConflictsReply, error)
 }
 
 type fUSEClient struct {
@@ -301,6 +952,51 @@ func (c *fUSEClient) ScanPackages(ctx context.Context, in *ScanPackagesRequest,
 	return out, nil
 }
 
+func (c *fUSEClient) ListPackages(ctx context.Context, in *ListPackagesRequest, opts ...grpc.CallOption) (*ListPackagesReply, error) {
+	out := new(ListPackagesReply)
+	err := c.cc.Invoke(ctx, "/pb.FUSE/ListPackages", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fUSEClient) ResolvePath(ctx context.Context, in *ResolvePathRequest, opts ...grpc.CallOption) (*ResolvePathReply, error) {
+	out := new(ResolvePathReply)
+	err := c.cc.Invoke(ctx, "/pb.FUSE/ResolvePath", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fUSEClient) ForgetPackage(ctx context.Context, in *ForgetPackageRequest, opts ...grpc.CallOption) (*ForgetPackageReply, error) {
+	out := new(ForgetPackageReply)
+	err := c.cc.Invoke(ctx, "/pb.FUSE/ForgetPackage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fUSEClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsReply, error) {
+	out := new(GetStatsReply)
+	err := c.cc.Invoke(ctx, "/pb.FUSE/GetStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fUSEClient) ListConflicts(ctx context.Context, in *ListConflictsRequest, opts ...grpc.CallOption) (*ListConflictsReply, error) {
+	out := new(ListConflictsReply)
+	err := c.cc.Invoke(ctx, "/pb.FUSE/ListConflicts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // FUSEServer is the server API for FUSE service.
 type FUSEServer interface {
 	Ping(context.Context, *PingRequest) (*PingReply, error)
@@ -311,6 +1007,20 @@ type FUSEServer interface {
 	// ScanPackages discovers new packages in the mounted repository. This is
 	// called by “distri install”.
 	ScanPackages(context.Context, *ScanPackagesRequest) (*ScanPackagesReply, error)
+	// ListPackages returns all packages provided by the file system.
+	ListPackages(context.Context, *ListPackagesRequest) (*ListPackagesReply, error)
+	// ResolvePath returns the package (and the path within the package) which
+	// provides the specified path, e.g. the target of the /ro/bin/bash symlink.
+	ResolvePath(context.Context, *ResolvePathRequest) (*ResolvePathReply, error)
+	// ForgetPackage closes the package image and removes the package from the
+	// exchange directories, without scanning the repository. This is called by
+	// “distri gc”.
+	ForgetPackage(context.Context, *ForgetPackageRequest) (*ForgetPackageReply, error)
+	// GetStats returns statistics about the file system.
+	GetStats(context.Context, *GetStatsRequest) (*GetStatsReply, error)
+	// ListConflicts returns all exchange directory entries which are provided
+	// by more than one package, see /etc/distri/pins.
+	ListConflicts(context.Context, *ListConflictsRequest) (*ListConflictsReply, error)
 }
 
 func RegisterFUSEServer(s *grpc.Server, srv FUSEServer) {
@@ -371,6 +1081,96 @@ func _FUSE_ScanPackages_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _FUSE_ListPackages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPackagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FUSEServer).ListPackages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.FUSE/ListPackages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FUSEServer).ListPackages(ctx, req.(*ListPackagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FUSE_ResolvePath_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolvePathRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FUSEServer).ResolvePath(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.FUSE/ResolvePath",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FUSEServer).ResolvePath(ctx, req.(*ResolvePathRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FUSE_ForgetPackage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ForgetPackageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FUSEServer).ForgetPackage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.FUSE/ForgetPackage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FUSEServer).ForgetPackage(ctx, req.(*ForgetPackageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FUSE_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FUSEServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.FUSE/GetStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FUSEServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FUSE_ListConflicts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConflictsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FUSEServer).ListConflicts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.FUSE/ListConflicts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FUSEServer).ListConflicts(ctx, req.(*ListConflictsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _FUSE_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "pb.FUSE",
 	HandlerType: (*FUSEServer)(nil),
@@ -387,6 +1187,26 @@ var _FUSE_serviceDesc = grpc.ServiceDesc{
 			MethodName: "ScanPackages",
 			Handler:    _FUSE_ScanPackages_Handler,
 		},
+		{
+			MethodName: "ListPackages",
+			Handler:    _FUSE_ListPackages_Handler,
+		},
+		{
+			MethodName: "ResolvePath",
+			Handler:    _FUSE_ResolvePath_Handler,
+		},
+		{
+			MethodName: "ForgetPackage",
+			Handler:    _FUSE_ForgetPackage_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _FUSE_GetStats_Handler,
+		},
+		{
+			MethodName: "ListConflicts",
+			Handler:    _FUSE_ListConflicts_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "fusectl.proto",
@@ -22,17 +22,23 @@ const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type Meta struct {
 	// Transitive closure of runtime dependency package names. E.g.:
-	// ["glibc-2.27", "pam-1.3.1"]
+	// ["glibc-amd64-2.27-3", "pam-amd64-1.3.1-3"]
 	RuntimeDep []string `protobuf:"bytes,1,rep,name=runtime_dep,json=runtimeDep" json:"runtime_dep,omitempty"`
 	// The source package from which this package was built. Useful to tie
-	// multiple binaries back to their source, and for globbing versions.
+	// split packages back to their source, and for globbing versions.
 	SourcePkg *string `protobuf:"bytes,2,opt,name=source_pkg,json=sourcePkg" json:"source_pkg,omitempty"`
 	// The version of the package. In some contexts, the version is already
 	// included in the filename, but not when e.g. “distri install” is obtaining
 	// meta.textproto files by accessing a symbolic link.
 	Version *string `protobuf:"bytes,3,opt,name=version" json:"version,omitempty"`
-	// TODO: document overlays
-	RuntimeUnion         []*Union `protobuf:"bytes,4,rep,name=runtime_union,json=runtimeUnion" json:"runtime_union,omitempty"`
+	// Runtime union directories are used to implement per-package exchange
+	// directories (as opposed to global exchange directories). This is to be used
+	// for tight coupling situations, e.g. when a plugin mechanism does not
+	// guarantee ABI compatibility across versions.
+	RuntimeUnion []*Union `protobuf:"bytes,4,rep,name=runtime_union,json=runtimeUnion" json:"runtime_union,omitempty"`
+	// Exchange directories declared by this package, e.g. “out/share/fonts”.
+	// See Build.exchange_dir.
+	ExchangeDir          []string `protobuf:"bytes,5,rep,name=exchange_dir,json=exchangeDir" json:"exchange_dir,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -91,6 +97,13 @@ func (m *Meta) GetRuntimeUnion() []*Union {
 	return nil
 }
 
+func (m *Meta) GetExchangeDir() []string {
+	if m != nil {
+		return m.ExchangeDir
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Meta)(nil), "pb.Meta")
 }
@@ -98,15 +111,17 @@ func init() {
 func init() { proto.RegisterFile("meta.proto", fileDescriptor_3b5ea8fe65782bcc) }
 
 var fileDescriptor_3b5ea8fe65782bcc = []byte{
-	// 159 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xca, 0x4d, 0x2d, 0x49,
-	0xd4, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2a, 0x48, 0x92, 0xe2, 0x4e, 0x2a, 0xcd, 0xcc,
-	0x49, 0x81, 0x08, 0x28, 0x4d, 0x60, 0xe4, 0x62, 0xf1, 0x4d, 0x2d, 0x49, 0x14, 0x92, 0xe7, 0xe2,
-	0x2e, 0x2a, 0xcd, 0x2b, 0xc9, 0xcc, 0x4d, 0x8d, 0x4f, 0x49, 0x2d, 0x90, 0x60, 0x54, 0x60, 0xd6,
-	0xe0, 0x0c, 0xe2, 0x82, 0x0a, 0xb9, 0xa4, 0x16, 0x08, 0xc9, 0x72, 0x71, 0x15, 0xe7, 0x97, 0x16,
-	0x25, 0xa7, 0xc6, 0x17, 0x64, 0xa7, 0x4b, 0x30, 0x29, 0x30, 0x6a, 0x70, 0x06, 0x71, 0x42, 0x44,
-	0x02, 0xb2, 0xd3, 0x85, 0x24, 0xb8, 0xd8, 0xcb, 0x52, 0x8b, 0x8a, 0x33, 0xf3, 0xf3, 0x24, 0x98,
-	0xc1, 0x72, 0x30, 0xae, 0x90, 0x1e, 0x17, 0x2f, 0xcc, 0xe4, 0xd2, 0x3c, 0x90, 0x3c, 0x8b, 0x02,
-	0xb3, 0x06, 0xb7, 0x11, 0xa7, 0x5e, 0x41, 0x92, 0x5e, 0x28, 0x48, 0x20, 0x88, 0x07, 0x2a, 0x0f,
-	0xe6, 0x01, 0x02, 0x00, 0x00, 0xff, 0xff, 0x80, 0x35, 0x18, 0xa3, 0xb0, 0x00, 0x00, 0x00,
+	// 178 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x34, 0xce, 0xbb, 0x0a, 0xc2, 0x30,
+	0x14, 0xc6, 0x71, 0x7a, 0x11, 0xc9, 0x49, 0x5d, 0x32, 0x05, 0x41, 0xac, 0x4e, 0x9d, 0x32, 0xf8,
+	0x0c, 0x5d, 0x05, 0x29, 0x38, 0x97, 0x5e, 0x0e, 0x35, 0xd4, 0x26, 0x21, 0x4d, 0xc4, 0xf7, 0xf2,
+	0x05, 0xa5, 0xb7, 0xf1, 0xfb, 0xfd, 0xe1, 0x70, 0x00, 0x06, 0x74, 0x95, 0x30, 0x56, 0x3b, 0xcd,
+	0x42, 0x53, 0x1f, 0x69, 0xed, 0xe5, 0xbb, 0x5d, 0xe0, 0xfa, 0x0b, 0x20, 0xbe, 0xa3, 0xab, 0xd8,
+	0x19, 0xa8, 0xf5, 0xca, 0xc9, 0x01, 0xcb, 0x16, 0x0d, 0x0f, 0xd2, 0x28, 0x23, 0x05, 0xac, 0x94,
+	0xa3, 0x61, 0x27, 0x80, 0x51, 0x7b, 0xdb, 0x60, 0x69, 0xfa, 0x8e, 0x87, 0x69, 0x90, 0x91, 0x82,
+	0x2c, 0xf2, 0xe8, 0x3b, 0xc6, 0x61, 0xff, 0x41, 0x3b, 0x4a, 0xad, 0x78, 0x34, 0xb7, 0x6d, 0x32,
+	0x01, 0x87, 0xed, 0xb2, 0x57, 0x53, 0x8f, 0xd3, 0x28, 0xa3, 0x37, 0x22, 0x4c, 0x2d, 0x9e, 0x13,
+	0x14, 0xc9, 0xda, 0xe7, 0xc5, 0x2e, 0x90, 0xe0, 0xb7, 0x79, 0x55, 0xaa, 0xc3, 0xb2, 0x95, 0x96,
+	0xef, 0xe6, 0x57, 0xe8, 0x66, 0xb9, 0xb4, 0xff, 0x01, 0x00, 0x16, 0xa0, 0xca, 0x4a, 0xd3, 0x00,
+	0x00, 0x00,
 }